@@ -0,0 +1,106 @@
+package main
+
+import (
+    "context"
+    "crypto/subtle"
+    "log"
+    "net/http"
+    "os"
+    "strings"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+type apiToken struct {
+    token     string
+    principal core.Principal
+}
+
+// loadAPITokens parses BASTION_API_TOKENS, a comma-separated list of
+// token:user[:role1|role2] entries.
+func loadAPITokens() []apiToken {
+    var tokens []apiToken
+    for _, entry := range strings.Split(os.Getenv("BASTION_API_TOKENS"), ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        parts := strings.SplitN(entry, ":", 3)
+        if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+            log.Printf("ignoring malformed BASTION_API_TOKENS entry")
+            continue
+        }
+        p := core.Principal{Name: parts[1]}
+        if len(parts) == 3 && parts[2] != "" {
+            p.Roles = strings.Split(parts[2], "|")
+        }
+        tokens = append(tokens, apiToken{token: parts[0], principal: p})
+    }
+    return tokens
+}
+
+// withAuth attaches the caller's principal to the request context. Without
+// configured tokens every caller is an anonymous admin, which keeps local
+// setups working. Browsers can't set headers on WebSocket upgrades, so the
+// token is also accepted as ?access_token=.
+func withAuth(tokens []apiToken, next http.Handler) http.Handler {
+    if len(tokens) == 0 {
+        log.Printf("BASTION_API_TOKENS not set; API is unauthenticated")
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            p := core.Principal{Name: "anonymous", Roles: []string{core.RoleAdmin}}
+            next.ServeHTTP(w, r.WithContext(core.WithPrincipal(r.Context(), p)))
+        })
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/healthz" || r.Method == http.MethodOptions {
+            next.ServeHTTP(w, r)
+            return
+        }
+        presented := r.URL.Query().Get("access_token")
+        if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+            presented = strings.TrimPrefix(h, "Bearer ")
+        }
+        for _, t := range tokens {
+            if subtle.ConstantTimeCompare([]byte(presented), []byte(t.token)) == 1 {
+                ctx := context.WithValue(core.WithPrincipal(r.Context(), t.principal), tokenAuthKey{}, true)
+                next.ServeHTTP(w, r.WithContext(ctx))
+                return
+            }
+        }
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
+    })
+}
+
+type tokenAuthKey struct{}
+
+// tokenAuthenticated reports whether withAuth matched the request's token to
+// a configured one, rather than merely seeing one presented.
+func tokenAuthenticated(ctx context.Context) bool {
+    ok, _ := ctx.Value(tokenAuthKey{}).(bool)
+    return ok
+}
+
+// requireRole rejects callers lacking role before the handler runs.
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if !core.PrincipalFrom(r.Context()).HasRole(role) {
+            http.Error(w, "forbidden", http.StatusForbidden)
+            return
+        }
+        next(w, r)
+    }
+}
+
+// requireRoleToModify lets any caller read but needs role for every other
+// method.
+func requireRoleToModify(role string, next http.HandlerFunc) http.HandlerFunc {
+    guarded := requireRole(role, next)
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == http.MethodGet || r.Method == http.MethodHead {
+            next(w, r)
+            return
+        }
+        guarded(w, r)
+    }
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "path"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// handleFiles uploads (PUT, raw body) or downloads (GET) a single file on a
+// node: ?node_id=&path=[&mode=&owner=]. Uploads may carry X-Content-Sha256.
+func (s *bastionServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    nodeID, filePath := q.Get("node_id"), q.Get("path")
+    switch r.Method {
+    case http.MethodGet:
+        resp, err := s.svc.GetFile(r.Context(), nodeID, filePath, r.Header.Get("Range"))
+        if err != nil {
+            writeError(w, err, http.StatusBadGateway)
+            return
+        }
+        defer resp.Body.Close()
+        for _, h := range []string{"Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "X-Content-Sha256", "X-File-Mode"} {
+            if v := resp.Header.Get(h); v != "" {
+                w.Header().Set(h, v)
+            }
+        }
+        w.Header().Set("Content-Type", "application/octet-stream")
+        w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(filePath)))
+        w.WriteHeader(resp.StatusCode)
+        io.Copy(w, resp.Body)
+    case http.MethodPut:
+        spec := core.FileSpec{
+            Path:   filePath,
+            Mode:   q.Get("mode"),
+            Owner:  q.Get("owner"),
+            SHA256: r.Header.Get("X-Content-Sha256"),
+        }
+        info, err := s.svc.PutFile(r.Context(), nodeID, spec, r.Body)
+        if err != nil {
+            writeError(w, err, http.StatusBadGateway)
+            return
+        }
+        writeJSON(w, http.StatusOK, info)
+    default:
+        w.WriteHeader(http.StatusMethodNotAllowed)
+    }
+}
+
+// handleFileCopy writes one file to several nodes:
+// POST ?node_id=a&node_id=b&path=[&mode=&owner=]. The content is the request
+// body, or an existing file when source_node_id and source_path are given.
+// The per-node results come back with 200 when every node succeeded, 207
+// when some failed and 502 when all did.
+func (s *bastionServer) handleFileCopy(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    q := r.URL.Query()
+    spec := core.FileSpec{
+        Path:   q.Get("path"),
+        Mode:   q.Get("mode"),
+        Owner:  q.Get("owner"),
+        SHA256: r.Header.Get("X-Content-Sha256"),
+    }
+    src := core.FileCopySource{NodeID: q.Get("source_node_id"), Path: q.Get("source_path"), Body: r.Body}
+    results, err := s.svc.CopyFile(r.Context(), q["node_id"], spec, src)
+    if err != nil {
+        writeError(w, err, http.StatusBadGateway)
+        return
+    }
+    failed := 0
+    for _, res := range results {
+        if res.Error != "" {
+            failed++
+        }
+    }
+    status := http.StatusOK
+    switch {
+    case failed == len(results):
+        status = http.StatusBadGateway
+    case failed > 0:
+        status = http.StatusMultiStatus
+    }
+    writeJSON(w, status, results)
+}
+
+func (s *bastionServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    events, err := s.svc.ListAuditEvents(r.Context())
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gorilla/websocket"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// runForward implements `bastion forward`, the client side of a tunnel: it
+// opens a tunnel on a bastion and relays every local connection through it,
+// much like `ssh -L`.
+func runForward(args []string) {
+    fs := flag.NewFlagSet("forward", flag.ExitOnError)
+    bastionURL := fs.String("bastion", envOr("BASTION_URL", "http://localhost:8080"), "bastion base URL")
+    token := fs.String("token", os.Getenv("BASTION_TOKEN"), "API token")
+    nodeID := fs.String("node", "", "node to forward to")
+    listen := fs.String("listen", "", "local address (default 127.0.0.1:<port>)")
+    ttl := fs.Duration("ttl", core.DefaultTunnelTTL, "how long the tunnel stays open")
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "usage: bastion forward -node <id> [flags] <port>\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if *nodeID == "" || fs.NArg() != 1 {
+        fs.Usage()
+        os.Exit(2)
+    }
+    port, err := strconv.Atoi(fs.Arg(0))
+    if err != nil {
+        log.Fatalf("invalid port %q", fs.Arg(0))
+    }
+    if *listen == "" {
+        *listen = net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+    }
+
+    tunnel, err := createTunnel(*bastionURL, *token, *nodeID, port, *ttl)
+    if err != nil {
+        log.Fatalf("open tunnel: %v", err)
+    }
+    ln, err := net.Listen("tcp", *listen)
+    if err != nil {
+        log.Fatalf("listen: %v", err)
+    }
+    log.Printf("Forwarding %s -> %s:%d via tunnel %s until %s", ln.Addr(), *nodeID, port, tunnel.ID, tunnel.ExpiresAt.Local().Format(time.Kitchen))
+
+    connectURL, err := tunnelConnectURL(*bastionURL, tunnel.ID)
+    if err != nil {
+        log.Fatalf("bastion url: %v", err)
+    }
+    header := http.Header{}
+    if *token != "" {
+        header.Set("Authorization", "Bearer "+*token)
+    }
+    for {
+        conn, err := ln.Accept()
+        if err != nil {
+            log.Fatalf("accept: %v", err)
+        }
+        go func() {
+            ws, resp, err := websocket.DefaultDialer.Dial(connectURL, header)
+            if err != nil {
+                if resp != nil {
+                    msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+                    err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+                }
+                log.Printf("connect: %v", err)
+                conn.Close()
+                return
+            }
+            core.PipeWebSocket(ws, conn)
+        }()
+    }
+}
+
+func createTunnel(base, token, nodeID string, port int, ttl time.Duration) (core.Tunnel, error) {
+    body, _ := json.Marshal(map[string]interface{}{
+        "node_id":     nodeID,
+        "port":        port,
+        "ttl_seconds": int(ttl.Seconds()),
+    })
+    req, err := http.NewRequest(http.MethodPost, strings.TrimRight(base, "/")+"/api/v1/tunnels", bytes.NewReader(body))
+    if err != nil {
+        return core.Tunnel{}, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    if token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return core.Tunnel{}, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusCreated {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return core.Tunnel{}, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+    }
+    var tunnel core.Tunnel
+    if err := json.NewDecoder(resp.Body).Decode(&tunnel); err != nil {
+        return core.Tunnel{}, err
+    }
+    return tunnel, nil
+}
+
+func tunnelConnectURL(base, id string) (string, error) {
+    u, err := url.Parse(strings.TrimRight(base, "/") + "/api/v1/tunnels/connect")
+    if err != nil {
+        return "", err
+    }
+    if u.Scheme == "https" {
+        u.Scheme = "wss"
+    } else {
+        u.Scheme = "ws"
+    }
+    u.RawQuery = url.Values{"id": {id}}.Encode()
+    return u.String(), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// handleGrants lists access grants (GET ?status=) or requests one
+// (POST {node_id, action, duration_seconds, reason}).
+func (s *bastionServer) handleGrants(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        grants, err := s.svc.ListGrants(r.Context(), core.GrantStatus(r.URL.Query().Get("status")))
+        if err != nil {
+            writeError(w, err, http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, grants)
+    case http.MethodPost:
+        var payload struct {
+            NodeID          string `json:"node_id"`
+            Action          string `json:"action"`
+            DurationSeconds int    `json:"duration_seconds"`
+            Reason          string `json:"reason"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+            http.Error(w, "invalid payload", http.StatusBadRequest)
+            return
+        }
+        if payload.Action == "" {
+            payload.Action = core.ActionExecute
+        }
+        grant, err := s.svc.RequestAccess(r.Context(), payload.NodeID, payload.Action, time.Duration(payload.DurationSeconds)*time.Second, payload.Reason)
+        if err != nil {
+            writeError(w, err, http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusCreated, grant)
+    default:
+        w.WriteHeader(http.StatusMethodNotAllowed)
+    }
+}
+
+// handleGrantDecision serves POST /api/v1/grants/{approve,deny,revoke}?id=.
+func (s *bastionServer) handleGrantDecision(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    id := r.URL.Query().Get("id")
+    var grant core.AccessGrant
+    var err error
+    switch r.URL.Path {
+    case "/api/v1/grants/approve":
+        grant, err = s.svc.DecideGrant(r.Context(), id, true)
+    case "/api/v1/grants/deny":
+        grant, err = s.svc.DecideGrant(r.Context(), id, false)
+    default:
+        grant, err = s.svc.RevokeGrant(r.Context(), id)
+    }
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, grant)
+}
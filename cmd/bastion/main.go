@@ -2,7 +2,6 @@
 
 import (
     "bufio"
-    "bytes"
     "context"
     "encoding/json"
     "errors"
@@ -10,71 +9,145 @@ import (
     "io"
     "log"
     "net/http"
+    "net/url"
     "os"
+    "path"
     "strconv"
     "strings"
     "time"
 
+    "github.com/gorilla/websocket"
+
     "github.com/yourorg/boundless-bastion/cmd/internal/core"
     yamlloader "github.com/yourorg/boundless-bastion/cmd/internal/yaml"
 )
 
 type bastionServer struct {
     svc *core.BastionService
+    // terminalIdle closes terminals that received no input for this long.
+    terminalIdle time.Duration
+    upgrader     websocket.Upgrader
 }
 
 func main() {
     loadEnvFile(".env")
+    if len(os.Args) > 1 {
+        switch os.Args[1] {
+        case "forward":
+            runForward(os.Args[2:])
+            return
+        case "migrate":
+            runMigrate(os.Args[2:])
+            return
+        }
+    }
 
-    var (
-        commandRepo core.CommandRepository
-        nodeRepo    core.NodeRepository
-        execRepo    core.ExecutionRepository
-    )
-
+    var repos core.Repositories
+    var leader core.LeaderElector
     if dsn := os.Getenv("BASTION_DB_DSN"); dsn != "" {
-        cmdRepo, nRepo, eRepo, closeFn, err := core.NewPostgresRepos(dsn)
+        db, err := core.OpenDatabase(dsn)
         if err != nil {
-            log.Fatalf("failed to init postgres: %v", err)
+            log.Fatalf("failed to init database: %v", err)
         }
-        log.Printf("Using PostgreSQL for persistence")
-        defer closeFn()
-        commandRepo = cmdRepo
-        nodeRepo = nRepo
-        execRepo = eRepo
+        defer db.Close()
+        if repos, err = core.NewSQLRepos(context.Background(), db); err != nil {
+            log.Fatalf("failed to init database: %v", err)
+        }
+        log.Printf("Using %s for persistence", db.Dialect)
+        leader = core.NewLeaderElector(db)
     } else {
-        commandRepo = core.NewInMemoryCommandRepo()
-        nodeRepo = core.NewInMemoryNodeRepo()
-        execRepo = core.NewInMemoryExecutionRepo()
+        repos = core.NewInMemoryRepos()
+    }
+    svc := core.NewBastionService(repos)
+    if leader != nil {
+        svc.SetLeaderElector(leader)
+    }
+    go func(started time.Time) {
+        n, err := svc.RecoverExecutions(context.Background(), started)
+        if err != nil {
+            log.Printf("recover executions: %v", err)
+        } else if n > 0 {
+            log.Printf("recovered %d orphaned executions", n)
+        }
+    }(time.Now())
+    svc.SetTunnelMaxTTL(envDuration("BASTION_TUNNEL_MAX_TTL", core.DefaultMaxTunnel))
+    svc.SetMaxCopyBytes(int64(envInt("BASTION_FILE_MAX_BYTES", core.DefaultMaxCopyBytes)))
+    svc.SetMaxRecordingBytes(int64(envInt("BASTION_RECORDING_MAX_BYTES", core.DefaultMaxRecordingBytes)))
+    svc.RequireGrants(envBool("BASTION_REQUIRE_GRANTS", false), envDuration("BASTION_GRANT_MAX_DURATION", core.DefaultMaxGrantDuration))
+    go svc.RunGrantExpiry(context.Background(), time.Minute)
+    svc.SetRetention(core.RetentionPolicy{
+        MaxAge:        envDuration("BASTION_RETENTION_MAX_AGE", 0),
+        MaxPerCommand: envInt("BASTION_RETENTION_MAX_PER_COMMAND", 0),
+        KeepFailures:  envInt("BASTION_RETENTION_KEEP_FAILURES", 0),
+        BatchSize:     envInt("BASTION_RETENTION_BATCH_SIZE", core.DefaultPruneBatchSize),
+        ArchiveDir:    os.Getenv("BASTION_RETENTION_ARCHIVE_DIR"),
+    })
+    go svc.RunPruner(context.Background(), envDuration("BASTION_RETENTION_INTERVAL", time.Hour))
+    if err := svc.SetQueuePolicy(core.QueuePolicy{
+        MaxRunning: envInt("BASTION_MAX_CONCURRENT", 0),
+        Order:      core.QueueOrder(envOr("BASTION_QUEUE_ORDER", string(core.QueueFIFO))),
+    }); err != nil {
+        log.Fatalf("invalid queue settings: %v", err)
+    }
+    svc.SetGPUHistory(core.GPUHistoryPolicy{
+        Interval:        envDuration("BASTION_GPU_COLLECT_INTERVAL", core.DefaultGPUHistoryPolicy.Interval),
+        RawRetention:    envDuration("BASTION_GPU_RAW_RETENTION", core.DefaultGPUHistoryPolicy.RawRetention),
+        MinuteRetention: envDuration("BASTION_GPU_MINUTE_RETENTION", core.DefaultGPUHistoryPolicy.MinuteRetention),
+        HourRetention:   envDuration("BASTION_GPU_HOUR_RETENTION", core.DefaultGPUHistoryPolicy.HourRetention),
+    })
+    if path := os.Getenv("BASTION_ALERT_RULES_FILE"); path != "" {
+        rules, err := yamlloader.LoadAlertRulesFromFile(path)
+        if err == nil {
+            err = svc.SetAlertRules(rules)
+        }
+        if err != nil {
+            log.Fatalf("failed to load alert rules from %s: %v", path, err)
+        }
+    }
+    if hook := os.Getenv("BASTION_ALERT_WEBHOOK_URL"); hook != "" {
+        svc.SetAlertNotifier(core.WebhookNotifier{URL: hook})
+    }
+    go svc.RunGPUCollector(context.Background())
+    go svc.RunExecutionWorkers(context.Background(), envInt("BASTION_EXEC_WORKERS", core.DefaultExecutionWorkers), envDuration("BASTION_EXEC_LEASE", core.DefaultExecutionLease))
+    if store, err := blobStoreFromEnv(); err != nil {
+        log.Fatalf("failed to init blob store: %v", err)
+    } else if store != nil {
+        svc.SetBlobStore(store, envInt("BASTION_INLINE_OUTPUT_BYTES", core.DefaultInlineOutputLimit))
     }
-    svc := core.NewBastionService(commandRepo, nodeRepo, execRepo)
 
     daemonURL := envOr("DAEMON_URL", "http://localhost:9081")
     nodeID := envOr("BASTION_NODE_ID", "node-remote")
     nodeName := envOr("BASTION_NODE_NAME", "Remote Daemon (shah@154.57.209.191)")
     nodeAddress := envOr("BASTION_NODE_ADDRESS", daemonURL)
-    nodeRepo.Save(core.Node{ID: nodeID, Name: nodeName, Address: nodeAddress})
+    ctx := context.Background()
+    if _, err := repos.Nodes.Save(ctx, core.Node{ID: nodeID, Name: nodeName, Address: nodeAddress, MaxConcurrent: envInt("BASTION_NODE_MAX_CONCURRENT", 0)}); err != nil {
+        log.Fatalf("failed to register node: %v", err)
+    }
 
     if yamlPath := os.Getenv("COMMANDS_FILE"); yamlPath != "" {
         if cmds, err := yamlloader.LoadCommandsFromFile(yamlPath); err != nil {
             log.Printf("failed to load commands from %s: %v", yamlPath, err)
         } else {
             for _, c := range cmds {
-                if _, err := svc.CreateCommand(c); err != nil {
+                if _, err := svc.CreateCommand(ctx, c); err != nil {
                     log.Printf("skip command %s: %v", c.Name, err)
                 }
             }
         }
     }
 
-    if len(commandRepo.List()) == 0 {
-        svc.CreateCommand(core.Command{
+    existing, err := repos.Commands.List(ctx)
+    if err != nil {
+        log.Fatalf("failed to list commands: %v", err)
+    }
+    if len(existing) == 0 {
+        svc.CreateCommand(ctx, core.Command{
             Name:           "Check GPU",
-            Description:    "Print GPU info with nvidia-smi",
-            Script:         "nvidia-smi || echo 'nvidia-smi not available'",
+            Description:    "Print GPU info with nvidia-smi or rocm-smi",
+            Script:         "nvidia-smi || rocm-smi || echo 'no GPU tool available'",
             TimeoutSeconds: 60,
         })
-        svc.CreateCommand(core.Command{
+        svc.CreateCommand(ctx, core.Command{
             Name:           "Docker ps",
             Description:    "List running containers",
             Script:         "docker ps",
@@ -82,16 +155,39 @@ func main() {
         })
     }
 
-    srv := &bastionServer{svc: svc}
+    srv := &bastionServer{
+        svc:          svc,
+        terminalIdle: envDuration("BASTION_TERMINAL_IDLE_TIMEOUT", 15*time.Minute),
+        upgrader:     newUpgrader(envList("BASTION_WS_ALLOWED_ORIGINS")),
+    }
     mux := http.NewServeMux()
     mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK); w.Write([]byte("ok")) })
-    mux.HandleFunc("/api/v1/commands", srv.handleCommands)
-    mux.HandleFunc("/api/v1/nodes", srv.handleNodes)
+    // Commands are scripts granted users run on nodes; only admins change them.
+    mux.HandleFunc("/api/v1/commands", requireRoleToModify(core.RoleAdmin, srv.handleCommands))
+    mux.HandleFunc("/api/v1/nodes", requireRoleToModify(core.RoleAdmin, srv.handleNodes))
     mux.HandleFunc("/api/v1/execute", srv.handleExecute)
     mux.HandleFunc("/api/v1/executions", srv.handleExecutions)
+    mux.HandleFunc("/api/v1/queue", srv.handleQueue)
+    mux.HandleFunc("/api/v1/executions/output", srv.handleExecutionOutput)
+    mux.HandleFunc("/api/v1/executions/artifacts", srv.handleExecutionArtifacts)
     mux.HandleFunc("/api/v1/gpu", srv.handleGPU)
+    mux.HandleFunc("/api/v1/gpu/reservations", srv.handleGPUReservations)
+    mux.HandleFunc("/api/v1/alerts", srv.handleAlerts)
+    mux.HandleFunc("/api/v1/alerts/rules", srv.handleAlertRules)
+    mux.HandleFunc("/api/v1/files", srv.handleFiles)
+    mux.HandleFunc("/api/v1/files/copy", srv.handleFileCopy)
+    mux.HandleFunc("/api/v1/terminal", srv.handleTerminal)
+    mux.HandleFunc("/api/v1/tunnels", srv.handleTunnels)
+    mux.HandleFunc("/api/v1/tunnels/connect", srv.handleTunnelConnect)
+    mux.HandleFunc("/api/v1/sessions", srv.handleSessions)
+    mux.HandleFunc("/api/v1/sessions/recording", srv.handleSessionRecording)
+    mux.HandleFunc("/api/v1/grants", srv.handleGrants)
+    mux.HandleFunc("/api/v1/grants/approve", srv.handleGrantDecision)
+    mux.HandleFunc("/api/v1/grants/deny", srv.handleGrantDecision)
+    mux.HandleFunc("/api/v1/grants/revoke", srv.handleGrantDecision)
+    mux.HandleFunc("/api/v1/audit", requireRole(core.RoleAdmin, srv.handleAudit))
 
-    handler := withCORS(mux)
+    handler := withCORS(withAuth(loadAPITokens(), mux))
 
     port := envOr("BASTION_PORT", "8080")
     log.Printf("Bastion listening on :%s", port)
@@ -104,56 +200,82 @@ func (s *bastionServer) handleCommands(w http.ResponseWriter, r *http.Request) {
     switch r.Method {
     case http.MethodGet:
         if id := r.URL.Query().Get("id"); id != "" {
-            if cmd, ok := s.svc.GetCommand(id); ok {
-                writeJSON(w, http.StatusOK, cmd)
+            cmd, err := s.svc.GetCommand(r.Context(), id)
+            if err != nil {
+                writeError(w, err, http.StatusInternalServerError)
                 return
             }
-            http.Error(w, "not found", http.StatusNotFound)
+            writeJSON(w, http.StatusOK, cmd)
+            return
+        }
+        cmds, err := s.svc.ListCommands(r.Context())
+        if err != nil {
+            writeError(w, err, http.StatusInternalServerError)
             return
         }
-        writeJSON(w, http.StatusOK, s.svc.ListCommands())
+        writeJSON(w, http.StatusOK, cmds)
     case http.MethodPost:
         var payload struct {
-            Name           string `json:"name"`
-            Description    string `json:"description"`
-            Script         string `json:"script"`
-            TimeoutSeconds int    `json:"timeout_seconds"`
+            Name           string              `json:"name"`
+            Description    string              `json:"description"`
+            Script         string              `json:"script"`
+            TimeoutSeconds int                 `json:"timeout_seconds"`
+            Limits         core.ResourceLimits `json:"limits"`
+            Isolation      core.IsolationMode  `json:"isolation"`
+            Artifacts      []string            `json:"artifacts"`
+            MaxConcurrent  int                 `json:"max_concurrent"`
+            GPU            core.GPURequirement `json:"gpu"`
         }
         if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
             http.Error(w, "invalid payload", http.StatusBadRequest)
             return
         }
-        cmd, err := s.svc.CreateCommand(core.Command{
+        cmd, err := s.svc.CreateCommand(r.Context(), core.Command{
             Name:           payload.Name,
             Description:    payload.Description,
             Script:         payload.Script,
             TimeoutSeconds: payload.TimeoutSeconds,
+            Limits:         payload.Limits,
+            Isolation:      payload.Isolation,
+            Artifacts:      payload.Artifacts,
+            MaxConcurrent:  payload.MaxConcurrent,
+            GPU:            payload.GPU,
         })
         if err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+            writeError(w, err, http.StatusInternalServerError)
             return
         }
         writeJSON(w, http.StatusCreated, cmd)
     case http.MethodPut:
         var payload struct {
-            ID             string `json:"id"`
-            Name           string `json:"name"`
-            Description    string `json:"description"`
-            Script         string `json:"script"`
-            TimeoutSeconds int    `json:"timeout_seconds"`
+            ID             string              `json:"id"`
+            Name           string              `json:"name"`
+            Description    string              `json:"description"`
+            Script         string              `json:"script"`
+            TimeoutSeconds int                 `json:"timeout_seconds"`
+            Limits         core.ResourceLimits `json:"limits"`
+            Isolation      core.IsolationMode  `json:"isolation"`
+            Artifacts      []string            `json:"artifacts"`
+            MaxConcurrent  int                 `json:"max_concurrent"`
+            GPU            core.GPURequirement `json:"gpu"`
         }
         if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
             http.Error(w, "invalid payload", http.StatusBadRequest)
             return
         }
-        cmd, err := s.svc.UpdateCommand(payload.ID, core.Command{
+        cmd, err := s.svc.UpdateCommand(r.Context(), payload.ID, core.Command{
             Name:           payload.Name,
             Description:    payload.Description,
             Script:         payload.Script,
             TimeoutSeconds: payload.TimeoutSeconds,
+            Limits:         payload.Limits,
+            Isolation:      payload.Isolation,
+            Artifacts:      payload.Artifacts,
+            MaxConcurrent:  payload.MaxConcurrent,
+            GPU:            payload.GPU,
         })
         if err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+            writeError(w, err, http.StatusInternalServerError)
             return
         }
         writeJSON(w, http.StatusOK, cmd)
@@ -163,8 +285,8 @@ func (s *bastionServer) handleCommands(w http.ResponseWriter, r *http.Request) {
             http.Error(w, "id is required", http.StatusBadRequest)
             return
         }
-        if err := s.svc.DeleteCommand(id); err != nil {
-            http.Error(w, err.Error(), http.StatusNotFound)
+        if err := s.svc.DeleteCommand(r.Context(), id); err != nil {
+            writeError(w, err, http.StatusInternalServerError)
             return
         }
         w.WriteHeader(http.StatusNoContent)
@@ -178,9 +300,31 @@ func (s *bastionServer) handleNodes(w http.ResponseWriter, r *http.Request) {
         w.WriteHeader(http.StatusMethodNotAllowed)
         return
     }
-    writeJSON(w, http.StatusOK, s.svc.ListNodes())
+    nodes, err := s.svc.ListNodes(r.Context())
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, nodes)
+}
+
+// handleQueue lists the pending executions with their queue positions.
+func (s *bastionServer) handleQueue(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    queue, err := s.svc.ListQueue(r.Context())
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, queue)
 }
 
+// handleExecute runs a command and returns the finished execution. node_id
+// may be left out for commands that need GPUs, to have the bastion place the
+// run.
 func (s *bastionServer) handleExecute(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPost {
         w.WriteHeader(http.StatusMethodNotAllowed)
@@ -189,6 +333,7 @@ func (s *bastionServer) handleExecute(w http.ResponseWriter, r *http.Request) {
     var payload struct {
         CommandID string `json:"command_id"`
         NodeID    string `json:"node_id"`
+        Priority  int    `json:"priority"`
     }
     if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
         http.Error(w, "invalid payload", http.StatusBadRequest)
@@ -196,115 +341,316 @@ func (s *bastionServer) handleExecute(w http.ResponseWriter, r *http.Request) {
     }
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
     defer cancel()
-    execRecord, err := s.svc.ExecuteCommand(ctx, payload.CommandID, payload.NodeID)
+    execRecord, err := s.svc.ExecuteCommand(ctx, payload.CommandID, payload.NodeID, payload.Priority)
+    if err != nil && execRecord.ID == "" {
+        // Nothing was recorded: bad input, no grant, or storage failure.
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
     if err != nil {
+        // The run was recorded as failed; the record explains why.
         log.Printf("execution error: %v", err)
     }
     writeJSON(w, http.StatusOK, execRecord)
 }
 
+// handleExecutions returns one execution in full for ?id=, and otherwise a
+// page of summaries filtered by command_id, node_id, status, triggered_by,
+// exit_code and an RFC 3339 from/to range; pass next_cursor back as cursor.
+// With grants enforced, non-admins see their own runs and runs on nodes they
+// hold an execute grant for; the output and artifact endpoints follow suit.
 func (s *bastionServer) handleExecutions(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
         w.WriteHeader(http.StatusMethodNotAllowed)
         return
     }
-    writeJSON(w, http.StatusOK, s.svc.ListExecutions())
+    q := r.URL.Query()
+    if id := q.Get("id"); id != "" {
+        execRecord, err := s.svc.GetExecution(r.Context(), id)
+        if err != nil {
+            writeError(w, err, http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, execRecord)
+        return
+    }
+    filter, err := parseExecutionFilter(q)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    page, err := s.svc.ListExecutions(r.Context(), filter)
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, page)
 }
 
-func (s *bastionServer) handleGPU(w http.ResponseWriter, r *http.Request) {
+func parseExecutionFilter(q url.Values) (core.ExecutionFilter, error) {
+    filter := core.ExecutionFilter{
+        CommandID:   q.Get("command_id"),
+        NodeID:      q.Get("node_id"),
+        Status:      core.ExecutionStatus(q.Get("status")),
+        TriggeredBy: q.Get("triggered_by"),
+        Cursor:      q.Get("cursor"),
+    }
+    if v := q.Get("exit_code"); v != "" {
+        code, err := strconv.Atoi(v)
+        if err != nil {
+            return filter, fmt.Errorf("invalid exit_code %q", v)
+        }
+        filter.ExitCode = &code
+    }
+    for _, bound := range []struct {
+        name string
+        dst  *time.Time
+    }{{"from", &filter.From}, {"to", &filter.To}} {
+        if v := q.Get(bound.name); v != "" {
+            t, err := time.Parse(time.RFC3339, v)
+            if err != nil {
+                return filter, fmt.Errorf("invalid %s %q: want RFC 3339", bound.name, v)
+            }
+            *bound.dst = t
+        }
+    }
+    if v := q.Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 {
+            return filter, fmt.Errorf("invalid limit %q", v)
+        }
+        filter.Limit = n
+    }
+    switch q.Get("order") {
+    case "", "desc":
+    case "asc":
+        filter.Ascending = true
+    default:
+        return filter, fmt.Errorf("order must be asc or desc")
+    }
+    return filter, nil
+}
+
+// handleExecutionOutput serves one stream of an execution with Range support:
+// from the blob store if it was offloaded, proxied from the daemon's spool if
+// it was truncated there, and from the executions table otherwise.
+func (s *bastionServer) handleExecutionOutput(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
         w.WriteHeader(http.StatusMethodNotAllowed)
         return
     }
-    nodes := s.svc.ListNodes()
-    now := time.Now().UTC()
-    samples := make([]core.GPUSample, 0, len(nodes))
-    for _, n := range nodes {
-        sample := core.GPUSample{NodeID: n.ID, Timestamp: now.Unix()}
-        fetched, err := fetchGPUSample(n, now.Unix())
+    id := r.URL.Query().Get("id")
+    stream := r.URL.Query().Get("stream")
+    if stream == "" {
+        stream = "stdout"
+    }
+    execRecord, err := s.svc.GetExecution(r.Context(), id)
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    var stored, ref string
+    var truncated bool
+    switch stream {
+    case "stdout":
+        stored, truncated, ref = execRecord.Stdout, execRecord.StdoutTruncated, execRecord.StdoutRef
+    case "stderr":
+        stored, truncated, ref = execRecord.Stderr, execRecord.StderrTruncated, execRecord.StderrRef
+    default:
+        http.Error(w, "stream must be stdout or stderr", http.StatusBadRequest)
+        return
+    }
+
+    if ref != "" {
+        blob, info, err := s.svc.OpenStoredOutput(r.Context(), execRecord, stream)
         if err != nil {
-            log.Printf("gpu fetch error for node %s: %v", n.ID, err)
-        } else {
-            sample = fetched
+            writeError(w, err, http.StatusBadGateway)
+            return
         }
-        samples = append(samples, sample)
+        defer blob.Close()
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        http.ServeContent(w, r, "", info.ModTime, blob)
+        return
     }
-    writeJSON(w, http.StatusOK, samples)
+
+    if truncated && execRecord.OutputSpooled {
+        resp, err := s.svc.OpenSpooledOutput(r.Context(), id, stream, r.Header.Get("Range"))
+        if err != nil {
+            writeError(w, err, http.StatusBadGateway)
+            return
+        }
+        defer resp.Body.Close()
+        for _, h := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified"} {
+            if v := resp.Header.Get(h); v != "" {
+                w.Header().Set(h, v)
+            }
+        }
+        w.WriteHeader(resp.StatusCode)
+        io.Copy(w, resp.Body)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    http.ServeContent(w, r, "", time.Time{}, strings.NewReader(stored))
 }
 
-func fetchGPUSample(node core.Node, timestamp int64) (core.GPUSample, error) {
-    req := map[string]interface{}{
-        "script":          "nvidia-smi --query-gpu=name,utilization.gpu,memory.used,memory.total --format=csv,noheader,nounits",
-        "timeout_seconds": 10,
+// handleExecutionArtifacts lists an execution's artifacts, or downloads one
+// when name is given.
+func (s *bastionServer) handleExecutionArtifacts(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
     }
-    payload, err := json.Marshal(req)
+    execRecord, err := s.svc.GetExecution(r.Context(), r.URL.Query().Get("id"))
     if err != nil {
-        return core.GPUSample{}, fmt.Errorf("marshal exec request: %w", err)
+        writeError(w, err, http.StatusInternalServerError)
+        return
     }
-
-    url := strings.TrimRight(node.Address, "/") + "/api/v1/exec"
-    resp, err := http.Post(url, "application/json", bytes.NewReader(payload))
+    name := r.URL.Query().Get("name")
+    if name == "" {
+        artifacts := execRecord.Artifacts
+        if artifacts == nil {
+            artifacts = []core.Artifact{}
+        }
+        writeJSON(w, http.StatusOK, artifacts)
+        return
+    }
+    blob, info, err := s.svc.OpenArtifact(r.Context(), execRecord, name)
     if err != nil {
-        return core.GPUSample{}, fmt.Errorf("post exec: %w", err)
+        writeError(w, err, http.StatusBadGateway)
+        return
     }
-    defer resp.Body.Close()
+    defer blob.Close()
+    w.Header().Set("Content-Type", "application/octet-stream")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(name)))
+    http.ServeContent(w, r, "", info.ModTime, blob)
+}
 
-    body, _ := io.ReadAll(resp.Body)
-    if resp.StatusCode != http.StatusOK {
-        return core.GPUSample{}, fmt.Errorf("exec status %d: %s", resp.StatusCode, string(body))
+// handleGPU samples every node's GPUs now, or, given any of from, to
+// (RFC 3339) and step (a duration such as 30s or 5m), returns the stored
+// history averaged into step-wide buckets. node restricts either to one node.
+func (s *bastionServer) handleGPU(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
     }
+    q := r.URL.Query()
+    nodeID := q.Get("node")
+    if q.Get("from") == "" && q.Get("to") == "" && q.Get("step") == "" {
+        samples, err := s.svc.GPUSamples(r.Context())
+        if err != nil {
+            writeError(w, err, http.StatusInternalServerError)
+            return
+        }
+        out := samples[:0]
+        for _, sample := range samples {
+            if nodeID == "" || sample.NodeID == nodeID {
+                out = append(out, sample)
+            }
+        }
+        writeJSON(w, http.StatusOK, out)
+        return
+    }
+    query, err := parseGPUQuery(q)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    samples, err := s.svc.GPUHistory(r.Context(), query)
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, samples)
+}
 
-    var execResp struct {
-        Stdout string `json:"stdout"`
-        Stderr string `json:"stderr"`
+// handleGPUReservations lists the GPUs held by executions.
+func (s *bastionServer) handleGPUReservations(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
     }
-    if err := json.Unmarshal(body, &execResp); err != nil {
-        return core.GPUSample{}, fmt.Errorf("decode exec response: %w", err)
+    reservations, err := s.svc.ListGPUReservations(r.Context())
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
     }
+    writeJSON(w, http.StatusOK, reservations)
+}
 
-    util, memMB, parseErr := parseNvidiaSmi(execResp.Stdout)
-    if parseErr != nil {
-        return core.GPUSample{
-            NodeID:      node.ID,
-            Timestamp:   timestamp,
-            Utilization: 0,
-            MemoryMB:    0,
-        }, fmt.Errorf("parse nvidia-smi output: %w (stderr: %s)", parseErr, execResp.Stderr)
+// handleAlerts lists GPU alerts, most recently updated first. state
+// (pending, firing or resolved) and limit narrow the listing.
+func (s *bastionServer) handleAlerts(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    q := r.URL.Query()
+    limit, _ := strconv.Atoi(q.Get("limit"))
+    alerts, err := s.svc.ListAlerts(r.Context(), core.AlertState(q.Get("state")), limit)
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
     }
+    writeJSON(w, http.StatusOK, alerts)
+}
 
-    return core.GPUSample{
-        NodeID:      node.ID,
-        Timestamp:   timestamp,
-        Utilization: util,
-        MemoryMB:    memMB,
-    }, nil
+func (s *bastionServer) handleAlertRules(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    rules := s.svc.AlertRules()
+    if rules == nil {
+        rules = []core.AlertRule{}
+    }
+    writeJSON(w, http.StatusOK, rules)
 }
 
-func parseNvidiaSmi(out string) (float64, int, error) {
-    scanner := bufio.NewScanner(strings.NewReader(out))
-    for scanner.Scan() {
-        line := strings.TrimSpace(scanner.Text())
-        if line == "" {
-            continue
+func parseGPUQuery(q url.Values) (core.GPUQuery, error) {
+    query := core.GPUQuery{NodeID: q.Get("node")}
+    for _, bound := range []struct {
+        name string
+        dst  *time.Time
+    }{{"from", &query.From}, {"to", &query.To}} {
+        if v := q.Get(bound.name); v != "" {
+            t, err := time.Parse(time.RFC3339, v)
+            if err != nil {
+                return query, fmt.Errorf("invalid %s %q: want RFC 3339", bound.name, v)
+            }
+            *bound.dst = t
         }
-        parts := strings.Split(line, ",")
-        if len(parts) < 4 {
-            continue
+    }
+    if v := q.Get("step"); v != "" {
+        step, err := time.ParseDuration(v)
+        if err != nil || step <= 0 {
+            return query, fmt.Errorf("invalid step %q", v)
         }
-        utilStr := strings.TrimSpace(parts[1])
-        memUsedStr := strings.TrimSpace(parts[2])
+        query.Step = step
+    }
+    return query, nil
+}
 
-        util, err := strconv.ParseFloat(utilStr, 64)
-        if err != nil {
-            return 0, 0, fmt.Errorf("utilization parse: %w", err)
-        }
-        memUsed, err := strconv.Atoi(memUsedStr)
-        if err != nil {
-            return 0, 0, fmt.Errorf("memory parse: %w", err)
-        }
-        return util, memUsed, nil
+// blobStoreFromEnv picks the execution output store: S3-compatible when
+// BASTION_S3_BUCKET is set, a local directory when BASTION_BLOB_DIR is set,
+// and none (outputs stay in the database) otherwise.
+func blobStoreFromEnv() (core.BlobStore, error) {
+    if bucket := os.Getenv("BASTION_S3_BUCKET"); bucket != "" {
+        log.Printf("Storing large outputs in S3 bucket %s", bucket)
+        return core.NewS3BlobStore(core.S3Config{
+            Endpoint:  envOr("BASTION_S3_ENDPOINT", "https://s3.amazonaws.com"),
+            Bucket:    bucket,
+            Region:    os.Getenv("BASTION_S3_REGION"),
+            AccessKey: os.Getenv("BASTION_S3_ACCESS_KEY"),
+            SecretKey: os.Getenv("BASTION_S3_SECRET_KEY"),
+            Prefix:    os.Getenv("BASTION_S3_PREFIX"),
+        })
+    }
+    if dir := os.Getenv("BASTION_BLOB_DIR"); dir != "" {
+        log.Printf("Storing large outputs in %s", dir)
+        return core.NewLocalBlobStore(dir)
     }
-    return 0, 0, errors.New("no GPU lines found")
+    return nil, nil
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
@@ -313,6 +659,32 @@ func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
     json.NewEncoder(w).Encode(payload)
 }
 
+// errorStatus maps service errors to HTTP statuses; anything unclassified
+// gets fallback.
+func errorStatus(err error, fallback int) int {
+    switch {
+    case errors.Is(err, core.ErrNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, core.ErrInvalid):
+        return http.StatusBadRequest
+    case errors.Is(err, core.ErrAccessDenied):
+        return http.StatusForbidden
+    case errors.Is(err, core.ErrUnavailable):
+        return http.StatusServiceUnavailable
+    }
+    return fallback
+}
+
+// writeError reports err with the status errorStatus picks, logging server
+// side failures since their details matter to operators, not callers.
+func writeError(w http.ResponseWriter, err error, fallback int) {
+    status := errorStatus(err, fallback)
+    if status >= 500 {
+        log.Printf("request failed: %v", err)
+    }
+    http.Error(w, err.Error(), status)
+}
+
 func loadEnvFile(path string) {
     f, err := os.Open(path)
     if err != nil {
@@ -365,10 +737,49 @@ func envOr(key, fallback string) string {
     return fallback
 }
 
+func envInt(key string, fallback int) int {
+    v := strings.TrimSpace(os.Getenv(key))
+    if v == "" {
+        return fallback
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil {
+        log.Printf("invalid %s=%q, using %d", key, v, fallback)
+        return fallback
+    }
+    return n
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+    v := os.Getenv(key)
+    if v == "" {
+        return fallback
+    }
+    d, err := time.ParseDuration(v)
+    if err != nil {
+        log.Printf("invalid %s=%q, using %s", key, v, fallback)
+        return fallback
+    }
+    return d
+}
+
+func envBool(key string, fallback bool) bool {
+    v := strings.TrimSpace(os.Getenv(key))
+    if v == "" {
+        return fallback
+    }
+    b, err := strconv.ParseBool(v)
+    if err != nil {
+        log.Printf("invalid %s=%q, using %t", key, v, fallback)
+        return fallback
+    }
+    return b
+}
+
 func withCORS(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
         w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
         if r.Method == http.MethodOptions {
             w.WriteHeader(http.StatusNoContent)
@@ -377,3 +788,14 @@ func withCORS(next http.Handler) http.Handler {
         next.ServeHTTP(w, r)
     })
 }
+
+// envList splits a comma-separated variable, dropping empty entries.
+func envList(key string) []string {
+    var out []string
+    for _, v := range strings.Split(os.Getenv(key), ",") {
+        if v = strings.TrimSpace(v); v != "" {
+            out = append(out, v)
+        }
+    }
+    return out
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "strconv"
+    "text/tabwriter"
+    "time"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// runMigrate implements `bastion migrate`, which reports and moves the
+// database schema version. The server migrates up on its own at startup;
+// this is for inspecting a database and for rolling back.
+func runMigrate(args []string) {
+    fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+    dsn := fs.String("dsn", os.Getenv("BASTION_DB_DSN"), "database DSN (postgres://... or sqlite:///path)")
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "usage: bastion migrate [flags] status | up [version] | down [steps]\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if *dsn == "" || fs.NArg() == 0 || fs.NArg() > 2 {
+        fs.Usage()
+        os.Exit(2)
+    }
+    n := 0
+    if fs.NArg() == 2 {
+        v, err := strconv.Atoi(fs.Arg(1))
+        if err != nil || v < 0 {
+            log.Fatalf("invalid argument %q", fs.Arg(1))
+        }
+        n = v
+    }
+
+    db, err := core.OpenDatabase(*dsn)
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer db.Close()
+    migrator, err := core.NewMigrator(db)
+    if err != nil {
+        log.Fatal(err)
+    }
+    ctx := context.Background()
+
+    var done []core.Migration
+    verb := "applied"
+    switch fs.Arg(0) {
+    case "status":
+        status, err := migrator.Status(ctx)
+        if err != nil {
+            log.Fatal(err)
+        }
+        tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+        fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+        for _, st := range status {
+            applied := "pending"
+            if st.AppliedAt != nil {
+                applied = st.AppliedAt.Local().Format(time.RFC3339)
+            }
+            fmt.Fprintf(tw, "%04d\t%s\t%s\n", st.Version, st.Name, applied)
+        }
+        tw.Flush()
+        return
+    case "up":
+        done, err = migrator.Up(ctx, n)
+    case "down":
+        if n == 0 {
+            n = 1
+        }
+        verb = "reverted"
+        done, err = migrator.Down(ctx, n)
+    default:
+        fs.Usage()
+        os.Exit(2)
+    }
+    for _, m := range done {
+        fmt.Printf("%s %04d_%s\n", verb, m.Version, m.Name)
+    }
+    if err != nil {
+        log.Fatal(err)
+    }
+    if len(done) == 0 {
+        fmt.Println("nothing to do")
+    }
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "net/http"
+    "slices"
+    "strconv"
+    "time"
+
+    "github.com/gorilla/websocket"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// newUpgrader accepts WebSockets from the bastion's own origin, from
+// allowedOrigins (the dashboard may be served separately), and from callers
+// whose bearer token withAuth validated, which a page on another site cannot
+// know. Anything else could let any site drive the bastion through a
+// visitor's browser, and an unauthenticated bastion hands out admin.
+func newUpgrader(allowedOrigins []string) websocket.Upgrader {
+    return websocket.Upgrader{
+        ReadBufferSize:  4096,
+        WriteBufferSize: 4096,
+        CheckOrigin: func(r *http.Request) bool {
+            if tokenAuthenticated(r.Context()) {
+                return true
+            }
+            origin := r.Header.Get("Origin")
+            if origin == "" || origin == "http://"+r.Host || origin == "https://"+r.Host {
+                return true
+            }
+            return slices.Contains(allowedOrigins, origin)
+        },
+    }
+}
+
+// handleTerminal bridges a browser WebSocket to a PTY shell on a node:
+// GET ?node_id=&cols=&rows=. See core.TerminalMessage for the framing.
+func (s *bastionServer) handleTerminal(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    q := r.URL.Query()
+    cols, _ := strconv.ParseUint(q.Get("cols"), 10, 16)
+    rows, _ := strconv.ParseUint(q.Get("rows"), 10, 16)
+    if cols == 0 || rows == 0 {
+        cols, rows = 80, 24
+    }
+    if !websocket.IsWebSocketUpgrade(r) {
+        http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+        return
+    }
+    term, err := s.svc.OpenTerminal(r.Context(), q.Get("node_id"), uint16(cols), uint16(rows))
+    if err != nil {
+        writeError(w, err, http.StatusBadGateway)
+        return
+    }
+    client, err := s.upgrader.Upgrade(w, r, nil)
+    if err != nil {
+        term.Close()
+        return
+    }
+    s.svc.BridgeTerminal(r.Context(), term, client, s.terminalIdle)
+}
+
+func (s *bastionServer) handleSessions(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    q := r.URL.Query()
+    sessions, err := s.svc.ListSessions(r.Context(), q.Get("node_id"), q.Get("user"))
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, sessions)
+}
+
+// handleSessionRecording returns a session's asciicast v2 recording. With
+// realtime=1 it is streamed at the original pace (scaled by speed, pauses
+// capped at max_wait) instead of sent whole.
+func (s *bastionServer) handleSessionRecording(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    q := r.URL.Query()
+    session, err := s.svc.GetSession(r.Context(), q.Get("id"))
+    if err != nil {
+        writeError(w, err, http.StatusInternalServerError)
+        return
+    }
+    if session.EndedAt == nil {
+        http.Error(w, "session is still active", http.StatusConflict)
+        return
+    }
+    w.Header().Set("Content-Type", "application/x-asciicast")
+    if realtime, _ := strconv.ParseBool(q.Get("realtime")); !realtime {
+        w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", session.ID+".cast"))
+        http.ServeContent(w, r, "", *session.EndedAt, bytes.NewReader(session.Recording))
+        return
+    }
+    speed, _ := strconv.ParseFloat(q.Get("speed"), 64)
+    maxWait := 2 * time.Second
+    if v, err := time.ParseDuration(q.Get("max_wait")); err == nil {
+        maxWait = v
+    }
+    core.ReplayAsciicast(r.Context(), w, session.Recording, speed, maxWait)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+
+    "github.com/gorilla/websocket"
+)
+
+// handleTunnels opens (POST {node_id, port, ttl_seconds}), lists (GET) and
+// closes (DELETE ?id=) TCP tunnels.
+func (s *bastionServer) handleTunnels(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        tunnels, err := s.svc.ListTunnels(r.Context())
+        if err != nil {
+            writeError(w, err, http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, tunnels)
+    case http.MethodPost:
+        var payload struct {
+            NodeID     string `json:"node_id"`
+            Port       int    `json:"port"`
+            TTLSeconds int    `json:"ttl_seconds"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+            http.Error(w, "invalid payload", http.StatusBadRequest)
+            return
+        }
+        tunnel, err := s.svc.OpenTunnel(r.Context(), payload.NodeID, payload.Port, time.Duration(payload.TTLSeconds)*time.Second)
+        if err != nil {
+            writeError(w, err, http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusCreated, tunnel)
+    case http.MethodDelete:
+        tunnel, err := s.svc.CloseTunnel(r.Context(), r.URL.Query().Get("id"))
+        if err != nil {
+            writeError(w, err, http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, tunnel)
+    default:
+        w.WriteHeader(http.StatusMethodNotAllowed)
+    }
+}
+
+// handleTunnelConnect carries one TCP connection of a tunnel over a
+// WebSocket: GET ?id=. `bastion forward` is the usual client.
+func (s *bastionServer) handleTunnelConnect(w http.ResponseWriter, r *http.Request) {
+    if !websocket.IsWebSocketUpgrade(r) {
+        http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+        return
+    }
+    tc, err := s.svc.DialTunnel(r.Context(), r.URL.Query().Get("id"))
+    if err != nil {
+        writeError(w, err, http.StatusBadGateway)
+        return
+    }
+    client, err := s.upgrader.Upgrade(w, r, nil)
+    if err != nil {
+        tc.Close()
+        return
+    }
+    s.svc.RelayTunnel(tc, client)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// artifactPolicy caps what a single execution may ship back as artifacts.
+// Collected files are copied under Dir, where the bastion fetches them from;
+// it deletes them once stored, and anything left is pruned after Retention.
+type artifactPolicy struct {
+    MaxFileBytes  int64
+    MaxTotalBytes int64
+    MaxFiles      int
+    Dir           string
+    Retention     time.Duration
+}
+
+func loadArtifactPolicy() artifactPolicy {
+    return artifactPolicy{
+        MaxFileBytes:  int64(envInt("DAEMON_ARTIFACT_MAX_FILE_BYTES", 50*1024*1024)),
+        MaxTotalBytes: int64(envInt("DAEMON_ARTIFACT_MAX_TOTAL_BYTES", 200*1024*1024)),
+        MaxFiles:      envInt("DAEMON_ARTIFACT_MAX_FILES", 100),
+        Dir:           envOr("DAEMON_ARTIFACT_DIR", filepath.Join(os.TempDir(), "bastion-artifacts")),
+        Retention:     envDuration("DAEMON_ARTIFACT_RETENTION", time.Hour),
+    }
+}
+
+var errArtifactOutsideRoot = errors.New("resolves outside the working directory")
+
+// stageDir holds the collected artifacts of one execution.
+func (p artifactPolicy) stageDir(executionID string) string {
+    return filepath.Join(p.Dir, safeID(executionID))
+}
+
+// stagePath is where the artifact called name is kept. Names are paths, so
+// they are hashed into a flat, fixed-length file name.
+func (p artifactPolicy) stagePath(executionID, name string) string {
+    sum := sha256.Sum256([]byte(name))
+    return filepath.Join(p.stageDir(executionID), hex.EncodeToString(sum[:]))
+}
+
+// collect stages the regular files matching patterns, which are relative to
+// root (the daemon's cwd when empty). Patterns that are absolute or climb out
+// of root are ignored, and matches are not followed through symlinks out of
+// root. Files over a cap are still reported, with Skipped set, so the caller
+// knows they existed.
+func (p artifactPolicy) collect(root, executionID string, patterns []string) []core.ArtifactFile {
+    if root == "" {
+        root, _ = os.Getwd()
+    }
+    realRoot, err := filepath.EvalSymlinks(root)
+    if err != nil {
+        log.Printf("artifact root %q: %v", root, err)
+        return nil
+    }
+    seen := map[string]bool{}
+    var paths []string
+    for _, pattern := range patterns {
+        pattern = strings.TrimSpace(pattern)
+        if pattern == "" {
+            continue
+        }
+        if err := core.ValidateArtifactPattern(pattern); err != nil {
+            log.Printf("artifact pattern %q: %v", pattern, err)
+            continue
+        }
+        matches, err := filepath.Glob(filepath.Join(root, pattern))
+        if err != nil {
+            log.Printf("artifact pattern %q: %v", pattern, err)
+            continue
+        }
+        for _, m := range matches {
+            if !seen[m] {
+                seen[m] = true
+                paths = append(paths, m)
+            }
+        }
+    }
+    sort.Strings(paths)
+
+    dir := p.stageDir(executionID)
+    staging := safeID(executionID) != ""
+    if staging {
+        // A run retried after a daemon restart starts from scratch.
+        os.RemoveAll(dir)
+        if err := os.MkdirAll(dir, 0o700); err != nil {
+            log.Printf("artifact dir: %v", err)
+            staging = false
+        }
+    }
+    var out []core.ArtifactFile
+    var total int64
+    for _, path := range paths {
+        // Lstat, so a symlink planted by the script is not read through.
+        info, err := os.Lstat(path)
+        if err != nil || !info.Mode().IsRegular() {
+            continue
+        }
+        rel, err := filepath.Rel(root, path)
+        if err != nil {
+            continue
+        }
+        file := core.ArtifactFile{Name: filepath.ToSlash(rel), Size: info.Size()}
+        switch {
+        case !staging:
+            file.Skipped = "artifact staging unavailable"
+        case len(out) >= p.MaxFiles:
+            file.Skipped = "too many artifacts"
+        case info.Size() > p.MaxFileBytes:
+            file.Skipped = "exceeds per-file size limit"
+        case total+info.Size() > p.MaxTotalBytes:
+            file.Skipped = "exceeds total size limit"
+        default:
+            size, sum, err := stageArtifact(realRoot, path, p.stagePath(executionID, file.Name), p.MaxFileBytes)
+            if err != nil {
+                file.Skipped = err.Error()
+                break
+            }
+            file.SHA256, file.Size = sum, size
+            total += size
+        }
+        out = append(out, file)
+    }
+    return out
+}
+
+// stageArtifact copies the file at path to dst and returns its size and
+// SHA-256. The path must resolve to a regular file under root, and is opened
+// without following a symlink swapped in since it was checked.
+func stageArtifact(root, path, dst string, limit int64) (int64, string, error) {
+    resolved, err := filepath.EvalSymlinks(path)
+    if err != nil {
+        return 0, "", err
+    }
+    if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+        return 0, "", errArtifactOutsideRoot
+    }
+    f, err := os.OpenFile(resolved, os.O_RDONLY|artifactOpenFlags, 0)
+    if err != nil {
+        return 0, "", err
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil {
+        return 0, "", err
+    }
+    if !info.Mode().IsRegular() {
+        return 0, "", errors.New("not a regular file")
+    }
+    out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+    if err != nil {
+        return 0, "", err
+    }
+    h := sha256.New()
+    // The file may still be growing; never copy past the cap.
+    n, err := io.Copy(io.MultiWriter(out, h), io.LimitReader(f, limit))
+    if cerr := out.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        os.Remove(dst)
+        return 0, "", err
+    }
+    return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handleArtifacts serves a staged artifact (GET ?execution_id=&name=) or
+// discards all of an execution's (DELETE ?execution_id=).
+func (d *daemonServer) handleArtifacts(w http.ResponseWriter, r *http.Request) {
+    id := r.URL.Query().Get("execution_id")
+    if safeID(id) == "" {
+        http.Error(w, "execution_id is required", http.StatusBadRequest)
+        return
+    }
+    switch r.Method {
+    case http.MethodGet:
+        name := r.URL.Query().Get("name")
+        if name == "" {
+            http.Error(w, "name is required", http.StatusBadRequest)
+            return
+        }
+        f, err := os.Open(d.artifacts.stagePath(id, name))
+        if err != nil {
+            http.Error(w, "not found", http.StatusNotFound)
+            return
+        }
+        defer f.Close()
+        info, err := f.Stat()
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "application/octet-stream")
+        http.ServeContent(w, r, "", info.ModTime(), f)
+    case http.MethodDelete:
+        if err := os.RemoveAll(d.artifacts.stageDir(id)); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    default:
+        w.WriteHeader(http.StatusMethodNotAllowed)
+    }
+}
+
+// runJanitor removes staged artifacts the bastion never collected.
+func (p artifactPolicy) runJanitor() {
+    if p.Retention <= 0 {
+        return
+    }
+    ticker := time.NewTicker(10 * time.Minute)
+    defer ticker.Stop()
+    for {
+        entries, _ := os.ReadDir(p.Dir)
+        cutoff := time.Now().Add(-p.Retention)
+        for _, e := range entries {
+            info, err := e.Info()
+            if err != nil || info.ModTime().After(cutoff) {
+                continue
+            }
+            if err := os.RemoveAll(filepath.Join(p.Dir, e.Name())); err != nil {
+                log.Printf("prune artifacts: %v", err)
+            }
+        }
+        <-ticker.C
+    }
+}
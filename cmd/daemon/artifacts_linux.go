@@ -0,0 +1,7 @@
+package main
+
+import "syscall"
+
+// artifactOpenFlags keep an artifact open from following a symlink or
+// blocking on a FIFO swapped in for the file after it was checked.
+const artifactOpenFlags = syscall.O_NOFOLLOW | syscall.O_NONBLOCK
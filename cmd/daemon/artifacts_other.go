@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+// artifactOpenFlags is empty off Linux; the symlink checks in stageArtifact
+// still apply.
+const artifactOpenFlags = 0
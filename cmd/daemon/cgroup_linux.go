@@ -0,0 +1,164 @@
+//go:build linux
+
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+const (
+    // cpuPeriodUsec is the cpu.max period; quota is derived from CPUPercent.
+    cpuPeriodUsec = 100000
+    // cgroup2SuperMagic is CGROUP2_SUPER_MAGIC from linux/magic.h.
+    cgroup2SuperMagic = 0x63677270
+)
+
+type execCgroup struct {
+    path string
+    dir  *os.File
+}
+
+func createExecCgroup(root, name string, limits core.ResourceLimits) (*execCgroup, error) {
+    // Refuse to create directories on a hybrid/v1 host where root is a plain tmpfs path.
+    var fs syscall.Statfs_t
+    if err := syscall.Statfs(filepath.Dir(root), &fs); err != nil {
+        return nil, fmt.Errorf("stat cgroup root: %w", err)
+    }
+    if fs.Type != cgroup2SuperMagic {
+        return nil, fmt.Errorf("%s is not on a cgroup v2 hierarchy", root)
+    }
+    if err := os.MkdirAll(root, 0o755); err != nil {
+        return nil, fmt.Errorf("create cgroup root: %w", err)
+    }
+    // Controllers are enabled one at a time so a missing one does not hide the others;
+    // writing the limit file below fails if the controller we need is absent.
+    for _, ctrl := range []string{"+cpu", "+memory", "+pids"} {
+        _ = os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte(ctrl), 0)
+    }
+
+    path := filepath.Join(root, name)
+    if err := os.Mkdir(path, 0o755); err != nil {
+        return nil, fmt.Errorf("create cgroup: %w", err)
+    }
+    cg := &execCgroup{path: path}
+    if err := cg.setLimits(limits); err != nil {
+        cg.remove()
+        return nil, err
+    }
+    dir, err := os.Open(path)
+    if err != nil {
+        cg.remove()
+        return nil, fmt.Errorf("open cgroup: %w", err)
+    }
+    cg.dir = dir
+    return cg, nil
+}
+
+func (c *execCgroup) setLimits(limits core.ResourceLimits) error {
+    if limits.MemoryMB > 0 {
+        if err := c.write("memory.max", strconv.FormatInt(int64(limits.MemoryMB)*1024*1024, 10)); err != nil {
+            return err
+        }
+        // Without this the limit only moves pages to swap. Not every host has swap accounting.
+        _ = c.write("memory.swap.max", "0")
+    }
+    if limits.CPUPercent > 0 {
+        quota := limits.CPUPercent * cpuPeriodUsec / 100
+        if err := c.write("cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriodUsec)); err != nil {
+            return err
+        }
+    }
+    if limits.MaxPids > 0 {
+        if err := c.write("pids.max", strconv.Itoa(limits.MaxPids)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (c *execCgroup) write(file, value string) error {
+    if err := os.WriteFile(filepath.Join(c.path, file), []byte(value), 0); err != nil {
+        return fmt.Errorf("set %s: %w", file, err)
+    }
+    return nil
+}
+
+// attach starts cmd directly inside the cgroup (clone3 CLONE_INTO_CGROUP), so
+// there is no window where the script runs unconfined. On cancellation the
+// whole group is killed rather than just the top-level shell.
+func (c *execCgroup) attach(cmd *exec.Cmd) {
+    if cmd.SysProcAttr == nil {
+        cmd.SysProcAttr = &syscall.SysProcAttr{}
+    }
+    cmd.SysProcAttr.UseCgroupFD = true
+    cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+    cmd.Cancel = func() error {
+        c.kill()
+        return cmd.Process.Kill()
+    }
+}
+
+func (c *execCgroup) kill() {
+    _ = c.write("cgroup.kill", "1")
+}
+
+func (c *execCgroup) usage() resourceUsage {
+    var u resourceUsage
+    if raw, err := os.ReadFile(filepath.Join(c.path, "memory.peak")); err == nil {
+        u.PeakMemoryBytes, _ = strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+    }
+    if raw, err := os.ReadFile(filepath.Join(c.path, "cpu.stat")); err == nil {
+        scanner := bufio.NewScanner(bytes.NewReader(raw))
+        for scanner.Scan() {
+            fields := strings.Fields(scanner.Text())
+            if len(fields) == 2 && fields[0] == "usage_usec" {
+                usec, _ := strconv.ParseInt(fields[1], 10, 64)
+                u.CPUTimeMs = usec / 1000
+            }
+        }
+    }
+    return u
+}
+
+// cgroupPath is the cgroup's directory in the cgroup2 mount.
+func (c *execCgroup) cgroupPath() string { return c.path }
+
+// remove kills anything the script left behind and deletes the cgroup.
+func (c *execCgroup) remove() {
+    if c.dir != nil {
+        c.dir.Close()
+    }
+    c.kill()
+    for i := 0; i < 50; i++ {
+        err := os.Remove(c.path)
+        if err == nil || errors.Is(err, os.ErrNotExist) {
+            return
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+}
+
+// processUsage is the fallback when the execution did not run in a cgroup. It
+// only covers the shell and the children it waited for.
+func processUsage(state *os.ProcessState) resourceUsage {
+    if state == nil {
+        return resourceUsage{}
+    }
+    u := resourceUsage{CPUTimeMs: (state.UserTime() + state.SystemTime()).Milliseconds()}
+    if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+        u.PeakMemoryBytes = ru.Maxrss * 1024
+    }
+    return u
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package main
+
+import (
+    "errors"
+    "os"
+    "os/exec"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+type execCgroup struct{}
+
+func createExecCgroup(root, name string, limits core.ResourceLimits) (*execCgroup, error) {
+    return nil, errors.New("cgroups v2 are only supported on linux")
+}
+
+func (c *execCgroup) attach(cmd *exec.Cmd) {}
+
+func (c *execCgroup) usage() resourceUsage { return resourceUsage{} }
+
+func (c *execCgroup) remove() {}
+
+func (c *execCgroup) cgroupPath() string { return "" }
+
+func processUsage(state *os.ProcessState) resourceUsage {
+    if state == nil {
+        return resourceUsage{}
+    }
+    return resourceUsage{CPUTimeMs: (state.UserTime() + state.SystemTime()).Milliseconds()}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+    "context"
+    "path"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// execRegistry tracks runs by execution ID. A run outlives the request that
+// started it, so a bastion that restarts mid-execution can ask for the
+// result instead of losing it, and a retried request does not run the
+// script twice. Results are kept in memory for ttl after the run finishes;
+// artifacts stay on disk, see artifactPolicy.
+type execRegistry struct {
+    mu   sync.Mutex
+    runs map[string]*execRun
+    ttl  time.Duration
+}
+
+type execRun struct {
+    done     chan struct{}
+    finished time.Time
+    result   core.ExecResponse
+    // cgroup is the run's cgroup directory while its script runs.
+    cgroup string
+}
+
+func loadExecRegistry() *execRegistry {
+    return &execRegistry{
+        runs: map[string]*execRun{},
+        ttl:  envDuration("DAEMON_EXEC_RESULT_TTL", time.Hour),
+    }
+}
+
+// start returns the run registered under id, creating it if there is none;
+// created tells the caller it must execute the run and call finish.
+func (r *execRegistry) start(id string) (run *execRun, created bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if run, ok := r.runs[id]; ok {
+        return run, false
+    }
+    run = &execRun{done: make(chan struct{})}
+    r.runs[id] = run
+    return run, true
+}
+
+func (r *execRegistry) finish(run *execRun, result core.ExecResponse) {
+    r.mu.Lock()
+    run.result = result
+    run.finished = time.Now()
+    r.mu.Unlock()
+    close(run.done)
+}
+
+// setCgroup records the cgroup directory a run's processes are confined to;
+// an empty path clears it once the cgroup is removed.
+func (r *execRegistry) setCgroup(id, path string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if run, ok := r.runs[id]; ok {
+        run.cgroup = path
+    }
+}
+
+// hasCgroup reports whether the run registered under id has a cgroup.
+func (r *execRegistry) hasCgroup(id string) bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    run, ok := r.runs[id]
+    return ok && run.cgroup != ""
+}
+
+// cgroupExecution returns the run whose cgroup holds a process in the
+// cgroup named by /proc/<pid>/cgroup. That name is relative to the
+// daemon's cgroup namespace, so it matches the tail of a run's directory;
+// scripts may create child cgroups, so parents are tried too.
+func (r *execRegistry) cgroupExecution(name string) (string, bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for strings.HasPrefix(name, "/") && name != "/" {
+        for id, run := range r.runs {
+            if run.cgroup != "" && strings.HasSuffix(run.cgroup, name) {
+                return id, true
+            }
+        }
+        name = path.Dir(name)
+    }
+    return "", false
+}
+
+func (r *execRegistry) lookup(id string) (core.DaemonExecution, bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    run, ok := r.runs[id]
+    if !ok {
+        return core.DaemonExecution{}, false
+    }
+    st := core.DaemonExecution{ExecutionID: id}
+    select {
+    case <-run.done:
+        result := run.result
+        st.Done, st.Result = true, &result
+    default:
+    }
+    return st, true
+}
+
+// runJanitor forgets finished runs older than the ttl until ctx is done.
+func (r *execRegistry) runJanitor(ctx context.Context) {
+    ticker := time.NewTicker(time.Minute)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        cutoff := time.Now().Add(-r.ttl)
+        r.mu.Lock()
+        for id, run := range r.runs {
+            if !run.finished.IsZero() && run.finished.Before(cutoff) {
+                delete(r.runs, id)
+            }
+        }
+        r.mu.Unlock()
+    }
+}
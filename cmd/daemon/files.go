@@ -0,0 +1,306 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// filePolicy restricts file transfer to a set of directory trees. With no
+// roots configured the endpoint is disabled.
+type filePolicy struct {
+    Roots    []string
+    MaxBytes int64
+    // AllowSetID permits uploads with the setuid or setgid bit.
+    AllowSetID bool
+    // UIDs and GIDs are the owners uploads may be given; with neither set,
+    // uploads keep the daemon's.
+    UIDs map[int]bool
+    GIDs map[int]bool
+}
+
+func loadFilePolicy() filePolicy {
+    var roots []string
+    for _, r := range strings.Split(os.Getenv("DAEMON_FILE_ROOTS"), ",") {
+        r = strings.TrimSpace(r)
+        if r == "" {
+            continue
+        }
+        if resolved, err := filepath.EvalSymlinks(r); err == nil {
+            r = resolved
+        }
+        roots = append(roots, filepath.Clean(r))
+    }
+    policy := filePolicy{
+        Roots:      roots,
+        MaxBytes:   int64(envInt("DAEMON_FILE_MAX_BYTES", 1024*1024*1024)),
+        AllowSetID: envBool("DAEMON_FILE_ALLOW_SETID", false),
+        UIDs:       map[int]bool{},
+        GIDs:       map[int]bool{},
+    }
+    // DAEMON_FILE_OWNERS lists the "user[:group]" owners uploads may ask
+    // for; a user brings its primary group.
+    for _, owner := range strings.Split(os.Getenv("DAEMON_FILE_OWNERS"), ",") {
+        owner = strings.TrimSpace(owner)
+        if owner == "" {
+            continue
+        }
+        uid, gid, err := lookupOwner(owner)
+        if err != nil {
+            log.Printf("DAEMON_FILE_OWNERS: %v", err)
+            continue
+        }
+        if uid >= 0 {
+            policy.UIDs[uid] = true
+        }
+        if gid >= 0 {
+            policy.GIDs[gid] = true
+        }
+    }
+    return policy
+}
+
+// ownerAllowed reports whether uploads may be given uid and gid; -1 leaves
+// an id unchanged and is always allowed.
+func (p filePolicy) ownerAllowed(uid, gid int) bool {
+    return (uid < 0 || p.UIDs[uid]) && (gid < 0 || p.GIDs[gid])
+}
+
+var errPathNotAllowed = errors.New("path is outside the allowed roots")
+
+// resolve checks that path lands inside an allowed root once symlinks are
+// followed. For uploads the file may not exist yet, so only its directory is
+// resolved.
+func (p filePolicy) resolve(path string, mustExist bool) (string, error) {
+    if !filepath.IsAbs(path) {
+        return "", errors.New("path must be absolute")
+    }
+    path = filepath.Clean(path)
+    var resolved string
+    if mustExist {
+        r, err := filepath.EvalSymlinks(path)
+        if err != nil {
+            return "", err
+        }
+        resolved = r
+    } else {
+        dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+        if err != nil {
+            return "", err
+        }
+        resolved = filepath.Join(dir, filepath.Base(path))
+        // Don't write through a symlink that points elsewhere.
+        if target, err := filepath.EvalSymlinks(resolved); err == nil {
+            resolved = target
+        }
+    }
+    for _, root := range p.Roots {
+        if resolved == root || strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+            return resolved, nil
+        }
+    }
+    return "", errPathNotAllowed
+}
+
+func (d *daemonServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+    if len(d.files.Roots) == 0 {
+        http.Error(w, "file transfer is disabled", http.StatusForbidden)
+        return
+    }
+    switch r.Method {
+    case http.MethodGet, http.MethodHead:
+        d.getFile(w, r)
+    case http.MethodPut:
+        d.putFile(w, r)
+    default:
+        w.WriteHeader(http.StatusMethodNotAllowed)
+    }
+}
+
+func (d *daemonServer) getFile(w http.ResponseWriter, r *http.Request) {
+    path, err := d.files.resolve(r.URL.Query().Get("path"), true)
+    if err != nil {
+        fileError(w, err)
+        return
+    }
+    f, err := os.Open(path)
+    if err != nil {
+        fileError(w, err)
+        return
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil || !info.Mode().IsRegular() {
+        http.Error(w, "not a regular file", http.StatusBadRequest)
+        return
+    }
+    h := sha256.New()
+    if _, err := io.Copy(h, f); err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    if _, err := f.Seek(0, io.SeekStart); err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("X-Content-Sha256", hex.EncodeToString(h.Sum(nil)))
+    w.Header().Set("X-File-Mode", fmt.Sprintf("%04o", info.Mode().Perm()))
+    w.Header().Set("Content-Type", "application/octet-stream")
+    http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// putFile writes the body next to the target and renames it into place only
+// after the checksum, mode and owner are settled, so a failed upload never
+// leaves a partial file at path.
+func (d *daemonServer) putFile(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    spec := core.FileSpec{
+        Path:   q.Get("path"),
+        Mode:   q.Get("mode"),
+        Owner:  q.Get("owner"),
+        SHA256: strings.ToLower(r.Header.Get("X-Content-Sha256")),
+    }
+    path, err := d.files.resolve(spec.Path, false)
+    if err != nil {
+        fileError(w, err)
+        return
+    }
+    bits := uint64(0o644)
+    if spec.Mode != "" {
+        bits, err = strconv.ParseUint(spec.Mode, 8, 32)
+        if err != nil || bits > 0o7777 {
+            http.Error(w, "invalid mode", http.StatusBadRequest)
+            return
+        }
+        if bits&0o6000 != 0 && !d.files.AllowSetID {
+            http.Error(w, "setuid and setgid modes are not allowed", http.StatusForbidden)
+            return
+        }
+    }
+    uid, gid, err := lookupOwner(spec.Owner)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if !d.files.ownerAllowed(uid, gid) {
+        http.Error(w, fmt.Sprintf("owner %q is not allowed", spec.Owner), http.StatusForbidden)
+        return
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+    if err != nil {
+        fileError(w, err)
+        return
+    }
+    defer os.Remove(tmp.Name())
+    h := sha256.New()
+    n, err := io.Copy(io.MultiWriter(tmp, h), http.MaxBytesReader(w, r.Body, d.files.MaxBytes))
+    if closeErr := tmp.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        http.Error(w, "upload failed: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+    sum := hex.EncodeToString(h.Sum(nil))
+    if spec.SHA256 != "" && spec.SHA256 != sum {
+        http.Error(w, fmt.Sprintf("checksum mismatch: got %s", sum), http.StatusBadRequest)
+        return
+    }
+    // Chown first: it clears the setuid and setgid bits.
+    if uid >= 0 || gid >= 0 {
+        if err := os.Chown(tmp.Name(), uid, gid); err != nil {
+            fileError(w, err)
+            return
+        }
+    }
+    if err := os.Chmod(tmp.Name(), fileModeFromUnix(bits)); err != nil {
+        fileError(w, err)
+        return
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        fileError(w, err)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(core.FileInfo{
+        Path:   path,
+        Size:   n,
+        SHA256: sum,
+        Mode:   fmt.Sprintf("%04o", bits),
+    })
+}
+
+// fileModeFromUnix converts chmod's mode bits into an os.FileMode, which
+// keeps setuid, setgid and sticky elsewhere.
+func fileModeFromUnix(bits uint64) os.FileMode {
+    mode := os.FileMode(bits & 0o777)
+    if bits&0o4000 != 0 {
+        mode |= os.ModeSetuid
+    }
+    if bits&0o2000 != 0 {
+        mode |= os.ModeSetgid
+    }
+    if bits&0o1000 != 0 {
+        mode |= os.ModeSticky
+    }
+    return mode
+}
+
+// lookupOwner turns "user[:group]" (names or ids) into ids; -1 means unchanged.
+func lookupOwner(owner string) (int, int, error) {
+    if owner == "" {
+        return -1, -1, nil
+    }
+    userPart, groupPart, _ := strings.Cut(owner, ":")
+    uid, gid := -1, -1
+    if userPart != "" {
+        id, err := strconv.Atoi(userPart)
+        if err != nil {
+            u, lookupErr := user.Lookup(userPart)
+            if lookupErr != nil {
+                return 0, 0, fmt.Errorf("unknown user %q", userPart)
+            }
+            id, _ = strconv.Atoi(u.Uid)
+            if groupPart == "" {
+                gid, _ = strconv.Atoi(u.Gid)
+            }
+        }
+        uid = id
+    }
+    if groupPart != "" {
+        id, err := strconv.Atoi(groupPart)
+        if err != nil {
+            g, lookupErr := user.LookupGroup(groupPart)
+            if lookupErr != nil {
+                return 0, 0, fmt.Errorf("unknown group %q", groupPart)
+            }
+            id, _ = strconv.Atoi(g.Gid)
+        }
+        gid = id
+    }
+    return uid, gid, nil
+}
+
+func fileError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, errPathNotAllowed), errors.Is(err, os.ErrPermission):
+        http.Error(w, err.Error(), http.StatusForbidden)
+    case errors.Is(err, os.ErrNotExist):
+        http.Error(w, "not found", http.StatusNotFound)
+    default:
+        http.Error(w, err.Error(), http.StatusBadRequest)
+    }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func putTestFile(t *testing.T, d *daemonServer, path, mode, owner string) *httptest.ResponseRecorder {
+    t.Helper()
+    q := url.Values{"path": {path}, "mode": {mode}, "owner": {owner}}
+    r := httptest.NewRequest(http.MethodPut, "/api/v1/files?"+q.Encode(), strings.NewReader("#!/bin/sh\n"))
+    w := httptest.NewRecorder()
+    d.handleFiles(w, r)
+    return w
+}
+
+func TestPutFileRejectsSetIDModes(t *testing.T) {
+    root := t.TempDir()
+    d := &daemonServer{files: filePolicy{Roots: []string{root}, MaxBytes: 1 << 20}}
+    path := filepath.Join(root, "tool")
+    for _, mode := range []string{"4755", "2755", "6755"} {
+        if w := putTestFile(t, d, path, mode, ""); w.Code != http.StatusForbidden {
+            t.Errorf("mode %s: status %d, want 403", mode, w.Code)
+        }
+    }
+    if _, err := os.Stat(path); !os.IsNotExist(err) {
+        t.Fatalf("rejected upload left a file: %v", err)
+    }
+    if w := putTestFile(t, d, path, "1755", ""); w.Code != http.StatusOK {
+        t.Fatalf("sticky mode: status %d: %s", w.Code, w.Body)
+    }
+
+    d.files.AllowSetID = true
+    if w := putTestFile(t, d, path, "4755", ""); w.Code != http.StatusOK {
+        t.Fatalf("setuid with the policy: status %d: %s", w.Code, w.Body)
+    }
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if info.Mode()&os.ModeSetuid == 0 || info.Mode().Perm() != 0o755 {
+        t.Errorf("mode = %v, want setuid 0755", info.Mode())
+    }
+}
+
+func TestPutFileOwnerAllowlist(t *testing.T) {
+    root := t.TempDir()
+    d := &daemonServer{files: filePolicy{Roots: []string{root}, MaxBytes: 1 << 20}}
+    path := filepath.Join(root, "config")
+    self := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+    if w := putTestFile(t, d, path, "", self); w.Code != http.StatusForbidden {
+        t.Fatalf("owner without an allowlist: status %d, want 403", w.Code)
+    }
+    if w := putTestFile(t, d, path, "", ""); w.Code != http.StatusOK {
+        t.Fatalf("no owner: status %d: %s", w.Code, w.Body)
+    }
+
+    d.files.UIDs = map[int]bool{os.Getuid(): true}
+    d.files.GIDs = map[int]bool{os.Getgid(): true}
+    if w := putTestFile(t, d, path, "", self); w.Code != http.StatusOK {
+        t.Fatalf("allowed owner: status %d: %s", w.Code, w.Body)
+    }
+    other := strconv.Itoa(os.Getuid() + 1)
+    for _, owner := range []string{other, ":" + strconv.Itoa(os.Getgid()+1), strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()+1)} {
+        if w := putTestFile(t, d, path, "", owner); w.Code != http.StatusForbidden {
+            t.Errorf("owner %s: status %d, want 403", owner, w.Code)
+        }
+    }
+}
+
+func TestLoadFilePolicyOwners(t *testing.T) {
+    t.Setenv("DAEMON_FILE_ROOTS", t.TempDir())
+    t.Setenv("DAEMON_FILE_OWNERS", "1001, 1002:1003, :1004, no-such-user-here")
+    p := loadFilePolicy()
+    for _, tc := range []struct {
+        uid, gid int
+        want     bool
+    }{
+        {1001, -1, true},
+        {1002, 1003, true},
+        {1001, 1004, true},
+        {-1, 1004, true},
+        {-1, -1, true},
+        {1003, -1, false},
+        {1001, 1001, false},
+        {0, 0, false},
+    } {
+        if got := p.ownerAllowed(tc.uid, tc.gid); got != tc.want {
+            t.Errorf("ownerAllowed(%d, %d) = %v, want %v", tc.uid, tc.gid, got, tc.want)
+        }
+    }
+}
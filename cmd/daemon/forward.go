@@ -0,0 +1,71 @@
+package main
+
+import (
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// forwardPolicy lists the local ports tunnels may reach, from
+// DAEMON_FORWARD_PORTS ("8888,6006,8000-8100"). Empty disables forwarding.
+type forwardPolicy struct {
+    ranges [][2]int
+}
+
+func loadForwardPolicy() forwardPolicy {
+    var p forwardPolicy
+    for _, part := range strings.Split(os.Getenv("DAEMON_FORWARD_PORTS"), ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        lo, hi, isRange := strings.Cut(part, "-")
+        from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+        to, err2 := from, error(nil)
+        if isRange {
+            to, err2 = strconv.Atoi(strings.TrimSpace(hi))
+        }
+        if err1 != nil || err2 != nil || from < 1 || to > 65535 || from > to {
+            log.Printf("ignoring invalid DAEMON_FORWARD_PORTS entry %q", part)
+            continue
+        }
+        p.ranges = append(p.ranges, [2]int{from, to})
+    }
+    return p
+}
+
+func (p forwardPolicy) allows(port int) bool {
+    for _, r := range p.ranges {
+        if port >= r[0] && port <= r[1] {
+            return true
+        }
+    }
+    return false
+}
+
+// handleForward connects to an allowed port on loopback and relays it over
+// a WebSocket as binary frames.
+func (d *daemonServer) handleForward(w http.ResponseWriter, r *http.Request) {
+    port, err := strconv.Atoi(r.URL.Query().Get("port"))
+    if err != nil || !d.forward.allows(port) {
+        http.Error(w, "port is not forwardable", http.StatusForbidden)
+        return
+    }
+    conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), 5*time.Second)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadGateway)
+        return
+    }
+    ws, err := wsUpgrader.Upgrade(w, r, nil)
+    if err != nil {
+        conn.Close()
+        return
+    }
+    core.PipeWebSocket(ws, conn)
+}
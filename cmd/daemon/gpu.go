@@ -0,0 +1,217 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    _ "embed"
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "time"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// gpuProvider reads this host's GPU telemetry.
+type gpuProvider interface {
+    name() string
+    sample(ctx context.Context) (core.GPUSample, error)
+}
+
+// defaultGPUFixture is what the fake provider reports unless
+// DAEMON_GPU_FIXTURE names another capture; fake-rocm reports
+// defaultROCmFixture, eight MI250 GCDs.
+//
+//go:embed testdata/nvidia-smi.csv
+var defaultGPUFixture []byte
+
+//go:embed testdata/rocm-smi.json
+var defaultROCmFixture []byte
+
+// The fixtures' process lists: nvidia-smi's compute apps, and rocm-smi's
+// pids and pid GPUs.
+var (
+    //go:embed testdata/nvidia-smi-apps.csv
+    defaultGPUAppsFixture []byte
+    //go:embed testdata/rocm-smi-pids.json
+    defaultROCmPidsFixture []byte
+    //go:embed testdata/rocm-smi-pidgpus.json
+    defaultROCmPidGPUsFixture []byte
+)
+
+// loadGPUProvider picks the telemetry source from DAEMON_GPU_PROVIDER:
+// "nvml", "nvidia-smi", "rocm-smi", "fake" or "fake-rocm" (a captured
+// output, for machines without GPUs), "none", or "auto", the default, which
+// takes NVML if the daemon was built with it and the library loads, then
+// nvidia-smi or rocm-smi, whichever is on the PATH. A nil provider means the
+// host reports no GPUs.
+func loadGPUProvider() gpuProvider {
+    var p gpuProvider
+    var err error
+    switch mode := envOr("DAEMON_GPU_PROVIDER", "auto"); mode {
+    case "none":
+        return nil
+    case "nvml":
+        p, err = newNVMLProvider()
+    case "nvidia-smi":
+        p, err = newNvidiaSMIProvider()
+    case "rocm-smi":
+        p, err = newROCmSMIProvider()
+    case "fake":
+        p = newFakeGPUProvider(defaultGPUFixture, defaultGPUAppsFixture)
+    case "fake-rocm":
+        p = newFakeGPUProvider(defaultROCmFixture, defaultROCmPidsFixture, defaultROCmPidGPUsFixture)
+    case "auto":
+        for _, probe := range []func() (gpuProvider, error){newNVMLProvider, newNvidiaSMIProvider, newROCmSMIProvider} {
+            if p, err = probe(); err == nil {
+                break
+            }
+        }
+        if err != nil {
+            return nil
+        }
+    default:
+        err = errors.New("unknown provider " + mode)
+    }
+    if err != nil {
+        log.Printf("GPU telemetry disabled: %v", err)
+        return nil
+    }
+    log.Printf("GPU telemetry from %s", p.name())
+    return p
+}
+
+// handleGPU reports a GPU sample taken now.
+func (d *daemonServer) handleGPU(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    if d.gpu == nil {
+        http.Error(w, "no GPU telemetry on this node", http.StatusNotFound)
+        return
+    }
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    sample, err := d.gpu.sample(ctx)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    attributeGPUProcesses(&sample, d.runs)
+    sample.Timestamp = time.Now().Unix()
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(sample)
+}
+
+// nvidiaSMIProvider queries the nvidia-smi binary.
+type nvidiaSMIProvider struct {
+    path string
+}
+
+func newNvidiaSMIProvider() (gpuProvider, error) {
+    path, err := exec.LookPath("nvidia-smi")
+    if err != nil {
+        return nil, err
+    }
+    return nvidiaSMIProvider{path: path}, nil
+}
+
+func (p nvidiaSMIProvider) name() string { return p.path }
+
+func (p nvidiaSMIProvider) sample(ctx context.Context) (core.GPUSample, error) {
+    out, err := exec.CommandContext(ctx, p.path, "--query-gpu="+nvidiaSMIQuery, "--format=csv,noheader,nounits").Output()
+    if err != nil {
+        var exitErr *exec.ExitError
+        if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+            return core.GPUSample{}, errors.New("nvidia-smi: " + string(exitErr.Stderr))
+        }
+        return core.GPUSample{}, err
+    }
+    sample, err := parseNvidiaSMI(out)
+    if err != nil {
+        return sample, err
+    }
+    apps, err := exec.CommandContext(ctx, p.path, "--query-compute-apps="+nvidiaSMIAppsQuery, "--format=csv,noheader,nounits").Output()
+    if err != nil {
+        // The readings stand without the process list.
+        log.Printf("nvidia-smi compute apps: %v", err)
+        return sample, nil
+    }
+    return sample, parseNvidiaSMIApps(apps, &sample)
+}
+
+// fakeGPUProvider replays a captured nvidia-smi or rocm-smi output, re-read
+// on every sample so it can be changed under a running daemon.
+// DAEMON_GPU_FIXTURE replaces the built-in readings, and
+// DAEMON_GPU_PROCESS_FIXTURE, a colon-separated list of the tool's process
+// captures, the process lists.
+type fakeGPUProvider struct {
+    fixture   string
+    processes []string
+    builtin   [][]byte
+}
+
+func newFakeGPUProvider(builtin ...[]byte) fakeGPUProvider {
+    p := fakeGPUProvider{fixture: os.Getenv("DAEMON_GPU_FIXTURE"), builtin: builtin}
+    if v := os.Getenv("DAEMON_GPU_PROCESS_FIXTURE"); v != "" {
+        p.processes = filepath.SplitList(v)
+    }
+    return p
+}
+
+func (p fakeGPUProvider) name() string {
+    if p.fixture == "" {
+        return "built-in fixture"
+    }
+    return "fixture " + p.fixture
+}
+
+func (p fakeGPUProvider) sample(ctx context.Context) (core.GPUSample, error) {
+    captures := p.builtin
+    if p.fixture != "" {
+        out, err := os.ReadFile(p.fixture)
+        if err != nil {
+            return core.GPUSample{}, err
+        }
+        // The built-in process lists belong to the built-in readings.
+        captures = [][]byte{out}
+    }
+    if p.processes != nil {
+        captures = captures[:1:1]
+        for _, path := range p.processes {
+            out, err := os.ReadFile(path)
+            if err != nil {
+                return core.GPUSample{}, err
+            }
+            captures = append(captures, out)
+        }
+    }
+    return parseGPUCapture(captures[0], captures[1:]...)
+}
+
+// parseGPUCapture tells the two tools' outputs apart by shape: rocm-smi
+// writes JSON objects, nvidia-smi CSV lines. processes are the tool's
+// process captures, if any: nvidia-smi's compute apps, or rocm-smi's pids
+// and pid GPUs.
+func parseGPUCapture(out []byte, processes ...[]byte) (core.GPUSample, error) {
+    if bytes.HasPrefix(bytes.TrimSpace(out), []byte("{")) {
+        sample, err := parseROCmSMI(out)
+        if err != nil || len(processes) == 0 {
+            return sample, err
+        }
+        if len(processes) != 2 {
+            return sample, errors.New("rocm-smi process fixture needs the pids and pid GPUs captures")
+        }
+        return sample, parseROCmPids(processes[0], processes[1], &sample)
+    }
+    sample, err := parseNvidiaSMI(out)
+    if err != nil || len(processes) == 0 {
+        return sample, err
+    }
+    return sample, parseNvidiaSMIApps(processes[0], &sample)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// nvidiaSMIQuery is the --query-gpu field list parseNvidiaSMI expects, in
+// order.
+const nvidiaSMIQuery = "index,name,uuid,utilization.gpu,memory.used,memory.total,temperature.gpu,power.draw"
+
+// parseNvidiaSMI reads every GPU of nvidia-smi's --query-gpu=nvidiaSMIQuery
+// CSV output (noheader, nounits). Readings the device does not support,
+// which nvidia-smi prints as [N/A] or [Not Supported], are left zero.
+func parseNvidiaSMI(out []byte) (core.GPUSample, error) {
+    var devices []core.GPUDevice
+    scanner := bufio.NewScanner(bytes.NewReader(out))
+    for line := 1; scanner.Scan(); line++ {
+        text := strings.TrimSpace(scanner.Text())
+        if text == "" {
+            continue
+        }
+        parts := strings.Split(text, ",")
+        if len(parts) != 8 {
+            return core.GPUSample{}, fmt.Errorf("line %d: want 8 fields, got %d", line, len(parts))
+        }
+        for i := range parts {
+            parts[i] = strings.TrimSpace(parts[i])
+        }
+        index, err := strconv.Atoi(parts[0])
+        if err != nil {
+            return core.GPUSample{}, fmt.Errorf("line %d: index: %w", line, err)
+        }
+        d := core.GPUDevice{Index: index, Vendor: core.GPUVendorNVIDIA, Name: parts[1], UUID: parts[2]}
+        var errs []error
+        d.Utilization = smiFloat(parts[3], &errs)
+        d.MemoryUsedMB = int(smiFloat(parts[4], &errs))
+        d.MemoryTotalMB = int(smiFloat(parts[5], &errs))
+        d.TemperatureC = smiFloat(parts[6], &errs)
+        d.PowerW = smiFloat(parts[7], &errs)
+        if err := errors.Join(errs...); err != nil {
+            return core.GPUSample{}, fmt.Errorf("line %d: %w", line, err)
+        }
+        devices = append(devices, d)
+    }
+    if err := scanner.Err(); err != nil {
+        return core.GPUSample{}, err
+    }
+    if len(devices) == 0 {
+        return core.GPUSample{}, errors.New("no GPU lines found")
+    }
+    return core.NewGPUSample(devices), nil
+}
+
+// smiFloat parses a numeric nvidia-smi field, treating its bracketed
+// placeholders as zero.
+func smiFloat(field string, errs *[]error) float64 {
+    if strings.HasPrefix(field, "[") {
+        return 0
+    }
+    v, err := strconv.ParseFloat(field, 64)
+    if err != nil {
+        *errs = append(*errs, err)
+    }
+    return v
+}
+
+// nvidiaSMIAppsQuery is the --query-compute-apps field list
+// parseNvidiaSMIApps expects, in order.
+const nvidiaSMIAppsQuery = "gpu_uuid,pid,process_name,used_memory"
+
+// parseNvidiaSMIApps attaches the compute processes of nvidia-smi's
+// --query-compute-apps=nvidiaSMIAppsQuery CSV output (noheader, nounits) to
+// the sample's devices, matched by UUID. nvidia-smi prints a line per process
+// and device, so a process spanning GPUs appears on each.
+func parseNvidiaSMIApps(out []byte, sample *core.GPUSample) error {
+    byUUID := map[string]*core.GPUDevice{}
+    for i := range sample.Devices {
+        byUUID[sample.Devices[i].UUID] = &sample.Devices[i]
+    }
+    scanner := bufio.NewScanner(bytes.NewReader(out))
+    for line := 1; scanner.Scan(); line++ {
+        text := strings.TrimSpace(scanner.Text())
+        if text == "" || strings.HasPrefix(text, "No running") {
+            continue
+        }
+        // Process names may contain commas; the other fields never do.
+        parts := strings.Split(text, ",")
+        if len(parts) < 4 {
+            return fmt.Errorf("line %d: want 4 fields, got %d", line, len(parts))
+        }
+        for i := range parts {
+            parts[i] = strings.TrimSpace(parts[i])
+        }
+        pid, err := strconv.Atoi(parts[1])
+        if err != nil {
+            return fmt.Errorf("line %d: pid: %w", line, err)
+        }
+        var errs []error
+        mem := smiFloat(parts[len(parts)-1], &errs)
+        if err := errors.Join(errs...); err != nil {
+            return fmt.Errorf("line %d: %w", line, err)
+        }
+        d, ok := byUUID[parts[0]]
+        if !ok {
+            continue
+        }
+        d.Processes = append(d.Processes, core.GPUProcess{
+            PID:          pid,
+            Name:         strings.Join(parts[2:len(parts)-1], ","),
+            MemoryUsedMB: int(mem),
+        })
+    }
+    return scanner.Err()
+}
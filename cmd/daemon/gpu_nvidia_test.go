@@ -0,0 +1,160 @@
+package main
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+    t.Helper()
+    out, err := os.ReadFile(filepath.Join("testdata", name))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return out
+}
+
+func TestParseNvidiaSMIFixture(t *testing.T) {
+    sample, err := parseNvidiaSMI(readFixture(t, "nvidia-smi.csv"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(sample.Devices) != 8 {
+        t.Fatalf("got %d devices, want 8", len(sample.Devices))
+    }
+    want := core.GPUDevice{
+        Index:         0,
+        Vendor:        core.GPUVendorNVIDIA,
+        Name:          "NVIDIA A100-SXM4-80GB",
+        UUID:          "GPU-5d2f6c1e-8a3b-4f07-9c4e-1b7a2d9e0f31",
+        Utilization:   87,
+        MemoryUsedMB:  61234,
+        MemoryTotalMB: 81920,
+        TemperatureC:  64,
+        PowerW:        312.45,
+    }
+    if !reflect.DeepEqual(sample.Devices[0], want) {
+        t.Errorf("device 0 = %+v, want %+v", sample.Devices[0], want)
+    }
+    for i, d := range sample.Devices {
+        if d.Index != i {
+            t.Errorf("device %d has index %d", i, d.Index)
+        }
+    }
+    // GPU 7 reports its power draw as [N/A].
+    if d := sample.Devices[7]; d.PowerW != 0 || d.Utilization != 78 {
+        t.Errorf("device 7 = %+v, want no power reading", d)
+    }
+    if sample.Utilization != 50.625 || sample.MemoryMB != 288930 || sample.MemoryTotalMB != 8*81920 {
+        t.Errorf("aggregates = %.3f%%, %d/%d MB", sample.Utilization, sample.MemoryMB, sample.MemoryTotalMB)
+    }
+}
+
+func TestParseNvidiaSMIRejectsMalformedOutput(t *testing.T) {
+    for name, out := range map[string]string{
+        "empty":          "\n\n",
+        "missing fields": "0, NVIDIA A100, GPU-1, 87, 61234",
+        "bad index":      "x, NVIDIA A100, GPU-1, 87, 61234, 81920, 64, 312.45",
+        "bad reading":    "0, NVIDIA A100, GPU-1, busy, 61234, 81920, 64, 312.45",
+    } {
+        if _, err := parseNvidiaSMI([]byte(out)); err == nil {
+            t.Errorf("%s: parsed without error", name)
+        }
+    }
+}
+
+func TestFakeGPUProvider(t *testing.T) {
+    ctx := context.Background()
+    t.Setenv("DAEMON_GPU_FIXTURE", "")
+    t.Setenv("DAEMON_GPU_PROCESS_FIXTURE", "")
+    builtin, err := newFakeGPUProvider(defaultGPUFixture, defaultGPUAppsFixture).sample(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(builtin.Devices) != 8 || len(builtin.Devices[4].Processes) != 2 {
+        t.Fatalf("built-in fixture: %d devices, %d processes on GPU 4", len(builtin.Devices), len(builtin.Devices[4].Processes))
+    }
+
+    // A fixture file replaces the built-in capture and is re-read on every
+    // sample.
+    path := filepath.Join(t.TempDir(), "smi.csv")
+    write := func(util string) {
+        line := "0, NVIDIA L4, GPU-x, " + util + ", 100, 23034, 40, 30\n"
+        if err := os.WriteFile(path, []byte(line), 0o600); err != nil {
+            t.Fatal(err)
+        }
+    }
+    write("10")
+    t.Setenv("DAEMON_GPU_FIXTURE", path)
+    p := newFakeGPUProvider(defaultGPUFixture, defaultGPUAppsFixture)
+    if !strings.Contains(p.name(), path) {
+        t.Errorf("name() = %q, want the fixture path", p.name())
+    }
+    for _, util := range []string{"10", "95"} {
+        write(util)
+        sample, err := p.sample(ctx)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(sample.Devices) != 1 || sample.Devices[0].Utilization != map[string]float64{"10": 10, "95": 95}[util] {
+            t.Fatalf("sample = %+v, want the fixture's one GPU at %s%%", sample.Devices, util)
+        }
+        if sample.Devices[0].Processes != nil {
+            t.Errorf("built-in processes attached to a custom fixture")
+        }
+    }
+
+    t.Setenv("DAEMON_GPU_FIXTURE", filepath.Join(t.TempDir(), "missing.csv"))
+    if _, err := newFakeGPUProvider(defaultGPUFixture).sample(ctx); err == nil {
+        t.Error("missing fixture sampled without error")
+    }
+}
+func TestParseNvidiaSMIAppsFixture(t *testing.T) {
+    sample, err := parseNvidiaSMI(readFixture(t, "nvidia-smi.csv"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := parseNvidiaSMIApps(readFixture(t, "nvidia-smi-apps.csv"), &sample); err != nil {
+        t.Fatal(err)
+    }
+    want := map[int][]core.GPUProcess{
+        // One process spanning two GPUs is listed on each.
+        0: {{PID: 48211, Name: "/opt/conda/bin/python3", MemoryUsedMB: 60798}},
+        1: {{PID: 48211, Name: "/opt/conda/bin/python3", MemoryUsedMB: 73576}},
+        4: {
+            {PID: 51877, Name: "/usr/bin/python3.10", MemoryUsedMB: 78184},
+            {PID: 51902, Name: "/usr/local/bin/tritonserver", MemoryUsedMB: 1246},
+        },
+        5: {{PID: 52330, Name: "/home/mlops/.venv/bin/python", MemoryUsedMB: 20044}},
+        // used_memory is [N/A] without MIG accounting.
+        7: {{PID: 50114, Name: "/usr/bin/ollama"}},
+    }
+    for _, d := range sample.Devices {
+        if !reflect.DeepEqual(d.Processes, want[d.Index]) {
+            t.Errorf("device %d processes = %+v, want %+v", d.Index, d.Processes, want[d.Index])
+        }
+    }
+}
+
+func TestParseNvidiaSMIAppsEdgeCases(t *testing.T) {
+    sample := core.NewGPUSample([]core.GPUDevice{{Index: 0, UUID: "GPU-a"}})
+    out := "No running processes found\n" +
+        "GPU-a, 10, python -c print(1,2), 512\n" +
+        "GPU-gone, 11, orphan, 64\n"
+    if err := parseNvidiaSMIApps([]byte(out), &sample); err != nil {
+        t.Fatal(err)
+    }
+    want := []core.GPUProcess{{PID: 10, Name: "python -c print(1,2)", MemoryUsedMB: 512}}
+    if !reflect.DeepEqual(sample.Devices[0].Processes, want) {
+        t.Errorf("processes = %+v, want %+v", sample.Devices[0].Processes, want)
+    }
+    if err := parseNvidiaSMIApps([]byte("GPU-a, pid, python, 1"), &sample); err == nil {
+        t.Error("bad pid parsed without error")
+    }
+}
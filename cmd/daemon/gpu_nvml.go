@@ -0,0 +1,179 @@
+//go:build nvml && linux
+
+package main
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+
+typedef int nvmlReturn_t;
+typedef void *nvmlDevice_t;
+typedef struct { unsigned int gpu; unsigned int memory; } nvmlUtilization_t;
+typedef struct { unsigned long long total; unsigned long long free; unsigned long long used; } nvmlMemory_t;
+typedef struct {
+    unsigned int pid;
+    unsigned long long usedGpuMemory;
+    unsigned int gpuInstanceId;
+    unsigned int computeInstanceId;
+} nvmlProcessInfo_t;
+
+static nvmlReturn_t (*nvml_init)(void);
+static nvmlReturn_t (*nvml_count)(unsigned int *);
+static nvmlReturn_t (*nvml_handle)(unsigned int, nvmlDevice_t *);
+static nvmlReturn_t (*nvml_util)(nvmlDevice_t, nvmlUtilization_t *);
+static nvmlReturn_t (*nvml_mem)(nvmlDevice_t, nvmlMemory_t *);
+static nvmlReturn_t (*nvml_name)(nvmlDevice_t, char *, unsigned int);
+static nvmlReturn_t (*nvml_uuid)(nvmlDevice_t, char *, unsigned int);
+static nvmlReturn_t (*nvml_temp)(nvmlDevice_t, int, unsigned int *);
+static nvmlReturn_t (*nvml_power)(nvmlDevice_t, unsigned int *);
+static nvmlReturn_t (*nvml_procs)(nvmlDevice_t, unsigned int *, nvmlProcessInfo_t *);
+
+// nvml_load opens the driver's NVML library and initialises it: -1 if the
+// library is missing, -2 if it lacks a symbol, else nvmlInit's result.
+static int nvml_load(void) {
+    void *lib = dlopen("libnvidia-ml.so.1", RTLD_NOW | RTLD_GLOBAL);
+    if (!lib) return -1;
+    nvml_init = dlsym(lib, "nvmlInit_v2");
+    nvml_count = dlsym(lib, "nvmlDeviceGetCount_v2");
+    nvml_handle = dlsym(lib, "nvmlDeviceGetHandleByIndex_v2");
+    nvml_util = dlsym(lib, "nvmlDeviceGetUtilizationRates");
+    nvml_mem = dlsym(lib, "nvmlDeviceGetMemoryInfo");
+    nvml_name = dlsym(lib, "nvmlDeviceGetName");
+    nvml_uuid = dlsym(lib, "nvmlDeviceGetUUID");
+    nvml_temp = dlsym(lib, "nvmlDeviceGetTemperature");
+    nvml_power = dlsym(lib, "nvmlDeviceGetPowerUsage");
+    // Optional: drivers before 450 have neither, and report no processes.
+    nvml_procs = dlsym(lib, "nvmlDeviceGetComputeRunningProcesses_v3");
+    if (!nvml_procs) nvml_procs = dlsym(lib, "nvmlDeviceGetComputeRunningProcesses_v2");
+    if (!nvml_init || !nvml_count || !nvml_handle || !nvml_util || !nvml_mem ||
+        !nvml_name || !nvml_uuid || !nvml_temp || !nvml_power) return -2;
+    return nvml_init();
+}
+
+static int nvml_device_count(unsigned int *n) { return nvml_count(n); }
+
+#define GPU_MAX_PROCS 64
+
+typedef struct {
+    char name[96];
+    char uuid[96];
+    unsigned int util;
+    unsigned long long mem_used;
+    unsigned long long mem_total;
+    unsigned int temp_c;
+    unsigned int power_mw;
+    unsigned int nprocs;
+    unsigned int pids[GPU_MAX_PROCS];
+    unsigned long long proc_mem[GPU_MAX_PROCS];
+} gpu_reading;
+
+// nvml_device_sample reads device i. Temperature, power and the process
+// list are optional: devices that do not support them read zero.
+static int nvml_device_sample(unsigned int i, gpu_reading *r) {
+    nvmlDevice_t dev;
+    nvmlUtilization_t u;
+    nvmlMemory_t m;
+    int rc = nvml_handle(i, &dev);
+    if (rc) return rc;
+    if ((rc = nvml_name(dev, r->name, sizeof r->name))) return rc;
+    if ((rc = nvml_uuid(dev, r->uuid, sizeof r->uuid))) return rc;
+    if ((rc = nvml_util(dev, &u))) return rc;
+    if ((rc = nvml_mem(dev, &m))) return rc;
+    r->util = u.gpu;
+    r->mem_used = m.used;
+    r->mem_total = m.total;
+    if (nvml_temp(dev, 0, &r->temp_c)) r->temp_c = 0;
+    if (nvml_power(dev, &r->power_mw)) r->power_mw = 0;
+    r->nprocs = 0;
+    if (nvml_procs) {
+        nvmlProcessInfo_t procs[GPU_MAX_PROCS];
+        unsigned int n = GPU_MAX_PROCS;
+        if (!nvml_procs(dev, &n, procs)) {
+            for (unsigned int j = 0; j < n; j++) {
+                r->pids[j] = procs[j].pid;
+                r->proc_mem[j] = procs[j].usedGpuMemory;
+            }
+            r->nprocs = n;
+        }
+    }
+    return 0;
+}
+*/
+import "C"
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math"
+    "sync"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+var (
+    nvmlOnce sync.Once
+    nvmlErr  error
+)
+
+// nvmlProvider reads telemetry straight from the driver through NVML,
+// loaded at runtime so the daemon still starts on hosts without it.
+type nvmlProvider struct{}
+
+func newNVMLProvider() (gpuProvider, error) {
+    nvmlOnce.Do(func() {
+        switch rc := C.nvml_load(); rc {
+        case 0:
+        case -1:
+            nvmlErr = errors.New("libnvidia-ml.so.1 not found")
+        case -2:
+            nvmlErr = errors.New("libnvidia-ml.so.1 lacks NVML v2 symbols")
+        default:
+            nvmlErr = fmt.Errorf("nvmlInit: error %d", int(rc))
+        }
+    })
+    if nvmlErr != nil {
+        return nil, nvmlErr
+    }
+    return nvmlProvider{}, nil
+}
+
+func (nvmlProvider) name() string { return "NVML" }
+
+func (nvmlProvider) sample(ctx context.Context) (core.GPUSample, error) {
+    var n C.uint
+    if rc := C.nvml_device_count(&n); rc != 0 {
+        return core.GPUSample{}, fmt.Errorf("nvmlDeviceGetCount: error %d", int(rc))
+    }
+    if n == 0 {
+        return core.GPUSample{}, errors.New("no GPUs found")
+    }
+    devices := make([]core.GPUDevice, 0, int(n))
+    for i := C.uint(0); i < n; i++ {
+        var r C.gpu_reading
+        if rc := C.nvml_device_sample(i, &r); rc != 0 {
+            return core.GPUSample{}, fmt.Errorf("nvml device %d: error %d", int(i), int(rc))
+        }
+        d := core.GPUDevice{
+            Index:         int(i),
+            Vendor:        core.GPUVendorNVIDIA,
+            Name:          C.GoString(&r.name[0]),
+            UUID:          C.GoString(&r.uuid[0]),
+            Utilization:   float64(r.util),
+            MemoryUsedMB:  int(r.mem_used >> 20),
+            MemoryTotalMB: int(r.mem_total >> 20),
+            TemperatureC:  float64(r.temp_c),
+            PowerW:        float64(r.power_mw) / 1000,
+        }
+        for j := 0; j < int(r.nprocs); j++ {
+            mem := uint64(r.proc_mem[j])
+            if mem == math.MaxUint64 {
+                // NVML_VALUE_NOT_AVAILABLE, e.g. under MIG.
+                mem = 0
+            }
+            d.Processes = append(d.Processes, core.GPUProcess{PID: int(r.pids[j]), MemoryUsedMB: int(mem >> 20)})
+        }
+        devices = append(devices, d)
+    }
+    return core.NewGPUSample(devices), nil
+}
@@ -0,0 +1,9 @@
+//go:build !nvml || !linux
+
+package main
+
+import "errors"
+
+func newNVMLProvider() (gpuProvider, error) {
+    return nil, errors.New("daemon built without NVML support (build tag nvml)")
+}
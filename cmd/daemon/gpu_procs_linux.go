@@ -0,0 +1,103 @@
+//go:build linux
+
+package main
+
+import (
+    "bytes"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// attributeGPUProcesses fills in what the GPU tools leave out of each
+// process from /proc: its owner, its name if the tool gave none, and the
+// execution it belongs to, see procExecutionID. PIDs are the host's, so this
+// needs the daemon in the host PID namespace; processes that have exited
+// since the sample are left as they are.
+func attributeGPUProcesses(sample *core.GPUSample, runs *execRegistry) {
+    users := map[string]string{}
+    for i := range sample.Devices {
+        for j := range sample.Devices[i].Processes {
+            p := &sample.Devices[i].Processes[j]
+            dir := filepath.Join("/proc", strconv.Itoa(p.PID))
+            if p.Name == "" {
+                if comm, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+                    p.Name = strings.TrimSpace(string(comm))
+                }
+            }
+            if uid, ok := procUID(dir); ok {
+                if _, seen := users[uid]; !seen {
+                    users[uid] = uid
+                    if u, err := user.LookupId(uid); err == nil {
+                        users[uid] = u.Username
+                    }
+                }
+                p.User = users[uid]
+            }
+            p.ExecutionID = procExecutionID(dir, runs)
+        }
+    }
+}
+
+// procUID returns the real uid from a process's status file.
+func procUID(dir string) (string, bool) {
+    status, err := os.ReadFile(filepath.Join(dir, "status"))
+    if err != nil {
+        return "", false
+    }
+    for _, line := range strings.Split(string(status), "\n") {
+        if rest, ok := strings.CutPrefix(line, "Uid:"); ok {
+            if fields := strings.Fields(rest); len(fields) > 0 {
+                return fields[0], true
+            }
+        }
+    }
+    return "", false
+}
+
+// procExecutionID returns the execution a process belongs to. A script can
+// set any environment for its children, so the run is found by the cgroup
+// the process is confined to; executionIDEnv is only trusted for runs that
+// have no cgroup, where there is nothing better to go on.
+func procExecutionID(dir string, runs *execRegistry) string {
+    if id, ok := runs.cgroupExecution(procCgroup(dir)); ok {
+        return id
+    }
+    if id := procEnvExecutionID(dir); id != "" && !runs.hasCgroup(id) {
+        return id
+    }
+    return ""
+}
+
+// procCgroup returns a process's cgroup v2 path from its cgroup file.
+func procCgroup(dir string) string {
+    raw, err := os.ReadFile(filepath.Join(dir, "cgroup"))
+    if err != nil {
+        return ""
+    }
+    for _, line := range strings.Split(string(raw), "\n") {
+        if name, ok := strings.CutPrefix(line, "0::"); ok {
+            return name
+        }
+    }
+    return ""
+}
+
+// procEnvExecutionID reads executionIDEnv from a process's environment.
+func procEnvExecutionID(dir string) string {
+    environ, err := os.ReadFile(filepath.Join(dir, "environ"))
+    if err != nil {
+        return ""
+    }
+    prefix := []byte(executionIDEnv + "=")
+    for _, kv := range bytes.Split(environ, []byte{0}) {
+        if id, ok := bytes.CutPrefix(kv, prefix); ok {
+            return string(id)
+        }
+    }
+    return ""
+}
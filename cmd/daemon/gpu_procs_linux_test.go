@@ -0,0 +1,55 @@
+//go:build linux
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// fakeProc writes a /proc/<pid> stand-in with the given cgroup and
+// environment files.
+func fakeProc(t *testing.T, cgroup, environ string) string {
+    t.Helper()
+    dir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "environ"), []byte(environ), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return dir
+}
+
+func TestProcExecutionID(t *testing.T) {
+    runs := &execRegistry{runs: map[string]*execRun{}, ttl: time.Hour}
+    for _, id := range []string{"exec-1", "exec-2", "exec-3"} {
+        runs.start(id)
+    }
+    runs.setCgroup("exec-1", "/sys/fs/cgroup/bastion/exec-1")
+    runs.setCgroup("exec-2", "/sys/fs/cgroup/bastion/exec-2")
+
+    env := func(id string) string { return "PATH=/bin\x00" + executionIDEnv + "=" + id + "\x00" }
+    for _, tc := range []struct {
+        name, cgroup, environ, want string
+    }{
+        {"own cgroup", "0::/bastion/exec-1\n", env("exec-1"), "exec-1"},
+        {"forged environment", "0::/bastion/exec-1\n", env("exec-2"), "exec-1"},
+        {"child cgroup", "0::/bastion/exec-2/inner\n", "", "exec-2"},
+        {"cgroup namespace", "0::/exec-2\n", "", "exec-2"},
+        {"claims a run with a cgroup from outside it", "0::/user.slice/session-1.scope\n", env("exec-1"), ""},
+        {"run without a cgroup", "0::/user.slice/session-1.scope\n", env("exec-3"), "exec-3"},
+        {"unattributed", "0::/user.slice/session-1.scope\n", "PATH=/bin\x00", ""},
+    } {
+        if got := procExecutionID(fakeProc(t, tc.cgroup, tc.environ), runs); got != tc.want {
+            t.Errorf("%s: procExecutionID = %q, want %q", tc.name, got, tc.want)
+        }
+    }
+
+    runs.setCgroup("exec-1", "")
+    if got := procExecutionID(fakeProc(t, "0::/user.slice\n", env("exec-1")), runs); got != "exec-1" {
+        t.Errorf("after exec-1's cgroup is removed: %q, want the environment's exec-1", got)
+    }
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "github.com/yourorg/boundless-bastion/cmd/internal/core"
+
+// attributeGPUProcesses needs /proc; elsewhere processes are reported as the
+// GPU tools list them.
+func attributeGPUProcesses(sample *core.GPUSample, runs *execRegistry) {}
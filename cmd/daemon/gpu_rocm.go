@@ -0,0 +1,205 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "os/exec"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// rocmSMIArgs asks rocm-smi for every reading parseROCmSMI uses, as JSON.
+var rocmSMIArgs = []string{
+    "--showproductname", "--showuniqueid", "--showuse", "--showmeminfo", "vram",
+    "--showtemp", "--showpower", "--json",
+}
+
+// rocmSMIProvider queries the rocm-smi binary on AMD hosts.
+type rocmSMIProvider struct {
+    path string
+}
+
+func newROCmSMIProvider() (gpuProvider, error) {
+    path, err := exec.LookPath("rocm-smi")
+    if err != nil {
+        return nil, err
+    }
+    return rocmSMIProvider{path: path}, nil
+}
+
+func (p rocmSMIProvider) name() string { return p.path }
+
+func (p rocmSMIProvider) sample(ctx context.Context) (core.GPUSample, error) {
+    out, err := exec.CommandContext(ctx, p.path, rocmSMIArgs...).Output()
+    if err != nil {
+        var exitErr *exec.ExitError
+        if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+            return core.GPUSample{}, errors.New("rocm-smi: " + string(exitErr.Stderr))
+        }
+        return core.GPUSample{}, err
+    }
+    sample, err := parseROCmSMI(out)
+    if err != nil {
+        return sample, err
+    }
+    // The readings stand without the process list.
+    pids, err := exec.CommandContext(ctx, p.path, "--showpids", "--json").Output()
+    if err != nil {
+        log.Printf("rocm-smi pids: %v", err)
+        return sample, nil
+    }
+    gpus, err := exec.CommandContext(ctx, p.path, "--showpidgpus", "--json").Output()
+    if err != nil {
+        log.Printf("rocm-smi pid gpus: %v", err)
+        return sample, nil
+    }
+    return sample, parseROCmPids(pids, gpus, &sample)
+}
+
+// parseROCmSMI reads every GPU of rocm-smi's JSON output, an object of
+// "cardN" entries (other keys, such as "system", are skipped) whose readings
+// are strings keyed by their rocm-smi labels. Each GCD of a multi-die part
+// such as the MI250 is a card of its own. Readings reported as N/A, like the
+// edge sensor and the second GCD's package power on an MI250, are left zero.
+func parseROCmSMI(out []byte) (core.GPUSample, error) {
+    var cards map[string]map[string]any
+    if err := json.Unmarshal(out, &cards); err != nil {
+        return core.GPUSample{}, fmt.Errorf("parse rocm-smi json: %w", err)
+    }
+    var devices []core.GPUDevice
+    for key, card := range cards {
+        index, err := strconv.Atoi(strings.TrimPrefix(key, "card"))
+        if !strings.HasPrefix(key, "card") || err != nil {
+            continue
+        }
+        var errs []error
+        field := func(labels ...string) float64 {
+            for _, label := range labels {
+                if v, ok := card[label]; ok {
+                    if f, ok := rocmFloat(v, &errs); ok {
+                        return f
+                    }
+                }
+            }
+            return 0
+        }
+        d := core.GPUDevice{
+            Index:       index,
+            Vendor:      core.GPUVendorAMD,
+            Name:        rocmString(card, "Card series", "Card model"),
+            UUID:        rocmString(card, "Unique ID"),
+            Utilization: field("GPU use (%)"),
+            // The edge sensor is the one nvidia-smi's reading compares to;
+            // parts without it report the junction.
+            TemperatureC: field("Temperature (Sensor edge) (C)", "Temperature (Sensor junction) (C)"),
+            // Older releases report the average, newer ones the current draw.
+            PowerW: field("Average Graphics Package Power (W)", "Current Socket Graphics Package Power (W)"),
+        }
+        d.MemoryUsedMB = int(field("VRAM Total Used Memory (B)") / (1 << 20))
+        d.MemoryTotalMB = int(field("VRAM Total Memory (B)") / (1 << 20))
+        if err := errors.Join(errs...); err != nil {
+            return core.GPUSample{}, fmt.Errorf("%s: %w", key, err)
+        }
+        devices = append(devices, d)
+    }
+    if len(devices) == 0 {
+        return core.GPUSample{}, errors.New("no GPU cards found")
+    }
+    sort.Slice(devices, func(i, j int) bool { return devices[i].Index < devices[j].Index })
+    return core.NewGPUSample(devices), nil
+}
+
+// rocmFloat parses a rocm-smi reading. ok is false for N/A and other
+// placeholders, so a fallback label can be tried.
+func rocmFloat(v any, errs *[]error) (float64, bool) {
+    switch v := v.(type) {
+    case float64:
+        return v, true
+    case string:
+        v = strings.TrimSpace(v)
+        if v == "" || strings.EqualFold(v, "N/A") {
+            return 0, false
+        }
+        f, err := strconv.ParseFloat(v, 64)
+        if err != nil {
+            *errs = append(*errs, err)
+            return 0, false
+        }
+        return f, true
+    }
+    return 0, false
+}
+
+// rocmString returns the first of labels the card reports.
+func rocmString(card map[string]any, labels ...string) string {
+    for _, label := range labels {
+        if v, ok := card[label].(string); ok && v != "" && !strings.EqualFold(v, "N/A") {
+            return v
+        }
+    }
+    return ""
+}
+
+// parseROCmPids attaches the KFD processes of rocm-smi's --showpids JSON to
+// the devices --showpidgpus places them on. Both are keyed "PID<n>" under
+// "system"; a --showpids entry reads "name, gpus, vram bytes, sdma, cu
+// occupancy" and a --showpidgpus one lists card indices. rocm-smi only
+// reports a process's VRAM in total, so it is split evenly across its GPUs.
+func parseROCmPids(pids, gpus []byte, sample *core.GPUSample) error {
+    var procs, placement struct {
+        System map[string]string `json:"system"`
+    }
+    if err := json.Unmarshal(pids, &procs); err != nil {
+        return fmt.Errorf("parse rocm-smi pids: %w", err)
+    }
+    if err := json.Unmarshal(gpus, &placement); err != nil {
+        return fmt.Errorf("parse rocm-smi pid gpus: %w", err)
+    }
+    byIndex := map[int]*core.GPUDevice{}
+    for i := range sample.Devices {
+        byIndex[sample.Devices[i].Index] = &sample.Devices[i]
+    }
+    keys := make([]string, 0, len(procs.System))
+    for key := range procs.System {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        pid, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(key, "PID")))
+        if err != nil {
+            continue
+        }
+        fields := strings.Split(procs.System[key], ",")
+        if len(fields) < 3 {
+            return fmt.Errorf("%s: want at least 3 fields, got %d", key, len(fields))
+        }
+        var errs []error
+        vram, _ := rocmFloat(fields[2], &errs)
+        if err := errors.Join(errs...); err != nil {
+            return fmt.Errorf("%s: %w", key, err)
+        }
+        indices := strings.FieldsFunc(placement.System[key], func(r rune) bool {
+            return r < '0' || r > '9'
+        })
+        if len(indices) == 0 {
+            continue
+        }
+        for _, v := range indices {
+            index, _ := strconv.Atoi(v)
+            if d, ok := byIndex[index]; ok {
+                d.Processes = append(d.Processes, core.GPUProcess{
+                    PID:          pid,
+                    Name:         strings.TrimSpace(fields[0]),
+                    MemoryUsedMB: int(vram / float64(len(indices)) / (1 << 20)),
+                })
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+    "context"
+    "reflect"
+    "testing"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+func TestParseROCmSMIFixture(t *testing.T) {
+    sample, err := parseROCmSMI(readFixture(t, "rocm-smi.json"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    // An MI250 is two GCDs, each its own card; the "system" entry is not one.
+    if len(sample.Devices) != 8 {
+        t.Fatalf("got %d devices, want 8", len(sample.Devices))
+    }
+    want := core.GPUDevice{
+        Index:         0,
+        Vendor:        core.GPUVendorAMD,
+        Name:          "AMD INSTINCT MI250 (MCM) OAM AC MBA",
+        UUID:          "0x8e9c7a52d1f30b46",
+        Utilization:   98,
+        MemoryUsedMB:  61203,
+        MemoryTotalMB: 65520,
+        // The edge sensor reads N/A, so the junction is reported.
+        TemperatureC: 71,
+        PowerW:       452,
+    }
+    if !reflect.DeepEqual(sample.Devices[0], want) {
+        t.Errorf("device 0 = %+v, want %+v", sample.Devices[0], want)
+    }
+    for i, d := range sample.Devices {
+        if d.Index != i {
+            t.Errorf("device %d has index %d", i, d.Index)
+        }
+    }
+    // The second GCD of each package reports no package power.
+    if d := sample.Devices[1]; d.PowerW != 0 || d.TemperatureC != 69 {
+        t.Errorf("device 1 = %+v, want 69C and no power reading", d)
+    }
+    if sample.Utilization != 55.25 || sample.MemoryMB != 269934 || sample.MemoryTotalMB != 8*65520 {
+        t.Errorf("aggregates = %.2f%%, %d/%d MB", sample.Utilization, sample.MemoryMB, sample.MemoryTotalMB)
+    }
+}
+
+func TestParseROCmSMILabelFallbacks(t *testing.T) {
+    out := `{"card3": {
+        "Card model": "0x740f",
+        "GPU use (%)": 12,
+        "Temperature (Sensor edge) (C)": "45.0",
+        "Temperature (Sensor junction) (C)": "50.0",
+        "Current Socket Graphics Package Power (W)": "210.5",
+        "VRAM Total Memory (B)": "1073741824",
+        "VRAM Total Used Memory (B)": "N/A"
+    }}`
+    sample, err := parseROCmSMI([]byte(out))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := core.GPUDevice{
+        Index:         3,
+        Vendor:        core.GPUVendorAMD,
+        Name:          "0x740f",
+        Utilization:   12,
+        MemoryTotalMB: 1024,
+        TemperatureC:  45,
+        PowerW:        210.5,
+    }
+    if !reflect.DeepEqual(sample.Devices, []core.GPUDevice{want}) {
+        t.Errorf("devices = %+v, want %+v", sample.Devices, want)
+    }
+}
+
+func TestParseROCmSMIRejectsMalformedOutput(t *testing.T) {
+    for name, out := range map[string]string{
+        "not json":    "ERROR: No AMD GPUs found",
+        "no cards":    `{"system": {"Driver version": "6.2.4"}}`,
+        "bad reading": `{"card0": {"GPU use (%)": "busy"}}`,
+    } {
+        if _, err := parseROCmSMI([]byte(out)); err == nil {
+            t.Errorf("%s: parsed without error", name)
+        }
+    }
+}
+
+func TestParseGPUCaptureDetectsTool(t *testing.T) {
+    for fixture, vendor := range map[string]string{
+        "nvidia-smi.csv": core.GPUVendorNVIDIA,
+        "rocm-smi.json":  core.GPUVendorAMD,
+    } {
+        sample, err := parseGPUCapture(readFixture(t, fixture))
+        if err != nil {
+            t.Fatalf("%s: %v", fixture, err)
+        }
+        for _, d := range sample.Devices {
+            if d.Vendor != vendor {
+                t.Fatalf("%s: device %d vendor %q, want %q", fixture, d.Index, d.Vendor, vendor)
+            }
+        }
+    }
+}
+
+func TestFakeROCmProvider(t *testing.T) {
+    t.Setenv("DAEMON_GPU_FIXTURE", "")
+    t.Setenv("DAEMON_GPU_PROCESS_FIXTURE", "")
+    sample, err := newFakeGPUProvider(defaultROCmFixture).sample(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(sample.Devices) != 8 || sample.Devices[7].Vendor != core.GPUVendorAMD {
+        t.Fatalf("fake-rocm sample = %+v", sample.Devices)
+    }
+}
+
+func TestParseROCmPidsFixture(t *testing.T) {
+    sample, err := parseROCmSMI(readFixture(t, "rocm-smi.json"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := parseROCmPids(readFixture(t, "rocm-smi-pids.json"), readFixture(t, "rocm-smi-pidgpus.json"), &sample); err != nil {
+        t.Fatal(err)
+    }
+    // rocm-smi reports a process's VRAM in total; it is split over its GPUs.
+    want := map[int][]core.GPUProcess{
+        0: {{PID: 61422, Name: "python3", MemoryUsedMB: 60229}},
+        1: {{PID: 61422, Name: "python3", MemoryUsedMB: 60229}},
+        4: {{PID: 73015, Name: "python3", MemoryUsedMB: 39845}},
+        5: {{PID: 73015, Name: "python3", MemoryUsedMB: 39845}},
+        6: {{PID: 73311, Name: "jupyter-lab", MemoryUsedMB: 4810}},
+        7: {{PID: 74580, Name: "torchrun", MemoryUsedMB: 63078}},
+    }
+    for _, d := range sample.Devices {
+        if !reflect.DeepEqual(d.Processes, want[d.Index]) {
+            t.Errorf("device %d processes = %+v, want %+v", d.Index, d.Processes, want[d.Index])
+        }
+    }
+}
+
+func TestParseROCmPidsEdgeCases(t *testing.T) {
+    sample := core.NewGPUSample([]core.GPUDevice{{Index: 0}})
+    pids := `{"system": {"PID10": "python3, 1, 1048576, 0, unknown", "PID11": "gone, 1, 0, 0, 0", "PID12": "idle, 0, 0, 0, 0", "note": "x"}}`
+    gpus := `{"system": {"PID10": "[0]", "PID11": "[5]"}}`
+    if err := parseROCmPids([]byte(pids), []byte(gpus), &sample); err != nil {
+        t.Fatal(err)
+    }
+    want := []core.GPUProcess{{PID: 10, Name: "python3", MemoryUsedMB: 1}}
+    if !reflect.DeepEqual(sample.Devices[0].Processes, want) {
+        t.Errorf("processes = %+v, want %+v", sample.Devices[0].Processes, want)
+    }
+    for name, pids := range map[string]string{
+        "not json":   "no KFD processes",
+        "few fields": `{"system": {"PID10": "python3"}}`,
+        "bad vram":   `{"system": {"PID10": "python3, 1, lots, 0, 0"}}`,
+    } {
+        if err := parseROCmPids([]byte(pids), []byte(gpus), &sample); err == nil {
+            t.Errorf("%s: parsed without error", name)
+        }
+    }
+}
+
+func TestFakeProvidersAttachProcesses(t *testing.T) {
+    t.Setenv("DAEMON_GPU_FIXTURE", "")
+    t.Setenv("DAEMON_GPU_PROCESS_FIXTURE", "")
+    sample, err := newFakeGPUProvider(defaultROCmFixture, defaultROCmPidsFixture, defaultROCmPidGPUsFixture).sample(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n := len(sample.Devices[0].Processes); n != 1 {
+        t.Errorf("fake-rocm GPU 0 has %d processes, want 1", n)
+    }
+    if _, err := parseGPUCapture(defaultROCmFixture, defaultROCmPidsFixture); err == nil {
+        t.Error("rocm-smi capture with only the pids accepted")
+    }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "os/exec"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// limitPolicy is the daemon-side ceiling for per-command resource limits.
+// Commands may ask for less than the policy allows, never more.
+type limitPolicy struct {
+    MaxMemoryMB   int
+    MaxCPUPercent int
+    MaxPids       int
+    // CgroupRoot is the cgroup v2 directory under which per-execution groups
+    // are created. Empty disables cgroup placement entirely.
+    CgroupRoot string
+    // Required makes executions fail instead of running unconfined when the
+    // cgroup cannot be created.
+    Required bool
+}
+
+type resourceUsage struct {
+    PeakMemoryBytes int64
+    CPUTimeMs       int64
+}
+
+func loadLimitPolicy() limitPolicy {
+    root := envOr("DAEMON_CGROUP_ROOT", "/sys/fs/cgroup/bastion")
+    if strings.EqualFold(root, "none") {
+        root = ""
+    }
+    return limitPolicy{
+        MaxMemoryMB:   envInt("DAEMON_MAX_MEMORY_MB", 0),
+        MaxCPUPercent: envInt("DAEMON_MAX_CPU_PERCENT", 0),
+        MaxPids:       envInt("DAEMON_MAX_PIDS", 0),
+        CgroupRoot:    root,
+        Required:      envBool("DAEMON_CGROUP_REQUIRED", false),
+    }
+}
+
+// effective caps the requested limits by the policy. A zero request falls
+// back to the policy maximum.
+func (p limitPolicy) effective(req core.ResourceLimits) core.ResourceLimits {
+    return core.ResourceLimits{
+        MemoryMB:   capLimit(req.MemoryMB, p.MaxMemoryMB),
+        CPUPercent: capLimit(req.CPUPercent, p.MaxCPUPercent),
+        MaxPids:    capLimit(req.MaxPids, p.MaxPids),
+    }
+}
+
+func capLimit(requested, max int) int {
+    if max <= 0 {
+        return requested
+    }
+    if requested <= 0 || requested > max {
+        return max
+    }
+    return requested
+}
+
+// prepareCgroup places cmd into a fresh cgroup for the execution. It returns a
+// nil cgroup when cgroups are disabled, or unavailable and not required.
+func (p limitPolicy) prepareCgroup(cmd *exec.Cmd, req core.ExecRequest) (*execCgroup, error) {
+    if p.CgroupRoot == "" {
+        return nil, nil
+    }
+    cg, err := createExecCgroup(p.CgroupRoot, cgroupName(req.ExecutionID), p.effective(req.Limits))
+    if err != nil {
+        if p.Required {
+            return nil, err
+        }
+        log.Printf("cgroup unavailable, running without limits: %v", err)
+        return nil, nil
+    }
+    cg.attach(cmd)
+    return cg, nil
+}
+
+var unsafeIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// safeID strips anything from an execution ID that could escape a path.
+func safeID(executionID string) string {
+    return unsafeIDChars.ReplaceAllString(executionID, "")
+}
+
+func cgroupName(executionID string) string {
+    name := safeID(executionID)
+    if name == "" {
+        name = fmt.Sprintf("%d", time.Now().UnixNano())
+    }
+    return "exec-" + name
+}
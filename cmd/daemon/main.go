@@ -1,24 +1,67 @@
 ﻿package main
 
 import (
-    "bytes"
     "context"
     "encoding/json"
     "errors"
+    "fmt"
+    "io"
     "log"
     "net/http"
     "os"
     "os/exec"
+    "sort"
+    "strconv"
     "strings"
     "time"
 
     "github.com/yourorg/boundless-bastion/cmd/internal/core"
 )
 
+type daemonServer struct {
+    limits limitPolicy
+    // sandboxTmpfsMB sizes the scratch /tmp of namespace-isolated executions.
+    sandboxTmpfsMB int
+    output         outputPolicy
+    artifacts      artifactPolicy
+    files          filePolicy
+    terminal       terminalPolicy
+    forward        forwardPolicy
+    runs           *execRegistry
+    // gpu is nil on hosts without GPU telemetry.
+    gpu gpuProvider
+}
+
 func main() {
+    if len(os.Args) > 1 && os.Args[1] == sandboxInitArg {
+        runSandboxInit(os.Args[2:])
+        return
+    }
+
+    srv := &daemonServer{
+        limits:         loadLimitPolicy(),
+        sandboxTmpfsMB: envInt("DAEMON_SANDBOX_TMPFS_MB", 256),
+        output:         loadOutputPolicy(),
+        artifacts:      loadArtifactPolicy(),
+        files:          loadFilePolicy(),
+        terminal:       loadTerminalPolicy(),
+        forward:        loadForwardPolicy(),
+        runs:           loadExecRegistry(),
+        gpu:            loadGPUProvider(),
+    }
+    go srv.output.runSpoolJanitor()
+    go srv.runs.runJanitor(context.Background())
+    go srv.artifacts.runJanitor()
+
     mux := http.NewServeMux()
     mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("ok")) })
-    mux.HandleFunc("/api/v1/exec", handleExec)
+    mux.HandleFunc("/api/v1/exec", srv.handleExec)
+    mux.HandleFunc("/api/v1/output", srv.handleOutput)
+    mux.HandleFunc("/api/v1/artifacts", srv.handleArtifacts)
+    mux.HandleFunc("/api/v1/files", srv.handleFiles)
+    mux.HandleFunc("/api/v1/terminal", srv.handleTerminal)
+    mux.HandleFunc("/api/v1/forward", srv.handleForward)
+    mux.HandleFunc("/api/v1/gpu", srv.handleGPU)
 
     port := envOr("DAEMON_PORT", "9081")
     log.Printf("Daemon listening on :%s", port)
@@ -27,8 +70,22 @@ func main() {
     }
 }
 
-func handleExec(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost {
+// handleExec runs a script (POST) or reports on a run by execution ID
+// (GET ?id=). A POST for an ID already known waits for that run instead of
+// starting another, and the run carries on if the caller goes away.
+func (d *daemonServer) handleExec(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        st, ok := d.runs.lookup(r.URL.Query().Get("id"))
+        if !ok {
+            http.Error(w, "unknown execution", http.StatusNotFound)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(st)
+        return
+    case http.MethodPost:
+    default:
         w.WriteHeader(http.StatusMethodNotAllowed)
         return
     }
@@ -37,51 +94,125 @@ func handleExec(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "invalid payload", http.StatusBadRequest)
         return
     }
+
+    var resp core.ExecResponse
+    if req.ExecutionID == "" {
+        resp = d.execute(r.Context(), req)
+    } else {
+        run, created := d.runs.start(req.ExecutionID)
+        if created {
+            go func() {
+                d.runs.finish(run, d.execute(context.Background(), req))
+            }()
+        }
+        select {
+        case <-run.done:
+            resp = run.result
+        case <-r.Context().Done():
+            return
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+func (d *daemonServer) execute(ctx context.Context, req core.ExecRequest) core.ExecResponse {
     timeout := req.TimeoutSeconds
     if timeout <= 0 {
         timeout = 300
     }
-
-    ctx := r.Context()
-    if timeout > 0 {
-        var cancel context.CancelFunc
-        ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
-        defer cancel()
-    }
+    ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+    defer cancel()
 
     start := time.Now()
-    stdout, stderr, exitCode, err := runScript(ctx, req.Script, req.WorkingDir)
+    result, err := d.runScript(ctx, req)
     duration := time.Since(start)
-
-    resp := core.ExecResponse{
-        Stdout:     stdout,
-        Stderr:     stderr,
-        ExitCode:   exitCode,
-        DurationMs: duration.Milliseconds(),
-    }
-
     if err != nil {
         log.Printf("exec error: %v", err)
     }
+    return core.ExecResponse{
+        Stdout:          result.Stdout,
+        Stderr:          result.Stderr,
+        ExitCode:        result.ExitCode,
+        DurationMs:      duration.Milliseconds(),
+        PeakMemoryBytes: result.Usage.PeakMemoryBytes,
+        CPUTimeMs:       result.Usage.CPUTimeMs,
+        StdoutBytes:     result.StdoutBytes,
+        StderrBytes:     result.StderrBytes,
+        StdoutTruncated: result.StdoutTruncated,
+        StderrTruncated: result.StderrTruncated,
+        Spooled:         result.Spooled,
+        Artifacts:       result.Artifacts,
+    }
+}
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(resp)
+type scriptResult struct {
+    Stdout          string
+    Stderr          string
+    ExitCode        int
+    Usage           resourceUsage
+    StdoutBytes     int64
+    StderrBytes     int64
+    StdoutTruncated bool
+    StderrTruncated bool
+    Spooled         bool
+    Artifacts       []core.ArtifactFile
 }
 
-func runScript(ctx context.Context, script string, workdir string) (string, string, int, error) {
-    if strings.TrimSpace(script) == "" {
-        return "", "empty script", 1, errors.New("empty script")
+func (d *daemonServer) runScript(ctx context.Context, req core.ExecRequest) (scriptResult, error) {
+    if strings.TrimSpace(req.Script) == "" {
+        return scriptResult{Stderr: "empty script", ExitCode: 1}, errors.New("empty script")
+    }
+    // Artifact globs are relative to the script's working directory. A sandbox's
+    // default one is a tmpfs that vanishes with it, so back it by a host dir.
+    artifactRoot := req.WorkingDir
+    var scratch string
+    if len(req.Artifacts) > 0 && req.Isolation == core.IsolationNamespace && req.WorkingDir == "" {
+        dir, err := os.MkdirTemp("", "bastion-scratch-")
+        if err != nil {
+            return scriptResult{Stderr: err.Error(), ExitCode: 1}, err
+        }
+        defer os.RemoveAll(dir)
+        scratch, artifactRoot = dir, dir
     }
-    cmd := exec.CommandContext(ctx, "bash", "-lc", script)
-    if workdir != "" {
-        cmd.Dir = workdir
+    cmd, err := d.commandFor(ctx, req, scratch)
+    if err != nil {
+        return scriptResult{Stderr: err.Error(), ExitCode: 1}, err
     }
 
-    var stdout, stderr bytes.Buffer
-    cmd.Stdout = &stdout
-    cmd.Stderr = &stderr
+    stdout := newCappedBuffer(d.output.HeadBytes, d.output.TailBytes)
+    stderr := newCappedBuffer(d.output.HeadBytes, d.output.TailBytes)
+    stdoutSpool := d.output.openSpool(req.ExecutionID, "stdout")
+    stderrSpool := d.output.openSpool(req.ExecutionID, "stderr")
+    cmd.Stdout = stdoutSpool.writer(stdout)
+    cmd.Stderr = stderrSpool.writer(stderr)
+
+    cg, err := d.limits.prepareCgroup(cmd, req)
+    if err != nil {
+        stdoutSpool.finish(false)
+        stderrSpool.finish(false)
+        return scriptResult{Stderr: err.Error(), ExitCode: 1}, err
+    }
+    if cg != nil {
+        d.runs.setCgroup(req.ExecutionID, cg.cgroupPath())
+    }
 
-    err := cmd.Run()
+    err = cmd.Run()
+    usage := processUsage(cmd.ProcessState)
+    if cg != nil {
+        // The cgroup also accounts for background children the shell did not wait for;
+        // older kernels lack memory.peak, so keep the rusage figure in that case.
+        cgUsage := cg.usage()
+        if cgUsage.PeakMemoryBytes > 0 {
+            usage.PeakMemoryBytes = cgUsage.PeakMemoryBytes
+        }
+        if cgUsage.CPUTimeMs > 0 {
+            usage.CPUTimeMs = cgUsage.CPUTimeMs
+        }
+        cg.remove()
+        d.runs.setCgroup(req.ExecutionID, "")
+    }
     exitCode := 0
     if err != nil {
         if exitErr, ok := err.(*exec.ExitError); ok {
@@ -91,10 +222,84 @@ func runScript(ctx context.Context, script string, workdir string) (string, stri
         }
         if stderr.Len() == 0 {
             // Surface process start failures (e.g., missing shell) to the caller.
-            stderr.WriteString(err.Error())
+            io.WriteString(cmd.Stderr, err.Error())
+        }
+    }
+    var artifacts []core.ArtifactFile
+    if len(req.Artifacts) > 0 {
+        // Collected on failure too: a crash dump is often the point.
+        artifacts = d.artifacts.collect(artifactRoot, req.ExecutionID, req.Artifacts)
+    }
+    // Both spools are kept as a pair if either stream lost data.
+    truncated := stdout.Truncated() || stderr.Truncated()
+    spooled := stdoutSpool.finish(truncated)
+    stderrSpool.finish(truncated)
+    return scriptResult{
+        Stdout:          stdout.String(),
+        Stderr:          stderr.String(),
+        ExitCode:        exitCode,
+        Usage:           usage,
+        StdoutBytes:     stdout.Len(),
+        StderrBytes:     stderr.Len(),
+        StdoutTruncated: stdout.Truncated(),
+        StderrTruncated: stderr.Truncated(),
+        Spooled:         spooled,
+        Artifacts:       artifacts,
+    }, err
+}
+
+// execSandbox is what a namespace-isolated execution needs from the request.
+type execSandbox struct {
+    Script string
+    // Env is added to the script's environment.
+    Env        []string
+    WorkingDir string
+    TmpfsMB    int
+    // ScratchDir is a host directory mounted as the sandbox's working
+    // directory so files left there (artifacts) outlive the namespaces.
+    ScratchDir string
+}
+
+// executionIDEnv is set in every execution's environment. Children inherit
+// it, which is how GPU telemetry attributes a process to its execution.
+const executionIDEnv = "BASTION_EXECUTION_ID"
+
+// execEnv is what a run adds to the daemon's environment: the request's
+// variables, such as the CUDA_VISIBLE_DEVICES of its reserved GPUs, and
+// executionIDEnv.
+func execEnv(req core.ExecRequest) []string {
+    keys := make([]string, 0, len(req.Env))
+    for k := range req.Env {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    env := make([]string, 0, len(keys)+1)
+    for _, k := range keys {
+        env = append(env, k+"="+req.Env[k])
+    }
+    return append(env, executionIDEnv+"="+req.ExecutionID)
+}
+
+func (d *daemonServer) commandFor(ctx context.Context, req core.ExecRequest, scratch string) (*exec.Cmd, error) {
+    switch req.Isolation {
+    case "", core.IsolationNone:
+        cmd := exec.CommandContext(ctx, "bash", "-lc", req.Script)
+        cmd.Env = append(os.Environ(), execEnv(req)...)
+        if req.WorkingDir != "" {
+            cmd.Dir = req.WorkingDir
         }
+        return cmd, nil
+    case core.IsolationNamespace:
+        return sandboxCommand(ctx, execSandbox{
+            Script:     req.Script,
+            Env:        execEnv(req),
+            WorkingDir: req.WorkingDir,
+            TmpfsMB:    d.sandboxTmpfsMB,
+            ScratchDir: scratch,
+        })
+    default:
+        return nil, fmt.Errorf("unknown isolation mode %q", req.Isolation)
     }
-    return stdout.String(), stderr.String(), exitCode, err
 }
 
 func envOr(key, fallback string) string {
@@ -103,3 +308,42 @@ func envOr(key, fallback string) string {
     }
     return fallback
 }
+
+func envInt(key string, fallback int) int {
+    v := strings.TrimSpace(os.Getenv(key))
+    if v == "" {
+        return fallback
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil {
+        log.Printf("invalid %s=%q, using %d", key, v, fallback)
+        return fallback
+    }
+    return n
+}
+
+func envBool(key string, fallback bool) bool {
+    v := strings.TrimSpace(os.Getenv(key))
+    if v == "" {
+        return fallback
+    }
+    b, err := strconv.ParseBool(v)
+    if err != nil {
+        log.Printf("invalid %s=%q, using %t", key, v, fallback)
+        return fallback
+    }
+    return b
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+    v := strings.TrimSpace(os.Getenv(key))
+    if v == "" {
+        return fallback
+    }
+    d, err := time.ParseDuration(v)
+    if err != nil {
+        log.Printf("invalid %s=%q, using %s", key, v, fallback)
+        return fallback
+    }
+    return d
+}
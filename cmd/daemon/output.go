@@ -0,0 +1,207 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// outputPolicy bounds how much of a stream is kept in memory and returned to
+// the bastion. Anything beyond HeadBytes+TailBytes is dropped from the middle.
+type outputPolicy struct {
+    HeadBytes int
+    TailBytes int
+    // SpoolDir keeps the untruncated streams on disk for later download.
+    // Empty disables spooling.
+    SpoolDir       string
+    SpoolRetention time.Duration
+}
+
+func loadOutputPolicy() outputPolicy {
+    retention, err := time.ParseDuration(envOr("DAEMON_SPOOL_RETENTION", "24h"))
+    if err != nil {
+        log.Printf("invalid DAEMON_SPOOL_RETENTION, using 24h: %v", err)
+        retention = 24 * time.Hour
+    }
+    return outputPolicy{
+        HeadBytes:      envInt("DAEMON_OUTPUT_HEAD_BYTES", 512*1024),
+        TailBytes:      envInt("DAEMON_OUTPUT_TAIL_BYTES", 512*1024),
+        SpoolDir:       strings.TrimSpace(os.Getenv("DAEMON_SPOOL_DIR")),
+        SpoolRetention: retention,
+    }
+}
+
+// cappedBuffer keeps the first head and the last tail bytes written to it and
+// counts everything in between.
+type cappedBuffer struct {
+    headCap int
+    tailCap int
+    head    []byte
+    tail    []byte
+    total   int64
+}
+
+func newCappedBuffer(headCap, tailCap int) *cappedBuffer {
+    return &cappedBuffer{headCap: headCap, tailCap: tailCap}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+    n := len(p)
+    b.total += int64(n)
+    if room := b.headCap - len(b.head); room > 0 {
+        if room > len(p) {
+            room = len(p)
+        }
+        b.head = append(b.head, p[:room]...)
+        p = p[room:]
+    }
+    if len(p) == 0 || b.tailCap <= 0 {
+        return n, nil
+    }
+    b.tail = append(b.tail, p...)
+    // Trim lazily so steady writes don't copy the tail on every call.
+    if len(b.tail) > 2*b.tailCap {
+        b.tail = append(b.tail[:0], b.tail[len(b.tail)-b.tailCap:]...)
+    }
+    return n, nil
+}
+
+func (b *cappedBuffer) Truncated() bool {
+    return b.total > int64(len(b.head))+int64(b.tailLen())
+}
+
+func (b *cappedBuffer) Len() int64 {
+    return b.total
+}
+
+func (b *cappedBuffer) tailLen() int {
+    if len(b.tail) > b.tailCap {
+        return b.tailCap
+    }
+    return len(b.tail)
+}
+
+func (b *cappedBuffer) String() string {
+    tail := b.tail[len(b.tail)-b.tailLen():]
+    if !b.Truncated() {
+        return string(b.head) + string(tail)
+    }
+    dropped := b.total - int64(len(b.head)) - int64(len(tail))
+    return fmt.Sprintf("%s\n... [truncated %d bytes] ...\n%s", b.head, dropped, tail)
+}
+
+// outputSpool tees a stream of one execution into a file under the spool dir.
+type outputSpool struct {
+    path string
+    file *os.File
+}
+
+func (p outputPolicy) spoolPath(executionID, stream string) string {
+    return filepath.Join(p.SpoolDir, safeID(executionID)+"."+stream)
+}
+
+func (p outputPolicy) openSpool(executionID, stream string) *outputSpool {
+    if p.SpoolDir == "" || safeID(executionID) == "" {
+        return nil
+    }
+    if err := os.MkdirAll(p.SpoolDir, 0o700); err != nil {
+        log.Printf("spool dir: %v", err)
+        return nil
+    }
+    path := p.spoolPath(executionID, stream)
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+    if err != nil {
+        log.Printf("open spool: %v", err)
+        return nil
+    }
+    return &outputSpool{path: path, file: f}
+}
+
+// writer returns where the stream should be written: the capped buffer and,
+// when spooling, the spool file too.
+func (s *outputSpool) writer(buf *cappedBuffer) io.Writer {
+    if s == nil {
+        return buf
+    }
+    return io.MultiWriter(buf, s.file)
+}
+
+// finish keeps the spool only if the in-memory copy lost data; otherwise
+// there is nothing more to download and the file is removed.
+func (s *outputSpool) finish(keep bool) bool {
+    if s == nil {
+        return false
+    }
+    s.file.Close()
+    if !keep {
+        os.Remove(s.path)
+    }
+    return keep
+}
+
+// handleOutput serves a spooled stream. Range requests are honoured so the
+// bastion can page through very large outputs.
+func (d *daemonServer) handleOutput(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    if d.output.SpoolDir == "" {
+        http.Error(w, "output spooling is disabled", http.StatusNotFound)
+        return
+    }
+    id := r.URL.Query().Get("execution_id")
+    stream := r.URL.Query().Get("stream")
+    if id == "" || (stream != "stdout" && stream != "stderr") {
+        http.Error(w, "execution_id and stream=stdout|stderr are required", http.StatusBadRequest)
+        return
+    }
+    f, err := os.Open(d.output.spoolPath(id, stream))
+    if err != nil {
+        http.Error(w, "not found", http.StatusNotFound)
+        return
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// pruneSpool deletes spooled outputs older than the retention period.
+func (p outputPolicy) pruneSpool() {
+    entries, err := os.ReadDir(p.SpoolDir)
+    if err != nil {
+        return
+    }
+    cutoff := time.Now().Add(-p.SpoolRetention)
+    for _, e := range entries {
+        info, err := e.Info()
+        if err != nil || e.IsDir() || info.ModTime().After(cutoff) {
+            continue
+        }
+        if err := os.Remove(filepath.Join(p.SpoolDir, e.Name())); err != nil {
+            log.Printf("prune spool: %v", err)
+        }
+    }
+}
+
+func (p outputPolicy) runSpoolJanitor() {
+    if p.SpoolDir == "" || p.SpoolRetention <= 0 {
+        return
+    }
+    ticker := time.NewTicker(10 * time.Minute)
+    defer ticker.Stop()
+    for {
+        p.pruneSpool()
+        <-ticker.C
+    }
+}
@@ -0,0 +1,257 @@
+//go:build linux
+
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "os"
+    "os/exec"
+    "sort"
+    "strconv"
+    "strings"
+    "syscall"
+)
+
+// sandboxInitArg makes the daemon binary act as the init process of a
+// namespace-isolated execution. It is never meant to be passed by hand.
+const sandboxInitArg = "__bastion-sandbox-init"
+
+// nobodyID is used for the sandbox's root user when the daemon itself runs as
+// root, so escaping the namespaces does not land on host uid 0.
+const nobodyID = 65534
+
+// sandboxEnvKeys are the only variables of the daemon's environment an
+// isolated script sees; the rest, credentials included, stay outside.
+var sandboxEnvKeys = []string{"PATH", "LANG", "TERM"}
+
+// sandboxCommand re-executes the daemon inside fresh namespaces; the child
+// finishes the setup in runSandboxInit before exec'ing bash.
+func sandboxCommand(ctx context.Context, req execSandbox) (*exec.Cmd, error) {
+    cmd := exec.CommandContext(ctx, "/proc/self/exe", sandboxInitArg, req.Script)
+    for _, key := range sandboxEnvKeys {
+        if v, ok := os.LookupEnv(key); ok {
+            cmd.Env = append(cmd.Env, key+"="+v)
+        }
+    }
+    cmd.Env = append(cmd.Env,
+        "BASTION_SANDBOX_TMPFS_MB="+strconv.Itoa(req.TmpfsMB),
+        "BASTION_SANDBOX_WORKDIR="+req.WorkingDir,
+        "BASTION_SANDBOX_SCRATCH="+req.ScratchDir,
+    )
+    cmd.Env = append(cmd.Env, req.Env...)
+
+    hostUID, hostGID := os.Getuid(), os.Getgid()
+    if hostUID == 0 {
+        hostUID, hostGID = nobodyID, nobodyID
+    }
+    if req.ScratchDir != "" {
+        if err := os.Chown(req.ScratchDir, hostUID, hostGID); err != nil {
+            return nil, fmt.Errorf("chown scratch dir: %w", err)
+        }
+    }
+    cmd.SysProcAttr = &syscall.SysProcAttr{
+        Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+            syscall.CLONE_NEWNET | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC,
+        UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: hostUID, Size: 1}},
+        GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: hostGID, Size: 1}},
+        GidMappingsEnableSetgroups: false,
+        // Become the namespace's root before exec so the init keeps its
+        // capabilities inside the user namespace.
+        Credential: &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true},
+        Pdeathsig:  syscall.SIGKILL,
+    }
+    return cmd, nil
+}
+
+// runSandboxInit runs as PID 1 of the new PID namespace. Any failure exits
+// before the script starts so a half-built sandbox never runs user code.
+func runSandboxInit(args []string) {
+    if len(args) != 1 {
+        fmt.Fprintln(os.Stderr, "sandbox: missing script")
+        os.Exit(125)
+    }
+    tmpfsMB, _ := strconv.Atoi(os.Getenv("BASTION_SANDBOX_TMPFS_MB"))
+    workdir := os.Getenv("BASTION_SANDBOX_WORKDIR")
+    scratch := os.Getenv("BASTION_SANDBOX_SCRATCH")
+    if err := enterSandbox(tmpfsMB, workdir, scratch); err != nil {
+        fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+        os.Exit(125)
+    }
+    bash, err := exec.LookPath("bash")
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+        os.Exit(127)
+    }
+    env := make([]string, 0, len(os.Environ()))
+    for _, kv := range os.Environ() {
+        if !strings.HasPrefix(kv, "BASTION_SANDBOX_") {
+            env = append(env, kv)
+        }
+    }
+    env = append(env, "HOME=/tmp")
+    if err := syscall.Exec(bash, []string{"bash", "-lc", args[0]}, env); err != nil {
+        fmt.Fprintf(os.Stderr, "sandbox: exec bash: %v\n", err)
+        os.Exit(126)
+    }
+}
+
+// sandboxScratchMount is where a host-backed scratch dir appears in the sandbox.
+const sandboxScratchMount = "/tmp/work"
+
+func enterSandbox(tmpfsMB int, workdir, scratch string) error {
+    if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+        return fmt.Errorf("make mounts private: %w", err)
+    }
+    // The host scratch dir usually lives under /tmp, which the tmpfs is about
+    // to hide, so hold on to it by file descriptor.
+    scratchFD := -1
+    if scratch != "" {
+        fd, err := syscall.Open(scratch, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+        if err != nil {
+            return fmt.Errorf("open scratch dir: %w", err)
+        }
+        defer syscall.Close(fd)
+        scratchFD = fd
+    }
+    if err := remountReadOnly(); err != nil {
+        return err
+    }
+    if tmpfsMB <= 0 {
+        tmpfsMB = 256
+    }
+    opts := fmt.Sprintf("size=%dm,mode=1777", tmpfsMB)
+    if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, opts); err != nil {
+        return fmt.Errorf("mount scratch tmpfs: %w", err)
+    }
+    if scratchFD >= 0 {
+        if err := os.Mkdir(sandboxScratchMount, 0o755); err != nil {
+            return fmt.Errorf("create scratch mount point: %w", err)
+        }
+        src := fmt.Sprintf("/proc/self/fd/%d", scratchFD)
+        if err := syscall.Mount(src, sandboxScratchMount, "", syscall.MS_BIND, ""); err != nil {
+            return fmt.Errorf("mount scratch dir: %w", err)
+        }
+        // A bind mount copies the read-only flag set on the root above.
+        if err := remount(sandboxScratchMount, syscall.MS_NOSUID|syscall.MS_NODEV); err != nil {
+            return fmt.Errorf("remount scratch dir writable: %w", err)
+        }
+        if workdir == "" {
+            workdir = sandboxScratchMount
+        }
+    }
+    if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+        return fmt.Errorf("mount proc: %w", err)
+    }
+    if workdir == "" {
+        workdir = "/tmp"
+    }
+    if err := os.Chdir(workdir); err != nil {
+        return fmt.Errorf("chdir: %w", err)
+    }
+    return nil
+}
+
+// sandboxReplacedMounts are covered by fresh mounts once the root is
+// read-only: /tmp by the scratch tmpfs (and the scratch dir inside it) and
+// /proc by the sandbox's own procfs. Mounts at or under them may stay as
+// they are.
+var sandboxReplacedMounts = []string{"/tmp", "/proc"}
+
+func replacedInSandbox(mp string) bool {
+    for _, p := range sandboxReplacedMounts {
+        if mp == p || strings.HasPrefix(mp, p+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// remountReadOnly flips every mount visible in the new mount namespace to
+// read-only. Flags the kernel locks for unprivileged user namespaces (nosuid,
+// nodev, noexec, atime) must be carried over or the remount is refused. Any
+// mount left writable fails the sandbox, unless it is about to be replaced.
+func remountReadOnly() error {
+    mounts, err := mountPoints()
+    if err != nil {
+        return err
+    }
+    for _, mp := range mounts {
+        if replacedInSandbox(mp) {
+            continue
+        }
+        if err := remount(mp, syscall.MS_RDONLY); err != nil {
+            return fmt.Errorf("remount %s read-only: %w", mp, err)
+        }
+    }
+    return nil
+}
+
+// remount changes the per-mount flags of mp to flags, keeping the ones the
+// kernel locks.
+func remount(mp string, flags uintptr) error {
+    var st syscall.Statfs_t
+    if err := syscall.Statfs(mp, &st); err != nil {
+        return err
+    }
+    flags |= syscall.MS_REMOUNT | syscall.MS_BIND
+    for stFlag, msFlag := range statfsToMountFlags {
+        if int64(st.Flags)&stFlag != 0 {
+            flags |= msFlag
+        }
+    }
+    return syscall.Mount("", mp, "", flags, "")
+}
+
+// statfsToMountFlags maps ST_* bits from statfs(2) to their MS_* counterparts.
+var statfsToMountFlags = map[int64]uintptr{
+    0x0002: syscall.MS_NOSUID,
+    0x0004: syscall.MS_NODEV,
+    0x0008: syscall.MS_NOEXEC,
+    0x0400: syscall.MS_NOATIME,
+    0x0800: syscall.MS_NODIRATIME,
+    0x1000: syscall.MS_RELATIME,
+}
+
+func mountPoints() ([]string, error) {
+    f, err := os.Open("/proc/self/mountinfo")
+    if err != nil {
+        return nil, fmt.Errorf("read mountinfo: %w", err)
+    }
+    defer f.Close()
+    var out []string
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) < 5 {
+            continue
+        }
+        out = append(out, unescapeMountPath(fields[4]))
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("read mountinfo: %w", err)
+    }
+    // Parents before children so a child remount is not undone by its parent's.
+    sort.Strings(out)
+    return out, nil
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space etc.) used in mountinfo.
+func unescapeMountPath(p string) string {
+    if !strings.Contains(p, `\`) {
+        return p
+    }
+    var b strings.Builder
+    for i := 0; i < len(p); i++ {
+        if p[i] == '\\' && i+3 < len(p) {
+            if n, err := strconv.ParseUint(p[i+1:i+4], 8, 8); err == nil {
+                b.WriteByte(byte(n))
+                i += 3
+                continue
+            }
+        }
+        b.WriteByte(p[i])
+    }
+    return b.String()
+}
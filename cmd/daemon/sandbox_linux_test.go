@@ -0,0 +1,96 @@
+//go:build linux
+
+package main
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// The sandbox re-executes /proc/self/exe, which under test is this binary.
+func TestMain(m *testing.M) {
+    if len(os.Args) > 1 && os.Args[1] == sandboxInitArg {
+        runSandboxInit(os.Args[2:])
+    }
+    os.Exit(m.Run())
+}
+
+// runSandboxed runs script in the sandbox and returns its combined output.
+func runSandboxed(t *testing.T, script string, env ...string) (string, error) {
+    t.Helper()
+    cmd, err := sandboxCommand(context.Background(), execSandbox{Script: script, Env: env, TmpfsMB: 16})
+    if err != nil {
+        t.Fatal(err)
+    }
+    out, err := cmd.CombinedOutput()
+    return string(out), err
+}
+
+// requireSandbox skips the test where user namespaces are unavailable.
+func requireSandbox(t *testing.T) {
+    t.Helper()
+    if out, err := runSandboxed(t, "true"); err != nil {
+        t.Skipf("sandbox unavailable here: %v: %s", err, out)
+    }
+}
+
+func TestSandboxMountsReadOnly(t *testing.T) {
+    requireSandbox(t)
+    mounts, err := mountPoints()
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Probe every host mount other than the root that the daemon could write
+    // to, such as /dev/shm.
+    tried := 0
+    for _, mp := range mounts {
+        if mp == "/" || replacedInSandbox(mp) {
+            continue
+        }
+        probe := filepath.Join(mp, "bastion-sandbox-probe")
+        f, err := os.OpenFile(probe, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+        if err != nil {
+            continue
+        }
+        f.Close()
+        os.Remove(probe)
+        tried++
+        if out, err := runSandboxed(t, "echo x > "+probe); err == nil {
+            os.Remove(probe)
+            t.Errorf("write to %s succeeded inside the sandbox: %s", mp, out)
+        }
+        if _, err := os.Stat(probe); err == nil {
+            os.Remove(probe)
+            t.Errorf("sandbox left %s behind", probe)
+        }
+    }
+    if tried == 0 {
+        t.Skip("no writable mount besides / to probe")
+    }
+    if out, err := runSandboxed(t, "echo x > /tmp/probe && cat /tmp/probe"); err != nil || out != "x\n" {
+        t.Errorf("scratch /tmp: %q, %v", out, err)
+    }
+}
+
+func TestSandboxEnvironment(t *testing.T) {
+    requireSandbox(t)
+    t.Setenv("DAEMON_TOKEN", "secret")
+    t.Setenv("LANG", "C.UTF-8")
+    out, err := runSandboxed(t, "env", "FROM_REQUEST=1", executionIDEnv+"=exec-1")
+    if err != nil {
+        t.Fatalf("%v: %s", err, out)
+    }
+    for _, want := range []string{"FROM_REQUEST=1", executionIDEnv + "=exec-1", "LANG=C.UTF-8", "HOME=/tmp", "PATH="} {
+        if !strings.Contains(out, want) {
+            t.Errorf("sandbox env lacks %s:\n%s", want, out)
+        }
+    }
+    for _, leaked := range []string{"DAEMON_TOKEN", "BASTION_SANDBOX_"} {
+        if strings.Contains(out, leaked) {
+            t.Errorf("sandbox env has %s:\n%s", leaked, out)
+        }
+    }
+}
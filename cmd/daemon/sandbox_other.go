@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+)
+
+const sandboxInitArg = "__bastion-sandbox-init"
+
+func sandboxCommand(ctx context.Context, req execSandbox) (*exec.Cmd, error) {
+    return nil, errors.New("namespace isolation requires linux")
+}
+
+func runSandboxInit(args []string) {
+    fmt.Fprintln(os.Stderr, "sandbox: namespace isolation requires linux")
+    os.Exit(125)
+}
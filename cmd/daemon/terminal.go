@@ -0,0 +1,119 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "os"
+    "os/exec"
+    "strconv"
+    "sync"
+    "syscall"
+
+    "github.com/creack/pty"
+    "github.com/gorilla/websocket"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+// terminalPolicy controls interactive shells. Like /api/v1/exec the endpoint
+// trusts its caller; the daemon only listens on loopback.
+type terminalPolicy struct {
+    Enabled bool
+    Shell   string
+}
+
+func loadTerminalPolicy() terminalPolicy {
+    return terminalPolicy{
+        Enabled: envBool("DAEMON_TERMINAL_ENABLED", true),
+        Shell:   envOr("DAEMON_TERMINAL_SHELL", "/bin/bash"),
+    }
+}
+
+var wsUpgrader = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+
+// handleTerminal runs a login shell on a PTY and relays it over a WebSocket:
+// binary frames are terminal bytes, text frames are core.TerminalMessage.
+// The shell is hung up when the socket goes away.
+func (d *daemonServer) handleTerminal(w http.ResponseWriter, r *http.Request) {
+    if !d.terminal.Enabled {
+        http.Error(w, "terminal is disabled", http.StatusForbidden)
+        return
+    }
+    size := &pty.Winsize{Cols: 80, Rows: 24}
+    if v, err := strconv.ParseUint(r.URL.Query().Get("cols"), 10, 16); err == nil && v > 0 {
+        size.Cols = uint16(v)
+    }
+    if v, err := strconv.ParseUint(r.URL.Query().Get("rows"), 10, 16); err == nil && v > 0 {
+        size.Rows = uint16(v)
+    }
+    conn, err := wsUpgrader.Upgrade(w, r, nil)
+    if err != nil {
+        return
+    }
+    defer conn.Close()
+
+    cmd := exec.Command(d.terminal.Shell, "-l")
+    cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+    ptmx, err := pty.StartWithSize(cmd, size)
+    if err != nil {
+        conn.WriteJSON(core.TerminalMessage{Type: "error", Message: err.Error()})
+        return
+    }
+    var closeOnce sync.Once
+    hangup := func() {
+        closeOnce.Do(func() {
+            ptmx.Close()
+            cmd.Process.Signal(syscall.SIGHUP)
+        })
+    }
+    defer hangup()
+
+    // The output pump is the only writer once the shell is running.
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        buf := make([]byte, 32*1024)
+        for {
+            n, err := ptmx.Read(buf)
+            if n > 0 {
+                if werr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+                    hangup()
+                    break
+                }
+            }
+            if err != nil {
+                break
+            }
+        }
+        exitCode := 0
+        var exitErr *exec.ExitError
+        if err := cmd.Wait(); errors.As(err, &exitErr) {
+            exitCode = exitErr.ExitCode()
+        }
+        conn.WriteJSON(core.TerminalMessage{Type: "exit", ExitCode: exitCode})
+        conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+        conn.Close()
+    }()
+
+    for {
+        kind, data, err := conn.ReadMessage()
+        if err != nil {
+            break
+        }
+        switch kind {
+        case websocket.BinaryMessage:
+            if _, err := ptmx.Write(data); err != nil {
+                log.Printf("terminal write: %v", err)
+            }
+        case websocket.TextMessage:
+            var msg core.TerminalMessage
+            if json.Unmarshal(data, &msg) == nil && msg.Type == "resize" && msg.Cols > 0 && msg.Rows > 0 {
+                pty.Setsize(ptmx, &pty.Winsize{Cols: msg.Cols, Rows: msg.Rows})
+            }
+        }
+    }
+    hangup()
+    <-done
+}
@@ -0,0 +1,290 @@
+package core
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "time"
+)
+
+// AlertNotifier is told about alerts as they fire and resolve.
+type AlertNotifier interface {
+    Notify(ctx context.Context, alert Alert) error
+}
+
+// LogNotifier writes alerts to the process log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, alert Alert) error {
+    log.Printf("alert %s [%s]: %s", alert.State, alert.Rule, alert.Summary)
+    return nil
+}
+
+// WebhookNotifier POSTs each alert as JSON to URL. Any response other than
+// 2xx counts as a failed delivery.
+type WebhookNotifier struct {
+    URL    string
+    Client *http.Client
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+    body, err := json.Marshal(alert)
+    if err != nil {
+        return err
+    }
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    client := n.Client
+    if client == nil {
+        client = http.DefaultClient
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        return fmt.Errorf("webhook returned %s", resp.Status)
+    }
+    return nil
+}
+
+// SetAlertRules validates rules and makes them the ones evaluated after each
+// GPU collection. Alerts of rules no longer in the set resolve at the next
+// evaluation.
+func (s *BastionService) SetAlertRules(rules []AlertRule) error {
+    seen := map[string]bool{}
+    for i, r := range rules {
+        if r.Name == "" {
+            return invalidf("alert rule %d: name is required", i+1)
+        }
+        if seen[r.Name] {
+            return invalidf("alert rule %q: duplicate name", r.Name)
+        }
+        seen[r.Name] = true
+        switch r.Metric {
+        case AlertUtilization, AlertMemoryPercent, AlertTemperature, AlertPower:
+        default:
+            return invalidf("alert rule %q: unknown metric %q", r.Name, r.Metric)
+        }
+        if r.Op != "<" && r.Op != ">" {
+            return invalidf("alert rule %q: op must be < or >", r.Name)
+        }
+        if r.ForSeconds < 0 {
+            return invalidf("alert rule %q: for must not be negative", r.Name)
+        }
+    }
+    s.alertRules = rules
+    return nil
+}
+
+// SetAlertNotifier sets where alerts are sent; the default is the log.
+func (s *BastionService) SetAlertNotifier(n AlertNotifier) {
+    s.notifier = n
+}
+
+func (s *BastionService) AlertRules() []AlertRule {
+    return s.alertRules
+}
+
+// ListAlerts returns the most recently updated alerts, in state if it is set.
+func (s *BastionService) ListAlerts(ctx context.Context, state AlertState, limit int) ([]Alert, error) {
+    switch state {
+    case "", AlertPending, AlertFiring, AlertResolved:
+    default:
+        return nil, invalidf("unknown alert state %q", state)
+    }
+    if limit <= 0 || limit > 500 {
+        limit = 100
+    }
+    return s.alerts.List(ctx, state, limit)
+}
+
+// alertValue reads the metric a rule watches off a device.
+func alertValue(metric AlertMetric, d GPUDevice) (float64, bool) {
+    switch metric {
+    case AlertUtilization:
+        return d.Utilization, true
+    case AlertMemoryPercent:
+        if d.MemoryTotalMB <= 0 {
+            return 0, false
+        }
+        return 100 * float64(d.MemoryUsedMB) / float64(d.MemoryTotalMB), true
+    case AlertTemperature:
+        return d.TemperatureC, true
+    case AlertPower:
+        return d.PowerW, true
+    }
+    return 0, false
+}
+
+func (r AlertRule) breached(value float64) bool {
+    if r.Op == "<" {
+        return value < r.Threshold
+    }
+    return value > r.Threshold
+}
+
+func alertKey(rule, nodeID string, device int) string {
+    return fmt.Sprintf("%s|%s|%d", rule, nodeID, device)
+}
+
+// EvaluateAlerts moves alerts along with a round of GPU samples taken at
+// now. A breach opens a pending alert, which fires once the breach has
+// lasted the rule's For; the alert resolves when a reading no longer
+// breaches, and a pending one that clears is dropped. A node or device
+// missing from samples leaves its alerts as they are: no reading is not a
+// healthy reading.
+func (s *BastionService) EvaluateAlerts(ctx context.Context, samples []GPUSample, now time.Time) error {
+    active, err := s.alerts.Active(ctx)
+    if err != nil {
+        return err
+    }
+    open := make(map[string]Alert, len(active))
+    for _, a := range active {
+        open[alertKey(a.Rule, a.NodeID, a.DeviceIndex)] = a
+    }
+    running := map[string]bool{}
+    isRunning := func(nodeID string) (bool, error) {
+        if v, ok := running[nodeID]; ok {
+            return v, nil
+        }
+        execs, err := s.executions.List(ctx, ExecutionFilter{NodeID: nodeID, Status: ExecutionRunning, Limit: 1})
+        if err != nil {
+            return false, err
+        }
+        running[nodeID] = len(execs) > 0
+        return running[nodeID], nil
+    }
+
+    rules := map[string]bool{}
+    for _, rule := range s.alertRules {
+        rules[rule.Name] = true
+        for _, sample := range samples {
+            if rule.NodeID != "" && rule.NodeID != sample.NodeID {
+                continue
+            }
+            busy := true
+            if rule.WhileRunning && len(sample.Devices) > 0 {
+                if busy, err = isRunning(sample.NodeID); err != nil {
+                    return err
+                }
+            }
+            for _, d := range sample.Devices {
+                value, ok := alertValue(rule.Metric, d)
+                if !ok {
+                    continue
+                }
+                key := alertKey(rule.Name, sample.NodeID, d.Index)
+                alert, exists := open[key]
+                switch {
+                case busy && rule.breached(value):
+                    if !exists {
+                        alert = Alert{
+                            ID:          randomID("alert"),
+                            Rule:        rule.Name,
+                            NodeID:      sample.NodeID,
+                            DeviceIndex: d.Index,
+                            State:       AlertPending,
+                            Severity:    rule.Severity,
+                            Threshold:   rule.Threshold,
+                            StartedAt:   now,
+                        }
+                    }
+                    alert.DeviceUUID = d.UUID
+                    alert.Value = value
+                    alert.Summary = fmt.Sprintf("%s GPU %d on node %s: %s %.1f %s %.1f",
+                        d.Name, d.Index, sample.NodeID, rule.Metric, value, rule.Op, rule.Threshold)
+                    if alert.State == AlertPending && now.Sub(alert.StartedAt) >= time.Duration(rule.ForSeconds)*time.Second {
+                        alert.State = AlertFiring
+                        alert.FiredAt = &now
+                    }
+                case exists && alert.State == AlertPending:
+                    if err := s.alerts.Delete(ctx, alert.ID); err != nil {
+                        return err
+                    }
+                    delete(open, key)
+                    continue
+                case exists:
+                    alert.resolve(now)
+                default:
+                    continue
+                }
+                alert.UpdatedAt = now
+                if err := s.saveAlert(ctx, alert); err != nil {
+                    return err
+                }
+                delete(open, key)
+            }
+        }
+    }
+
+    // Alerts left over are of nodes not sampled this round, whose state
+    // stands, or of rules that are gone, which resolve. Firing alerts whose
+    // notification failed earlier are retried either way.
+    for _, alert := range open {
+        if !rules[alert.Rule] {
+            if alert.State == AlertPending {
+                if err := s.alerts.Delete(ctx, alert.ID); err != nil {
+                    return err
+                }
+                continue
+            }
+            alert.resolve(now)
+            alert.UpdatedAt = now
+        }
+        if err := s.saveAlert(ctx, alert); err != nil {
+            return err
+        }
+    }
+    return s.renotifyResolved(ctx)
+}
+
+func (a *Alert) resolve(now time.Time) {
+    a.State = AlertResolved
+    a.ResolvedAt = &now
+}
+
+// saveAlert stores an alert and tells the notifier about a state it has not
+// announced yet. Only firing and resolved are announced, each once; a failed
+// delivery is left for the next evaluation to retry.
+func (s *BastionService) saveAlert(ctx context.Context, alert Alert) error {
+    if alert.State != AlertPending && alert.Notified != alert.State {
+        if alert.State == AlertResolved && alert.Notified == "" {
+            // Never announced as firing, so there is nothing to take back.
+            alert.Notified = AlertResolved
+        } else if err := s.notifier.Notify(ctx, alert); err != nil {
+            log.Printf("notify alert %s: %v", alert.ID, err)
+        } else {
+            alert.Notified = alert.State
+        }
+    }
+    _, err := s.alerts.Save(ctx, alert)
+    return err
+}
+
+// renotifyResolved retries resolutions whose notification failed. Resolved
+// alerts are no longer active, so they are picked up from the recent ones.
+func (s *BastionService) renotifyResolved(ctx context.Context) error {
+    recent, err := s.alerts.List(ctx, AlertResolved, 100)
+    if err != nil {
+        return err
+    }
+    for _, alert := range recent {
+        if alert.Notified == AlertResolved {
+            continue
+        }
+        if err := s.saveAlert(ctx, alert); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+    "context"
+    "errors"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+)
+
+// recordingNotifier keeps the state of every delivered alert and fails while
+// failing is set, as an unreachable webhook would.
+type recordingNotifier struct {
+    mu        sync.Mutex
+    failing   bool
+    delivered []AlertState
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert Alert) error {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    if n.failing {
+        return errors.New("webhook down")
+    }
+    n.delivered = append(n.delivered, alert.State)
+    return nil
+}
+
+func (n *recordingNotifier) take() []AlertState {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    out := n.delivered
+    n.delivered = nil
+    return out
+}
+
+func temperatureSample(nodeID string, celsius float64) GPUSample {
+    sample := NewGPUSample([]GPUDevice{{Index: 0, Name: "NVIDIA L4", UUID: "GPU-0", TemperatureC: celsius}})
+    sample.NodeID = nodeID
+    return sample
+}
+
+func TestEvaluateAlertsTransitions(t *testing.T) {
+    ctx := context.Background()
+    t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    for name, repos := range testRepos(t) {
+        t.Run(name, func(t *testing.T) {
+            svc := NewBastionService(repos)
+            notifier := &recordingNotifier{}
+            svc.SetAlertNotifier(notifier)
+            if err := svc.SetAlertRules([]AlertRule{{Name: "hot", Metric: AlertTemperature, Op: ">", Threshold: 80, ForSeconds: 60}}); err != nil {
+                t.Fatal(err)
+            }
+            // step evaluates one round with node-1's GPU at celsius, or with
+            // node-1 missing when celsius is negative, and returns the alerts.
+            step := func(offset time.Duration, celsius float64) []Alert {
+                t.Helper()
+                var samples []GPUSample
+                if celsius >= 0 {
+                    samples = append(samples, temperatureSample("node-1", celsius))
+                }
+                if err := svc.EvaluateAlerts(ctx, samples, t0.Add(offset)); err != nil {
+                    t.Fatal(err)
+                }
+                alerts, err := svc.ListAlerts(ctx, "", 0)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                return alerts
+            }
+
+            alerts := step(0, 85)
+            if len(alerts) != 1 || alerts[0].State != AlertPending || alerts[0].Value != 85 {
+                t.Fatalf("after a first breach: %+v, want one pending alert", alerts)
+            }
+            // A pending alert that clears is dropped, not resolved.
+            if alerts := step(30*time.Second, 70); len(alerts) != 0 {
+                t.Fatalf("after the breach cleared: %+v, want none", alerts)
+            }
+            alerts = step(40*time.Second, 90)
+            if len(alerts) != 1 || alerts[0].State != AlertPending || !alerts[0].StartedAt.Equal(t0.Add(40*time.Second)) {
+                t.Fatalf("after a new breach: %+v, want a pending alert started anew", alerts)
+            }
+            id := alerts[0].ID
+            // 59s into the breach is still short of For.
+            if alerts := step(99*time.Second, 91); alerts[0].State != AlertPending {
+                t.Fatalf("59s into the breach: %+v, want pending", alerts)
+            }
+            alerts = step(100*time.Second, 92)
+            if len(alerts) != 1 || alerts[0].ID != id || alerts[0].State != AlertFiring || alerts[0].FiredAt == nil || alerts[0].Value != 92 {
+                t.Fatalf("60s into the breach: %+v, want alert %s firing", alerts, id)
+            }
+            // A node missing from a round is no evidence it recovered.
+            if alerts := step(110*time.Second, -1); alerts[0].State != AlertFiring {
+                t.Fatalf("without a reading: %+v, want still firing", alerts)
+            }
+            alerts = step(120*time.Second, 75)
+            if len(alerts) != 1 || alerts[0].ID != id || alerts[0].State != AlertResolved || alerts[0].ResolvedAt == nil {
+                t.Fatalf("after recovering: %+v, want alert %s resolved", alerts, id)
+            }
+            // A breach after resolving opens a new alert.
+            alerts = step(130*time.Second, 95)
+            if len(alerts) != 2 || alerts[0].ID == id || alerts[0].State != AlertPending {
+                t.Fatalf("after breaching again: %+v, want a new pending alert", alerts)
+            }
+            if got, want := notifier.take(), []AlertState{AlertFiring, AlertResolved}; !reflect.DeepEqual(got, want) {
+                t.Errorf("notified %v, want %v", got, want)
+            }
+        })
+    }
+}
+
+func TestEvaluateAlertsRetriesNotifications(t *testing.T) {
+    ctx := context.Background()
+    t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    svc := NewBastionService(NewInMemoryRepos())
+    notifier := &recordingNotifier{failing: true}
+    svc.SetAlertNotifier(notifier)
+    if err := svc.SetAlertRules([]AlertRule{{Name: "hot", Metric: AlertTemperature, Op: ">", Threshold: 80}}); err != nil {
+        t.Fatal(err)
+    }
+    round := func(offset time.Duration, celsius float64) {
+        t.Helper()
+        if err := svc.EvaluateAlerts(ctx, []GPUSample{temperatureSample("node-1", celsius)}, t0.Add(offset)); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // With no For, a breach fires at once, but the webhook is down.
+    round(0, 90)
+    notifier.failing = false
+    round(10*time.Second, 90)
+    if got := notifier.take(); !reflect.DeepEqual(got, []AlertState{AlertFiring}) {
+        t.Fatalf("notified %v after the webhook came back, want the firing retried once", got)
+    }
+    round(20*time.Second, 90)
+    if got := notifier.take(); len(got) != 0 {
+        t.Fatalf("notified %v again for an announced alert", got)
+    }
+
+    // A resolution that fails to deliver is retried though it is no longer
+    // active.
+    notifier.failing = true
+    round(30*time.Second, 60)
+    notifier.failing = false
+    round(40*time.Second, 60)
+    if got := notifier.take(); !reflect.DeepEqual(got, []AlertState{AlertResolved}) {
+        t.Fatalf("notified %v, want the resolution retried once", got)
+    }
+
+    // Removing the rule resolves what it raised.
+    round(50*time.Second, 90)
+    if err := svc.SetAlertRules(nil); err != nil {
+        t.Fatal(err)
+    }
+    round(60*time.Second, 90)
+    if got := notifier.take(); !reflect.DeepEqual(got, []AlertState{AlertFiring, AlertResolved}) {
+        t.Errorf("notified %v, want the new alert fired and resolved with its rule", got)
+    }
+}
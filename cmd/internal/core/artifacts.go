@@ -0,0 +1,122 @@
+package core
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "path"
+    "strings"
+)
+
+func artifactBlobKey(executionID, name string) string {
+    return "executions/" + executionID + "/artifacts/" + name
+}
+
+// ValidateArtifactPattern accepts glob patterns that stay inside the
+// script's working directory: relative, and never climbing out with "..".
+func ValidateArtifactPattern(pattern string) error {
+    pattern = strings.ReplaceAll(pattern, `\`, "/")
+    if strings.HasPrefix(pattern, "/") {
+        return fmt.Errorf("must be relative to the working directory")
+    }
+    for _, part := range strings.Split(pattern, "/") {
+        if part == ".." {
+            return fmt.Errorf("must not contain ..")
+        }
+    }
+    if _, err := path.Match(pattern, ""); err != nil {
+        return err
+    }
+    return nil
+}
+
+func validateArtifactPatterns(patterns []string) error {
+    for _, p := range patterns {
+        if err := ValidateArtifactPattern(strings.TrimSpace(p)); err != nil {
+            return invalidf("artifact pattern %q: %v", p, err)
+        }
+    }
+    return nil
+}
+
+// storeArtifacts streams the files the daemon collected into the blob store
+// and returns their metadata for the execution record. The daemon's copies
+// are discarded afterwards. Without a blob store the files are listed but not
+// kept.
+func (s *BastionService) storeArtifacts(ctx context.Context, node Node, executionID string, files []ArtifactFile) []Artifact {
+    if len(files) == 0 {
+        return nil
+    }
+    staged := false
+    out := make([]Artifact, 0, len(files))
+    for _, f := range files {
+        a := Artifact{Name: f.Name, Size: f.Size, SHA256: f.SHA256, Skipped: f.Skipped}
+        if a.Skipped == "" {
+            staged = true
+            key := artifactBlobKey(executionID, f.Name)
+            switch {
+            case s.blobs == nil:
+                a.Skipped = "no blob store configured"
+            case validateBlobKey(key) != nil:
+                a.Skipped = "unsupported file name"
+            default:
+                if err := s.copyArtifact(ctx, node, executionID, f, key); err != nil {
+                    log.Printf("store artifact %s of %s: %v", f.Name, executionID, err)
+                    a.Skipped = "storage failed"
+                } else {
+                    a.Ref = key
+                }
+            }
+        }
+        out = append(out, a)
+    }
+    if staged {
+        q := url.Values{"execution_id": {executionID}}
+        if resp, err := s.daemonRequest(ctx, node, http.MethodDelete, "/api/v1/artifacts", q, ""); err != nil {
+            log.Printf("discard artifacts of %s: %v", executionID, err)
+        } else {
+            resp.Body.Close()
+        }
+    }
+    return out
+}
+
+// copyArtifact streams one staged artifact from the daemon into the blob
+// store under key.
+func (s *BastionService) copyArtifact(ctx context.Context, node Node, executionID string, f ArtifactFile, key string) error {
+    q := url.Values{"execution_id": {executionID}, "name": {f.Name}}
+    resp, err := s.daemonRequest(ctx, node, http.MethodGet, "/api/v1/artifacts", q, "")
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    n, err := s.blobs.Put(ctx, key, resp.Body)
+    if err == nil && n != f.Size {
+        err = fmt.Errorf("got %d bytes, want %d", n, f.Size)
+    }
+    if err != nil {
+        s.blobs.Delete(ctx, key)
+        return err
+    }
+    return nil
+}
+
+// OpenArtifact opens a stored artifact of an execution for download.
+func (s *BastionService) OpenArtifact(ctx context.Context, execRecord Execution, name string) (*BlobReadSeeker, BlobInfo, error) {
+    for _, a := range execRecord.Artifacts {
+        if a.Name != name {
+            continue
+        }
+        if a.Ref == "" || s.blobs == nil {
+            return nil, BlobInfo{}, fmt.Errorf("artifact %s was not stored: %s", name, a.Skipped)
+        }
+        info, err := s.blobs.Stat(ctx, a.Ref)
+        if err != nil {
+            return nil, BlobInfo{}, err
+        }
+        return NewBlobReadSeeker(ctx, s.blobs, a.Ref, info.Size), info, nil
+    }
+    return nil, BlobInfo{}, fmt.Errorf("unknown artifact %s: %w", name, ErrNotFound)
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+    "context"
+    "log"
+    "sort"
+    "time"
+)
+
+// recordAudit stores who did what; err marks the attempt as failed and is
+// kept as the detail.
+func (s *BastionService) recordAudit(ctx context.Context, action, nodeID, target, detail string, err error) {
+    event := AuditEvent{
+        ID:      randomID("audit"),
+        At:      time.Now().UTC(),
+        Actor:   PrincipalFrom(ctx).Name,
+        Action:  action,
+        NodeID:  nodeID,
+        Target:  target,
+        Detail:  detail,
+        Success: err == nil,
+    }
+    if err != nil {
+        event.Detail = err.Error()
+    }
+    // An audit write must not turn a completed action into a reported failure.
+    if _, err := s.audit.Save(ctx, event); err != nil {
+        log.Printf("audit %s by %s: %v", action, event.Actor, err)
+    }
+}
+
+func (s *BastionService) ListAuditEvents(ctx context.Context) ([]AuditEvent, error) {
+    list, err := s.audit.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    sort.Slice(list, func(i, j int) bool {
+        return list[i].At.After(list[j].At)
+    })
+    return list, nil
+}
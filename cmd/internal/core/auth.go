@@ -0,0 +1,37 @@
+package core
+
+import "context"
+
+const (
+    RoleAdmin = "admin"
+)
+
+// Principal is the authenticated caller of a bastion API request.
+type Principal struct {
+    Name  string   `json:"name"`
+    Roles []string `json:"roles,omitempty"`
+}
+
+func (p Principal) HasRole(role string) bool {
+    for _, r := range p.Roles {
+        if r == role || r == RoleAdmin {
+            return true
+        }
+    }
+    return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+    return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller attached to ctx. Calls made outside an
+// HTTP request (startup, background jobs) act as "system".
+func PrincipalFrom(ctx context.Context) Principal {
+    if p, ok := ctx.Value(principalKey{}).(Principal); ok {
+        return p
+    }
+    return Principal{Name: "system", Roles: []string{RoleAdmin}}
+}
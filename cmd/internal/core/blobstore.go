@@ -0,0 +1,103 @@
+package core
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+    "time"
+)
+
+// ErrBlobNotFound is returned by BlobStore implementations for missing keys.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps large execution data (full outputs, artifacts) outside the
+// database. Keys are slash-separated relative paths.
+type BlobStore interface {
+    Put(ctx context.Context, key string, r io.Reader) (int64, error)
+    // Get streams the blob starting at offset. A negative length reads to the end.
+    Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+    Stat(ctx context.Context, key string) (BlobInfo, error)
+    Delete(ctx context.Context, key string) error
+}
+
+type BlobInfo struct {
+    Size    int64
+    ModTime time.Time
+}
+
+func validateBlobKey(key string) error {
+    if key == "" || strings.HasPrefix(key, "/") {
+        return fmt.Errorf("invalid blob key %q", key)
+    }
+    for _, part := range strings.Split(key, "/") {
+        if part == "" || part == "." || part == ".." {
+            return fmt.Errorf("invalid blob key %q", key)
+        }
+    }
+    return nil
+}
+
+// BlobReadSeeker adapts a blob to io.ReadSeeker by issuing ranged Gets, so it
+// can be handed to http.ServeContent for Range request support.
+type BlobReadSeeker struct {
+    ctx    context.Context
+    store  BlobStore
+    key    string
+    size   int64
+    offset int64
+    body   io.ReadCloser
+}
+
+func NewBlobReadSeeker(ctx context.Context, store BlobStore, key string, size int64) *BlobReadSeeker {
+    return &BlobReadSeeker{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (b *BlobReadSeeker) Read(p []byte) (int, error) {
+    if b.offset >= b.size {
+        return 0, io.EOF
+    }
+    if b.body == nil {
+        body, err := b.store.Get(b.ctx, b.key, b.offset, -1)
+        if err != nil {
+            return 0, err
+        }
+        b.body = body
+    }
+    n, err := b.body.Read(p)
+    b.offset += int64(n)
+    return n, err
+}
+
+func (b *BlobReadSeeker) Seek(offset int64, whence int) (int64, error) {
+    var abs int64
+    switch whence {
+    case io.SeekStart:
+        abs = offset
+    case io.SeekCurrent:
+        abs = b.offset + offset
+    case io.SeekEnd:
+        abs = b.size + offset
+    default:
+        return 0, errors.New("invalid whence")
+    }
+    if abs < 0 {
+        return 0, errors.New("negative position")
+    }
+    if abs != b.offset && b.body != nil {
+        b.body.Close()
+        b.body = nil
+    }
+    b.offset = abs
+    return abs, nil
+}
+
+func (b *BlobReadSeeker) Close() error {
+    if b.body == nil {
+        return nil
+    }
+    err := b.body.Close()
+    b.body = nil
+    return err
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// LocalBlobStore stores blobs as files under a root directory.
+type LocalBlobStore struct {
+    root string
+}
+
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+    if err := os.MkdirAll(root, 0o750); err != nil {
+        return nil, fmt.Errorf("create blob dir: %w", err)
+    }
+    return &LocalBlobStore{root: root}, nil
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+    if err := validateBlobKey(key); err != nil {
+        return "", err
+    }
+    return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return 0, err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+        return 0, fmt.Errorf("create blob dir: %w", err)
+    }
+    // Write to a temp file first so readers never see a partial blob.
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+    if err != nil {
+        return 0, fmt.Errorf("create blob: %w", err)
+    }
+    n, err := io.Copy(tmp, r)
+    if closeErr := tmp.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+        return 0, fmt.Errorf("write blob: %w", err)
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        os.Remove(tmp.Name())
+        return 0, fmt.Errorf("commit blob: %w", err)
+    }
+    return n, nil
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return nil, err
+    }
+    f, err := os.Open(path)
+    if err != nil {
+        if errors.Is(err, os.ErrNotExist) {
+            return nil, ErrBlobNotFound
+        }
+        return nil, fmt.Errorf("open blob: %w", err)
+    }
+    if offset > 0 {
+        if _, err := f.Seek(offset, io.SeekStart); err != nil {
+            f.Close()
+            return nil, fmt.Errorf("seek blob: %w", err)
+        }
+    }
+    if length < 0 {
+        return f, nil
+    }
+    return struct {
+        io.Reader
+        io.Closer
+    }{io.LimitReader(f, length), f}, nil
+}
+
+func (s *LocalBlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return BlobInfo{}, err
+    }
+    info, err := os.Stat(path)
+    if err != nil {
+        if errors.Is(err, os.ErrNotExist) {
+            return BlobInfo{}, ErrBlobNotFound
+        }
+        return BlobInfo{}, fmt.Errorf("stat blob: %w", err)
+    }
+    return BlobInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+    path, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return fmt.Errorf("delete blob: %w", err)
+    }
+    return nil
+}
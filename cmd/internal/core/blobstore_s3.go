@@ -0,0 +1,249 @@
+package core
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// S3Config points an S3BlobStore at AWS S3 or any S3-compatible server
+// (MinIO, Ceph RGW, ...). Requests use path-style addressing.
+type S3Config struct {
+    Endpoint  string
+    Bucket    string
+    Region    string
+    AccessKey string
+    SecretKey string
+    // Prefix is prepended to every key, e.g. "bastion/".
+    Prefix string
+}
+
+// S3BlobStore talks to the S3 REST API directly with SigV4 signing to avoid
+// pulling in the AWS SDK for four calls.
+type S3BlobStore struct {
+    cfg    S3Config
+    client *http.Client
+}
+
+func NewS3BlobStore(cfg S3Config) (*S3BlobStore, error) {
+    if cfg.Endpoint == "" || cfg.Bucket == "" {
+        return nil, fmt.Errorf("s3 endpoint and bucket are required")
+    }
+    if cfg.Region == "" {
+        cfg.Region = "us-east-1"
+    }
+    cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+    return &S3BlobStore{cfg: cfg, client: &http.Client{}}, nil
+}
+
+func (s *S3BlobStore) objectURL(key string) (*url.URL, error) {
+    if err := validateBlobKey(key); err != nil {
+        return nil, err
+    }
+    u, err := url.Parse(s.cfg.Endpoint + "/" + s.cfg.Bucket + "/" + s.cfg.Prefix + key)
+    if err != nil {
+        return nil, fmt.Errorf("object url: %w", err)
+    }
+    // Send exactly the encoding that gets signed.
+    u.RawPath = s3EscapePath(u.Path)
+    return u, nil
+}
+
+// Put buffers the body to a temp file first: S3 needs the length and the
+// payload hash up front.
+func (s *S3BlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+    u, err := s.objectURL(key)
+    if err != nil {
+        return 0, err
+    }
+    tmp, err := os.CreateTemp("", "bastion-s3-*")
+    if err != nil {
+        return 0, fmt.Errorf("buffer blob: %w", err)
+    }
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+    h := sha256.New()
+    n, err := io.Copy(io.MultiWriter(tmp, h), r)
+    if err != nil {
+        return 0, fmt.Errorf("buffer blob: %w", err)
+    }
+    if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+        return 0, fmt.Errorf("buffer blob: %w", err)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), tmp)
+    if err != nil {
+        return 0, err
+    }
+    req.ContentLength = n
+    s.sign(req, hex.EncodeToString(h.Sum(nil)))
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return 0, fmt.Errorf("s3 put: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        return 0, s3Error("put", resp)
+    }
+    return n, nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+    u, err := s.objectURL(key)
+    if err != nil {
+        return nil, err
+    }
+    if length == 0 {
+        // bytes=N-(N-1) is not a valid range; S3 would ignore it and send
+        // the whole object.
+        return io.NopCloser(strings.NewReader("")), nil
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+    if err != nil {
+        return nil, err
+    }
+    switch {
+    case length >= 0:
+        req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+    case offset > 0:
+        req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+    }
+    s.sign(req, emptyPayloadHash)
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("s3 get: %w", err)
+    }
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+        defer resp.Body.Close()
+        if resp.StatusCode == http.StatusNotFound {
+            return nil, ErrBlobNotFound
+        }
+        return nil, s3Error("get", resp)
+    }
+    return resp.Body, nil
+}
+
+func (s *S3BlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+    u, err := s.objectURL(key)
+    if err != nil {
+        return BlobInfo{}, err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+    if err != nil {
+        return BlobInfo{}, err
+    }
+    s.sign(req, emptyPayloadHash)
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return BlobInfo{}, fmt.Errorf("s3 head: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusNotFound {
+        return BlobInfo{}, ErrBlobNotFound
+    }
+    if resp.StatusCode != http.StatusOK {
+        return BlobInfo{}, s3Error("head", resp)
+    }
+    size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+    modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+    return BlobInfo{Size: size, ModTime: modTime}, nil
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+    u, err := s.objectURL(key)
+    if err != nil {
+        return err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+    if err != nil {
+        return err
+    }
+    s.sign(req, emptyPayloadHash)
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("s3 delete: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+        return s3Error("delete", resp)
+    }
+    return nil
+}
+
+func s3Error(op string, resp *http.Response) error {
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    return fmt.Errorf("s3 %s: status %d: %s", op, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds AWS Signature Version 4 headers for the s3 service.
+func (s *S3BlobStore) sign(req *http.Request, payloadHash string) {
+    now := time.Now().UTC()
+    amzDate := now.Format("20060102T150405Z")
+    day := now.Format("20060102")
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+    canonicalHeaders := "host:" + req.URL.Host + "\n" +
+        "x-amz-content-sha256:" + payloadHash + "\n" +
+        "x-amz-date:" + amzDate + "\n"
+    canonicalRequest := strings.Join([]string{
+        req.Method,
+        s3EscapePath(req.URL.Path),
+        req.URL.Query().Encode(),
+        canonicalHeaders,
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+
+    scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+    key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+    key = hmacSHA256(key, s.cfg.Region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath applies SigV4's URI encoding to each path segment.
+func s3EscapePath(p string) string {
+    segments := strings.Split(p, "/")
+    for i, seg := range segments {
+        var b strings.Builder
+        for _, c := range []byte(seg) {
+            if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+                b.WriteByte(c)
+            } else {
+                fmt.Fprintf(&b, "%%%02X", c)
+            }
+        }
+        segments[i] = b.String()
+    }
+    return strings.Join(segments, "/")
+}
+
+func sha256Hex(s string) string {
+    sum := sha256.Sum256([]byte(s))
+    return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    m := hmac.New(sha256.New, key)
+    m.Write([]byte(data))
+    return m.Sum(nil)
+}
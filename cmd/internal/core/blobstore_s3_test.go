@@ -0,0 +1,296 @@
+package core
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// s3StandIn is a minimal in-memory S3 in the way MinIO behaves: path-style
+// objects, Range GETs (an unsatisfiable range is ignored and the whole
+// object sent), and SigV4 checked against its own copy of the secret.
+type s3StandIn struct {
+    accessKey, secretKey, region string
+
+    mu       sync.Mutex
+    objects  map[string][]byte
+    requests int
+}
+
+func newS3StandIn(t *testing.T) (*s3StandIn, *S3BlobStore) {
+    t.Helper()
+    s := &s3StandIn{accessKey: "AKIDEXAMPLE", secretKey: "secret/EXAMPLEKEY", region: "eu-west-1", objects: map[string][]byte{}}
+    srv := httptest.NewServer(s)
+    t.Cleanup(srv.Close)
+    store, err := NewS3BlobStore(S3Config{
+        Endpoint:  srv.URL,
+        Bucket:    "bucket",
+        Region:    s.region,
+        AccessKey: s.accessKey,
+        SecretKey: s.secretKey,
+        Prefix:    "bastion/",
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s, store
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err := s.verify(r, body); err != nil {
+        http.Error(w, "SignatureDoesNotMatch: "+err.Error(), http.StatusForbidden)
+        return
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.requests++
+    key := r.URL.Path
+    obj, ok := s.objects[key]
+    switch r.Method {
+    case http.MethodPut:
+        s.objects[key] = body
+    case http.MethodHead, http.MethodGet:
+        if !ok {
+            http.Error(w, "NoSuchKey", http.StatusNotFound)
+            return
+        }
+        w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+        start, end, partial := parseS3Range(r.Header.Get("Range"), int64(len(obj)))
+        if !partial {
+            start, end = 0, int64(len(obj))-1
+        }
+        w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+        status := http.StatusOK
+        if partial {
+            w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj)))
+            status = http.StatusPartialContent
+        }
+        w.WriteHeader(status)
+        if r.Method == http.MethodGet {
+            w.Write(obj[start : end+1])
+        }
+    case http.MethodDelete:
+        delete(s.objects, key)
+        w.WriteHeader(http.StatusNoContent)
+    default:
+        w.WriteHeader(http.StatusMethodNotAllowed)
+    }
+}
+
+func (s *s3StandIn) stored(key string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    _, ok := s.objects[key]
+    return ok
+}
+
+func (s *s3StandIn) requestCount() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.requests
+}
+
+// parseS3Range reads "bytes=a-b" or "bytes=a-". ok is false for anything
+// S3 would ignore, including a range that ends before it starts.
+func parseS3Range(h string, size int64) (start, end int64, ok bool) {
+    spec, found := strings.CutPrefix(h, "bytes=")
+    if !found {
+        return 0, 0, false
+    }
+    from, to, _ := strings.Cut(spec, "-")
+    start, err := strconv.ParseInt(from, 10, 64)
+    if err != nil || start >= size {
+        return 0, 0, false
+    }
+    end = size - 1
+    if to != "" {
+        if end, err = strconv.ParseInt(to, 10, 64); err != nil || end < start {
+            return 0, 0, false
+        }
+        end = min(end, size-1)
+    }
+    return start, end, true
+}
+
+// verify recomputes the request's SigV4 signature from what arrived on the
+// wire, independently of S3BlobStore.sign.
+func (s *s3StandIn) verify(r *http.Request, body []byte) error {
+    auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+    if !ok {
+        return errors.New("not a SigV4 request")
+    }
+    fields := map[string]string{}
+    for _, part := range strings.Split(auth, ", ") {
+        k, v, _ := strings.Cut(part, "=")
+        fields[k] = v
+    }
+    amzDate := r.Header.Get("X-Amz-Date")
+    at, err := time.Parse("20060102T150405Z", amzDate)
+    if err != nil || time.Since(at).Abs() > 15*time.Minute {
+        return fmt.Errorf("bad x-amz-date %q", amzDate)
+    }
+    scope := at.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+    if fields["Credential"] != s.accessKey+"/"+scope {
+        return fmt.Errorf("credential %q", fields["Credential"])
+    }
+    payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+    sum := sha256.Sum256(body)
+    if payloadHash != hex.EncodeToString(sum[:]) {
+        return errors.New("payload hash does not match the body")
+    }
+    signed := strings.Split(fields["SignedHeaders"], ";")
+    if !sort.StringsAreSorted(signed) || !strings.Contains(fields["SignedHeaders"], "host") {
+        return fmt.Errorf("signed headers %q", fields["SignedHeaders"])
+    }
+    var canonicalHeaders strings.Builder
+    for _, h := range signed {
+        v := r.Header.Get(h)
+        if h == "host" {
+            v = r.Host
+        }
+        canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+    }
+    canonicalRequest := strings.Join([]string{
+        r.Method,
+        r.URL.EscapedPath(),
+        r.URL.Query().Encode(),
+        canonicalHeaders.String(),
+        fields["SignedHeaders"],
+        payloadHash,
+    }, "\n")
+    crSum := sha256.Sum256([]byte(canonicalRequest))
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crSum[:])
+    key := hmacSHA256([]byte("AWS4"+s.secretKey), at.Format("20060102"))
+    key = hmacSHA256(key, s.region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); fields["Signature"] != want {
+        return errors.New("signature mismatch")
+    }
+    return nil
+}
+
+func readBlob(t *testing.T, store BlobStore, key string, offset, length int64) string {
+    t.Helper()
+    rc, err := store.Get(context.Background(), key, offset, length)
+    if err != nil {
+        t.Fatalf("Get(%q, %d, %d): %v", key, offset, length, err)
+    }
+    defer rc.Close()
+    b, err := io.ReadAll(rc)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(b)
+}
+
+func TestS3BlobStoreRoundTrip(t *testing.T) {
+    ctx := context.Background()
+    standIn, store := newS3StandIn(t)
+    // Spaces, plus signs and non-ASCII all need SigV4's path encoding.
+    key := "executions/exec-1/artifacts/out dir/résumé+1.txt"
+    content := "hello, world"
+
+    n, err := store.Put(ctx, key, strings.NewReader(content))
+    if err != nil {
+        t.Fatalf("Put: %v", err)
+    }
+    if n != int64(len(content)) {
+        t.Fatalf("Put wrote %d bytes, want %d", n, len(content))
+    }
+    if !standIn.stored("/bucket/bastion/" + key) {
+        t.Fatalf("object not stored under the prefixed path-style key")
+    }
+    info, err := store.Stat(ctx, key)
+    if err != nil {
+        t.Fatalf("Stat: %v", err)
+    }
+    if info.Size != int64(len(content)) || info.ModTime.IsZero() {
+        t.Fatalf("Stat = %+v", info)
+    }
+
+    for _, tc := range []struct {
+        offset, length int64
+        want           string
+    }{
+        {0, -1, "hello, world"},
+        {7, -1, "world"},
+        {7, 5, "world"},
+        {0, 5, "hello"},
+        {11, 1, "d"},
+    } {
+        if got := readBlob(t, store, key, tc.offset, tc.length); got != tc.want {
+            t.Errorf("Get(%d, %d) = %q, want %q", tc.offset, tc.length, got, tc.want)
+        }
+    }
+
+    before := standIn.requestCount()
+    if got := readBlob(t, store, key, 4, 0); got != "" {
+        t.Errorf("Get(4, 0) = %q, want nothing", got)
+    }
+    if standIn.requestCount() != before {
+        t.Errorf("Get with length 0 sent a request")
+    }
+
+    // BlobReadSeeker serves Range requests through ranged Gets.
+    rs := NewBlobReadSeeker(ctx, store, key, info.Size)
+    if _, err := rs.Seek(-5, io.SeekEnd); err != nil {
+        t.Fatal(err)
+    }
+    tail, err := io.ReadAll(rs)
+    rs.Close()
+    if err != nil || string(tail) != "world" {
+        t.Errorf("read after Seek = %q, %v", tail, err)
+    }
+
+    if err := store.Delete(ctx, key); err != nil {
+        t.Fatalf("Delete: %v", err)
+    }
+    if _, err := store.Get(ctx, key, 0, -1); !errors.Is(err, ErrBlobNotFound) {
+        t.Errorf("Get after Delete: %v, want ErrBlobNotFound", err)
+    }
+    if _, err := store.Stat(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+        t.Errorf("Stat after Delete: %v, want ErrBlobNotFound", err)
+    }
+    if err := store.Delete(ctx, key); err != nil {
+        t.Errorf("Delete of a missing key: %v", err)
+    }
+}
+
+func TestS3BlobStoreRejectsBadSignature(t *testing.T) {
+    standIn, store := newS3StandIn(t)
+    store.cfg.SecretKey = "not-the-secret"
+    _, err := store.Put(context.Background(), "k", bytes.NewReader([]byte("x")))
+    if err == nil || !strings.Contains(err.Error(), "403") {
+        t.Fatalf("Put with the wrong secret: %v, want a 403", err)
+    }
+    if standIn.stored("/bucket/bastion/k") {
+        t.Fatalf("badly signed Put was stored")
+    }
+}
+
+func TestS3BlobStoreRejectsInvalidKeys(t *testing.T) {
+    _, store := newS3StandIn(t)
+    for _, key := range []string{"", "/abs", "a/../b", "a//b"} {
+        if _, err := store.Put(context.Background(), key, strings.NewReader("x")); err == nil {
+            t.Errorf("Put(%q) succeeded", key)
+        }
+    }
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+    "database/sql"
+    "fmt"
+    "strings"
+
+    _ "github.com/jackc/pgx/v5/stdlib"
+    _ "modernc.org/sqlite"
+)
+
+const (
+    DialectPostgres = "postgres"
+    DialectSQLite   = "sqlite"
+)
+
+// sqliteScheme prefixes SQLite DSNs: sqlite:///var/lib/bastion.db.
+const sqliteScheme = "sqlite://"
+
+// sqliteParams configure every SQLite connection: foreign keys on as in
+// PostgreSQL, WAL with a busy timeout so readers and the writer coexist,
+// write-locking transactions up front so concurrent writers queue instead of
+// deadlocking, and times stored as Unix nanoseconds so they compare and sort
+// as numbers.
+const sqliteParams = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_integer_format=unix_nano&_inttotime=1"
+
+// Database is an open SQL database and the dialect its schema is kept in.
+type Database struct {
+    *sql.DB
+    Dialect string
+}
+
+// OpenDatabase connects to the database a DSN names, without touching its
+// schema: sqlite:///path/to/file.db for SQLite, anything else for PostgreSQL.
+func OpenDatabase(dsn string) (*Database, error) {
+    driver, name, dialect := "pgx", dsn, DialectPostgres
+    if strings.HasPrefix(dsn, sqliteScheme) {
+        path := strings.TrimPrefix(dsn, sqliteScheme)
+        if path == "" || path == "/" {
+            return nil, fmt.Errorf("open db: %s names no file", dsn)
+        }
+        sep := "?"
+        if strings.Contains(path, "?") {
+            sep = "&"
+        }
+        driver, name, dialect = "sqlite", path+sep+sqliteParams, DialectSQLite
+    }
+    db, err := sql.Open(driver, name)
+    if err != nil {
+        return nil, fmt.Errorf("open db: %w", err)
+    }
+    if err := db.Ping(); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("ping db: %w", err)
+    }
+    return &Database{DB: db, Dialect: dialect}, nil
+}
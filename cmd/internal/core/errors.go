@@ -0,0 +1,36 @@
+package core
+
+import (
+    "errors"
+    "fmt"
+)
+
+var (
+    // ErrNotFound is returned by repositories when no record has the given id.
+    ErrNotFound = errors.New("not found")
+    // ErrInvalid marks errors caused by the request rather than the bastion.
+    ErrInvalid = errors.New("invalid request")
+    // ErrUnavailable marks requests the bastion cannot serve right now, such
+    // as a GPU job no node has room for.
+    ErrUnavailable = errors.New("unavailable")
+)
+
+// invalidf builds an ErrInvalid error whose message is just the formatted text.
+func invalidf(format string, args ...interface{}) error {
+    return invalidError{msg: fmt.Sprintf(format, args...)}
+}
+
+type invalidError struct{ msg string }
+
+func (e invalidError) Error() string { return e.msg }
+
+func (e invalidError) Is(target error) bool { return target == ErrInvalid }
+
+// unknown labels a lookup miss with what was looked up, keeping ErrNotFound
+// in the chain; other errors pass through.
+func unknown(err error, kind, id string) error {
+    if errors.Is(err, ErrNotFound) {
+        return fmt.Errorf("unknown %s %s: %w", kind, id, ErrNotFound)
+    }
+    return err
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+    "context"
+    "encoding/base64"
+    "slices"
+    "sort"
+    "strings"
+    "time"
+)
+
+const (
+    DefaultExecutionPageSize = 50
+    MaxExecutionPageSize     = 500
+)
+
+// authorizeExecution checks that the caller may see a run and its outputs:
+// when grants are enforced, non-admins only see runs they triggered and runs
+// on nodes they hold an active execute grant for.
+func (s *BastionService) authorizeExecution(ctx context.Context, execRecord Execution) error {
+    if !s.grantsApply(ctx) || execRecord.TriggeredBy == PrincipalFrom(ctx).Name {
+        return nil
+    }
+    _, err := s.authorizeNode(ctx, execRecord.NodeID, ActionExecute)
+    return err
+}
+
+// ListExecutions returns one page of execution summaries matching filter,
+// newest first unless filter.Ascending is set, limited to the runs
+// authorizeExecution would let the caller see.
+func (s *BastionService) ListExecutions(ctx context.Context, filter ExecutionFilter) (ExecutionPage, error) {
+    filter.VisibleTo, filter.VisibleNodes = "", nil
+    if s.grantsApply(ctx) {
+        grants, err := s.activeGrants(ctx, "", ActionExecute)
+        if err != nil {
+            return ExecutionPage{}, err
+        }
+        filter.VisibleTo = PrincipalFrom(ctx).Name
+        filter.VisibleNodes = make([]string, 0, len(grants))
+        for nodeID := range grants {
+            filter.VisibleNodes = append(filter.VisibleNodes, nodeID)
+        }
+        sort.Strings(filter.VisibleNodes)
+    }
+    switch filter.Status {
+    case "", ExecutionPending, ExecutionRunning, ExecutionSucceeded, ExecutionFailed, ExecutionLost:
+    default:
+        return ExecutionPage{}, invalidf("unknown status %q", filter.Status)
+    }
+    if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+        return ExecutionPage{}, invalidf("from must be before to")
+    }
+    if filter.Cursor != "" {
+        after, err := decodeExecutionCursor(filter.Cursor)
+        if err != nil {
+            return ExecutionPage{}, err
+        }
+        filter.After = &after
+    }
+    limit := filter.Limit
+    if limit <= 0 {
+        limit = DefaultExecutionPageSize
+    }
+    if limit > MaxExecutionPageSize {
+        limit = MaxExecutionPageSize
+    }
+    // One extra row tells whether another page follows.
+    filter.Limit = limit + 1
+    items, err := s.executions.List(ctx, filter)
+    if err != nil {
+        return ExecutionPage{}, err
+    }
+    page := ExecutionPage{Items: items}
+    if len(items) > limit {
+        page.Items = items[:limit]
+        last := page.Items[limit-1]
+        page.NextCursor = encodeExecutionCursor(ExecutionCursor{StartedAt: last.StartedAt, ID: last.ID})
+    }
+    var positions map[string]int
+    for i, item := range page.Items {
+        if item.Status != ExecutionPending {
+            continue
+        }
+        if positions == nil {
+            if positions, err = s.queuePositions(ctx); err != nil {
+                return ExecutionPage{}, err
+            }
+        }
+        page.Items[i].QueuePosition = positions[item.ID]
+    }
+    return page, nil
+}
+
+func encodeExecutionCursor(c ExecutionCursor) string {
+    raw := c.StartedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+    return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeExecutionCursor(cursor string) (ExecutionCursor, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return ExecutionCursor{}, invalidf("malformed cursor")
+    }
+    at, id, ok := strings.Cut(string(raw), "|")
+    if !ok || id == "" {
+        return ExecutionCursor{}, invalidf("malformed cursor")
+    }
+    started, err := time.Parse(time.RFC3339Nano, at)
+    if err != nil {
+        return ExecutionCursor{}, invalidf("malformed cursor")
+    }
+    return ExecutionCursor{StartedAt: started, ID: id}, nil
+}
+
+// matches applies the filter to e the way the SQL WHERE clause does,
+// including the cursor bound.
+func (f ExecutionFilter) matches(e Execution) bool {
+    switch {
+    case f.CommandID != "" && e.CommandID != f.CommandID,
+        f.NodeID != "" && e.NodeID != f.NodeID,
+        f.Status != "" && e.Status != f.Status,
+        f.TriggeredBy != "" && e.TriggeredBy != f.TriggeredBy,
+        f.ExitCode != nil && e.ExitCode != *f.ExitCode,
+        f.VisibleTo != "" && e.TriggeredBy != f.VisibleTo && !slices.Contains(f.VisibleNodes, e.NodeID),
+        !f.From.IsZero() && e.StartedAt.Before(f.From),
+        !f.To.IsZero() && !e.StartedAt.Before(f.To):
+        return false
+    }
+    if f.After != nil {
+        return f.before(f.After.StartedAt, f.After.ID, e.StartedAt, e.ID)
+    }
+    return true
+}
+
+// before reports whether (at1, id1) sorts ahead of (at2, id2) in the
+// filter's order.
+func (f ExecutionFilter) before(at1 time.Time, id1 string, at2 time.Time, id2 string) bool {
+    if !at1.Equal(at2) {
+        return at1.Before(at2) == f.Ascending
+    }
+    return id1 != id2 && (id1 < id2) == f.Ascending
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+    "context"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+)
+
+// testRepos returns fresh in-memory and SQLite repositories, so one test
+// covers both implementations of each query.
+func testRepos(t *testing.T) map[string]Repositories {
+    t.Helper()
+    db, err := OpenDatabase("sqlite://" + filepath.Join(t.TempDir(), "bastion.db"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.DB.Close() })
+    sqlRepos, err := NewSQLRepos(context.Background(), db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return map[string]Repositories{"memory": NewInMemoryRepos(), "sqlite": sqlRepos}
+}
+
+// saveTestCommand stores a command and a node for executions to refer to.
+func saveTestCommand(t *testing.T, repos Repositories, commandID, nodeID string) {
+    t.Helper()
+    ctx := context.Background()
+    if _, err := repos.Commands.Save(ctx, Command{ID: commandID, Name: commandID, Script: "true"}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := repos.Nodes.Save(ctx, Node{ID: nodeID, Name: nodeID, Address: "http://127.0.0.1:1"}); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestDecodeExecutionCursor(t *testing.T) {
+    want := ExecutionCursor{StartedAt: time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC), ID: "exec|with|bars"}
+    got, err := decodeExecutionCursor(encodeExecutionCursor(want))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !got.StartedAt.Equal(want.StartedAt) || got.ID != want.ID {
+        t.Errorf("round trip = %+v, want %+v", got, want)
+    }
+    enc := base64.RawURLEncoding.EncodeToString
+    for name, cursor := range map[string]string{
+        "not base64": "!!!",
+        "padded":     base64.URLEncoding.EncodeToString([]byte("2026-03-01T12:00:00Z|a")),
+        "no id":      enc([]byte("2026-03-01T12:00:00Z|")),
+        "no time":    enc([]byte("exec-1")),
+        "bad time":   enc([]byte("yesterday|exec-1")),
+    } {
+        if _, err := decodeExecutionCursor(cursor); !errors.Is(err, ErrInvalid) {
+            t.Errorf("%s: err = %v, want ErrInvalid", name, err)
+        }
+    }
+}
+
+func TestExecutionFilterBefore(t *testing.T) {
+    t0 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+    t1 := t0.Add(time.Millisecond)
+    for _, tc := range []struct {
+        ascending bool
+        at1       time.Time
+        id1       string
+        at2       time.Time
+        id2       string
+        want      bool
+    }{
+        {false, t1, "a", t0, "b", true},
+        {false, t0, "b", t1, "a", false},
+        {true, t0, "b", t1, "a", true},
+        // Ties on started_at fall back to the id, in the same direction.
+        {false, t0, "b", t0, "a", true},
+        {true, t0, "a", t0, "b", true},
+        {true, t0, "b", t0, "a", false},
+        // Nothing sorts before itself, which keeps the cursor exclusive.
+        {false, t0, "a", t0, "a", false},
+        {true, t0, "a", t0, "a", false},
+    } {
+        f := ExecutionFilter{Ascending: tc.ascending}
+        if got := f.before(tc.at1, tc.id1, tc.at2, tc.id2); got != tc.want {
+            t.Errorf("ascending=%v before(%s %s, %s %s) = %v, want %v", tc.ascending, tc.at1.Format(time.StampMilli), tc.id1, tc.at2.Format(time.StampMilli), tc.id2, got, tc.want)
+        }
+    }
+}
+
+func TestListExecutionsPaging(t *testing.T) {
+    ctx := context.Background()
+    base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+    for name, repos := range testRepos(t) {
+        t.Run(name, func(t *testing.T) {
+            saveTestCommand(t, repos, "cmd-1", "node-1")
+            // Several executions share a start time so pages split ties.
+            var ids []string
+            for i := 0; i < 11; i++ {
+                exec := Execution{
+                    ID:        fmt.Sprintf("exec-%02d", i),
+                    CommandID: "cmd-1",
+                    NodeID:    "node-1",
+                    Status:    ExecutionSucceeded,
+                    StartedAt: base.Add(time.Duration(i/4) * time.Second),
+                }
+                if _, err := repos.Executions.Save(ctx, exec); err != nil {
+                    t.Fatal(err)
+                }
+                ids = append(ids, exec.ID)
+            }
+            svc := NewBastionService(repos)
+            for _, ascending := range []bool{true, false} {
+                var got []string
+                filter := ExecutionFilter{Ascending: ascending, Limit: 3}
+                for pages := 0; ; pages++ {
+                    if pages > len(ids) {
+                        t.Fatalf("ascending=%v: paging does not end", ascending)
+                    }
+                    page, err := svc.ListExecutions(ctx, filter)
+                    if err != nil {
+                        t.Fatal(err)
+                    }
+                    for _, item := range page.Items {
+                        got = append(got, item.ID)
+                    }
+                    if page.NextCursor == "" {
+                        break
+                    }
+                    filter.Cursor = page.NextCursor
+                }
+                want := ids
+                if !ascending {
+                    want = make([]string, len(ids))
+                    for i, id := range ids {
+                        want[len(ids)-1-i] = id
+                    }
+                }
+                if !reflect.DeepEqual(got, want) {
+                    t.Errorf("ascending=%v: paged through %v, want %v", ascending, got, want)
+                }
+            }
+            if _, err := svc.ListExecutions(ctx, ExecutionFilter{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalid) {
+                t.Errorf("bad cursor: err = %v, want ErrInvalid", err)
+            }
+        })
+    }
+}
+
+func TestExecutionVisibilityUnderGrants(t *testing.T) {
+    ctx := context.Background()
+    alice := WithPrincipal(ctx, Principal{Name: "alice"})
+    admin := WithPrincipal(ctx, Principal{Name: "root", Roles: []string{RoleAdmin}})
+    for name, repos := range testRepos(t) {
+        t.Run(name, func(t *testing.T) {
+            saveTestCommand(t, repos, "cmd-1", "node-1")
+            saveTestCommand(t, repos, "cmd-1", "node-2")
+            base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+            for i, run := range []struct{ node, user string }{{"node-1", "bob"}, {"node-2", "bob"}, {"node-2", "alice"}} {
+                exec := Execution{ID: fmt.Sprintf("exec-%d", i+1), CommandID: "cmd-1", NodeID: run.node, Status: ExecutionSucceeded, StartedAt: base.Add(time.Duration(i) * time.Second), TriggeredBy: run.user}
+                if _, err := repos.Executions.Save(ctx, exec); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            start, end := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+            if _, err := repos.Grants.Save(ctx, AccessGrant{ID: "grant-1", User: "alice", NodeID: "node-1", Action: ActionExecute, Status: GrantApproved, RequestedAt: start, StartsAt: &start, ExpiresAt: &end}); err != nil {
+                t.Fatal(err)
+            }
+            svc := NewBastionService(repos)
+            list := func(ctx context.Context) []string {
+                t.Helper()
+                page, err := svc.ListExecutions(ctx, ExecutionFilter{Ascending: true})
+                if err != nil {
+                    t.Fatal(err)
+                }
+                var ids []string
+                for _, item := range page.Items {
+                    ids = append(ids, item.ID)
+                }
+                return ids
+            }
+            all := []string{"exec-1", "exec-2", "exec-3"}
+            if got := list(alice); !reflect.DeepEqual(got, all) {
+                t.Errorf("grants off: alice sees %v, want %v", got, all)
+            }
+
+            svc.RequireGrants(true, time.Hour)
+            // exec-1 ran on the node alice holds a grant for, exec-3 is hers.
+            if got, want := list(alice), []string{"exec-1", "exec-3"}; !reflect.DeepEqual(got, want) {
+                t.Errorf("alice sees %v, want %v", got, want)
+            }
+            if got := list(admin); !reflect.DeepEqual(got, all) {
+                t.Errorf("admin sees %v, want %v", got, all)
+            }
+            for id, allowed := range map[string]bool{"exec-1": true, "exec-2": false, "exec-3": true} {
+                _, err := svc.GetExecution(alice, id)
+                if allowed && err != nil {
+                    t.Errorf("alice getting %s: %v", id, err)
+                }
+                if !allowed && !errors.Is(err, ErrAccessDenied) {
+                    t.Errorf("alice getting %s: %v, want ErrAccessDenied", id, err)
+                }
+            }
+        })
+    }
+}
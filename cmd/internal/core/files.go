@@ -0,0 +1,208 @@
+package core
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "sync"
+)
+
+// PutFile streams body to path on a node. The daemon verifies spec.SHA256
+// when set and only moves the file into place once it matches.
+func (s *BastionService) PutFile(ctx context.Context, nodeID string, spec FileSpec, body io.Reader) (FileInfo, error) {
+    info, err := s.putFile(ctx, nodeID, spec, body)
+    s.recordAudit(ctx, "file.put", nodeID, spec.Path, fmt.Sprintf("%d bytes sha256=%s", info.Size, info.SHA256), err)
+    return info, err
+}
+
+func (s *BastionService) putFile(ctx context.Context, nodeID string, spec FileSpec, body io.Reader) (FileInfo, error) {
+    node, err := s.getNode(ctx, nodeID)
+    if err != nil {
+        return FileInfo{}, err
+    }
+    if strings.TrimSpace(spec.Path) == "" {
+        return FileInfo{}, invalidf("path is required")
+    }
+    if _, err := s.authorizeNode(ctx, nodeID, ActionFiles); err != nil {
+        return FileInfo{}, err
+    }
+    q := url.Values{"path": {spec.Path}}
+    if spec.Mode != "" {
+        q.Set("mode", spec.Mode)
+    }
+    if spec.Owner != "" {
+        q.Set("owner", spec.Owner)
+    }
+    target := strings.TrimRight(node.Address, "/") + "/api/v1/files?" + q.Encode()
+    httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, target, body)
+    if err != nil {
+        return FileInfo{}, fmt.Errorf("build request: %w", err)
+    }
+    httpReq.Header.Set("Content-Type", "application/octet-stream")
+    if spec.SHA256 != "" {
+        httpReq.Header.Set("X-Content-Sha256", spec.SHA256)
+    }
+    // Transfers can be large; don't apply the client's whole-request timeout.
+    resp, err := http.DefaultClient.Do(httpReq)
+    if err != nil {
+        return FileInfo{}, fmt.Errorf("request failed: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return FileInfo{}, fmt.Errorf("daemon status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+    }
+    var info FileInfo
+    if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+        return FileInfo{}, fmt.Errorf("decode response: %w", err)
+    }
+    return info, nil
+}
+
+// GetFile opens path on a node for download. The response carries the
+// file's SHA-256 in X-Content-Sha256; the caller must close the body.
+func (s *BastionService) GetFile(ctx context.Context, nodeID, path, byteRange string) (*http.Response, error) {
+    resp, err := s.getFile(ctx, nodeID, path, byteRange)
+    detail := ""
+    if resp != nil {
+        detail = "sha256=" + resp.Header.Get("X-Content-Sha256")
+    }
+    s.recordAudit(ctx, "file.get", nodeID, path, detail, err)
+    return resp, err
+}
+
+func (s *BastionService) getFile(ctx context.Context, nodeID, path, byteRange string) (*http.Response, error) {
+    node, err := s.getNode(ctx, nodeID)
+    if err != nil {
+        return nil, err
+    }
+    if strings.TrimSpace(path) == "" {
+        return nil, invalidf("path is required")
+    }
+    if _, err := s.authorizeNode(ctx, nodeID, ActionFiles); err != nil {
+        return nil, err
+    }
+    target := strings.TrimRight(node.Address, "/") + "/api/v1/files?" + url.Values{"path": {path}}.Encode()
+    httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+    if err != nil {
+        return nil, fmt.Errorf("build request: %w", err)
+    }
+    if byteRange != "" {
+        httpReq.Header.Set("Range", byteRange)
+    }
+    resp, err := http.DefaultClient.Do(httpReq)
+    if err != nil {
+        return nil, fmt.Errorf("request failed: %w", err)
+    }
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        resp.Body.Close()
+        return nil, fmt.Errorf("daemon status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+    }
+    return resp, nil
+}
+
+// DefaultMaxCopyBytes matches the daemon's default upload limit
+// (DAEMON_FILE_MAX_BYTES).
+const DefaultMaxCopyBytes = 1 << 30
+
+// SetMaxCopyBytes caps the content CopyFile spools; set it to the daemons'
+// upload limit. A non-positive max uses the default.
+func (s *BastionService) SetMaxCopyBytes(max int64) {
+    if max <= 0 {
+        max = DefaultMaxCopyBytes
+    }
+    s.maxCopyBytes = max
+}
+
+// FileCopySource is the content CopyFile distributes: Path on node NodeID
+// when NodeID is set, and Body otherwise.
+type FileCopySource struct {
+    NodeID string
+    Path   string
+    Body   io.Reader
+}
+
+// CopyFile writes the same content to path on every node in nodeIDs. Every
+// target is authorized before the source is read. The source is spooled to
+// a local temp file once, up to the copy limit, so each node gets its own
+// reader and the checksum is known up front; uploads run concurrently and
+// one node failing does not stop the others.
+func (s *BastionService) CopyFile(ctx context.Context, nodeIDs []string, spec FileSpec, src FileCopySource) ([]FileCopyResult, error) {
+    if len(nodeIDs) == 0 {
+        return nil, invalidf("at least one node_id is required")
+    }
+    if strings.TrimSpace(spec.Path) == "" {
+        return nil, invalidf("path is required")
+    }
+    for _, nodeID := range nodeIDs {
+        if _, err := s.authorizeNode(ctx, nodeID, ActionFiles); err != nil {
+            s.recordAudit(ctx, "file.put", nodeID, spec.Path, "copy", err)
+            return nil, err
+        }
+    }
+    source := src.Body
+    if src.NodeID != "" {
+        resp, err := s.GetFile(ctx, src.NodeID, src.Path, "")
+        if err != nil {
+            return nil, err
+        }
+        defer resp.Body.Close()
+        source = resp.Body
+        if spec.SHA256 == "" {
+            spec.SHA256 = resp.Header.Get("X-Content-Sha256")
+        }
+    }
+    if source == nil {
+        return nil, invalidf("no source content")
+    }
+    max := s.maxCopyBytes
+    if max <= 0 {
+        max = DefaultMaxCopyBytes
+    }
+
+    tmp, err := os.CreateTemp("", "bastion-copy-")
+    if err != nil {
+        return nil, err
+    }
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+    h := sha256.New()
+    size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(source, max+1))
+    if err != nil {
+        return nil, fmt.Errorf("read source: %w", err)
+    }
+    if size > max {
+        return nil, invalidf("source exceeds the %d byte upload limit", max)
+    }
+    sum := hex.EncodeToString(h.Sum(nil))
+    if spec.SHA256 != "" && !strings.EqualFold(spec.SHA256, sum) {
+        return nil, invalidf("checksum mismatch: got %s", sum)
+    }
+    spec.SHA256 = sum
+
+    results := make([]FileCopyResult, len(nodeIDs))
+    var wg sync.WaitGroup
+    for i, nodeID := range nodeIDs {
+        wg.Add(1)
+        go func(i int, nodeID string) {
+            defer wg.Done()
+            results[i] = FileCopyResult{NodeID: nodeID}
+            info, err := s.PutFile(ctx, nodeID, spec, io.NewSectionReader(tmp, 0, size))
+            if err != nil {
+                results[i].Error = err.Error()
+                return
+            }
+            results[i].File = &info
+        }(i, nodeID)
+    }
+    wg.Wait()
+    return results, nil
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// readCounter counts the bytes read through it.
+type readCounter struct {
+    r io.Reader
+    n atomic.Int64
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+    n, err := c.r.Read(p)
+    c.n.Add(int64(n))
+    return n, err
+}
+
+func TestCopyFileAuthorizesTargetsFirst(t *testing.T) {
+    ctx := context.Background()
+    var uploads atomic.Int32
+    daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        uploads.Add(1)
+        n, _ := io.Copy(io.Discard, r.Body)
+        json.NewEncoder(w).Encode(FileInfo{Path: r.URL.Query().Get("path"), Size: n})
+    }))
+    defer daemon.Close()
+
+    repos := NewInMemoryRepos()
+    svc := NewBastionService(repos)
+    svc.RequireGrants(true, time.Hour)
+    for _, id := range []string{"node-1", "node-2"} {
+        if _, err := repos.Nodes.Save(ctx, Node{ID: id, Name: id, Address: daemon.URL}); err != nil {
+            t.Fatal(err)
+        }
+    }
+    start, end := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+    if _, err := repos.Grants.Save(ctx, AccessGrant{ID: "grant-1", User: "alice", NodeID: "node-1", Action: ActionFiles, Status: GrantApproved, RequestedAt: start, StartsAt: &start, ExpiresAt: &end}); err != nil {
+        t.Fatal(err)
+    }
+    alice := WithPrincipal(ctx, Principal{Name: "alice"})
+    spec := FileSpec{Path: "/etc/motd"}
+
+    body := &readCounter{r: strings.NewReader("hello")}
+    if _, err := svc.CopyFile(alice, []string{"node-1", "node-2"}, spec, FileCopySource{Body: body}); !errors.Is(err, ErrAccessDenied) {
+        t.Fatalf("copy to a node without a grant: %v, want ErrAccessDenied", err)
+    }
+    if n := body.n.Load(); n != 0 || uploads.Load() != 0 {
+        t.Fatalf("denied copy read %d bytes and made %d uploads", n, uploads.Load())
+    }
+
+    results, err := svc.CopyFile(alice, []string{"node-1"}, spec, FileCopySource{Body: strings.NewReader("hello")})
+    if err != nil || len(results) != 1 || results[0].Error != "" || results[0].File.Size != 5 {
+        t.Fatalf("copy to the granted node = %+v, %v", results, err)
+    }
+}
+
+func TestCopyFileSizeLimit(t *testing.T) {
+    ctx := context.Background()
+    daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        n, _ := io.Copy(io.Discard, r.Body)
+        json.NewEncoder(w).Encode(FileInfo{Size: n})
+    }))
+    defer daemon.Close()
+
+    repos := NewInMemoryRepos()
+    svc := NewBastionService(repos)
+    svc.SetMaxCopyBytes(10)
+    if _, err := repos.Nodes.Save(ctx, Node{ID: "node-1", Name: "node-1", Address: daemon.URL}); err != nil {
+        t.Fatal(err)
+    }
+    spec := FileSpec{Path: "/etc/motd"}
+    if results, err := svc.CopyFile(ctx, []string{"node-1"}, spec, FileCopySource{Body: strings.NewReader("0123456789")}); err != nil || results[0].Error != "" {
+        t.Fatalf("copy at the limit = %+v, %v", results, err)
+    }
+    body := &readCounter{r: strings.NewReader(strings.Repeat("x", 1<<20))}
+    if _, err := svc.CopyFile(ctx, []string{"node-1"}, spec, FileCopySource{Body: body}); !errors.Is(err, ErrInvalid) {
+        t.Fatalf("copy over the limit: %v, want ErrInvalid", err)
+    }
+    if n := body.n.Load(); n > 11 {
+        t.Errorf("read %d bytes of an oversized source, want at most 11", n)
+    }
+}
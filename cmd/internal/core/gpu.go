@@ -0,0 +1,58 @@
+package core
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// GPUSamples takes a GPU sample from every node. A node that cannot be
+// sampled reports zeros rather than failing the whole listing.
+func (s *BastionService) GPUSamples(ctx context.Context) ([]GPUSample, error) {
+    nodes, err := s.nodes.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now().UTC()
+    samples := make([]GPUSample, 0, len(nodes))
+    for _, n := range nodes {
+        sample, err := s.fetchGPUSample(ctx, n)
+        if err != nil {
+            log.Printf("gpu fetch error for node %s: %v", n.ID, err)
+            sample = GPUSample{Timestamp: now.Unix()}
+        }
+        sample.NodeID = n.ID
+        samples = append(samples, sample)
+    }
+    return samples, nil
+}
+
+// fetchGPUSample asks a node's daemon for its GPU telemetry.
+func (s *BastionService) fetchGPUSample(ctx context.Context, node Node) (GPUSample, error) {
+    ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+    defer cancel()
+    endpoint := strings.TrimRight(node.Address, "/") + "/api/v1/gpu"
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+    if err != nil {
+        return GPUSample{}, err
+    }
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return GPUSample{}, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return GPUSample{}, fmt.Errorf("daemon returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+    }
+    var sample GPUSample
+    if err := json.NewDecoder(resp.Body).Decode(&sample); err != nil {
+        return GPUSample{}, fmt.Errorf("decode gpu sample: %w", err)
+    }
+    return sample, nil
+}
@@ -0,0 +1,270 @@
+package core
+
+import (
+    "context"
+    "log"
+    "sort"
+    "time"
+)
+
+const (
+    DefaultGPUCollectInterval = 15 * time.Second
+    // MaxGPUHistoryPoints bounds how many buckets a history query returns
+    // per node.
+    MaxGPUHistoryPoints = 2000
+    // defaultGPUHistoryPoints is roughly how many buckets a query without a
+    // step is answered with.
+    defaultGPUHistoryPoints = 300
+)
+
+// GPURollups are the resolutions older readings are averaged into, finest
+// first.
+var GPURollups = []time.Duration{time.Minute, time.Hour}
+
+// GPUHistoryPolicy says how often GPU telemetry is collected and how long
+// each resolution is kept. Raw samples older than RawRetention are averaged
+// into one-minute buckets, those older than MinuteRetention into one-hour
+// buckets, and those older than HourRetention are dropped.
+type GPUHistoryPolicy struct {
+    Interval        time.Duration
+    RawRetention    time.Duration
+    MinuteRetention time.Duration
+    HourRetention   time.Duration
+}
+
+// DefaultGPUHistoryPolicy keeps a day of raw samples, a week of minutes and
+// three months of hours.
+var DefaultGPUHistoryPolicy = GPUHistoryPolicy{
+    Interval:        DefaultGPUCollectInterval,
+    RawRetention:    24 * time.Hour,
+    MinuteRetention: 7 * 24 * time.Hour,
+    HourRetention:   90 * 24 * time.Hour,
+}
+
+// SetGPUHistory sets how RunGPUCollector collects and downsamples.
+func (s *BastionService) SetGPUHistory(policy GPUHistoryPolicy) {
+    s.gpuHistory = policy
+}
+
+// RunGPUCollector samples every node's GPUs each interval, evaluates the
+// alert rules against the samples, frees GPUs left reserved by finished
+// executions and downsamples the history once a minute, on the leader only,
+// until ctx is done.
+func (s *BastionService) RunGPUCollector(ctx context.Context) {
+    interval := s.gpuHistory.Interval
+    if interval <= 0 {
+        interval = DefaultGPUCollectInterval
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    var downsampled time.Time
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        if !s.leading(ctx) {
+            continue
+        }
+        samples, err := s.CollectGPUSamples(ctx)
+        if err != nil {
+            log.Printf("collect gpu samples: %v", err)
+        }
+        if samples != nil {
+            if err := s.EvaluateAlerts(ctx, samples, time.Now().UTC()); err != nil {
+                log.Printf("evaluate alerts: %v", err)
+            }
+        }
+        if err := s.releaseStaleGPUs(ctx, time.Now().UTC()); err != nil {
+            log.Printf("release gpus: %v", err)
+        }
+        if time.Since(downsampled) >= time.Minute {
+            downsampled = time.Now()
+            if err := s.DownsampleGPUMetrics(ctx, downsampled); err != nil {
+                log.Printf("downsample gpu metrics: %v", err)
+            }
+        }
+    }
+}
+
+// CollectGPUSamples samples every node's GPUs and stores the readings.
+func (s *BastionService) CollectGPUSamples(ctx context.Context) ([]GPUSample, error) {
+    samples, err := s.GPUSamples(ctx)
+    if err != nil {
+        return nil, err
+    }
+    var metrics []GPUMetric
+    for _, sample := range samples {
+        at := time.Unix(sample.Timestamp, 0).UTC()
+        for _, d := range sample.Devices {
+            d.Processes = nil
+            metrics = append(metrics, GPUMetric{NodeID: sample.NodeID, At: at, Samples: 1, GPUDevice: d})
+        }
+    }
+    if len(metrics) == 0 {
+        return samples, nil
+    }
+    return samples, s.gpuMetrics.Append(ctx, metrics)
+}
+
+// DownsampleGPUMetrics applies the history policy as of now: each
+// resolution's readings past its retention are averaged into the next one,
+// a window at a time, and the coarsest are dropped.
+func (s *BastionService) DownsampleGPUMetrics(ctx context.Context, now time.Time) error {
+    policy := s.gpuHistory
+    from := time.Duration(0)
+    for i, to := range GPURollups {
+        retention := policy.RawRetention
+        if i > 0 {
+            retention = policy.MinuteRetention
+        }
+        if retention > 0 {
+            if err := s.compactGPUMetrics(ctx, from, to, now.Add(-retention).Truncate(to)); err != nil {
+                return err
+            }
+        }
+        from = to
+    }
+    if policy.HourRetention > 0 {
+        if _, err := s.gpuMetrics.DeleteBefore(ctx, from, now.Add(-policy.HourRetention)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// compactGPUMetrics rolls readings at resolution from older than cutoff up
+// into resolution to, in windows of a few hundred target buckets so no pass
+// holds much in memory or in one transaction.
+func (s *BastionService) compactGPUMetrics(ctx context.Context, from, to time.Duration, cutoff time.Time) error {
+    window := 240 * to
+    if from == 0 {
+        window = 60 * to
+    }
+    for {
+        oldest, ok, err := s.gpuMetrics.Oldest(ctx, from)
+        if err != nil || !ok || !oldest.Before(cutoff) {
+            return err
+        }
+        start := oldest.Truncate(to)
+        end := start.Add(window)
+        if end.After(cutoff) {
+            end = cutoff
+        }
+        if _, err := s.gpuMetrics.Compact(ctx, from, to, start, end); err != nil {
+            return err
+        }
+    }
+}
+
+// GPUHistory returns stored GPU samples in q's range averaged into q.Step
+// buckets, per node and oldest first. Without a range it covers the last
+// hour; without a step it picks one giving a few hundred points.
+func (s *BastionService) GPUHistory(ctx context.Context, q GPUQuery) ([]GPUSample, error) {
+    if q.To.IsZero() {
+        q.To = time.Now()
+    }
+    if q.From.IsZero() {
+        q.From = q.To.Add(-time.Hour)
+    }
+    if !q.From.Before(q.To) {
+        return nil, invalidf("from must be before to")
+    }
+    span := q.To.Sub(q.From)
+    switch {
+    case q.Step < 0:
+        return nil, invalidf("step must be positive")
+    case q.Step == 0:
+        q.Step = gpuHistoryStep(span)
+    case span/q.Step > MaxGPUHistoryPoints:
+        return nil, invalidf("step too small: at most %d points per query", MaxGPUHistoryPoints)
+    }
+    metrics, err := s.gpuMetrics.Range(ctx, q.NodeID, q.From, q.To)
+    if err != nil {
+        return nil, err
+    }
+    return gpuSamplesFromMetrics(rollupGPUMetrics(metrics, q.Step)), nil
+}
+
+// gpuHistoryStep picks the smallest round step giving at most
+// defaultGPUHistoryPoints buckets over span.
+func gpuHistoryStep(span time.Duration) time.Duration {
+    steps := []time.Duration{
+        DefaultGPUCollectInterval, time.Minute, 5 * time.Minute, 15 * time.Minute,
+        time.Hour, 6 * time.Hour, 24 * time.Hour,
+    }
+    for _, step := range steps {
+        if span/step <= defaultGPUHistoryPoints {
+            return step
+        }
+    }
+    return span / defaultGPUHistoryPoints
+}
+
+// rollupGPUMetrics averages metrics into resolution-wide buckets per node
+// and device, weighting each by the readings it stands for.
+func rollupGPUMetrics(metrics []GPUMetric, resolution time.Duration) []GPUMetric {
+    buckets := map[gpuMetricKey]GPUMetric{}
+    for _, m := range metrics {
+        m.At = m.At.Truncate(resolution)
+        m.Resolution = resolution
+        if cur, ok := buckets[m.key()]; ok {
+            m = mergeGPUMetrics(cur, m)
+        }
+        buckets[m.key()] = m
+    }
+    out := make([]GPUMetric, 0, len(buckets))
+    for _, m := range buckets {
+        out = append(out, m)
+    }
+    sortGPUMetrics(out)
+    return out
+}
+
+// mergeGPUMetrics combines two readings of one device and bucket into their
+// weighted average. Name, UUID and vendor come from b, the later write.
+func mergeGPUMetrics(a, b GPUMetric) GPUMetric {
+    wa, wb := float64(max(a.Samples, 1)), float64(max(b.Samples, 1))
+    avg := func(x, y float64) float64 { return (x*wa + y*wb) / (wa + wb) }
+    out := b
+    out.Samples = int(wa + wb)
+    out.Utilization = avg(a.Utilization, b.Utilization)
+    out.MemoryUsedMB = int(avg(float64(a.MemoryUsedMB), float64(b.MemoryUsedMB)) + 0.5)
+    out.MemoryTotalMB = max(a.MemoryTotalMB, b.MemoryTotalMB)
+    out.TemperatureC = avg(a.TemperatureC, b.TemperatureC)
+    out.PowerW = avg(a.PowerW, b.PowerW)
+    return out
+}
+
+func sortGPUMetrics(metrics []GPUMetric) {
+    sort.Slice(metrics, func(i, j int) bool {
+        a, b := metrics[i], metrics[j]
+        if !a.At.Equal(b.At) {
+            return a.At.Before(b.At)
+        }
+        if a.NodeID != b.NodeID {
+            return a.NodeID < b.NodeID
+        }
+        return a.Index < b.Index
+    })
+}
+
+// gpuSamplesFromMetrics groups sorted metrics sharing a node and bucket into
+// samples.
+func gpuSamplesFromMetrics(metrics []GPUMetric) []GPUSample {
+    out := []GPUSample{}
+    for i := 0; i < len(metrics); {
+        j := i
+        var devices []GPUDevice
+        for ; j < len(metrics) && metrics[j].NodeID == metrics[i].NodeID && metrics[j].At.Equal(metrics[i].At); j++ {
+            devices = append(devices, metrics[j].GPUDevice)
+        }
+        sample := NewGPUSample(devices)
+        sample.NodeID = metrics[i].NodeID
+        sample.Timestamp = metrics[i].At.Unix()
+        out = append(out, sample)
+        i = j
+    }
+    return out
+}
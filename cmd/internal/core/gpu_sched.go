@@ -0,0 +1,301 @@
+package core
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ErrGPUReserved is returned when a device asked for is already reserved.
+var ErrGPUReserved = errors.New("gpu already reserved")
+
+// errGPUsBusy reports that a claimed run's devices are not free yet.
+var errGPUsBusy = errors.New("gpus busy")
+
+const (
+    // gpuPlacementAttempts bounds how often placement is retried after
+    // losing a device to a concurrent placement.
+    gpuPlacementAttempts = 3
+    // gpuRetryInterval is how long a run whose devices were taken when it
+    // was claimed waits in the queue before it is tried again.
+    gpuRetryInterval = 5 * time.Second
+)
+
+func validateGPURequirement(req GPURequirement) error {
+    if req.Count < 0 || req.MinFreeMemoryMB < 0 {
+        return invalidf("gpu requirements must not be negative")
+    }
+    if req.Count == 0 && (req.MinFreeMemoryMB > 0 || len(req.Nodes) > 0) {
+        return invalidf("gpu min_free_memory_mb and nodes need a gpu count")
+    }
+    for i, id := range req.Nodes {
+        if id == "" || slices.Contains(req.Nodes[:i], id) {
+            return invalidf("gpu nodes must be distinct node IDs")
+        }
+    }
+    return nil
+}
+
+// gpuNodeAllowed reports whether req lets a command run on nodeID.
+func gpuNodeAllowed(req GPURequirement, nodeID string) bool {
+    return len(req.Nodes) == 0 || slices.Contains(req.Nodes, nodeID)
+}
+
+// placeExecution picks the node for an execution of a command that needs
+// GPUs, among those the command's selector names and the caller may execute
+// on. Its devices are reserved when the run starts.
+func (s *BastionService) placeExecution(ctx context.Context, cmd Command) (Node, string, error) {
+    nodes, err := s.nodes.List(ctx)
+    if err != nil {
+        return Node{}, "", err
+    }
+    nodes = slices.DeleteFunc(nodes, func(n Node) bool { return !gpuNodeAllowed(cmd.GPU, n.ID) })
+    if len(nodes) == 0 {
+        return Node{}, "", fmt.Errorf("%w: none of the nodes command %s may run on is registered", ErrUnavailable, cmd.ID)
+    }
+    restricted := s.grantsApply(ctx)
+    var grants map[string]string
+    if restricted {
+        if grants, err = s.activeGrants(ctx, "", ActionExecute); err != nil {
+            return Node{}, "", err
+        }
+    }
+    allowed := nodes[:0]
+    for _, n := range nodes {
+        if _, ok := grants[n.ID]; ok || !restricted {
+            allowed = append(allowed, n)
+        }
+    }
+    if len(allowed) == 0 {
+        err := fmt.Errorf("%w: no active %s grant for any node", ErrAccessDenied, ActionExecute)
+        s.recordAudit(ctx, "execute", "", cmd.ID, "", err)
+        return Node{}, "", err
+    }
+    node, err := s.chooseGPUNode(ctx, cmd.GPU, allowed)
+    if err != nil {
+        return Node{}, "", err
+    }
+    return node, grants[node.ID], nil
+}
+
+// chooseGPUNode picks the node to queue a run needing req on: the one
+// placeGPUs would reserve on now or, when no node has the devices free, the
+// best one with enough devices to wait for.
+func (s *BastionService) chooseGPUNode(ctx context.Context, req GPURequirement, nodes []Node) (Node, error) {
+    samples := s.latestGPUSamples(ctx, nodes)
+    held, err := s.heldGPUs(ctx)
+    if err != nil {
+        return Node{}, err
+    }
+    if node, _, ok := pickGPUs(nodes, samples, held, req); ok {
+        return node, nil
+    }
+    // Held devices are judged as they will be once their runs end.
+    idle := make(map[string]GPUSample, len(samples))
+    for id, sample := range samples {
+        devices := slices.Clone(sample.Devices)
+        for i := range devices {
+            devices[i].MemoryUsedMB = 0
+        }
+        idle[id] = NewGPUSample(devices)
+    }
+    if node, _, ok := pickGPUs(nodes, idle, nil, req); ok {
+        return node, nil
+    }
+    return Node{}, fmt.Errorf("%w: no node has %d GPUs with %d MB of memory", ErrUnavailable, req.Count, req.MinFreeMemoryMB)
+}
+
+func (s *BastionService) heldGPUs(ctx context.Context) (map[gpuDeviceKey]bool, error) {
+    reservations, err := s.gpus.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    held := make(map[gpuDeviceKey]bool, len(reservations))
+    for _, r := range reservations {
+        held[gpuDeviceKey{r.NodeID, r.DeviceIndex}] = true
+    }
+    return held, nil
+}
+
+// placeGPUs reserves req's devices for an execution on one of nodes: the
+// node whose best eligible devices are least utilised, going by the latest
+// telemetry. A device is eligible if it is not reserved and has
+// MinFreeMemoryMB free.
+func (s *BastionService) placeGPUs(ctx context.Context, req GPURequirement, nodes []Node, executionID string) (Node, []int, error) {
+    for attempt := 1; ; attempt++ {
+        samples := s.latestGPUSamples(ctx, nodes)
+        held, err := s.heldGPUs(ctx)
+        if err != nil {
+            return Node{}, nil, err
+        }
+        node, devices, ok := pickGPUs(nodes, samples, held, req)
+        if !ok {
+            return Node{}, nil, fmt.Errorf("%w: no node has %d free GPUs with %d MB free memory", ErrUnavailable, req.Count, req.MinFreeMemoryMB)
+        }
+        now := time.Now().UTC()
+        wanted := make([]GPUReservation, len(devices))
+        for i, index := range devices {
+            wanted[i] = GPUReservation{NodeID: node.ID, DeviceIndex: index, ExecutionID: executionID, ReservedAt: now}
+        }
+        err = s.gpus.Reserve(ctx, wanted)
+        if err == nil {
+            return node, devices, nil
+        }
+        if !errors.Is(err, ErrGPUReserved) || attempt == gpuPlacementAttempts {
+            return Node{}, nil, err
+        }
+    }
+}
+
+// pickGPUs chooses, for each node with enough eligible devices, the least
+// utilised of them, and returns the node where those average lowest. Ties go
+// to the earlier node.
+func pickGPUs(nodes []Node, samples map[string]GPUSample, held map[gpuDeviceKey]bool, req GPURequirement) (Node, []int, bool) {
+    var best Node
+    var bestDevices []int
+    bestScore := -1.0
+    for _, n := range nodes {
+        var eligible []GPUDevice
+        for _, d := range samples[n.ID].Devices {
+            if held[gpuDeviceKey{n.ID, d.Index}] || d.MemoryTotalMB-d.MemoryUsedMB < req.MinFreeMemoryMB {
+                continue
+            }
+            eligible = append(eligible, d)
+        }
+        if len(eligible) < req.Count {
+            continue
+        }
+        sort.SliceStable(eligible, func(i, j int) bool {
+            a, b := eligible[i], eligible[j]
+            if a.Utilization != b.Utilization {
+                return a.Utilization < b.Utilization
+            }
+            return a.MemoryTotalMB-a.MemoryUsedMB > b.MemoryTotalMB-b.MemoryUsedMB
+        })
+        var score float64
+        devices := make([]int, req.Count)
+        for i, d := range eligible[:req.Count] {
+            score += d.Utilization
+            devices[i] = d.Index
+        }
+        score /= float64(req.Count)
+        if bestScore < 0 || score < bestScore {
+            best, bestDevices, bestScore = n, devices, score
+        }
+    }
+    sort.Ints(bestDevices)
+    return best, bestDevices, bestScore >= 0
+}
+
+// latestGPUSamples returns each node's most recent stored GPU sample, asking
+// the daemon directly for nodes the collector has not sampled lately. Nodes
+// that cannot be sampled are left out.
+func (s *BastionService) latestGPUSamples(ctx context.Context, nodes []Node) map[string]GPUSample {
+    now := time.Now()
+    window := max(3*s.gpuHistory.Interval, time.Minute)
+    metrics, err := s.gpuMetrics.Range(ctx, "", now.Add(-window), now.Add(time.Second))
+    if err != nil {
+        log.Printf("latest gpu samples: %v", err)
+    }
+    latest := map[string]time.Time{}
+    byNode := map[string][]GPUDevice{}
+    for _, m := range metrics {
+        if m.Resolution != 0 {
+            continue
+        }
+        switch at := latest[m.NodeID]; {
+        case m.At.After(at):
+            latest[m.NodeID] = m.At
+            byNode[m.NodeID] = []GPUDevice{m.GPUDevice}
+        case m.At.Equal(at):
+            byNode[m.NodeID] = append(byNode[m.NodeID], m.GPUDevice)
+        }
+    }
+    samples := make(map[string]GPUSample, len(nodes))
+    for _, n := range nodes {
+        if devices, ok := byNode[n.ID]; ok {
+            samples[n.ID] = NewGPUSample(devices)
+            continue
+        }
+        sample, err := s.fetchGPUSample(ctx, n)
+        if err != nil {
+            log.Printf("gpu fetch error for node %s: %v", n.ID, err)
+            continue
+        }
+        samples[n.ID] = sample
+    }
+    return samples
+}
+
+// gpuEnv restricts a run to its reserved devices. Indices are nvidia-smi's
+// and rocm-smi's, which follow PCI bus order, so CUDA is told to number
+// devices the same way; HIP honours CUDA_VISIBLE_DEVICES as well.
+func gpuEnv(devices []int) map[string]string {
+    if len(devices) == 0 {
+        return nil
+    }
+    ids := make([]string, len(devices))
+    for i, d := range devices {
+        ids[i] = strconv.Itoa(d)
+    }
+    return map[string]string{
+        "CUDA_VISIBLE_DEVICES": strings.Join(ids, ","),
+        "CUDA_DEVICE_ORDER":    "PCI_BUS_ID",
+    }
+}
+
+// releaseGPUs frees an execution's devices. Failures are logged; the
+// collector's sweep retries them.
+func (s *BastionService) releaseGPUs(ctx context.Context, executionID string) {
+    if err := s.gpus.Release(ctx, executionID); err != nil {
+        log.Printf("execution %s: %v", executionID, err)
+    }
+}
+
+// releaseStaleGPUs frees devices still held by executions that have
+// finished or are gone. Devices are reserved just before the execution is
+// saved as running, so recent reservations are left alone.
+func (s *BastionService) releaseStaleGPUs(ctx context.Context, now time.Time) error {
+    reservations, err := s.gpus.List(ctx)
+    if err != nil {
+        return err
+    }
+    checked := map[string]bool{}
+    for _, r := range reservations {
+        if checked[r.ExecutionID] || now.Sub(r.ReservedAt) < time.Minute {
+            continue
+        }
+        checked[r.ExecutionID] = true
+        rec, err := s.executions.Get(ctx, r.ExecutionID)
+        if err != nil && !errors.Is(err, ErrNotFound) {
+            return err
+        }
+        if err == nil && !rec.Status.Finished() {
+            continue
+        }
+        if err := s.gpus.Release(ctx, r.ExecutionID); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (s *BastionService) ListGPUReservations(ctx context.Context) ([]GPUReservation, error) {
+    return s.gpus.List(ctx)
+}
+
+func sortGPUReservations(reservations []GPUReservation) {
+    sort.Slice(reservations, func(i, j int) bool {
+        a, b := reservations[i], reservations[j]
+        if a.NodeID != b.NodeID {
+            return a.NodeID < b.NodeID
+        }
+        return a.DeviceIndex < b.DeviceIndex
+    })
+}
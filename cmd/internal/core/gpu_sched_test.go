@@ -0,0 +1,218 @@
+package core
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+)
+
+func gpuNodeSample(utilization ...float64) GPUSample {
+    devices := make([]GPUDevice, len(utilization))
+    for i, u := range utilization {
+        devices[i] = GPUDevice{Index: i, Utilization: u, MemoryUsedMB: int(u) * 100, MemoryTotalMB: 16000}
+    }
+    return NewGPUSample(devices)
+}
+
+func TestPickGPUs(t *testing.T) {
+    nodes := []Node{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+    samples := map[string]GPUSample{
+        "a": gpuNodeSample(90, 10, 50, 20),
+        "b": gpuNodeSample(15, 15),
+        // c has not been sampled.
+    }
+    for _, tc := range []struct {
+        name    string
+        held    []gpuDeviceKey
+        req     GPURequirement
+        node    string
+        devices []int
+    }{
+        {name: "least utilised devices", req: GPURequirement{Count: 1}, node: "a", devices: []int{1}},
+        // a's two best average 15, as do b's; the tie goes to the earlier node.
+        {name: "tie", req: GPURequirement{Count: 2}, node: "a", devices: []int{1, 3}},
+        {name: "held device skipped", held: []gpuDeviceKey{{"a", 1}}, req: GPURequirement{Count: 2}, node: "b", devices: []int{0, 1}},
+        {name: "only a has enough", req: GPURequirement{Count: 3}, node: "a", devices: []int{1, 2, 3}},
+        // Only a's device 1 has 14200 MB free; both of b's have 14500.
+        {name: "free memory", req: GPURequirement{Count: 2, MinFreeMemoryMB: 14200}, node: "b", devices: []int{0, 1}},
+        {name: "not enough free memory", req: GPURequirement{Count: 1, MinFreeMemoryMB: 15001}},
+        {name: "all held", held: []gpuDeviceKey{{"a", 0}, {"a", 1}, {"a", 2}, {"a", 3}, {"b", 0}}, req: GPURequirement{Count: 1}, node: "b", devices: []int{1}},
+        {name: "none free", held: []gpuDeviceKey{{"a", 0}, {"a", 1}, {"a", 2}, {"b", 0}}, req: GPURequirement{Count: 2}},
+    } {
+        held := map[gpuDeviceKey]bool{}
+        for _, k := range tc.held {
+            held[k] = true
+        }
+        node, devices, ok := pickGPUs(nodes, samples, held, tc.req)
+        if ok != (tc.node != "") || node.ID != tc.node || !reflect.DeepEqual(devices, tc.devices) {
+            t.Errorf("%s: pickGPUs = %q %v %v, want %q %v", tc.name, node.ID, devices, ok, tc.node, tc.devices)
+        }
+    }
+}
+
+func TestValidateGPURequirement(t *testing.T) {
+    for _, req := range []GPURequirement{{}, {Count: 2, MinFreeMemoryMB: 1}, {Count: 1, Nodes: []string{"a", "b"}}} {
+        if err := validateGPURequirement(req); err != nil {
+            t.Errorf("%+v: %v", req, err)
+        }
+    }
+    for _, req := range []GPURequirement{
+        {Count: -1},
+        {MinFreeMemoryMB: 1},
+        {Nodes: []string{"a"}},
+        {Count: 1, Nodes: []string{"a", ""}},
+        {Count: 1, Nodes: []string{"a", "a"}},
+    } {
+        if err := validateGPURequirement(req); !errors.Is(err, ErrInvalid) {
+            t.Errorf("%+v: err = %v, want ErrInvalid", req, err)
+        }
+    }
+}
+
+func TestPlaceExecutionHonoursNodeSelector(t *testing.T) {
+    ctx := context.Background()
+    repos := NewInMemoryRepos()
+    svc := NewBastionService(repos)
+    now := time.Now().UTC()
+    var metrics []GPUMetric
+    for nodeID, sample := range map[string]GPUSample{"idle": gpuNodeSample(0, 0), "busy": gpuNodeSample(60, 70)} {
+        if _, err := repos.Nodes.Save(ctx, Node{ID: nodeID, Name: nodeID}); err != nil {
+            t.Fatal(err)
+        }
+        for _, d := range sample.Devices {
+            metrics = append(metrics, GPUMetric{NodeID: nodeID, At: now, Samples: 1, GPUDevice: d})
+        }
+    }
+    if err := repos.GPUMetrics.Append(ctx, metrics); err != nil {
+        t.Fatal(err)
+    }
+
+    cmd := Command{ID: "train", GPU: GPURequirement{Count: 1}}
+    if node, _, err := svc.placeExecution(ctx, cmd); err != nil || node.ID != "idle" {
+        t.Fatalf("without a selector: placed on %q, %v; want the idle node", node.ID, err)
+    }
+    cmd.GPU.Nodes = []string{"busy"}
+    if node, _, err := svc.placeExecution(ctx, cmd); err != nil || node.ID != "busy" {
+        t.Fatalf("selecting busy: placed on %q, %v", node.ID, err)
+    }
+    cmd.GPU.Nodes = []string{"gone"}
+    if _, _, err := svc.placeExecution(ctx, cmd); !errors.Is(err, ErrUnavailable) {
+        t.Fatalf("selecting an unregistered node: %v, want ErrUnavailable", err)
+    }
+
+    if _, err := repos.Commands.Save(ctx, Command{ID: "train", Name: "train", Script: "true", GPU: GPURequirement{Count: 1, Nodes: []string{"busy"}}}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := svc.ExecuteCommand(ctx, "train", "idle", 0); !errors.Is(err, ErrInvalid) {
+        t.Errorf("executing on a node outside the selector: %v, want ErrInvalid", err)
+    }
+}
+
+func TestCommandGPUNodesStored(t *testing.T) {
+    ctx := context.Background()
+    for name, repos := range testRepos(t) {
+        want := GPURequirement{Count: 2, MinFreeMemoryMB: 1000, Nodes: []string{"node-a", "node-b"}}
+        if _, err := repos.Commands.Save(ctx, Command{ID: "train", Name: "train", Script: "true", GPU: want}); err != nil {
+            t.Fatal(err)
+        }
+        cmd, err := repos.Commands.Get(ctx, "train")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !reflect.DeepEqual(cmd.GPU, want) {
+            t.Errorf("%s: GPU = %+v, want %+v", name, cmd.GPU, want)
+        }
+    }
+}
+
+func TestQueuedRunReservesGPUsWhenClaimed(t *testing.T) {
+    ctx := context.Background()
+    var mu sync.Mutex
+    var env map[string]string
+    daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var req ExecRequest
+        json.NewDecoder(r.Body).Decode(&req)
+        mu.Lock()
+        env = req.Env
+        mu.Unlock()
+        json.NewEncoder(w).Encode(ExecResponse{Stdout: "ok"})
+    }))
+    defer daemon.Close()
+
+    repos := NewInMemoryRepos()
+    queue := repos.Queue.(*InMemoryQueue)
+    svc := NewBastionService(repos)
+    if _, err := repos.Nodes.Save(ctx, Node{ID: "gpu-node", Name: "gpu-node", Address: daemon.URL}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := repos.Commands.Save(ctx, Command{ID: "train", Name: "train", Script: "true", GPU: GPURequirement{Count: 1}}); err != nil {
+        t.Fatal(err)
+    }
+    if err := repos.GPUMetrics.Append(ctx, []GPUMetric{{NodeID: "gpu-node", At: time.Now().UTC(), Samples: 1, GPUDevice: GPUDevice{Index: 0, MemoryTotalMB: 16000}}}); err != nil {
+        t.Fatal(err)
+    }
+    // The node's one GPU is taken by another run.
+    if err := repos.GPUs.Reserve(ctx, []GPUReservation{{NodeID: "gpu-node", DeviceIndex: 0, ExecutionID: "other", ReservedAt: time.Now()}}); err != nil {
+        t.Fatal(err)
+    }
+
+    // No worker is running, so the run stays queued, holding nothing.
+    waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+    defer cancel()
+    rec, err := svc.ExecuteCommand(waitCtx, "train", "gpu-node", 0)
+    if !errors.Is(err, context.DeadlineExceeded) || rec.Status != ExecutionPending {
+        t.Fatalf("ExecuteCommand = %+v, %v; want it left pending", rec, err)
+    }
+    reservations, err := svc.ListGPUReservations(ctx)
+    if err != nil || len(reservations) != 1 {
+        t.Fatalf("reservations after enqueueing: %+v, %v; want only the other run's", reservations, err)
+    }
+
+    // Claimed while the GPU is taken, the run goes back in line unstarted.
+    job, ok, err := queue.Claim(ctx, "w1", time.Minute, QueuePolicy{})
+    if err != nil || !ok {
+        t.Fatalf("Claim = %v, %v", ok, err)
+    }
+    svc.runJob(ctx, job, time.Minute)
+    if job, err = queue.Get(ctx, rec.ID); err != nil || job.Worker != "" || job.Attempts != 0 || job.NotBefore == nil {
+        t.Fatalf("job after a busy claim = %+v, %v; want it deferred without counting the attempt", job, err)
+    }
+    if _, ok, _ := queue.Claim(ctx, "w1", time.Minute, QueuePolicy{}); ok {
+        t.Fatal("deferred job claimed again at once")
+    }
+    if rec, _ := repos.Executions.Get(ctx, rec.ID); rec.Status != ExecutionPending {
+        t.Fatalf("execution after a busy claim: %+v", rec)
+    }
+
+    // Once the GPU is free the next claim reserves it for the run.
+    if err := repos.GPUs.Release(ctx, "other"); err != nil {
+        t.Fatal(err)
+    }
+    past := time.Now().Add(-time.Second)
+    queue.mu.Lock()
+    job.NotBefore = &past
+    queue.jobs[job.ExecutionID] = job
+    queue.mu.Unlock()
+    if job, ok, err = queue.Claim(ctx, "w1", time.Minute, QueuePolicy{}); err != nil || !ok {
+        t.Fatalf("Claim after the retry interval = %v, %v", ok, err)
+    }
+    svc.runJob(ctx, job, time.Minute)
+    rec, err = repos.Executions.Get(ctx, rec.ID)
+    if err != nil || rec.Status != ExecutionSucceeded || !reflect.DeepEqual(rec.GPUDevices, []int{0}) {
+        t.Fatalf("execution = %+v, %v; want it run on GPU 0", rec, err)
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if env["CUDA_VISIBLE_DEVICES"] != "0" {
+        t.Errorf("daemon got env %v", env)
+    }
+    if reservations, _ := svc.ListGPUReservations(ctx); len(reservations) != 0 {
+        t.Errorf("reservations after the run: %+v", reservations)
+    }
+}
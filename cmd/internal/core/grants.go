@@ -0,0 +1,291 @@
+package core
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "sort"
+    "strings"
+    "time"
+)
+
+const (
+    // RoleApprover may decide other users' access requests.
+    RoleApprover = "approver"
+
+    DefaultMaxGrantDuration = 24 * time.Hour
+)
+
+// ErrAccessDenied is returned when grants are enforced and the caller holds
+// no active grant for the node and action.
+var ErrAccessDenied = errors.New("access denied")
+
+// RequireGrants turns on just-in-time access: node actions by non-admins
+// need an approved, unexpired grant. maxDuration caps what can be requested.
+func (s *BastionService) RequireGrants(enabled bool, maxDuration time.Duration) {
+    s.requireGrants = enabled
+    s.maxGrantDuration = maxDuration
+}
+
+func validAction(action string) bool {
+    switch action {
+    case ActionExecute, ActionTerminal, ActionFiles, ActionTunnel:
+        return true
+    }
+    return false
+}
+
+// RequestAccess files a pending grant for the caller.
+func (s *BastionService) RequestAccess(ctx context.Context, nodeID, action string, duration time.Duration, reason string) (AccessGrant, error) {
+    if _, err := s.getNode(ctx, nodeID); err != nil {
+        return AccessGrant{}, err
+    }
+    if !validAction(action) {
+        return AccessGrant{}, invalidf("unknown action %q", action)
+    }
+    if strings.TrimSpace(reason) == "" {
+        return AccessGrant{}, invalidf("reason is required")
+    }
+    max := s.maxGrantDuration
+    if max <= 0 {
+        max = DefaultMaxGrantDuration
+    }
+    if duration <= 0 || duration > max {
+        return AccessGrant{}, invalidf("duration must be between 1s and %s", max)
+    }
+    grant, err := s.grants.Save(ctx, AccessGrant{
+        ID:              randomID("grant"),
+        User:            PrincipalFrom(ctx).Name,
+        NodeID:          nodeID,
+        Action:          action,
+        Reason:          reason,
+        DurationSeconds: int(duration.Seconds()),
+        Status:          GrantPending,
+        RequestedAt:     time.Now().UTC(),
+    })
+    if err != nil {
+        return AccessGrant{}, err
+    }
+    s.recordAudit(ctx, "grant.request", nodeID, grant.ID, fmt.Sprintf("%s for %s: %s", action, duration, reason), nil)
+    return grant, nil
+}
+
+// ListGrants returns grants newest first. Approvers see everyone's; other
+// callers only their own. status narrows the list when set.
+func (s *BastionService) ListGrants(ctx context.Context, status GrantStatus) ([]AccessGrant, error) {
+    caller := PrincipalFrom(ctx)
+    grants, err := s.grants.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    out := []AccessGrant{}
+    for _, g := range grants {
+        g = expireIfDue(g, now)
+        if !caller.HasRole(RoleApprover) && g.User != caller.Name {
+            continue
+        }
+        if status != "" && g.Status != status {
+            continue
+        }
+        out = append(out, g)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        return out[i].RequestedAt.After(out[j].RequestedAt)
+    })
+    return out, nil
+}
+
+// DecideGrant approves or denies a pending request. The window of an
+// approved grant starts now. Approvers cannot approve their own requests.
+func (s *BastionService) DecideGrant(ctx context.Context, id string, approve bool) (AccessGrant, error) {
+    caller := PrincipalFrom(ctx)
+    action := "grant.deny"
+    if approve {
+        action = "grant.approve"
+    }
+    grant, err := s.decideGrant(ctx, caller, id, approve)
+    s.recordAudit(ctx, action, grant.NodeID, id, "", err)
+    return grant, err
+}
+
+func (s *BastionService) decideGrant(ctx context.Context, caller Principal, id string, approve bool) (AccessGrant, error) {
+    if !caller.HasRole(RoleApprover) {
+        return AccessGrant{}, fmt.Errorf("%w: approver role required", ErrAccessDenied)
+    }
+    s.grantsMu.Lock()
+    defer s.grantsMu.Unlock()
+    grant, err := s.grants.Get(ctx, id)
+    if err != nil {
+        return AccessGrant{}, unknown(err, "grant", id)
+    }
+    if grant.Status != GrantPending {
+        return grant, invalidf("grant %s is %s", id, grant.Status)
+    }
+    if approve && grant.User == caller.Name {
+        return grant, fmt.Errorf("%w: cannot approve your own request", ErrAccessDenied)
+    }
+    now := time.Now().UTC()
+    grant.DecidedBy = caller.Name
+    grant.DecidedAt = &now
+    if approve {
+        expires := now.Add(time.Duration(grant.DurationSeconds) * time.Second)
+        grant.Status = GrantApproved
+        grant.StartsAt = &now
+        grant.ExpiresAt = &expires
+    } else {
+        grant.Status = GrantDenied
+    }
+    return s.grants.Save(ctx, grant)
+}
+
+// RevokeGrant ends a grant early. The grantee or any approver may revoke.
+func (s *BastionService) RevokeGrant(ctx context.Context, id string) (AccessGrant, error) {
+    grant, err := s.revokeGrant(ctx, PrincipalFrom(ctx), id)
+    s.recordAudit(ctx, "grant.revoke", grant.NodeID, id, "", err)
+    return grant, err
+}
+
+func (s *BastionService) revokeGrant(ctx context.Context, caller Principal, id string) (AccessGrant, error) {
+    s.grantsMu.Lock()
+    defer s.grantsMu.Unlock()
+    grant, err := s.grants.Get(ctx, id)
+    if err == nil && !caller.HasRole(RoleApprover) && grant.User != caller.Name {
+        err = ErrNotFound
+    }
+    if err != nil {
+        return AccessGrant{}, unknown(err, "grant", id)
+    }
+    if grant.Status != GrantPending && grant.Status != GrantApproved {
+        return grant, invalidf("grant %s is %s", id, grant.Status)
+    }
+    now := time.Now().UTC()
+    grant.Status = GrantRevoked
+    grant.DecidedBy = caller.Name
+    grant.DecidedAt = &now
+    if grant.ExpiresAt != nil && grant.ExpiresAt.After(now) {
+        grant.ExpiresAt = &now
+    }
+    return s.grants.Save(ctx, grant)
+}
+
+// authorizeNode checks that the caller may perform action on nodeID and
+// returns the grant that allows it. With grants off, or for admins (and
+// background work running as "system"), no grant is needed.
+func (s *BastionService) authorizeNode(ctx context.Context, nodeID, action string) (string, error) {
+    if !s.grantsApply(ctx) {
+        return "", nil
+    }
+    grants, err := s.activeGrants(ctx, nodeID, action)
+    if err != nil {
+        return "", err
+    }
+    grantID, ok := grants[nodeID]
+    if !ok {
+        return "", fmt.Errorf("%w: no active %s grant for node %s", ErrAccessDenied, action, nodeID)
+    }
+    return grantID, nil
+}
+
+// checkRunGrant confirms that the grant a run was authorized under is still
+// active when the run starts, since it may have waited in the queue past the
+// grant's window or the grant may have been revoked meanwhile. Runs recorded
+// without a grant need none.
+func (s *BastionService) checkRunGrant(ctx context.Context, execRecord Execution) error {
+    if execRecord.GrantID == "" {
+        return nil
+    }
+    grant, err := s.grants.Get(ctx, execRecord.GrantID)
+    if err != nil {
+        return fmt.Errorf("%w: grant %s: %v", ErrAccessDenied, execRecord.GrantID, unknown(err, "grant", execRecord.GrantID))
+    }
+    now := time.Now()
+    if !grant.activeAt(now) {
+        return fmt.Errorf("%w: grant %s was %s before the run started", ErrAccessDenied, grant.ID, expireIfDue(grant, now).Status)
+    }
+    return nil
+}
+
+// grantsApply reports whether the caller needs a grant for node actions.
+func (s *BastionService) grantsApply(ctx context.Context) bool {
+    return s.requireGrants && !PrincipalFrom(ctx).HasRole(RoleAdmin)
+}
+
+// activeGrants maps each node the caller holds an active grant for action on
+// (nodeID only, unless it is empty) to the grant that lasts longest.
+func (s *BastionService) activeGrants(ctx context.Context, nodeID, action string) (map[string]string, error) {
+    grants, err := s.grants.Active(ctx, PrincipalFrom(ctx).Name, nodeID, action, time.Now())
+    if err != nil {
+        return nil, err
+    }
+    best := map[string]AccessGrant{}
+    for _, g := range grants {
+        if b, ok := best[g.NodeID]; !ok || g.ExpiresAt.After(*b.ExpiresAt) {
+            best[g.NodeID] = g
+        }
+    }
+    out := make(map[string]string, len(best))
+    for node, g := range best {
+        out[node] = g.ID
+    }
+    return out, nil
+}
+
+func (g AccessGrant) activeAt(t time.Time) bool {
+    return g.Status == GrantApproved && g.StartsAt != nil && g.ExpiresAt != nil &&
+        !t.Before(*g.StartsAt) && t.Before(*g.ExpiresAt)
+}
+
+func expireIfDue(g AccessGrant, now time.Time) AccessGrant {
+    if g.Status == GrantApproved && g.ExpiresAt != nil && !now.Before(*g.ExpiresAt) {
+        g.Status = GrantExpired
+    }
+    return g
+}
+
+// ExpireGrants marks approved grants whose window has passed as expired.
+// authorizeNode never honours them either way; this keeps stored state and
+// the audit log truthful.
+func (s *BastionService) ExpireGrants(ctx context.Context) (int, error) {
+    s.grantsMu.Lock()
+    defer s.grantsMu.Unlock()
+    grants, err := s.grants.List(ctx)
+    if err != nil {
+        return 0, err
+    }
+    now := time.Now()
+    n := 0
+    for _, g := range grants {
+        expired := expireIfDue(g, now)
+        if expired.Status == g.Status {
+            continue
+        }
+        if _, err := s.grants.Save(ctx, expired); err != nil {
+            return n, err
+        }
+        s.recordAudit(ctx, "grant.expire", g.NodeID, g.ID, g.User+" "+g.Action, nil)
+        n++
+    }
+    return n, nil
+}
+
+// RunGrantExpiry calls ExpireGrants every interval until ctx is done, on the
+// leader only.
+func (s *BastionService) RunGrantExpiry(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if !s.leading(ctx) {
+                continue
+            }
+            if _, err := s.ExpireGrants(ctx); err != nil {
+                log.Printf("expire grants: %v", err)
+            }
+        }
+    }
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+    "context"
+    "database/sql"
+    "log"
+    "sync"
+)
+
+// LeaderElector decides which of several bastion replicas sharing a
+// database runs the periodic jobs, so they do not run once per replica.
+type LeaderElector interface {
+    // IsLeader reports whether this replica is the leader right now, trying
+    // to become it if no one is.
+    IsLeader(ctx context.Context) bool
+}
+
+// soleLeader is the elector of a bastion that shares its database with no
+// one.
+type soleLeader struct{}
+
+func (soleLeader) IsLeader(context.Context) bool { return true }
+
+// leaderLockKey is the PostgreSQL advisory lock the leader holds, distinct
+// from migrationLockKey.
+const leaderLockKey int64 = 0x62617374696f6f
+
+// advisoryLeader holds a session-level advisory lock on a dedicated
+// connection. The lock lasts as long as the connection, so a leader that
+// crashes or is cut off from the database hands over to the next replica to
+// ask.
+type advisoryLeader struct {
+    db   *sql.DB
+    mu   sync.Mutex
+    conn *sql.Conn
+}
+
+// NewLeaderElector returns an elector backed by db: advisory locks on
+// PostgreSQL, and leadership always on SQLite, whose database file one
+// bastion owns.
+func NewLeaderElector(db *Database) LeaderElector {
+    if db.Dialect != DialectPostgres {
+        return soleLeader{}
+    }
+    return &advisoryLeader{db: db.DB}
+}
+
+func (l *advisoryLeader) IsLeader(ctx context.Context) bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.conn != nil {
+        if err := l.conn.PingContext(ctx); err == nil {
+            return true
+        }
+        log.Printf("leader connection lost; stepping down")
+        l.conn.Close()
+        l.conn = nil
+    }
+    conn, err := l.db.Conn(ctx)
+    if err != nil {
+        return false
+    }
+    var locked bool
+    if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, leaderLockKey).Scan(&locked); err != nil || !locked {
+        conn.Close()
+        return false
+    }
+    log.Printf("elected leader")
+    l.conn = conn
+    return true
+}
+
+// SetLeaderElector makes the periodic jobs run only while elector says this
+// replica leads.
+func (s *BastionService) SetLeaderElector(elector LeaderElector) {
+    s.leader = elector
+}
+
+func (s *BastionService) leading(ctx context.Context) bool {
+    return s.leader.IsLeader(ctx)
+}
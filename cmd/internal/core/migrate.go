@@ -0,0 +1,300 @@
+package core
+
+import (
+    "context"
+    "database/sql"
+    "embed"
+    "fmt"
+    "io/fs"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql and NNNN_name.down.sql
+// and are applied in version order. They are written for PostgreSQL and
+// translated for SQLite by sqliteDDL. Statements are separated by
+// semicolons, which therefore must not appear inside string literals.
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// migrationLockKey is the PostgreSQL advisory lock held while migrating, so
+// bastions starting together apply each migration once.
+const migrationLockKey int64 = 0x62617374696f6e
+
+// sqliteDDL maps the PostgreSQL column types the migrations use to ones the
+// SQLite driver scans back into the same Go types. SQLite databases never
+// predate the migrations, so ADD COLUMN needs no existence guard there.
+var sqliteDDL = strings.NewReplacer(
+    "TIMESTAMPTZ", "TIMESTAMP",
+    "JSONB", "TEXT",
+    "BYTEA", "BLOB",
+    "ADD COLUMN IF NOT EXISTS", "ADD COLUMN",
+)
+
+type Migration struct {
+    Version int
+    Name    string
+    up      string
+    down    string
+}
+
+// MigrationStatus reports whether a migration has been applied and when.
+type MigrationStatus struct {
+    Version   int        `json:"version"`
+    Name      string     `json:"name"`
+    AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+func loadMigrations() ([]Migration, error) {
+    entries, err := fs.ReadDir(migrationFS, "migrations")
+    if err != nil {
+        return nil, err
+    }
+    byVersion := map[int]*Migration{}
+    for _, e := range entries {
+        file := e.Name()
+        stem, direction := strings.TrimSuffix(file, ".sql"), ""
+        switch {
+        case strings.HasSuffix(stem, ".up"):
+            stem, direction = strings.TrimSuffix(stem, ".up"), "up"
+        case strings.HasSuffix(stem, ".down"):
+            stem, direction = strings.TrimSuffix(stem, ".down"), "down"
+        default:
+            return nil, fmt.Errorf("migration %s: want NNNN_name.up.sql or NNNN_name.down.sql", file)
+        }
+        num, name, _ := strings.Cut(stem, "_")
+        version, err := strconv.Atoi(num)
+        if err != nil || version <= 0 || name == "" {
+            return nil, fmt.Errorf("migration %s: want NNNN_name.up.sql or NNNN_name.down.sql", file)
+        }
+        body, err := migrationFS.ReadFile("migrations/" + file)
+        if err != nil {
+            return nil, err
+        }
+        m := byVersion[version]
+        if m == nil {
+            m = &Migration{Version: version, Name: name}
+            byVersion[version] = m
+        } else if m.Name != name {
+            return nil, fmt.Errorf("migration %d is both %s and %s", version, m.Name, name)
+        }
+        if direction == "up" {
+            m.up = string(body)
+        } else {
+            m.down = string(body)
+        }
+    }
+    out := make([]Migration, 0, len(byVersion))
+    for _, m := range byVersion {
+        if m.up == "" {
+            return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+        }
+        out = append(out, *m)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+    return out, nil
+}
+
+// splitStatements breaks a migration file into statements, dropping
+// comment-only lines.
+func splitStatements(body string) []string {
+    var lines []string
+    for _, line := range strings.Split(body, "\n") {
+        if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+            lines = append(lines, line)
+        }
+    }
+    var stmts []string
+    for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+        if stmt = strings.TrimSpace(stmt); stmt != "" {
+            stmts = append(stmts, stmt)
+        }
+    }
+    return stmts
+}
+
+// Migrator applies the embedded migrations to a database and records them in
+// schema_migrations.
+type Migrator struct {
+    db         *Database
+    migrations []Migration
+}
+
+func NewMigrator(db *Database) (*Migrator, error) {
+    migrations, err := loadMigrations()
+    if err != nil {
+        return nil, fmt.Errorf("load migrations: %w", err)
+    }
+    return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Status lists every migration known to this build, plus any applied ones it
+// does not know about (the database is newer than the binary).
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+    var out []MigrationStatus
+    err := m.locked(ctx, func(conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for _, mig := range m.migrations {
+            st := MigrationStatus{Version: mig.Version, Name: mig.Name}
+            if a, ok := applied[mig.Version]; ok {
+                st.AppliedAt = a.AppliedAt
+                delete(applied, mig.Version)
+            }
+            out = append(out, st)
+        }
+        for _, a := range applied {
+            out = append(out, a)
+        }
+        sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+        return nil
+    })
+    return out, err
+}
+
+// Up applies pending migrations up to and including target, or all of them
+// when target is 0, and returns those it applied.
+func (m *Migrator) Up(ctx context.Context, target int) ([]Migration, error) {
+    var done []Migration
+    err := m.locked(ctx, func(conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for _, mig := range m.migrations {
+            if target > 0 && mig.Version > target {
+                break
+            }
+            if _, ok := applied[mig.Version]; ok {
+                continue
+            }
+            ok, err := m.apply(ctx, conn, mig, true)
+            if err != nil {
+                return err
+            }
+            if ok {
+                done = append(done, mig)
+            }
+        }
+        return nil
+    })
+    return done, err
+}
+
+// Down reverts the most recently applied steps migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+    var done []Migration
+    err := m.locked(ctx, func(conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+            mig := m.migrations[i]
+            if _, ok := applied[mig.Version]; !ok {
+                continue
+            }
+            if mig.down == "" {
+                return fmt.Errorf("migration %04d_%s cannot be reverted: no down file", mig.Version, mig.Name)
+            }
+            ok, err := m.apply(ctx, conn, mig, false)
+            if err != nil {
+                return err
+            }
+            if ok {
+                done = append(done, mig)
+            }
+        }
+        return nil
+    })
+    return done, err
+}
+
+// apply runs one direction of a migration and its bookkeeping in a single
+// transaction. It reports false if another migrator got there first, which
+// on SQLite, where there is no advisory lock, is only visible once this
+// transaction holds the write lock.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) (bool, error) {
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return false, err
+    }
+    defer tx.Rollback()
+    var n int
+    if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version=$1`, mig.Version).Scan(&n); err != nil {
+        return false, fmt.Errorf("read schema_migrations: %w", err)
+    }
+    if (n > 0) == up {
+        return false, nil
+    }
+    body, record, args := mig.down, `DELETE FROM schema_migrations WHERE version=$1`, []interface{}{mig.Version}
+    if up {
+        body, record, args = mig.up, `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`, []interface{}{mig.Version, mig.Name, time.Now().UTC()}
+    }
+    for _, stmt := range splitStatements(m.ddl(body)) {
+        if _, err := tx.ExecContext(ctx, stmt); err != nil {
+            return false, fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+        }
+    }
+    if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+        return false, fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+    }
+    return true, tx.Commit()
+}
+
+func (m *Migrator) ddl(body string) string {
+    if m.db.Dialect == DialectSQLite {
+        return sqliteDDL.Replace(body)
+    }
+    return body
+}
+
+// locked runs fn on a single connection, holding the migration lock on
+// PostgreSQL, after making sure schema_migrations exists.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+    conn, err := m.db.Conn(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    if m.db.Dialect == DialectPostgres {
+        if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+            return fmt.Errorf("acquire migration lock: %w", err)
+        }
+        // Session-level locks die with the session, so a failed unlock only
+        // delays the next migrator until the pool drops this connection.
+        defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+    }
+    if _, err := conn.ExecContext(ctx, m.ddl(`CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL
+        )`)); err != nil {
+        return fmt.Errorf("create schema_migrations: %w", err)
+    }
+    return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]MigrationStatus, error) {
+    rows, err := conn.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+    if err != nil {
+        return nil, fmt.Errorf("read schema_migrations: %w", err)
+    }
+    defer rows.Close()
+    out := map[int]MigrationStatus{}
+    for rows.Next() {
+        var st MigrationStatus
+        var at time.Time
+        if err := rows.Scan(&st.Version, &st.Name, &at); err != nil {
+            return nil, fmt.Errorf("read schema_migrations: %w", err)
+        }
+        st.AppliedAt = &at
+        out[st.Version] = st
+    }
+    return out, rows.Err()
+}
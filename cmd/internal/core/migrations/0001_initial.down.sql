@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS access_grants;
+DROP TABLE IF EXISTS terminal_sessions;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS executions;
+DROP TABLE IF EXISTS nodes;
+DROP TABLE IF EXISTS commands;
@@ -0,0 +1,93 @@
+-- Baseline: the schema ensureSchema used to create. Everything is guarded
+-- so databases created before migrations existed adopt it as version 1.
+
+CREATE TABLE IF NOT EXISTS commands (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT,
+    script TEXT NOT NULL,
+    timeout_seconds INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS nodes (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    address TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS executions (
+    id TEXT PRIMARY KEY,
+    command_id TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    stdout TEXT,
+    stderr TEXT,
+    exit_code INTEGER NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    CONSTRAINT fk_command FOREIGN KEY (command_id) REFERENCES commands(id) ON DELETE CASCADE,
+    CONSTRAINT fk_node FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id TEXT PRIMARY KEY,
+    at TIMESTAMPTZ NOT NULL,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    node_id TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    detail TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS terminal_sessions (
+    id TEXT PRIMARY KEY,
+    node_id TEXT NOT NULL,
+    user_name TEXT NOT NULL,
+    cols INTEGER NOT NULL,
+    rows INTEGER NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    ended_at TIMESTAMPTZ,
+    recording_bytes BIGINT NOT NULL DEFAULT 0,
+    recording BYTEA
+);
+
+CREATE TABLE IF NOT EXISTS access_grants (
+    id TEXT PRIMARY KEY,
+    user_name TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    duration_seconds INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    requested_at TIMESTAMPTZ NOT NULL,
+    decided_by TEXT NOT NULL DEFAULT '',
+    decided_at TIMESTAMPTZ,
+    starts_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS memory_limit_mb INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS cpu_limit_percent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS pids_limit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS isolation TEXT NOT NULL DEFAULT '';
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS artifacts JSONB NOT NULL DEFAULT '[]';
+
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS peak_memory_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS cpu_time_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS stdout_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS stderr_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS stdout_truncated BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS stderr_truncated BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS output_spooled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS stdout_ref TEXT NOT NULL DEFAULT '';
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS stderr_ref TEXT NOT NULL DEFAULT '';
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS artifacts JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS triggered_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS grant_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS executions_started_at_idx ON executions (started_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS executions_command_idx ON executions (command_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS executions_node_idx ON executions (node_id, started_at DESC);
@@ -0,0 +1,11 @@
+CREATE TABLE execution_jobs (
+    execution_id TEXT PRIMARY KEY REFERENCES executions(id) ON DELETE CASCADE,
+    node_id TEXT NOT NULL,
+    command_id TEXT NOT NULL,
+    enqueued_at TIMESTAMPTZ NOT NULL,
+    leased_by TEXT NOT NULL DEFAULT '',
+    lease_expires_at TIMESTAMPTZ,
+    attempts INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX execution_jobs_enqueued_idx ON execution_jobs (enqueued_at, execution_id);
@@ -0,0 +1,5 @@
+ALTER TABLE execution_jobs DROP COLUMN command_limit;
+ALTER TABLE execution_jobs DROP COLUMN node_limit;
+ALTER TABLE execution_jobs DROP COLUMN priority;
+ALTER TABLE nodes DROP COLUMN max_concurrent;
+ALTER TABLE commands DROP COLUMN max_concurrent;
@@ -0,0 +1,5 @@
+ALTER TABLE commands ADD COLUMN max_concurrent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE nodes ADD COLUMN max_concurrent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE execution_jobs ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE execution_jobs ADD COLUMN node_limit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE execution_jobs ADD COLUMN command_limit INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,18 @@
+CREATE TABLE gpu_metrics (
+    node_id TEXT NOT NULL,
+    resolution INTEGER NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    device_index INTEGER NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    uuid TEXT NOT NULL DEFAULT '',
+    samples INTEGER NOT NULL,
+    utilization DOUBLE PRECISION NOT NULL,
+    memory_used_mb DOUBLE PRECISION NOT NULL,
+    memory_total_mb INTEGER NOT NULL,
+    temperature_c DOUBLE PRECISION NOT NULL,
+    power_w DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (node_id, resolution, bucket, device_index)
+);
+
+CREATE INDEX gpu_metrics_resolution_bucket_idx ON gpu_metrics (resolution, bucket);
+CREATE INDEX gpu_metrics_bucket_idx ON gpu_metrics (bucket);
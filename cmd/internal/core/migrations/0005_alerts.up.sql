@@ -0,0 +1,20 @@
+CREATE TABLE alerts (
+    id TEXT PRIMARY KEY,
+    rule TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    device_index INTEGER NOT NULL,
+    device_uuid TEXT NOT NULL DEFAULT '',
+    state TEXT NOT NULL,
+    severity TEXT NOT NULL DEFAULT '',
+    value DOUBLE PRECISION NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    summary TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ NOT NULL,
+    fired_at TIMESTAMPTZ,
+    resolved_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL,
+    notified TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX alerts_state_idx ON alerts (state);
+CREATE INDEX alerts_updated_idx ON alerts (updated_at);
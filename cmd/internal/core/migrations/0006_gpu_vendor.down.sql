@@ -0,0 +1 @@
+ALTER TABLE gpu_metrics DROP COLUMN vendor;
@@ -0,0 +1 @@
+ALTER TABLE gpu_metrics ADD COLUMN vendor TEXT NOT NULL DEFAULT '';
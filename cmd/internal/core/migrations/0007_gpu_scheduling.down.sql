@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS gpu_reservations;
+ALTER TABLE executions DROP COLUMN gpu_devices;
+ALTER TABLE commands DROP COLUMN gpu_min_free_mb;
+ALTER TABLE commands DROP COLUMN gpu_count;
@@ -0,0 +1,13 @@
+ALTER TABLE commands ADD COLUMN gpu_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE commands ADD COLUMN gpu_min_free_mb INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE executions ADD COLUMN gpu_devices JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE gpu_reservations (
+    node_id TEXT NOT NULL,
+    device_index INTEGER NOT NULL,
+    execution_id TEXT NOT NULL,
+    reserved_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (node_id, device_index)
+);
+
+CREATE INDEX gpu_reservations_execution_idx ON gpu_reservations (execution_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS access_grants_active_idx;
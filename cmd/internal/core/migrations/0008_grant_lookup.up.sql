@@ -0,0 +1 @@
+CREATE INDEX access_grants_active_idx ON access_grants (user_name, action, node_id) WHERE status = 'approved';
@@ -0,0 +1 @@
+ALTER TABLE commands ADD COLUMN gpu_nodes JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1 @@
+ALTER TABLE execution_jobs DROP COLUMN not_before;
@@ -0,0 +1 @@
+ALTER TABLE execution_jobs ADD COLUMN not_before TIMESTAMPTZ;
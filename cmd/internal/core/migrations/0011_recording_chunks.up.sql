@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS terminal_recording_chunks (
+    session_id TEXT NOT NULL,
+    seq INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    PRIMARY KEY (session_id, seq)
+);
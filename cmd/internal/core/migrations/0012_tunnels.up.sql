@@ -0,0 +1,14 @@
+CREATE TABLE tunnels (
+    id TEXT PRIMARY KEY,
+    node_id TEXT NOT NULL,
+    port INTEGER NOT NULL,
+    user_name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    closed_at TIMESTAMPTZ,
+    closed_by TEXT NOT NULL DEFAULT '',
+    active_connections INTEGER NOT NULL DEFAULT 0,
+    connections INTEGER NOT NULL DEFAULT 0,
+    bytes_in BIGINT NOT NULL DEFAULT 0,
+    bytes_out BIGINT NOT NULL DEFAULT 0
+);
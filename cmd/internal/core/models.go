@@ -3,58 +3,563 @@
 import "time"
 
 type Command struct {
-    ID             string    `json:"id"`
-    Name           string    `json:"name"`
-    Description    string    `json:"description"`
-    Script         string    `json:"script"`
-    TimeoutSeconds int       `json:"timeout_seconds"`
-    CreatedAt      time.Time `json:"created_at"`
+    ID             string         `json:"id"`
+    Name           string         `json:"name"`
+    Description    string         `json:"description"`
+    Script         string         `json:"script"`
+    TimeoutSeconds int            `json:"timeout_seconds"`
+    Limits         ResourceLimits `json:"limits"`
+    Isolation      IsolationMode  `json:"isolation,omitempty"`
+    // Artifacts are glob patterns, relative to the script's working directory,
+    // of files to collect after the script finishes.
+    Artifacts []string `json:"artifacts,omitempty"`
+    // MaxConcurrent caps how many executions of the command run at once;
+    // zero means no cap.
+    MaxConcurrent int `json:"max_concurrent,omitempty"`
+    // GPU is what the command needs of a node's GPUs; the zero value needs
+    // none.
+    GPU       GPURequirement `json:"gpu,omitzero"`
+    CreatedAt time.Time      `json:"created_at"`
 }
 
+// GPURequirement asks for Count GPUs of one node, each with at least
+// MinFreeMemoryMB free.
+type GPURequirement struct {
+    Count           int `json:"count"`
+    MinFreeMemoryMB int `json:"min_free_memory_mb,omitempty"`
+    // Nodes, if set, are the IDs of the only nodes the command may run on,
+    // e.g. the ones with the right GPU model.
+    Nodes []string `json:"nodes,omitempty"`
+}
+
+// ResourceLimits bounds what a single execution may consume on the daemon.
+// Zero values mean "use the daemon's policy maximum".
+type ResourceLimits struct {
+    MemoryMB   int `json:"memory_mb,omitempty"`
+    CPUPercent int `json:"cpu_percent,omitempty"`
+    MaxPids    int `json:"max_pids,omitempty"`
+}
+
+// IsolationMode selects how the daemon sandboxes a script.
+type IsolationMode string
+
+const (
+    // IsolationNone runs the script directly on the daemon host.
+    IsolationNone IsolationMode = "none"
+    // IsolationNamespace runs the script in fresh mount, PID, network, UTS, IPC
+    // and user namespaces with a read-only root and a scratch tmpfs on /tmp.
+    IsolationNamespace IsolationMode = "namespace"
+)
+
 type Node struct {
     ID      string `json:"id"`
     Name    string `json:"name"`
     Address string `json:"address"`
+    // MaxConcurrent caps how many executions run on the node at once; zero
+    // means no cap.
+    MaxConcurrent int `json:"max_concurrent,omitempty"`
 }
 
 type ExecutionStatus string
 
 const (
-    ExecutionPending  ExecutionStatus = "pending"
-    ExecutionRunning  ExecutionStatus = "running"
+    ExecutionPending   ExecutionStatus = "pending"
+    ExecutionRunning   ExecutionStatus = "running"
     ExecutionSucceeded ExecutionStatus = "succeeded"
-    ExecutionFailed   ExecutionStatus = "failed"
+    ExecutionFailed    ExecutionStatus = "failed"
+    // ExecutionLost marks a run whose result could not be recovered after
+    // the bastion lost track of it.
+    ExecutionLost ExecutionStatus = "lost"
 )
 
+// Finished reports whether the status is final.
+func (s ExecutionStatus) Finished() bool {
+    return s != ExecutionPending && s != ExecutionRunning
+}
+
 type Execution struct {
-    ID          string          `json:"id"`
-    CommandID   string          `json:"command_id"`
-    NodeID      string          `json:"node_id"`
-    Status      ExecutionStatus `json:"status"`
-    StartedAt   time.Time       `json:"started_at"`
-    CompletedAt *time.Time      `json:"completed_at,omitempty"`
-    Stdout      string          `json:"stdout"`
-    Stderr      string          `json:"stderr"`
-    ExitCode    int             `json:"exit_code"`
-    DurationMs  int64           `json:"duration_ms"`
+    ID              string          `json:"id"`
+    CommandID       string          `json:"command_id"`
+    NodeID          string          `json:"node_id"`
+    Status          ExecutionStatus `json:"status"`
+    StartedAt       time.Time       `json:"started_at"`
+    CompletedAt     *time.Time      `json:"completed_at,omitempty"`
+    Stdout          string          `json:"stdout"`
+    Stderr          string          `json:"stderr"`
+    ExitCode        int             `json:"exit_code"`
+    DurationMs      int64           `json:"duration_ms"`
+    PeakMemoryBytes int64           `json:"peak_memory_bytes"`
+    CPUTimeMs       int64           `json:"cpu_time_ms"`
+    // StdoutBytes and StderrBytes are the sizes the script actually produced;
+    // Stdout/Stderr hold at most the daemon's head and tail when truncated.
+    StdoutBytes     int64 `json:"stdout_bytes"`
+    StderrBytes     int64 `json:"stderr_bytes"`
+    StdoutTruncated bool  `json:"stdout_truncated"`
+    StderrTruncated bool  `json:"stderr_truncated"`
+    // OutputSpooled reports that the daemon kept the full streams on disk.
+    OutputSpooled bool `json:"output_spooled"`
+    // StdoutRef and StderrRef are blob store keys of the full streams when
+    // they were too large to keep inline.
+    StdoutRef string     `json:"stdout_ref,omitempty"`
+    StderrRef string     `json:"stderr_ref,omitempty"`
+    Artifacts []Artifact `json:"artifacts,omitempty"`
+    // GPUDevices are the indices of the node's GPUs reserved for the run.
+    GPUDevices []int `json:"gpu_devices,omitempty"`
+    // TriggeredBy is the principal that started the run; GrantID the access
+    // grant it was authorised by, if grants are enforced.
+    TriggeredBy string `json:"triggered_by,omitempty"`
+    GrantID     string `json:"grant_id,omitempty"`
+    // QueuePosition is, while the execution is pending, its place in the
+    // queue counting from 1. It is not stored.
+    QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// QueueJob is a queued execution. A worker that claims it holds a lease it
+// must keep renewing; once the lease runs out the job is up for grabs again.
+type QueueJob struct {
+    ExecutionID string
+    NodeID      string
+    CommandID   string
+    EnqueuedAt  time.Time
+    // Priority orders the queue when it is run by priority; higher first.
+    Priority int
+    // NodeLimit and CommandLimit are the node's and command's MaxConcurrent
+    // when the job was enqueued.
+    NodeLimit      int
+    CommandLimit   int
+    Worker         string
+    LeaseExpiresAt *time.Time
+    // Attempts counts claims, so a job that keeps killing its workers is
+    // eventually given up on.
+    Attempts int
+    // NotBefore, if set, keeps the job from being claimed until then.
+    NotBefore *time.Time
+}
+
+// QueueOrder is the order pending executions are started in.
+type QueueOrder string
+
+const (
+    // QueueFIFO starts executions in the order they were requested.
+    QueueFIFO QueueOrder = "fifo"
+    // QueuePriority starts higher-priority executions first, and executions
+    // of equal priority in the order they were requested.
+    QueuePriority QueueOrder = "priority"
+)
+
+// QueuePolicy is what a claim must respect besides per-node and per-command
+// limits.
+type QueuePolicy struct {
+    // MaxRunning caps executions running across all nodes; zero means no cap.
+    MaxRunning int
+    Order      QueueOrder
+}
+
+// QueuedExecution is a pending execution's place in the queue.
+type QueuedExecution struct {
+    ExecutionID string    `json:"execution_id"`
+    CommandID   string    `json:"command_id"`
+    NodeID      string    `json:"node_id"`
+    Priority    int       `json:"priority"`
+    EnqueuedAt  time.Time `json:"enqueued_at"`
+    Position    int       `json:"position"`
+}
+
+// ExecutionSummary is the list view of an Execution: everything but the
+// captured output and artifact manifest, which are fetched per execution.
+type ExecutionSummary struct {
+    ID              string          `json:"id"`
+    CommandID       string          `json:"command_id"`
+    NodeID          string          `json:"node_id"`
+    Status          ExecutionStatus `json:"status"`
+    StartedAt       time.Time       `json:"started_at"`
+    CompletedAt     *time.Time      `json:"completed_at,omitempty"`
+    ExitCode        int             `json:"exit_code"`
+    DurationMs      int64           `json:"duration_ms"`
+    PeakMemoryBytes int64           `json:"peak_memory_bytes"`
+    CPUTimeMs       int64           `json:"cpu_time_ms"`
+    StdoutBytes     int64           `json:"stdout_bytes"`
+    StderrBytes     int64           `json:"stderr_bytes"`
+    StdoutTruncated bool            `json:"stdout_truncated"`
+    StderrTruncated bool            `json:"stderr_truncated"`
+    OutputSpooled   bool            `json:"output_spooled"`
+    TriggeredBy     string          `json:"triggered_by,omitempty"`
+    GrantID         string          `json:"grant_id,omitempty"`
+    QueuePosition   int             `json:"queue_position,omitempty"`
+}
+
+// Summary returns the list view of e.
+func (e Execution) Summary() ExecutionSummary {
+    return ExecutionSummary{
+        ID:              e.ID,
+        CommandID:       e.CommandID,
+        NodeID:          e.NodeID,
+        Status:          e.Status,
+        StartedAt:       e.StartedAt,
+        CompletedAt:     e.CompletedAt,
+        ExitCode:        e.ExitCode,
+        DurationMs:      e.DurationMs,
+        PeakMemoryBytes: e.PeakMemoryBytes,
+        CPUTimeMs:       e.CPUTimeMs,
+        StdoutBytes:     e.StdoutBytes,
+        StderrBytes:     e.StderrBytes,
+        StdoutTruncated: e.StdoutTruncated,
+        StderrTruncated: e.StderrTruncated,
+        OutputSpooled:   e.OutputSpooled,
+        TriggeredBy:     e.TriggeredBy,
+        GrantID:         e.GrantID,
+        QueuePosition:   e.QueuePosition,
+    }
+}
+
+// ExecutionFilter selects executions for a listing. Zero-valued fields match
+// everything.
+type ExecutionFilter struct {
+    CommandID   string
+    NodeID      string
+    Status      ExecutionStatus
+    TriggeredBy string
+    ExitCode    *int
+    // From and To bound StartedAt; From is inclusive, To exclusive.
+    From time.Time
+    To   time.Time
+    // Ascending orders oldest first; the default is newest first.
+    Ascending bool
+    // Cursor is the opaque NextCursor of the previous page.
+    Cursor string
+    // After is the decoded Cursor: the listing resumes strictly after it.
+    After *ExecutionCursor
+    Limit int
+    // VisibleTo, when set, narrows the listing to runs that principal
+    // triggered or that ran on one of VisibleNodes.
+    VisibleTo    string
+    VisibleNodes []string
+}
+
+// ExecutionCursor is a position in the (started_at, id) ordering.
+type ExecutionCursor struct {
+    StartedAt time.Time
+    ID        string
+}
+
+// ExecutionPage is one page of a listing. NextCursor is empty on the last page.
+type ExecutionPage struct {
+    Items      []ExecutionSummary `json:"items"`
+    NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// Artifact is a file collected from the node after an execution.
+type Artifact struct {
+    Name   string `json:"name"`
+    Size   int64  `json:"size"`
+    SHA256 string `json:"sha256,omitempty"`
+    // Ref is the blob store key; empty when the file was not stored.
+    Ref string `json:"ref,omitempty"`
+    // Skipped explains why the file was not collected or stored.
+    Skipped string `json:"skipped,omitempty"`
 }
 
 type ExecRequest struct {
-    Script         string `json:"script"`
-    TimeoutSeconds int    `json:"timeout_seconds"`
-    WorkingDir     string `json:"working_dir,omitempty"`
+    ExecutionID    string         `json:"execution_id,omitempty"`
+    Script         string         `json:"script"`
+    TimeoutSeconds int            `json:"timeout_seconds"`
+    WorkingDir     string         `json:"working_dir,omitempty"`
+    Limits         ResourceLimits `json:"limits"`
+    Isolation      IsolationMode  `json:"isolation,omitempty"`
+    Artifacts      []string       `json:"artifacts,omitempty"`
+    // Env is added to the script's environment.
+    Env map[string]string `json:"env,omitempty"`
 }
 
 type ExecResponse struct {
-    Stdout     string `json:"stdout"`
-    Stderr     string `json:"stderr"`
-    ExitCode   int    `json:"exit_code"`
-    DurationMs int64  `json:"duration_ms"`
+    Stdout          string         `json:"stdout"`
+    Stderr          string         `json:"stderr"`
+    ExitCode        int            `json:"exit_code"`
+    DurationMs      int64          `json:"duration_ms"`
+    PeakMemoryBytes int64          `json:"peak_memory_bytes"`
+    CPUTimeMs       int64          `json:"cpu_time_ms"`
+    StdoutBytes     int64          `json:"stdout_bytes"`
+    StderrBytes     int64          `json:"stderr_bytes"`
+    StdoutTruncated bool           `json:"stdout_truncated"`
+    StderrTruncated bool           `json:"stderr_truncated"`
+    Spooled         bool           `json:"spooled"`
+    Artifacts       []ArtifactFile `json:"artifacts,omitempty"`
+}
+
+// DaemonExecution is a daemon's record of a run it was asked for, kept a
+// while after it finishes so a restarted bastion can still collect it.
+type DaemonExecution struct {
+    ExecutionID string        `json:"execution_id"`
+    Done        bool          `json:"done"`
+    Result      *ExecResponse `json:"result,omitempty"`
+}
+
+// ArtifactFile is an artifact as reported by the daemon. Unless Skipped, the
+// daemon holds a copy for the bastion to fetch.
+type ArtifactFile struct {
+    Name    string `json:"name"`
+    Size    int64  `json:"size"`
+    SHA256  string `json:"sha256,omitempty"`
+    Skipped string `json:"skipped,omitempty"`
 }
 
+// GPUSample is a node's GPU telemetry at one moment. Utilization and the
+// memory totals aggregate Devices: mean utilization, summed memory.
 type GPUSample struct {
-    NodeID       string  `json:"node_id"`
-    Timestamp    int64   `json:"timestamp"`
-    Utilization  float64 `json:"utilization"`
-    MemoryMB     int     `json:"memory_mb"`
+    NodeID        string      `json:"node_id"`
+    Timestamp     int64       `json:"timestamp"`
+    Utilization   float64     `json:"utilization"`
+    MemoryMB      int         `json:"memory_mb"`
+    MemoryTotalMB int         `json:"memory_total_mb"`
+    Devices       []GPUDevice `json:"devices,omitempty"`
+}
+
+// GPUDevice is one GPU's telemetry. Vendor is GPUVendorNVIDIA or
+// GPUVendorAMD. Readings a device does not support are zero.
+type GPUDevice struct {
+    Index         int     `json:"index"`
+    Vendor        string  `json:"vendor,omitempty"`
+    Name          string  `json:"name"`
+    UUID          string  `json:"uuid"`
+    Utilization   float64 `json:"utilization"`
+    MemoryUsedMB  int     `json:"memory_used_mb"`
+    MemoryTotalMB int     `json:"memory_total_mb"`
+    TemperatureC  float64 `json:"temperature_c"`
+    PowerW        float64 `json:"power_w"`
+    // Processes are the compute processes on the device. Only live samples
+    // carry them; stored history does not.
+    Processes []GPUProcess `json:"processes,omitempty"`
+}
+
+// GPUProcess is a compute process using a GPU. ExecutionID is set when the
+// process belongs to an execution the node's daemon launched.
+type GPUProcess struct {
+    PID          int    `json:"pid"`
+    Name         string `json:"name"`
+    User         string `json:"user,omitempty"`
+    MemoryUsedMB int    `json:"memory_used_mb"`
+    ExecutionID  string `json:"execution_id,omitempty"`
+}
+
+const (
+    GPUVendorNVIDIA = "nvidia"
+    GPUVendorAMD    = "amd"
+)
+
+// GPUReservation holds a GPU for an execution from when it is placed until
+// it finishes, so concurrent runs are never given the same device.
+type GPUReservation struct {
+    NodeID      string    `json:"node_id"`
+    DeviceIndex int       `json:"device_index"`
+    ExecutionID string    `json:"execution_id"`
+    ReservedAt  time.Time `json:"reserved_at"`
+}
+
+// GPUMetric is a stored reading of one device: a raw sample, or the average
+// of Samples readings over a Resolution-long bucket starting at At.
+type GPUMetric struct {
+    NodeID string
+    // Resolution is zero for raw samples.
+    Resolution time.Duration
+    At         time.Time
+    Samples    int
+    GPUDevice
+}
+
+// GPUQuery selects stored GPU metrics. NodeID empty means every node.
+type GPUQuery struct {
+    NodeID string
+    From   time.Time
+    To     time.Time
+    // Step is the width of the buckets the range is averaged into.
+    Step time.Duration
+}
+
+// NewGPUSample aggregates devices into a sample.
+func NewGPUSample(devices []GPUDevice) GPUSample {
+    sample := GPUSample{Devices: devices}
+    for _, d := range devices {
+        sample.Utilization += d.Utilization
+        sample.MemoryMB += d.MemoryUsedMB
+        sample.MemoryTotalMB += d.MemoryTotalMB
+    }
+    if len(devices) > 0 {
+        sample.Utilization /= float64(len(devices))
+    }
+    return sample
+}
+
+// AlertMetric is a GPU reading alert rules can watch.
+type AlertMetric string
+
+const (
+    AlertUtilization   AlertMetric = "utilization"
+    AlertMemoryPercent AlertMetric = "memory_percent"
+    AlertTemperature   AlertMetric = "temperature_c"
+    AlertPower         AlertMetric = "power_w"
+)
+
+// AlertRule raises an alert for every GPU whose Metric stays on the wrong
+// side of Threshold for ForSeconds.
+type AlertRule struct {
+    Name   string      `json:"name"`
+    Metric AlertMetric `json:"metric"`
+    // Op is "<" or ">".
+    Op         string  `json:"op"`
+    Threshold  float64 `json:"threshold"`
+    ForSeconds int     `json:"for_seconds"`
+    // NodeID limits the rule to one node; empty watches every node.
+    NodeID string `json:"node_id,omitempty"`
+    // WhileRunning only counts readings taken while an execution is running
+    // on the node, e.g. to catch jobs that leave their GPUs idle.
+    WhileRunning bool   `json:"while_running,omitempty"`
+    Severity     string `json:"severity,omitempty"`
+}
+
+type AlertState string
+
+const (
+    // AlertPending: the condition holds but not yet for long enough.
+    AlertPending AlertState = "pending"
+    AlertFiring  AlertState = "firing"
+    // AlertResolved: the condition cleared after the alert fired.
+    AlertResolved AlertState = "resolved"
+)
+
+// Alert is one rule's alert for one GPU. A GPU has at most one pending or
+// firing alert per rule; once resolved, a new breach opens a new alert.
+type Alert struct {
+    ID          string     `json:"id"`
+    Rule        string     `json:"rule"`
+    NodeID      string     `json:"node_id"`
+    DeviceIndex int        `json:"device_index"`
+    DeviceUUID  string     `json:"device_uuid,omitempty"`
+    State       AlertState `json:"state"`
+    Severity    string     `json:"severity,omitempty"`
+    // Value is the latest reading that breached the threshold.
+    Value      float64    `json:"value"`
+    Threshold  float64    `json:"threshold"`
+    Summary    string     `json:"summary"`
+    StartedAt  time.Time  `json:"started_at"`
+    FiredAt    *time.Time `json:"fired_at,omitempty"`
+    ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+    UpdatedAt  time.Time  `json:"updated_at"`
+    // Notified is the last state notifiers were told about, so each
+    // transition is announced once and failed deliveries are retried.
+    Notified AlertState `json:"notified,omitempty"`
+}
+
+// AuditEvent records a privileged action taken through the bastion.
+type AuditEvent struct {
+    ID      string    `json:"id"`
+    At      time.Time `json:"at"`
+    Actor   string    `json:"actor"`
+    Action  string    `json:"action"`
+    NodeID  string    `json:"node_id,omitempty"`
+    Target  string    `json:"target,omitempty"`
+    Detail  string    `json:"detail,omitempty"`
+    Success bool      `json:"success"`
+}
+
+// FileSpec describes a file written to a node.
+type FileSpec struct {
+    Path string `json:"path"`
+    // Mode is octal, e.g. "0644". Empty keeps the daemon default.
+    Mode string `json:"mode,omitempty"`
+    // Owner is "user", "user:group" or numeric ids. Empty leaves ownership alone.
+    Owner string `json:"owner,omitempty"`
+    // SHA256 is the expected checksum; the daemon rejects mismatching uploads.
+    SHA256 string `json:"sha256,omitempty"`
+}
+
+// FileInfo is what the daemon reports about a file it wrote.
+type FileInfo struct {
+    Path   string `json:"path"`
+    Size   int64  `json:"size"`
+    SHA256 string `json:"sha256"`
+    Mode   string `json:"mode"`
+}
+
+// FileCopyResult is the outcome of copying a file to one node.
+type FileCopyResult struct {
+    NodeID string    `json:"node_id"`
+    File   *FileInfo `json:"file,omitempty"`
+    Error  string    `json:"error,omitempty"`
+}
+
+// TerminalMessage is a control frame on a terminal WebSocket. Terminal data
+// travels in binary frames; text frames carry these.
+type TerminalMessage struct {
+    // Type is "resize" (client to daemon), "exit" or "error" (towards the client).
+    Type     string `json:"type"`
+    Cols     uint16 `json:"cols,omitempty"`
+    Rows     uint16 `json:"rows,omitempty"`
+    ExitCode int    `json:"exit_code,omitempty"`
+    Message  string `json:"message,omitempty"`
+}
+
+// TerminalSession is an interactive shell opened through the bastion. The
+// recording is an asciicast v2 document and is only loaded for replay.
+type TerminalSession struct {
+    ID             string     `json:"id"`
+    NodeID         string     `json:"node_id"`
+    User           string     `json:"user"`
+    Cols           int        `json:"cols"`
+    Rows           int        `json:"rows"`
+    StartedAt      time.Time  `json:"started_at"`
+    EndedAt        *time.Time `json:"ended_at,omitempty"`
+    RecordingBytes int64      `json:"recording_bytes"`
+    Recording      []byte     `json:"-"`
+}
+
+// Tunnel is a time-limited TCP forward to a port on a node, relayed through
+// the bastion over WebSockets.
+type Tunnel struct {
+    ID          string     `json:"id"`
+    NodeID      string     `json:"node_id"`
+    Port        int        `json:"port"`
+    User        string     `json:"user"`
+    CreatedAt   time.Time  `json:"created_at"`
+    ExpiresAt   time.Time  `json:"expires_at"`
+    ClosedAt    *time.Time `json:"closed_at,omitempty"`
+    ClosedBy    string     `json:"closed_by,omitempty"`
+    Active      int        `json:"active_connections"`
+    Connections int        `json:"connections"`
+    BytesIn     int64      `json:"bytes_in"`
+    BytesOut    int64      `json:"bytes_out"`
+}
+
+type GrantStatus string
+
+const (
+    GrantPending  GrantStatus = "pending"
+    GrantApproved GrantStatus = "approved"
+    GrantDenied   GrantStatus = "denied"
+    GrantRevoked  GrantStatus = "revoked"
+    GrantExpired  GrantStatus = "expired"
+)
+
+// Actions an access grant can cover.
+const (
+    ActionExecute  = "execute"
+    ActionTerminal = "terminal"
+    ActionFiles    = "files"
+    ActionTunnel   = "tunnel"
+)
+
+// AccessGrant is a time-boxed permission for one user to perform an action on
+// a node. The window starts when the grant is approved.
+type AccessGrant struct {
+    ID              string      `json:"id"`
+    User            string      `json:"user"`
+    NodeID          string      `json:"node_id"`
+    Action          string      `json:"action"`
+    Reason          string      `json:"reason"`
+    DurationSeconds int         `json:"duration_seconds"`
+    Status          GrantStatus `json:"status"`
+    RequestedAt     time.Time   `json:"requested_at"`
+    DecidedBy       string      `json:"decided_by,omitempty"`
+    DecidedAt       *time.Time  `json:"decided_at,omitempty"`
+    StartsAt        *time.Time  `json:"starts_at,omitempty"`
+    ExpiresAt       *time.Time  `json:"expires_at,omitempty"`
 }
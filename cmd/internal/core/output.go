@@ -0,0 +1,168 @@
+package core
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "unicode/utf8"
+)
+
+// DefaultInlineOutputLimit is how many bytes of a stream stay in the
+// executions table once a blob store is configured.
+const DefaultInlineOutputLimit = 64 * 1024
+
+// SetBlobStore moves streams larger than inlineLimit bytes out of the
+// executions table into store. A non-positive limit uses the default.
+func (s *BastionService) SetBlobStore(store BlobStore, inlineLimit int) {
+    if inlineLimit <= 0 {
+        inlineLimit = DefaultInlineOutputLimit
+    }
+    s.blobs = store
+    s.inlineOutputLimit = inlineLimit
+}
+
+func outputBlobKey(executionID, stream string) string {
+    return "executions/" + executionID + "/" + stream
+}
+
+// offloadOutputs stores oversized streams in the blob store and leaves a
+// preview inline. When the daemon truncated a stream but spooled it, the full
+// copy is pulled from the daemon so the blob is complete. Failures keep the
+// inline copy; losing the offload is better than losing the execution.
+func (s *BastionService) offloadOutputs(ctx context.Context, node Node, execRecord *Execution) {
+    if s.blobs == nil {
+        return
+    }
+    streams := []struct {
+        name      string
+        inline    *string
+        truncated *bool
+        ref       *string
+    }{
+        {"stdout", &execRecord.Stdout, &execRecord.StdoutTruncated, &execRecord.StdoutRef},
+        {"stderr", &execRecord.Stderr, &execRecord.StderrTruncated, &execRecord.StderrRef},
+    }
+    for _, st := range streams {
+        fromSpool := *st.truncated && execRecord.OutputSpooled
+        if !fromSpool && len(*st.inline) <= s.inlineOutputLimit {
+            continue
+        }
+        var src io.ReadCloser = io.NopCloser(strings.NewReader(*st.inline))
+        if fromSpool {
+            resp, err := s.fetchDaemonOutput(ctx, node, execRecord.ID, st.name, "")
+            if err != nil {
+                log.Printf("offload %s of %s: %v", st.name, execRecord.ID, err)
+                continue
+            }
+            src = resp.Body
+        } else if *st.truncated {
+            // The daemon dropped the middle and kept nothing on disk; storing the
+            // head+tail copy as the "full" blob would be misleading.
+            continue
+        }
+        key := outputBlobKey(execRecord.ID, st.name)
+        _, err := s.blobs.Put(ctx, key, src)
+        src.Close()
+        if err != nil {
+            log.Printf("offload %s of %s: %v", st.name, execRecord.ID, err)
+            continue
+        }
+        *st.ref = key
+        if len(*st.inline) > s.inlineOutputLimit {
+            *st.inline = previewOutput(*st.inline, s.inlineOutputLimit)
+            *st.truncated = true
+        }
+    }
+}
+
+// previewOutput keeps the head and tail of out within limit bytes. Both cuts
+// fall on rune boundaries: a split character is invalid UTF-8, which a TEXT
+// column rejects.
+func previewOutput(out string, limit int) string {
+    head, tail := limit/2, len(out)-limit/2
+    for head > 0 && !utf8.RuneStart(out[head]) {
+        head--
+    }
+    for tail < len(out) && !utf8.RuneStart(out[tail]) {
+        tail++
+    }
+    return fmt.Sprintf("%s\n... [%d bytes omitted, download the full output] ...\n%s", out[:head], tail-head, out[tail:])
+}
+
+// OpenStoredOutput opens the blob-stored copy of an execution stream. The
+// returned reader supports seeking for Range requests and must be closed.
+func (s *BastionService) OpenStoredOutput(ctx context.Context, execRecord Execution, stream string) (*BlobReadSeeker, BlobInfo, error) {
+    var key string
+    switch stream {
+    case "stdout":
+        key = execRecord.StdoutRef
+    case "stderr":
+        key = execRecord.StderrRef
+    default:
+        return nil, BlobInfo{}, invalidf("unknown stream %q", stream)
+    }
+    if key == "" || s.blobs == nil {
+        return nil, BlobInfo{}, fmt.Errorf("execution %s has no stored %s", execRecord.ID, stream)
+    }
+    info, err := s.blobs.Stat(ctx, key)
+    if err != nil {
+        return nil, BlobInfo{}, err
+    }
+    return NewBlobReadSeeker(ctx, s.blobs, key, info.Size), info, nil
+}
+
+// OpenSpooledOutput fetches the full stdout or stderr of a truncated execution
+// from the daemon that ran it. byteRange is forwarded as the Range header so
+// callers can page through large outputs; the caller must close the body.
+func (s *BastionService) OpenSpooledOutput(ctx context.Context, executionID, stream, byteRange string) (*http.Response, error) {
+    if stream != "stdout" && stream != "stderr" {
+        return nil, invalidf("unknown stream %q", stream)
+    }
+    execRecord, err := s.GetExecution(ctx, executionID)
+    if err != nil {
+        return nil, err
+    }
+    if !execRecord.OutputSpooled {
+        return nil, invalidf("execution %s has no spooled output", executionID)
+    }
+    node, err := s.getNode(ctx, execRecord.NodeID)
+    if err != nil {
+        return nil, err
+    }
+    return s.fetchDaemonOutput(ctx, node, execRecord.ID, stream, byteRange)
+}
+
+func (s *BastionService) fetchDaemonOutput(ctx context.Context, node Node, executionID, stream, byteRange string) (*http.Response, error) {
+    q := url.Values{"execution_id": {executionID}, "stream": {stream}}
+    return s.daemonRequest(ctx, node, http.MethodGet, "/api/v1/output", q, byteRange)
+}
+
+// daemonRequest calls a daemon endpoint that may stream a large body. Any
+// status but 200, 204 or 206 is an error; otherwise the caller must close
+// the body.
+func (s *BastionService) daemonRequest(ctx context.Context, node Node, method, path string, q url.Values, byteRange string) (*http.Response, error) {
+    target := strings.TrimRight(node.Address, "/") + path + "?" + q.Encode()
+    httpReq, err := http.NewRequestWithContext(ctx, method, target, nil)
+    if err != nil {
+        return nil, fmt.Errorf("build request: %w", err)
+    }
+    if byteRange != "" {
+        httpReq.Header.Set("Range", byteRange)
+    }
+    // Bodies can be large; don't apply the client's whole-request timeout.
+    resp, err := http.DefaultClient.Do(httpReq)
+    if err != nil {
+        return nil, fmt.Errorf("request failed: %w", err)
+    }
+    switch resp.StatusCode {
+    case http.StatusOK, http.StatusNoContent, http.StatusPartialContent:
+        return resp, nil
+    }
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    resp.Body.Close()
+    return nil, fmt.Errorf("daemon status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
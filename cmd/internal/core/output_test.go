@@ -0,0 +1,35 @@
+package core
+
+import (
+    "strings"
+    "testing"
+    "unicode/utf8"
+)
+
+func TestPreviewOutputKeepsUTF8(t *testing.T) {
+    // Every cut of a run of 3-byte runes lands mid-character two times in
+    // three, whatever the limit.
+    out := strings.Repeat("日本語", 1000)
+    for limit := 10; limit < 40; limit++ {
+        got := previewOutput(out, limit)
+        if !utf8.ValidString(got) {
+            t.Fatalf("limit %d: preview is not valid UTF-8", limit)
+        }
+        head, tail, ok := strings.Cut(got, "\n... [")
+        if !ok || !strings.HasPrefix(out, head) {
+            t.Fatalf("limit %d: head %q is not a prefix of the output", limit, head)
+        }
+        tail = tail[strings.Index(tail, "] ...\n")+len("] ...\n"):]
+        if !strings.HasSuffix(out, tail) || len(head)+len(tail) > limit {
+            t.Fatalf("limit %d: head %q, tail %q", limit, head, tail)
+        }
+    }
+}
+
+func TestPreviewOutputCountsDroppedBytes(t *testing.T) {
+    got := previewOutput(strings.Repeat("a", 100), 20)
+    want := strings.Repeat("a", 10) + "\n... [80 bytes omitted, download the full output] ...\n" + strings.Repeat("a", 10)
+    if got != want {
+        t.Fatalf("previewOutput = %q, want %q", got, want)
+    }
+}
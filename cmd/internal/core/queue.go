@@ -0,0 +1,332 @@
+package core
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "sync"
+    "time"
+)
+
+// ErrLeaseLost is returned when a worker's lease on a job has been taken
+// over or the job is gone.
+var ErrLeaseLost = errors.New("lease lost")
+
+const (
+    DefaultExecutionWorkers = 32
+    DefaultExecutionLease   = 30 * time.Second
+    // maxExecutionAttempts bounds how often a job is claimed before its
+    // execution is declared lost, so a run that crashes its workers does not
+    // take down every replica in turn.
+    maxExecutionAttempts = 3
+    queuePollInterval    = time.Second
+)
+
+// SetQueuePolicy sets the global concurrency limit and the order pending
+// executions start in.
+func (s *BastionService) SetQueuePolicy(policy QueuePolicy) error {
+    switch policy.Order {
+    case "":
+        policy.Order = QueueFIFO
+    case QueueFIFO, QueuePriority:
+    default:
+        return invalidf("unknown queue order %q", policy.Order)
+    }
+    if policy.MaxRunning < 0 {
+        return invalidf("max running executions must not be negative")
+    }
+    s.queuePolicy = policy
+    return nil
+}
+
+// ListQueue returns the pending executions in the order they will be
+// considered for starting. An execution may start ahead of its position when
+// those before it wait on a node or command limit.
+func (s *BastionService) ListQueue(ctx context.Context) ([]QueuedExecution, error) {
+    jobs, err := s.queue.Pending(ctx, s.queuePolicy.Order)
+    if err != nil {
+        return nil, err
+    }
+    out := make([]QueuedExecution, len(jobs))
+    for i, job := range jobs {
+        out[i] = QueuedExecution{
+            ExecutionID: job.ExecutionID,
+            CommandID:   job.CommandID,
+            NodeID:      job.NodeID,
+            Priority:    job.Priority,
+            EnqueuedAt:  job.EnqueuedAt,
+            Position:    i + 1,
+        }
+    }
+    return out, nil
+}
+
+func (s *BastionService) queuePositions(ctx context.Context) (map[string]int, error) {
+    jobs, err := s.queue.Pending(ctx, s.queuePolicy.Order)
+    if err != nil {
+        return nil, err
+    }
+    positions := make(map[string]int, len(jobs))
+    for i, job := range jobs {
+        positions[job.ExecutionID] = i + 1
+    }
+    return positions, nil
+}
+
+// executionWaiters lets ExecuteCommand hear about a run this process
+// finished without polling the repository.
+type executionWaiters struct {
+    mu      sync.Mutex
+    waiting map[string][]chan struct{}
+}
+
+func (w *executionWaiters) add(id string) chan struct{} {
+    ch := make(chan struct{})
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if w.waiting == nil {
+        w.waiting = map[string][]chan struct{}{}
+    }
+    w.waiting[id] = append(w.waiting[id], ch)
+    return ch
+}
+
+func (w *executionWaiters) remove(id string, ch chan struct{}) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    list := w.waiting[id]
+    for i, c := range list {
+        if c == ch {
+            list = append(list[:i], list[i+1:]...)
+            break
+        }
+    }
+    if len(list) == 0 {
+        delete(w.waiting, id)
+    } else {
+        w.waiting[id] = list
+    }
+}
+
+func (w *executionWaiters) notify(id string) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    for _, ch := range w.waiting[id] {
+        close(ch)
+    }
+    delete(w.waiting, id)
+}
+
+// wakeWorkers nudges an idle worker to claim a job now rather than at its
+// next poll.
+func (s *BastionService) wakeWorkers() {
+    select {
+    case s.queueWake <- struct{}{}:
+    default:
+    }
+}
+
+// RunExecutionWorkers consumes the execution queue with n workers, each
+// holding a lease on the job it runs and renewing it while the run lasts. It
+// returns once ctx is done and the workers have stopped; jobs they were
+// running are left for another worker to take over when their leases expire.
+func (s *BastionService) RunExecutionWorkers(ctx context.Context, n int, lease time.Duration) {
+    if n <= 0 {
+        n = DefaultExecutionWorkers
+    }
+    if lease <= 0 {
+        lease = DefaultExecutionLease
+    }
+    host, _ := os.Hostname()
+    instance := randomID(host)
+    var wg sync.WaitGroup
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func(worker string) {
+            defer wg.Done()
+            s.runWorker(ctx, worker, lease)
+        }(fmt.Sprintf("%s/%d", instance, i))
+    }
+    wg.Wait()
+}
+
+func (s *BastionService) runWorker(ctx context.Context, worker string, lease time.Duration) {
+    ticker := time.NewTicker(queuePollInterval)
+    defer ticker.Stop()
+    for {
+        job, ok, err := s.queue.Claim(ctx, worker, lease, s.queuePolicy)
+        if err != nil && ctx.Err() == nil {
+            log.Printf("claim execution: %v", err)
+        }
+        if ok {
+            // There may be more where this came from.
+            s.wakeWorkers()
+            s.runJob(ctx, job, lease)
+            continue
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-s.queueWake:
+        case <-ticker.C:
+        }
+    }
+}
+
+// runJob runs a claimed job while renewing its lease. Losing the lease, or
+// failing to renew it for a whole lease period, abandons the run to whoever
+// claims the job next.
+func (s *BastionService) runJob(ctx context.Context, job QueueJob, lease time.Duration) {
+    runCtx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    go func() {
+        ticker := time.NewTicker(lease / 3)
+        defer ticker.Stop()
+        renewed := time.Now()
+        for {
+            select {
+            case <-runCtx.Done():
+                return
+            case <-ticker.C:
+            }
+            err := s.queue.Heartbeat(runCtx, job, lease)
+            switch {
+            case err == nil:
+                renewed = time.Now()
+            case errors.Is(err, ErrLeaseLost):
+                log.Printf("execution %s: lease lost", job.ExecutionID)
+                cancel()
+                return
+            default:
+                log.Printf("execution %s: renew lease: %v", job.ExecutionID, err)
+                if time.Since(renewed) >= lease {
+                    cancel()
+                    return
+                }
+            }
+        }
+    }()
+
+    // Work that happens after the run is not cut short by a lost lease: the
+    // result is already in hand and saving it is idempotent.
+    bg := context.WithoutCancel(ctx)
+    err := s.runQueuedExecution(runCtx, bg, job)
+    if errors.Is(err, errGPUsBusy) {
+        // Back in line without holding a slot, so runs behind it that can
+        // start meanwhile do.
+        if err := s.queue.Defer(bg, job, time.Now().Add(gpuRetryInterval)); err != nil {
+            log.Printf("execution %s: requeue: %v", job.ExecutionID, err)
+        }
+        return
+    }
+    if err != nil {
+        if runCtx.Err() != nil {
+            return
+        }
+        log.Printf("execution %s: %v", job.ExecutionID, err)
+    }
+    s.releaseGPUs(bg, job.ExecutionID)
+    if err := s.queue.Complete(bg, job); err != nil {
+        log.Printf("execution %s: complete job: %v", job.ExecutionID, err)
+    }
+    s.waiters.notify(job.ExecutionID)
+}
+
+// runQueuedExecution takes a job's execution to a final status. A job
+// claimed again after its worker died finds the execution already running:
+// the daemon deduplicates by execution ID, so dispatching it again joins the
+// run if the daemon still has it.
+func (s *BastionService) runQueuedExecution(ctx, bg context.Context, job QueueJob) error {
+    rec, err := s.executions.Get(bg, job.ExecutionID)
+    if errors.Is(err, ErrNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if rec.Status.Finished() {
+        return nil
+    }
+    if job.Attempts > maxExecutionAttempts {
+        return s.loseExecution(bg, rec, fmt.Sprintf("gave up after %d attempts", job.Attempts-1))
+    }
+    cmd, err := s.commands.Get(bg, rec.CommandID)
+    if err != nil {
+        s.failExecution(bg, rec, fmt.Sprintf("command %s: %v", rec.CommandID, unknown(err, "command", rec.CommandID)))
+        return nil
+    }
+    node, err := s.getNode(bg, rec.NodeID)
+    if err != nil {
+        s.failExecution(bg, rec, fmt.Sprintf("node %s: %v", rec.NodeID, err))
+        return nil
+    }
+    if rec.Status == ExecutionRunning {
+        // A previous worker got as far as dispatching. If the daemon never
+        // heard of the run, do not start it a second time.
+        if _, err := s.daemonExecution(ctx, node, rec.ID); errors.Is(err, ErrNotFound) {
+            return s.loseExecution(bg, rec, "daemon has no record of this execution")
+        }
+    } else {
+        if err := s.checkRunGrant(bg, rec); err != nil {
+            s.failExecution(bg, rec, err.Error())
+            return nil
+        }
+        if cmd.GPU.Count > 0 {
+            if rec.GPUDevices, err = s.reserveQueuedGPUs(ctx, cmd, node, rec.ID); err != nil {
+                return err
+            }
+        }
+        rec.Status = ExecutionRunning
+        if rec, err = s.executions.Save(bg, rec); err != nil {
+            return err
+        }
+    }
+    _, err = s.dispatchExecution(ctx, bg, cmd, node, rec)
+    return err
+}
+
+// reserveQueuedGPUs reserves the devices of a run that is about to start,
+// or reports errGPUsBusy if the node does not have them free yet. Any left
+// held for the run by a worker that died before starting it are freed first.
+func (s *BastionService) reserveQueuedGPUs(ctx context.Context, cmd Command, node Node, executionID string) ([]int, error) {
+    err := s.gpus.Release(ctx, executionID)
+    var devices []int
+    if err == nil {
+        _, devices, err = s.placeGPUs(ctx, cmd.GPU, []Node{node}, executionID)
+    }
+    if err != nil {
+        if !errors.Is(err, ErrUnavailable) && !errors.Is(err, ErrGPUReserved) {
+            log.Printf("execution %s: reserve gpus: %v", executionID, err)
+        }
+        return nil, errGPUsBusy
+    }
+    return devices, nil
+}
+
+// awaitExecution waits for an execution to reach a final status, whichever
+// replica runs it. If ctx ends first the execution is returned as it stands,
+// with ctx's error; the run itself carries on.
+func (s *BastionService) awaitExecution(ctx context.Context, id string) (Execution, error) {
+    done := s.waiters.add(id)
+    defer func() { s.waiters.remove(id, done) }()
+    ticker := time.NewTicker(queuePollInterval)
+    defer ticker.Stop()
+    for {
+        rec, err := s.executions.Get(context.WithoutCancel(ctx), id)
+        if err != nil {
+            return rec, unknown(err, "execution", id)
+        }
+        if rec.Status.Finished() {
+            return rec, nil
+        }
+        select {
+        case <-ctx.Done():
+            return rec, ctx.Err()
+        case <-done:
+            done = s.waiters.add(id)
+        case <-ticker.C:
+        }
+    }
+}
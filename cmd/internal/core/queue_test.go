@@ -0,0 +1,142 @@
+package core
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestQueueDefer(t *testing.T) {
+    ctx := context.Background()
+    for name, repos := range testRepos(t) {
+        saveTestCommand(t, repos, "cmd-1", "node-1")
+        if _, err := repos.Executions.Save(ctx, Execution{ID: "exec-1", CommandID: "cmd-1", NodeID: "node-1", Status: ExecutionPending, StartedAt: time.Now()}); err != nil {
+            t.Fatal(err)
+        }
+        if err := repos.Queue.Enqueue(ctx, QueueJob{ExecutionID: "exec-1", NodeID: "node-1", CommandID: "cmd-1", EnqueuedAt: time.Now(), NodeLimit: 1}); err != nil {
+            t.Fatal(err)
+        }
+        job, ok, err := repos.Queue.Claim(ctx, "w1", time.Minute, QueuePolicy{})
+        if err != nil || !ok {
+            t.Fatalf("%s: Claim = %v, %v", name, ok, err)
+        }
+        stale := job
+        stale.Worker = "w2"
+        if err := repos.Queue.Defer(ctx, stale, time.Now()); !errors.Is(err, ErrLeaseLost) {
+            t.Errorf("%s: Defer by another worker: %v, want ErrLeaseLost", name, err)
+        }
+
+        until := time.Now().Add(200 * time.Millisecond)
+        if err := repos.Queue.Defer(ctx, job, until); err != nil {
+            t.Fatalf("%s: Defer: %v", name, err)
+        }
+        // A deferred job is pending again, its claim uncounted, but it is
+        // not claimable yet.
+        pending, err := repos.Queue.Pending(ctx, QueueFIFO)
+        if err != nil || len(pending) != 1 || pending[0].Attempts != 0 {
+            t.Fatalf("%s: Pending = %+v, %v", name, pending, err)
+        }
+        if _, ok, err := repos.Queue.Claim(ctx, "w1", time.Minute, QueuePolicy{}); ok || err != nil {
+            t.Fatalf("%s: deferred job claimed early: %v, %v", name, ok, err)
+        }
+        time.Sleep(time.Until(until))
+        job, ok, err = repos.Queue.Claim(ctx, "w1", time.Minute, QueuePolicy{})
+        if err != nil || !ok || job.Attempts != 1 {
+            t.Fatalf("%s: Claim after until = %+v, %v, %v", name, job, ok, err)
+        }
+    }
+}
+
+func TestDispatchOutlastsClientTimeout(t *testing.T) {
+    ctx := context.Background()
+    daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        time.Sleep(200 * time.Millisecond)
+        json.NewEncoder(w).Encode(ExecResponse{Stdout: "done"})
+    }))
+    defer daemon.Close()
+    svc := NewBastionService(NewInMemoryRepos())
+    // Short requests to the daemon keep their overall timeout; runs do not.
+    svc.client.Timeout = 50 * time.Millisecond
+    node := Node{ID: "node-1", Address: daemon.URL}
+    rec := Execution{ID: "exec-1", CommandID: "slow", NodeID: node.ID, Status: ExecutionRunning, StartedAt: time.Now()}
+    done, err := svc.dispatchExecution(ctx, ctx, Command{ID: "slow", TimeoutSeconds: 1}, node, rec)
+    if err != nil || done.Status != ExecutionSucceeded || done.Stdout != "done" {
+        t.Fatalf("dispatch = %+v, %v", done, err)
+    }
+}
+
+func TestQueuedRunRechecksGrant(t *testing.T) {
+    ctx := context.Background()
+    var dispatched atomic.Int32
+    daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        dispatched.Add(1)
+        json.NewEncoder(w).Encode(ExecResponse{Stdout: "ok"})
+    }))
+    defer daemon.Close()
+
+    for _, tc := range []struct {
+        name string
+        // lapse ends the grant while the run waits in the queue.
+        lapse func(svc *BastionService, repos Repositories, grant AccessGrant)
+        want  string
+    }{
+        {"revoked", func(svc *BastionService, repos Repositories, grant AccessGrant) {
+            if _, err := svc.RevokeGrant(WithPrincipal(ctx, Principal{Name: "alice"}), grant.ID); err != nil {
+                t.Fatal(err)
+            }
+        }, "was revoked"},
+        {"expired", func(svc *BastionService, repos Repositories, grant AccessGrant) {
+            past := time.Now().Add(-time.Second)
+            grant.ExpiresAt = &past
+            if _, err := repos.Grants.Save(ctx, grant); err != nil {
+                t.Fatal(err)
+            }
+        }, "was expired"},
+    } {
+        repos := NewInMemoryRepos()
+        svc := NewBastionService(repos)
+        svc.RequireGrants(true, time.Hour)
+        if _, err := repos.Nodes.Save(ctx, Node{ID: "node-1", Name: "node-1", Address: daemon.URL}); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := repos.Commands.Save(ctx, Command{ID: "cmd-1", Name: "cmd-1", Script: "true"}); err != nil {
+            t.Fatal(err)
+        }
+        start, end := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+        grant, err := repos.Grants.Save(ctx, AccessGrant{ID: "grant-1", User: "alice", NodeID: "node-1", Action: ActionExecute, Status: GrantApproved, RequestedAt: start, StartsAt: &start, ExpiresAt: &end})
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        // No worker is running, so the run waits in the queue.
+        waitCtx, cancel := context.WithTimeout(WithPrincipal(ctx, Principal{Name: "alice"}), 50*time.Millisecond)
+        rec, err := svc.ExecuteCommand(waitCtx, "cmd-1", "node-1", 0)
+        cancel()
+        if !errors.Is(err, context.DeadlineExceeded) || rec.GrantID != grant.ID {
+            t.Fatalf("%s: ExecuteCommand = %+v, %v; want it queued under %s", tc.name, rec, err, grant.ID)
+        }
+        tc.lapse(svc, repos, grant)
+
+        job, ok, err := repos.Queue.Claim(ctx, "w1", time.Minute, QueuePolicy{})
+        if err != nil || !ok {
+            t.Fatalf("%s: Claim = %v, %v", tc.name, ok, err)
+        }
+        svc.runJob(ctx, job, time.Minute)
+        rec, err = repos.Executions.Get(ctx, rec.ID)
+        if err != nil || rec.Status != ExecutionFailed || !strings.Contains(rec.Stderr, tc.want) {
+            t.Errorf("%s: execution = %+v, %v; want it failed as %q", tc.name, rec, err, tc.want)
+        }
+        if pending, _ := repos.Queue.Pending(ctx, QueueFIFO); len(pending) != 0 {
+            t.Errorf("%s: job still queued: %+v", tc.name, pending)
+        }
+    }
+    if n := dispatched.Load(); n != 0 {
+        t.Errorf("%d runs reached the daemon after their grant ended", n)
+    }
+}
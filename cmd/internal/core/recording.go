@@ -0,0 +1,257 @@
+package core
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "sort"
+    "sync"
+    "time"
+    "unicode/utf8"
+)
+
+// DefaultRecordingChunkSize is how much of a recording is buffered before it
+// is written out as a chunk.
+const DefaultRecordingChunkSize = 64 * 1024
+
+// DefaultMaxRecordingBytes caps a single session's recording.
+const DefaultMaxRecordingBytes = 32 << 20
+
+// recordingFlushInterval bounds how long recorded events sit in memory on a
+// quiet session before they are written out.
+const recordingFlushInterval = 10 * time.Second
+
+// SetMaxRecordingBytes caps each terminal recording at about max bytes; past
+// it the session goes on unrecorded. A non-positive max uses the default.
+func (s *BastionService) SetMaxRecordingBytes(max int64) {
+    if max <= 0 {
+        max = DefaultMaxRecordingBytes
+    }
+    s.maxRecordingBytes = max
+}
+
+// asciicastRecorder captures a terminal session as asciicast v2: a JSON
+// header line followed by one [seconds, code, data] event per line, with
+// "o" for output, "i" for input and "r" for resizes. Events are buffered
+// and handed to store in numbered chunks, so memory stays bounded however
+// long the session runs.
+type asciicastRecorder struct {
+    mu    sync.Mutex
+    buf   bytes.Buffer
+    start time.Time
+    // Frames can split a multi-byte character; the incomplete tail is held
+    // back per stream so events stay valid UTF-8.
+    pending map[string][]byte
+    // size counts every byte recorded; once the next event would take it
+    // past max, a marker event is written and the rest is dropped.
+    size      int64
+    max       int64
+    truncated bool
+
+    // flushMu keeps chunks in order. A chunk that fails to store is kept in
+    // unsent and retried with the next one.
+    flushMu   sync.Mutex
+    chunkSize int
+    seq       int
+    unsent    []byte
+    stored    int64
+    store     func(seq int, chunk []byte) error
+}
+
+func newAsciicastRecorder(cols, rows int, start time.Time, title string, max int64, store func(seq int, chunk []byte) error) *asciicastRecorder {
+    rec := &asciicastRecorder{start: start, pending: map[string][]byte{}, max: max, chunkSize: DefaultRecordingChunkSize, store: store}
+    header, _ := json.Marshal(map[string]interface{}{
+        "version":   2,
+        "width":     cols,
+        "height":    rows,
+        "timestamp": start.Unix(),
+        "title":     title,
+        "env":       map[string]string{"TERM": "xterm-256color"},
+    })
+    rec.writeLine(append(header, '\n'))
+    return rec
+}
+
+func (r *asciicastRecorder) output(data []byte) { r.event("o", data) }
+
+func (r *asciicastRecorder) input(data []byte) { r.event("i", data) }
+
+func (r *asciicastRecorder) resize(cols, rows uint16) {
+    r.mu.Lock()
+    r.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+    full := r.buf.Len() >= r.chunkSize
+    r.mu.Unlock()
+    if full {
+        r.flush()
+    }
+}
+
+func (r *asciicastRecorder) event(code string, data []byte) {
+    r.mu.Lock()
+    data = append(r.pending[code], data...)
+    cut := len(data)
+    // Back up over at most utf8.UTFMax-1 bytes of an unfinished character.
+    for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+        if utf8.RuneStart(data[i]) {
+            if !utf8.FullRune(data[i:]) {
+                cut = i
+            }
+            break
+        }
+    }
+    r.pending[code] = append([]byte(nil), data[cut:]...)
+    if cut > 0 {
+        r.writeEvent(code, string(data[:cut]))
+    }
+    full := r.buf.Len() >= r.chunkSize
+    r.mu.Unlock()
+    if full {
+        r.flush()
+    }
+}
+
+// writeEvent appends an event, or the truncation marker once the cap is
+// reached. The caller holds mu.
+func (r *asciicastRecorder) writeEvent(code, data string) {
+    if r.truncated {
+        return
+    }
+    line := r.eventLine(code, data)
+    if r.max > 0 && r.size+int64(len(line)) > r.max {
+        r.truncated = true
+        line = r.eventLine("m", fmt.Sprintf("recording stopped at the %d byte limit", r.max))
+    }
+    r.writeLine(line)
+}
+
+func (r *asciicastRecorder) eventLine(code, data string) []byte {
+    elapsed := time.Since(r.start).Seconds()
+    line, _ := json.Marshal([]interface{}{float64(int64(elapsed*1e6)) / 1e6, code, data})
+    return append(line, '\n')
+}
+
+func (r *asciicastRecorder) writeLine(line []byte) {
+    r.buf.Write(line)
+    r.size += int64(len(line))
+}
+
+// flush hands whatever is buffered to store as the next chunk.
+func (r *asciicastRecorder) flush() {
+    r.flushMu.Lock()
+    defer r.flushMu.Unlock()
+    r.mu.Lock()
+    r.unsent = append(r.unsent, r.buf.Bytes()...)
+    r.buf.Reset()
+    r.mu.Unlock()
+    if len(r.unsent) == 0 {
+        return
+    }
+    if err := r.store(r.seq, r.unsent); err != nil {
+        log.Printf("store recording chunk %d: %v", r.seq, err)
+        return
+    }
+    r.seq++
+    r.stored += int64(len(r.unsent))
+    r.unsent = nil
+}
+
+// close writes out held-back partial characters and the last chunk, and
+// returns how many bytes were stored.
+func (r *asciicastRecorder) close() int64 {
+    r.mu.Lock()
+    for code, rest := range r.pending {
+        if len(rest) > 0 {
+            r.writeEvent(code, string(rest))
+        }
+        delete(r.pending, code)
+    }
+    r.mu.Unlock()
+    r.flush()
+    r.flushMu.Lock()
+    defer r.flushMu.Unlock()
+    return r.stored
+}
+
+// ListSessions returns terminal sessions newest first, optionally narrowed to
+// a node or user. Callers without the admin role only see their own.
+func (s *BastionService) ListSessions(ctx context.Context, nodeID, user string) ([]TerminalSession, error) {
+    caller := PrincipalFrom(ctx)
+    if !caller.HasRole(RoleAdmin) {
+        user = caller.Name
+    }
+    sessions, err := s.sessions.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    out := []TerminalSession{}
+    for _, t := range sessions {
+        if (nodeID == "" || t.NodeID == nodeID) && (user == "" || t.User == user) {
+            out = append(out, t)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        return out[i].StartedAt.After(out[j].StartedAt)
+    })
+    return out, nil
+}
+
+// GetSession loads a session with its recording, subject to the same
+// visibility rule as ListSessions. Viewing a recording is audited.
+func (s *BastionService) GetSession(ctx context.Context, id string) (TerminalSession, error) {
+    t, err := s.sessions.Get(ctx, id)
+    caller := PrincipalFrom(ctx)
+    if err == nil && !caller.HasRole(RoleAdmin) && t.User != caller.Name {
+        err = ErrNotFound
+    }
+    if err != nil {
+        return TerminalSession{}, unknown(err, "session", id)
+    }
+    s.recordAudit(ctx, "session.replay", t.NodeID, t.ID, "", nil)
+    return t, nil
+}
+
+// ReplayAsciicast writes a recording to w at the pace it was captured,
+// scaled by speed, flushing after every event so HTTP clients see it live.
+// Gaps longer than maxWait are shortened to maxWait.
+func ReplayAsciicast(ctx context.Context, w io.Writer, cast []byte, speed float64, maxWait time.Duration) error {
+    if speed <= 0 {
+        speed = 1
+    }
+    flusher, _ := w.(http.Flusher)
+    lines := bytes.SplitAfter(cast, []byte("\n"))
+    var last float64
+    for i, line := range lines {
+        if len(bytes.TrimSpace(line)) == 0 {
+            continue
+        }
+        if i > 0 {
+            var event []json.RawMessage
+            var at float64
+            if json.Unmarshal(line, &event) == nil && len(event) > 0 && json.Unmarshal(event[0], &at) == nil {
+                wait := time.Duration((at - last) / speed * float64(time.Second))
+                if maxWait > 0 && wait > maxWait {
+                    wait = maxWait
+                }
+                last = at
+                if wait > 0 {
+                    select {
+                    case <-ctx.Done():
+                        return ctx.Err()
+                    case <-time.After(wait):
+                    }
+                }
+            }
+        }
+        if _, err := w.Write(line); err != nil {
+            return err
+        }
+        if flusher != nil {
+            flusher.Flush()
+        }
+    }
+    return nil
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+// castEvents parses an asciicast document into its events' codes and data,
+// failing on a malformed header or line.
+func castEvents(t *testing.T, cast []byte) (codes []string, data []string) {
+    t.Helper()
+    lines := strings.Split(strings.TrimSuffix(string(cast), "\n"), "\n")
+    var header map[string]interface{}
+    if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header["version"] != 2.0 {
+        t.Fatalf("header %q: %v", lines[0], err)
+    }
+    for _, line := range lines[1:] {
+        var event []interface{}
+        if err := json.Unmarshal([]byte(line), &event); err != nil || len(event) != 3 {
+            t.Fatalf("event %q: %v", line, err)
+        }
+        codes = append(codes, event[1].(string))
+        data = append(data, event[2].(string))
+    }
+    return codes, data
+}
+
+func TestRecordingStoredInChunks(t *testing.T) {
+    ctx := context.Background()
+    for name, repos := range testRepos(t) {
+        t.Run(name, func(t *testing.T) {
+            session := TerminalSession{ID: "sess-1", NodeID: "node-1", User: "alice", Cols: 80, Rows: 24, StartedAt: time.Now().UTC()}
+            if _, err := repos.Sessions.Save(ctx, session); err != nil {
+                t.Fatal(err)
+            }
+            rec := newAsciicastRecorder(80, 24, time.Now(), "alice@node-1", 0, func(seq int, chunk []byte) error {
+                return repos.Sessions.AppendRecording(ctx, session.ID, seq, chunk)
+            })
+            rec.chunkSize = 256
+            for i := 0; i < 50; i++ {
+                rec.output([]byte("line of output\r\n"))
+            }
+            // A character split across frames is recorded whole, in the second.
+            rec.output([]byte("caf\xc3"))
+            rec.output([]byte("\xa9\r\n"))
+            rec.resize(100, 30)
+            rec.input([]byte("exit\r"))
+
+            // Full chunks are stored while the session runs, leaving at most
+            // a chunk's worth in memory.
+            live, err := repos.Sessions.Get(ctx, session.ID)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(live.Recording) == 0 || live.RecordingBytes != int64(len(live.Recording)) {
+                t.Fatalf("mid-session: %d bytes stored, RecordingBytes %d", len(live.Recording), live.RecordingBytes)
+            }
+            if rec.buf.Len() >= rec.chunkSize {
+                t.Errorf("%d bytes still buffered", rec.buf.Len())
+            }
+
+            session.RecordingBytes = rec.close()
+            ended := time.Now().UTC()
+            session.EndedAt = &ended
+            if _, err := repos.Sessions.Save(ctx, session); err != nil {
+                t.Fatal(err)
+            }
+            got, err := repos.Sessions.Get(ctx, session.ID)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got.RecordingBytes != int64(len(got.Recording)) || got.RecordingBytes != rec.size {
+                t.Errorf("RecordingBytes %d, stored %d, recorded %d", got.RecordingBytes, len(got.Recording), rec.size)
+            }
+            codes, data := castEvents(t, got.Recording)
+            if len(codes) != 54 || data[50] != "caf" || data[51] != "é\r\n" || codes[52] != "r" || data[52] != "100x30" || codes[53] != "i" {
+                t.Errorf("events %v %q", codes, data[50:])
+            }
+            if sessions, err := repos.Sessions.List(ctx); err != nil || len(sessions) != 1 || sessions[0].Recording != nil {
+                t.Errorf("List = %+v, %v; want the session without its recording", sessions, err)
+            }
+        })
+    }
+}
+
+func TestAppendRecordingIgnoresRepeatedChunks(t *testing.T) {
+    ctx := context.Background()
+    for name, repos := range testRepos(t) {
+        if err := repos.Sessions.AppendRecording(ctx, "missing", 0, []byte("x")); !errors.Is(err, ErrNotFound) {
+            t.Errorf("%s: appending to a missing session: %v, want ErrNotFound", name, err)
+        }
+        if _, err := repos.Sessions.Save(ctx, TerminalSession{ID: "sess-1", NodeID: "node-1", User: "alice", StartedAt: time.Now().UTC()}); err != nil {
+            t.Fatal(err)
+        }
+        for _, chunk := range []struct {
+            seq  int
+            data string
+        }{{0, "first "}, {1, "second"}, {1, "again"}} {
+            if err := repos.Sessions.AppendRecording(ctx, "sess-1", chunk.seq, []byte(chunk.data)); err != nil {
+                t.Fatalf("%s: %v", name, err)
+            }
+        }
+        got, err := repos.Sessions.Get(ctx, "sess-1")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if string(got.Recording) != "first second" || got.RecordingBytes != 12 {
+            t.Errorf("%s: recording %q, %d bytes", name, got.Recording, got.RecordingBytes)
+        }
+    }
+}
+
+func TestRecordingStopsAtLimit(t *testing.T) {
+    var stored bytes.Buffer
+    rec := newAsciicastRecorder(80, 24, time.Now(), "alice@node-1", 1024, func(seq int, chunk []byte) error {
+        stored.Write(chunk)
+        return nil
+    })
+    for i := 0; i < 100; i++ {
+        rec.output([]byte("0123456789abcdef\r\n"))
+    }
+    rec.resize(100, 30)
+    if n := rec.close(); n != int64(stored.Len()) {
+        t.Errorf("close = %d, stored %d", n, stored.Len())
+    }
+    codes, data := castEvents(t, stored.Bytes())
+    last := len(codes) - 1
+    if codes[last] != "m" || !strings.Contains(data[last], "1024 byte limit") {
+        t.Fatalf("last event %s %q, want the limit marker", codes[last], data[last])
+    }
+    for _, code := range codes[:last] {
+        if code != "o" {
+            t.Fatalf("events %v: want only output before the marker", codes)
+        }
+    }
+    // Only the marker may run past the limit.
+    lines := bytes.SplitAfter(stored.Bytes(), []byte("\n"))
+    if before := stored.Len() - len(lines[last+1]); before > 1024 {
+        t.Errorf("%d bytes recorded before the marker, limit 1024", before)
+    }
+}
+
+func TestRecordingRetriesFailedChunks(t *testing.T) {
+    var stored bytes.Buffer
+    var seqs []int
+    failing := true
+    rec := newAsciicastRecorder(80, 24, time.Now(), "alice@node-1", 0, func(seq int, chunk []byte) error {
+        if failing {
+            return errors.New("database down")
+        }
+        seqs = append(seqs, seq)
+        stored.Write(chunk)
+        return nil
+    })
+    rec.output([]byte("before\r\n"))
+    rec.flush()
+    failing = false
+    rec.output([]byte("after\r\n"))
+    if n := rec.close(); n != int64(stored.Len()) || n != rec.size {
+        t.Errorf("close = %d, stored %d, recorded %d", n, stored.Len(), rec.size)
+    }
+    if len(seqs) != 1 || seqs[0] != 0 {
+        t.Errorf("stored chunks %v, want the failed one retried as 0", seqs)
+    }
+    if _, data := castEvents(t, stored.Bytes()); len(data) != 2 || data[0] != "before\r\n" || data[1] != "after\r\n" {
+        t.Errorf("events %q", data)
+    }
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+const (
+    recoveryPollInterval = 5 * time.Second
+    // recoveryGrace is how long past its timeout a run whose daemon cannot
+    // be reached is waited for before it is declared lost.
+    recoveryGrace = 5 * time.Minute
+)
+
+// RecoverExecutions reconciles executions a previous bastion process left
+// pending or running, those started before the given time: each is looked
+// up on its daemon, collected if it has finished and marked lost if the
+// daemon has no record of it. Runs still in progress are watched in the
+// background. Executions still in the queue are left to its workers. It
+// returns how many were settled right away.
+func (s *BastionService) RecoverExecutions(ctx context.Context, before time.Time) (int, error) {
+    var orphans []ExecutionSummary
+    for _, status := range []ExecutionStatus{ExecutionPending, ExecutionRunning} {
+        filter := ExecutionFilter{Status: status, To: before, Ascending: true, Limit: MaxExecutionPageSize}
+        for {
+            page, err := s.executions.List(ctx, filter)
+            if err != nil {
+                return 0, err
+            }
+            orphans = append(orphans, page...)
+            if len(page) < filter.Limit {
+                break
+            }
+            last := page[len(page)-1]
+            filter.After = &ExecutionCursor{StartedAt: last.StartedAt, ID: last.ID}
+        }
+    }
+    settled := 0
+    for _, o := range orphans {
+        if _, err := s.queue.Get(ctx, o.ID); err == nil {
+            continue
+        }
+        rec, err := s.executions.Get(ctx, o.ID)
+        if err != nil {
+            log.Printf("recover execution %s: %v", o.ID, err)
+            continue
+        }
+        done, err := s.recoverExecution(ctx, rec)
+        if err != nil {
+            log.Printf("recover execution %s: %v", rec.ID, err)
+        }
+        if done {
+            settled++
+        } else {
+            go s.watchExecution(ctx, rec)
+        }
+    }
+    return settled, nil
+}
+
+// recoverExecution asks the daemon about one run and settles it if the daemon
+// has a result or no record at all. It reports whether the run is settled.
+func (s *BastionService) recoverExecution(ctx context.Context, rec Execution) (bool, error) {
+    node, err := s.getNode(ctx, rec.NodeID)
+    if errors.Is(err, ErrNotFound) {
+        return true, s.loseExecution(ctx, rec, "node is no longer registered")
+    }
+    if err != nil {
+        return false, err
+    }
+    st, err := s.daemonExecution(ctx, node, rec.ID)
+    switch {
+    case errors.Is(err, ErrNotFound):
+        return true, s.loseExecution(ctx, rec, "daemon has no record of this execution")
+    case err != nil:
+        return false, err
+    case !st.Done || st.Result == nil:
+        return false, nil
+    }
+    done, err := s.finishExecution(ctx, node, rec, *st.Result)
+    s.recordAudit(ctx, "execution.recover", rec.NodeID, rec.ID, string(done.Status), err)
+    return true, err
+}
+
+// watchExecution polls the daemon until the run is settled. A daemon that
+// stays unreachable until well past the command's timeout loses the run.
+func (s *BastionService) watchExecution(ctx context.Context, rec Execution) {
+    timeout := commandTimeout(Command{})
+    if cmd, err := s.commands.Get(ctx, rec.CommandID); err == nil {
+        timeout = commandTimeout(cmd)
+    }
+    deadline := rec.StartedAt.Add(timeout + recoveryGrace)
+    ticker := time.NewTicker(recoveryPollInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        done, err := s.recoverExecution(ctx, rec)
+        if done {
+            if err != nil {
+                log.Printf("recover execution %s: %v", rec.ID, err)
+            }
+            return
+        }
+        if err != nil && time.Now().After(deadline) {
+            if err := s.loseExecution(ctx, rec, fmt.Sprintf("daemon unreachable: %v", err)); err != nil {
+                log.Printf("recover execution %s: %v", rec.ID, err)
+            }
+            return
+        }
+    }
+}
+
+// commandTimeout is how long the daemon lets a run of cmd go on, with the
+// daemon's default for commands that set none.
+func commandTimeout(cmd Command) time.Duration {
+    if cmd.TimeoutSeconds > 0 {
+        return time.Duration(cmd.TimeoutSeconds) * time.Second
+    }
+    return 300 * time.Second
+}
+
+func (s *BastionService) loseExecution(ctx context.Context, rec Execution, reason string) error {
+    now := time.Now().UTC()
+    rec.Status = ExecutionLost
+    rec.CompletedAt = &now
+    rec.ExitCode = -1
+    rec.Stderr = reason
+    _, err := s.executions.Save(ctx, rec)
+    s.recordAudit(ctx, "execution.lost", rec.NodeID, rec.ID, reason, err)
+    return err
+}
+
+// daemonExecution fetches the daemon's record of a run; ErrNotFound means it
+// has none.
+func (s *BastionService) daemonExecution(ctx context.Context, node Node, id string) (DaemonExecution, error) {
+    endpoint := strings.TrimRight(node.Address, "/") + "/api/v1/exec?id=" + url.QueryEscape(id)
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+    if err != nil {
+        return DaemonExecution{}, err
+    }
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return DaemonExecution{}, err
+    }
+    defer resp.Body.Close()
+    switch resp.StatusCode {
+    case http.StatusOK:
+    case http.StatusNotFound:
+        return DaemonExecution{}, ErrNotFound
+    default:
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return DaemonExecution{}, fmt.Errorf("daemon returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+    }
+    var st DaemonExecution
+    if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+        return DaemonExecution{}, fmt.Errorf("decode daemon execution: %w", err)
+    }
+    return st, nil
+}
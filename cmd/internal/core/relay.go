@@ -0,0 +1,94 @@
+package core
+
+import (
+    "io"
+    "sync"
+    "time"
+
+    "github.com/gorilla/websocket"
+)
+
+// PipeWebSocket copies binary frames from ws into conn and conn's bytes back
+// as binary frames until either side ends, then closes both. It returns the
+// byte counts in each direction.
+func PipeWebSocket(ws *websocket.Conn, conn io.ReadWriteCloser) (fromWS, toWS int64) {
+    var once sync.Once
+    closeBoth := func() {
+        once.Do(func() {
+            ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+            ws.Close()
+            conn.Close()
+        })
+    }
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        buf := make([]byte, 32*1024)
+        for {
+            n, err := conn.Read(buf)
+            if n > 0 {
+                if werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+                    break
+                }
+                toWS += int64(n)
+            }
+            if err != nil {
+                break
+            }
+        }
+        closeBoth()
+    }()
+    for {
+        kind, data, err := ws.ReadMessage()
+        if err != nil {
+            break
+        }
+        if kind != websocket.BinaryMessage {
+            continue
+        }
+        if _, err := conn.Write(data); err != nil {
+            break
+        }
+        fromWS += int64(len(data))
+    }
+    closeBoth()
+    <-done
+    return fromWS, toWS
+}
+
+// relayWebSockets joins two sockets frame for frame and returns the byte
+// counts a→b and b→a.
+func relayWebSockets(a, b *websocket.Conn) (aToB, bToA int64) {
+    var once sync.Once
+    closeBoth := func() {
+        once.Do(func() {
+            closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+            deadline := time.Now().Add(time.Second)
+            a.WriteControl(websocket.CloseMessage, closeMsg, deadline)
+            b.WriteControl(websocket.CloseMessage, closeMsg, deadline)
+            a.Close()
+            b.Close()
+        })
+    }
+    pump := func(from, to *websocket.Conn, n *int64) {
+        for {
+            kind, data, err := from.ReadMessage()
+            if err != nil {
+                break
+            }
+            if err := to.WriteMessage(kind, data); err != nil {
+                break
+            }
+            *n += int64(len(data))
+        }
+        closeBoth()
+    }
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        pump(b, a, &bToA)
+    }()
+    pump(a, b, &aToB)
+    <-done
+    return aToB, bToA
+}
@@ -1,24 +1,168 @@
 ﻿package core
 
-import "sync"
+import (
+    "context"
+    "sort"
+    "sync"
+    "time"
+)
 
 type CommandRepository interface {
-    List() []Command
-    Get(id string) (Command, bool)
-    Save(command Command) Command
-    Delete(id string)
+    List(ctx context.Context) ([]Command, error)
+    Get(ctx context.Context, id string) (Command, error)
+    Save(ctx context.Context, command Command) (Command, error)
+    Delete(ctx context.Context, id string) error
 }
 
 type NodeRepository interface {
-    List() []Node
-    Get(id string) (Node, bool)
-    Save(node Node) Node
+    List(ctx context.Context) ([]Node, error)
+    Get(ctx context.Context, id string) (Node, error)
+    Save(ctx context.Context, node Node) (Node, error)
 }
 
 type ExecutionRepository interface {
-    List() []Execution
-    Get(id string) (Execution, bool)
-    Save(execution Execution) Execution
+    // List returns the summaries matching filter in (started_at, id) order,
+    // at most filter.Limit of them when it is positive.
+    List(ctx context.Context, filter ExecutionFilter) ([]ExecutionSummary, error)
+    Get(ctx context.Context, id string) (Execution, error)
+    Save(ctx context.Context, execution Execution) (Execution, error)
+    // Prunable returns up to limit finished executions that policy no longer
+    // keeps as of now, oldest first.
+    Prunable(ctx context.Context, policy RetentionPolicy, now time.Time, limit int) ([]Execution, error)
+    // Delete removes the executions with the given ids and returns how many
+    // existed.
+    Delete(ctx context.Context, ids ...string) (int, error)
+}
+
+type AuditRepository interface {
+    List(ctx context.Context) ([]AuditEvent, error)
+    Save(ctx context.Context, event AuditEvent) (AuditEvent, error)
+}
+
+type GrantRepository interface {
+    List(ctx context.Context) ([]AccessGrant, error)
+    // Active returns user's approved grants for action whose window covers
+    // at, on nodeID or, when it is empty, on any node.
+    Active(ctx context.Context, user, nodeID, action string, at time.Time) ([]AccessGrant, error)
+    Get(ctx context.Context, id string) (AccessGrant, error)
+    Save(ctx context.Context, grant AccessGrant) (AccessGrant, error)
+}
+
+// SessionRepository stores terminal sessions. List leaves Recording empty;
+// Get assembles it from the chunks AppendRecording stored. Save leaves the
+// stored recording alone.
+type SessionRepository interface {
+    List(ctx context.Context) ([]TerminalSession, error)
+    Get(ctx context.Context, id string) (TerminalSession, error)
+    Save(ctx context.Context, session TerminalSession) (TerminalSession, error)
+    // AppendRecording stores chunk seq of a session's recording and adds its
+    // length to RecordingBytes. Storing the same seq again is a no-op.
+    AppendRecording(ctx context.Context, id string, seq int, chunk []byte) error
+}
+
+// ExecutionQueue hands queued executions to workers, possibly in other
+// bastion processes sharing the database.
+type ExecutionQueue interface {
+    Enqueue(ctx context.Context, job QueueJob) error
+    // Claim leases to worker the first job, in policy's order, that is not
+    // leased, or whose lease has run out, and that starting would not exceed
+    // its node's, its command's or the global limit. Leased jobs count as
+    // running. It reports false when there is none.
+    Claim(ctx context.Context, worker string, lease time.Duration, policy QueuePolicy) (QueueJob, bool, error)
+    // Heartbeat renews a lease, or fails with ErrLeaseLost if the job has
+    // been claimed by someone else or completed.
+    Heartbeat(ctx context.Context, job QueueJob, lease time.Duration) error
+    // Defer hands a leased job back without counting the claim, to be
+    // claimed again no sooner than until. It fails with ErrLeaseLost as
+    // Heartbeat does.
+    Defer(ctx context.Context, job QueueJob, until time.Time) error
+    Complete(ctx context.Context, job QueueJob) error
+    Get(ctx context.Context, executionID string) (QueueJob, error)
+    // Pending lists the jobs waiting to be claimed, in order.
+    Pending(ctx context.Context, order QueueOrder) ([]QueueJob, error)
+}
+
+// GPUMetricsRepository stores GPU readings at raw, per-minute and per-hour
+// resolution. Writing a reading into an existing bucket merges the two.
+type GPUMetricsRepository interface {
+    Append(ctx context.Context, metrics []GPUMetric) error
+    // Range returns the readings of every resolution in [from, to), oldest
+    // first; nodeID empty means every node.
+    Range(ctx context.Context, nodeID string, from, to time.Time) ([]GPUMetric, error)
+    // Oldest returns the earliest bucket stored at resolution.
+    Oldest(ctx context.Context, resolution time.Duration) (time.Time, bool, error)
+    // Compact replaces, atomically, the readings at resolution from in
+    // [start, end) with their averages at resolution to.
+    Compact(ctx context.Context, from, to time.Duration, start, end time.Time) (int, error)
+    DeleteBefore(ctx context.Context, resolution time.Duration, before time.Time) (int, error)
+}
+
+// GPUReservationRepository stores which GPUs are held by which executions.
+type GPUReservationRepository interface {
+    List(ctx context.Context) ([]GPUReservation, error)
+    // Reserve takes all of reservations or, if any device is already held,
+    // none of them and returns ErrGPUReserved.
+    Reserve(ctx context.Context, reservations []GPUReservation) error
+    // Release frees every device held by the execution.
+    Release(ctx context.Context, executionID string) error
+}
+
+// AlertRepository stores GPU alerts.
+type AlertRepository interface {
+    // Active lists the pending and firing alerts.
+    Active(ctx context.Context) ([]Alert, error)
+    // List returns the most recently updated alerts, in state if it is set.
+    List(ctx context.Context, state AlertState, limit int) ([]Alert, error)
+    Save(ctx context.Context, alert Alert) (Alert, error)
+    Delete(ctx context.Context, id string) error
+}
+
+// TunnelRepository stores tunnels so any bastion replica can list, connect
+// through and close them. Traffic counters only move through AddTraffic, so
+// replicas relaying the same tunnel never overwrite each other's counts.
+type TunnelRepository interface {
+    List(ctx context.Context) ([]Tunnel, error)
+    Get(ctx context.Context, id string) (Tunnel, error)
+    Create(ctx context.Context, tunnel Tunnel) (Tunnel, error)
+    // Close marks an open tunnel closed and reports whether it was open.
+    Close(ctx context.Context, id, by string, at time.Time) (bool, error)
+    // AddTraffic adjusts a tunnel's live and total connection counts and
+    // adds to its byte counts.
+    AddTraffic(ctx context.Context, id string, active, connections int, in, out int64) error
+    // DeleteEndedBefore forgets tunnels that closed or expired before t.
+    DeleteEndedBefore(ctx context.Context, t time.Time) error
+}
+
+// Repositories bundles the persistence the bastion needs so backends can be
+// swapped as a unit.
+type Repositories struct {
+    Commands   CommandRepository
+    Nodes      NodeRepository
+    Executions ExecutionRepository
+    Audit      AuditRepository
+    Sessions   SessionRepository
+    Grants     GrantRepository
+    Queue      ExecutionQueue
+    GPUMetrics GPUMetricsRepository
+    Alerts     AlertRepository
+    GPUs       GPUReservationRepository
+    Tunnels    TunnelRepository
+}
+
+func NewInMemoryRepos() Repositories {
+    return Repositories{
+        Commands:   NewInMemoryCommandRepo(),
+        Nodes:      NewInMemoryNodeRepo(),
+        Executions: NewInMemoryExecutionRepo(),
+        Audit:      NewInMemoryAuditRepo(),
+        Sessions:   NewInMemorySessionRepo(),
+        Grants:     NewInMemoryGrantRepo(),
+        Queue:      NewInMemoryQueue(),
+        GPUMetrics: NewInMemoryGPUMetricsRepo(),
+        Alerts:     NewInMemoryAlertRepo(),
+        GPUs:       NewInMemoryGPUReservationRepo(),
+        Tunnels:    NewInMemoryTunnelRepo(),
+    }
 }
 
 type InMemoryCommandRepo struct {
@@ -30,34 +174,41 @@ func NewInMemoryCommandRepo() *InMemoryCommandRepo {
     return &InMemoryCommandRepo{data: map[string]Command{}}
 }
 
-func (r *InMemoryCommandRepo) List() []Command {
+func (r *InMemoryCommandRepo) List(ctx context.Context) ([]Command, error) {
     r.mu.RLock()
     defer r.mu.RUnlock()
     out := make([]Command, 0, len(r.data))
     for _, v := range r.data {
         out = append(out, v)
     }
-    return out
+    return out, nil
 }
 
-func (r *InMemoryCommandRepo) Get(id string) (Command, bool) {
+func (r *InMemoryCommandRepo) Get(ctx context.Context, id string) (Command, error) {
     r.mu.RLock()
     defer r.mu.RUnlock()
     v, ok := r.data[id]
-    return v, ok
+    if !ok {
+        return Command{}, ErrNotFound
+    }
+    return v, nil
 }
 
-func (r *InMemoryCommandRepo) Save(command Command) Command {
+func (r *InMemoryCommandRepo) Save(ctx context.Context, command Command) (Command, error) {
     r.mu.Lock()
     defer r.mu.Unlock()
     r.data[command.ID] = command
-    return command
+    return command, nil
 }
 
-func (r *InMemoryCommandRepo) Delete(id string) {
+func (r *InMemoryCommandRepo) Delete(ctx context.Context, id string) error {
     r.mu.Lock()
     defer r.mu.Unlock()
+    if _, ok := r.data[id]; !ok {
+        return ErrNotFound
+    }
     delete(r.data, id)
+    return nil
 }
 
 type InMemoryNodeRepo struct {
@@ -69,28 +220,31 @@ func NewInMemoryNodeRepo() *InMemoryNodeRepo {
     return &InMemoryNodeRepo{data: map[string]Node{}}
 }
 
-func (r *InMemoryNodeRepo) List() []Node {
+func (r *InMemoryNodeRepo) List(ctx context.Context) ([]Node, error) {
     r.mu.RLock()
     defer r.mu.RUnlock()
     out := make([]Node, 0, len(r.data))
     for _, v := range r.data {
         out = append(out, v)
     }
-    return out
+    return out, nil
 }
 
-func (r *InMemoryNodeRepo) Get(id string) (Node, bool) {
+func (r *InMemoryNodeRepo) Get(ctx context.Context, id string) (Node, error) {
     r.mu.RLock()
     defer r.mu.RUnlock()
     v, ok := r.data[id]
-    return v, ok
+    if !ok {
+        return Node{}, ErrNotFound
+    }
+    return v, nil
 }
 
-func (r *InMemoryNodeRepo) Save(node Node) Node {
+func (r *InMemoryNodeRepo) Save(ctx context.Context, node Node) (Node, error) {
     r.mu.Lock()
     defer r.mu.Unlock()
     r.data[node.ID] = node
-    return node
+    return node, nil
 }
 
 type InMemoryExecutionRepo struct {
@@ -102,26 +256,585 @@ func NewInMemoryExecutionRepo() *InMemoryExecutionRepo {
     return &InMemoryExecutionRepo{data: map[string]Execution{}}
 }
 
-func (r *InMemoryExecutionRepo) List() []Execution {
+func (r *InMemoryExecutionRepo) List(ctx context.Context, filter ExecutionFilter) ([]ExecutionSummary, error) {
     r.mu.RLock()
     defer r.mu.RUnlock()
-    out := make([]Execution, 0, len(r.data))
+    out := []ExecutionSummary{}
     for _, v := range r.data {
-        out = append(out, v)
+        if filter.matches(v) {
+            out = append(out, v.Summary())
+        }
     }
-    return out
+    sort.Slice(out, func(i, j int) bool {
+        return filter.before(out[i].StartedAt, out[i].ID, out[j].StartedAt, out[j].ID)
+    })
+    if filter.Limit > 0 && len(out) > filter.Limit {
+        out = out[:filter.Limit]
+    }
+    return out, nil
 }
 
-func (r *InMemoryExecutionRepo) Get(id string) (Execution, bool) {
+func (r *InMemoryExecutionRepo) Get(ctx context.Context, id string) (Execution, error) {
     r.mu.RLock()
     defer r.mu.RUnlock()
     v, ok := r.data[id]
-    return v, ok
+    if !ok {
+        return Execution{}, ErrNotFound
+    }
+    return v, nil
 }
 
-func (r *InMemoryExecutionRepo) Save(execution Execution) Execution {
+func (r *InMemoryExecutionRepo) Save(ctx context.Context, execution Execution) (Execution, error) {
     r.mu.Lock()
     defer r.mu.Unlock()
     r.data[execution.ID] = execution
-    return execution
+    return execution, nil
+}
+
+func (r *InMemoryExecutionRepo) Prunable(ctx context.Context, policy RetentionPolicy, now time.Time, limit int) ([]Execution, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    all := make([]Execution, 0, len(r.data))
+    for _, v := range r.data {
+        all = append(all, v)
+    }
+    return prunable(all, policy, now, limit), nil
+}
+
+func (r *InMemoryExecutionRepo) Delete(ctx context.Context, ids ...string) (int, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    n := 0
+    for _, id := range ids {
+        if _, ok := r.data[id]; ok {
+            delete(r.data, id)
+            n++
+        }
+    }
+    return n, nil
+}
+
+type InMemoryAuditRepo struct {
+    mu     sync.RWMutex
+    events []AuditEvent
+}
+
+func NewInMemoryAuditRepo() *InMemoryAuditRepo {
+    return &InMemoryAuditRepo{}
+}
+
+func (r *InMemoryAuditRepo) List(ctx context.Context) ([]AuditEvent, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    out := make([]AuditEvent, len(r.events))
+    copy(out, r.events)
+    return out, nil
+}
+
+func (r *InMemoryAuditRepo) Save(ctx context.Context, event AuditEvent) (AuditEvent, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.events = append(r.events, event)
+    return event, nil
+}
+
+type InMemorySessionRepo struct {
+    mu     sync.RWMutex
+    data   map[string]TerminalSession
+    chunks map[string]map[int][]byte
+}
+
+func NewInMemorySessionRepo() *InMemorySessionRepo {
+    return &InMemorySessionRepo{data: map[string]TerminalSession{}, chunks: map[string]map[int][]byte{}}
+}
+
+func (r *InMemorySessionRepo) List(ctx context.Context) ([]TerminalSession, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    out := make([]TerminalSession, 0, len(r.data))
+    for _, v := range r.data {
+        v.Recording = nil
+        out = append(out, v)
+    }
+    return out, nil
+}
+
+func (r *InMemorySessionRepo) Get(ctx context.Context, id string) (TerminalSession, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    v, ok := r.data[id]
+    if !ok {
+        return TerminalSession{}, ErrNotFound
+    }
+    chunks := r.chunks[id]
+    v.Recording = nil
+    for seq := 0; seq < len(chunks); seq++ {
+        v.Recording = append(v.Recording, chunks[seq]...)
+    }
+    return v, nil
+}
+
+func (r *InMemorySessionRepo) Save(ctx context.Context, session TerminalSession) (TerminalSession, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    session.Recording = nil
+    r.data[session.ID] = session
+    return session, nil
+}
+
+func (r *InMemorySessionRepo) AppendRecording(ctx context.Context, id string, seq int, chunk []byte) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    v, ok := r.data[id]
+    if !ok {
+        return ErrNotFound
+    }
+    if r.chunks[id] == nil {
+        r.chunks[id] = map[int][]byte{}
+    }
+    if _, dup := r.chunks[id][seq]; dup {
+        return nil
+    }
+    r.chunks[id][seq] = append([]byte(nil), chunk...)
+    v.RecordingBytes += int64(len(chunk))
+    r.data[id] = v
+    return nil
+}
+
+type InMemoryGrantRepo struct {
+    mu   sync.RWMutex
+    data map[string]AccessGrant
+}
+
+func NewInMemoryGrantRepo() *InMemoryGrantRepo {
+    return &InMemoryGrantRepo{data: map[string]AccessGrant{}}
+}
+
+func (r *InMemoryGrantRepo) List(ctx context.Context) ([]AccessGrant, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    out := make([]AccessGrant, 0, len(r.data))
+    for _, v := range r.data {
+        out = append(out, v)
+    }
+    return out, nil
+}
+
+func (r *InMemoryGrantRepo) Active(ctx context.Context, user, nodeID, action string, at time.Time) ([]AccessGrant, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    var out []AccessGrant
+    for _, g := range r.data {
+        if g.User == user && g.Action == action && (nodeID == "" || g.NodeID == nodeID) && g.activeAt(at) {
+            out = append(out, g)
+        }
+    }
+    return out, nil
+}
+
+func (r *InMemoryGrantRepo) Get(ctx context.Context, id string) (AccessGrant, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    v, ok := r.data[id]
+    if !ok {
+        return AccessGrant{}, ErrNotFound
+    }
+    return v, nil
+}
+
+func (r *InMemoryGrantRepo) Save(ctx context.Context, grant AccessGrant) (AccessGrant, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.data[grant.ID] = grant
+    return grant, nil
+}
+
+type InMemoryQueue struct {
+    mu   sync.Mutex
+    jobs map[string]QueueJob
+}
+
+func NewInMemoryQueue() *InMemoryQueue {
+    return &InMemoryQueue{jobs: map[string]QueueJob{}}
+}
+
+func (q *InMemoryQueue) Enqueue(ctx context.Context, job QueueJob) error {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.jobs[job.ExecutionID] = job
+    return nil
+}
+
+func (q *InMemoryQueue) Claim(ctx context.Context, worker string, lease time.Duration, policy QueuePolicy) (QueueJob, bool, error) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    now := time.Now()
+    running := 0
+    perNode := map[string]int{}
+    perCommand := map[string]int{}
+    for _, job := range q.jobs {
+        if job.leased(now) {
+            running++
+            perNode[job.NodeID]++
+            perCommand[job.CommandID]++
+        }
+    }
+    if policy.MaxRunning > 0 && running >= policy.MaxRunning {
+        return QueueJob{}, false, nil
+    }
+    for _, job := range q.pending(now, policy.Order) {
+        if job.NotBefore != nil && job.NotBefore.After(now) ||
+            job.NodeLimit > 0 && perNode[job.NodeID] >= job.NodeLimit ||
+            job.CommandLimit > 0 && perCommand[job.CommandID] >= job.CommandLimit {
+            continue
+        }
+        expires := now.Add(lease)
+        job.Worker, job.LeaseExpiresAt = worker, &expires
+        job.Attempts++
+        q.jobs[job.ExecutionID] = job
+        return job, true, nil
+    }
+    return QueueJob{}, false, nil
+}
+
+func (q *InMemoryQueue) Heartbeat(ctx context.Context, job QueueJob, lease time.Duration) error {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    cur, ok := q.jobs[job.ExecutionID]
+    if !ok || cur.Worker != job.Worker {
+        return ErrLeaseLost
+    }
+    expires := time.Now().Add(lease)
+    cur.LeaseExpiresAt = &expires
+    q.jobs[job.ExecutionID] = cur
+    return nil
+}
+
+func (q *InMemoryQueue) Defer(ctx context.Context, job QueueJob, until time.Time) error {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    cur, ok := q.jobs[job.ExecutionID]
+    if !ok || cur.Worker != job.Worker {
+        return ErrLeaseLost
+    }
+    cur.Worker, cur.LeaseExpiresAt, cur.NotBefore = "", nil, &until
+    cur.Attempts--
+    q.jobs[job.ExecutionID] = cur
+    return nil
+}
+
+func (q *InMemoryQueue) Complete(ctx context.Context, job QueueJob) error {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    if cur, ok := q.jobs[job.ExecutionID]; ok && cur.Worker == job.Worker {
+        delete(q.jobs, job.ExecutionID)
+    }
+    return nil
+}
+
+func (q *InMemoryQueue) Get(ctx context.Context, executionID string) (QueueJob, error) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    job, ok := q.jobs[executionID]
+    if !ok {
+        return QueueJob{}, ErrNotFound
+    }
+    return job, nil
+}
+
+func (q *InMemoryQueue) Pending(ctx context.Context, order QueueOrder) ([]QueueJob, error) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    return q.pending(time.Now(), order), nil
+}
+
+func (q *InMemoryQueue) pending(now time.Time, order QueueOrder) []QueueJob {
+    out := []QueueJob{}
+    for _, job := range q.jobs {
+        if !job.leased(now) {
+            out = append(out, job)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        a, b := out[i], out[j]
+        if order == QueuePriority && a.Priority != b.Priority {
+            return a.Priority > b.Priority
+        }
+        if !a.EnqueuedAt.Equal(b.EnqueuedAt) {
+            return a.EnqueuedAt.Before(b.EnqueuedAt)
+        }
+        return a.ExecutionID < b.ExecutionID
+    })
+    return out
+}
+
+func (j QueueJob) leased(now time.Time) bool {
+    return j.LeaseExpiresAt != nil && j.LeaseExpiresAt.After(now)
+}
+
+type gpuMetricKey struct {
+    nodeID     string
+    resolution time.Duration
+    at         int64
+    index      int
+}
+
+func (m GPUMetric) key() gpuMetricKey {
+    return gpuMetricKey{m.NodeID, m.Resolution, m.At.UnixNano(), m.Index}
+}
+
+type InMemoryGPUMetricsRepo struct {
+    mu   sync.Mutex
+    data map[gpuMetricKey]GPUMetric
+}
+
+func NewInMemoryGPUMetricsRepo() *InMemoryGPUMetricsRepo {
+    return &InMemoryGPUMetricsRepo{data: map[gpuMetricKey]GPUMetric{}}
+}
+
+func (r *InMemoryGPUMetricsRepo) Append(ctx context.Context, metrics []GPUMetric) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.append(metrics)
+    return nil
+}
+
+func (r *InMemoryGPUMetricsRepo) append(metrics []GPUMetric) {
+    for _, m := range metrics {
+        if cur, ok := r.data[m.key()]; ok {
+            m = mergeGPUMetrics(cur, m)
+        }
+        r.data[m.key()] = m
+    }
+}
+
+func (r *InMemoryGPUMetricsRepo) Range(ctx context.Context, nodeID string, from, to time.Time) ([]GPUMetric, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := []GPUMetric{}
+    for _, m := range r.data {
+        if (nodeID == "" || m.NodeID == nodeID) && !m.At.Before(from) && m.At.Before(to) {
+            out = append(out, m)
+        }
+    }
+    sortGPUMetrics(out)
+    return out, nil
+}
+
+func (r *InMemoryGPUMetricsRepo) Oldest(ctx context.Context, resolution time.Duration) (time.Time, bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    var oldest time.Time
+    found := false
+    for _, m := range r.data {
+        if m.Resolution == resolution && (!found || m.At.Before(oldest)) {
+            oldest, found = m.At, true
+        }
+    }
+    return oldest, found, nil
+}
+
+func (r *InMemoryGPUMetricsRepo) Compact(ctx context.Context, from, to time.Duration, start, end time.Time) (int, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    var rows []GPUMetric
+    for k, m := range r.data {
+        if m.Resolution == from && !m.At.Before(start) && m.At.Before(end) {
+            rows = append(rows, m)
+            delete(r.data, k)
+        }
+    }
+    r.append(rollupGPUMetrics(rows, to))
+    return len(rows), nil
+}
+
+func (r *InMemoryGPUMetricsRepo) DeleteBefore(ctx context.Context, resolution time.Duration, before time.Time) (int, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    n := 0
+    for k, m := range r.data {
+        if m.Resolution == resolution && m.At.Before(before) {
+            delete(r.data, k)
+            n++
+        }
+    }
+    return n, nil
+}
+
+type InMemoryAlertRepo struct {
+    mu   sync.Mutex
+    data map[string]Alert
+}
+
+func NewInMemoryAlertRepo() *InMemoryAlertRepo {
+    return &InMemoryAlertRepo{data: map[string]Alert{}}
+}
+
+func (r *InMemoryAlertRepo) Active(ctx context.Context) ([]Alert, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := []Alert{}
+    for _, a := range r.data {
+        if a.State == AlertPending || a.State == AlertFiring {
+            out = append(out, a)
+        }
+    }
+    return out, nil
+}
+
+func (r *InMemoryAlertRepo) List(ctx context.Context, state AlertState, limit int) ([]Alert, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := []Alert{}
+    for _, a := range r.data {
+        if state == "" || a.State == state {
+            out = append(out, a)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *InMemoryAlertRepo) Save(ctx context.Context, alert Alert) (Alert, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.data[alert.ID] = alert
+    return alert, nil
+}
+
+func (r *InMemoryAlertRepo) Delete(ctx context.Context, id string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    delete(r.data, id)
+    return nil
+}
+
+type InMemoryTunnelRepo struct {
+    mu   sync.Mutex
+    data map[string]Tunnel
+}
+
+func NewInMemoryTunnelRepo() *InMemoryTunnelRepo {
+    return &InMemoryTunnelRepo{data: map[string]Tunnel{}}
+}
+
+func (r *InMemoryTunnelRepo) List(ctx context.Context) ([]Tunnel, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]Tunnel, 0, len(r.data))
+    for _, t := range r.data {
+        out = append(out, t)
+    }
+    return out, nil
+}
+
+func (r *InMemoryTunnelRepo) Get(ctx context.Context, id string) (Tunnel, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    t, ok := r.data[id]
+    if !ok {
+        return Tunnel{}, ErrNotFound
+    }
+    return t, nil
+}
+
+func (r *InMemoryTunnelRepo) Create(ctx context.Context, tunnel Tunnel) (Tunnel, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.data[tunnel.ID] = tunnel
+    return tunnel, nil
+}
+
+func (r *InMemoryTunnelRepo) Close(ctx context.Context, id, by string, at time.Time) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    t, ok := r.data[id]
+    if !ok {
+        return false, ErrNotFound
+    }
+    if t.ClosedAt != nil {
+        return false, nil
+    }
+    t.ClosedAt, t.ClosedBy = &at, by
+    r.data[id] = t
+    return true, nil
+}
+
+func (r *InMemoryTunnelRepo) AddTraffic(ctx context.Context, id string, active, connections int, in, out int64) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    t, ok := r.data[id]
+    if !ok {
+        return ErrNotFound
+    }
+    t.Active += active
+    t.Connections += connections
+    t.BytesIn += in
+    t.BytesOut += out
+    r.data[id] = t
+    return nil
+}
+
+func (r *InMemoryTunnelRepo) DeleteEndedBefore(ctx context.Context, before time.Time) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for id, t := range r.data {
+        if (t.ClosedAt != nil && t.ClosedAt.Before(before)) || t.ExpiresAt.Before(before) {
+            delete(r.data, id)
+        }
+    }
+    return nil
+}
+
+type gpuDeviceKey struct {
+    nodeID string
+    index  int
+}
+
+type InMemoryGPUReservationRepo struct {
+    mu   sync.Mutex
+    data map[gpuDeviceKey]GPUReservation
+}
+
+func NewInMemoryGPUReservationRepo() *InMemoryGPUReservationRepo {
+    return &InMemoryGPUReservationRepo{data: map[gpuDeviceKey]GPUReservation{}}
+}
+
+func (r *InMemoryGPUReservationRepo) List(ctx context.Context) ([]GPUReservation, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]GPUReservation, 0, len(r.data))
+    for _, v := range r.data {
+        out = append(out, v)
+    }
+    sortGPUReservations(out)
+    return out, nil
+}
+
+func (r *InMemoryGPUReservationRepo) Reserve(ctx context.Context, reservations []GPUReservation) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for _, res := range reservations {
+        if _, ok := r.data[gpuDeviceKey{res.NodeID, res.DeviceIndex}]; ok {
+            return ErrGPUReserved
+        }
+    }
+    for _, res := range reservations {
+        r.data[gpuDeviceKey{res.NodeID, res.DeviceIndex}] = res
+    }
+    return nil
+}
+
+func (r *InMemoryGPUReservationRepo) Release(ctx context.Context, executionID string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for k, v := range r.data {
+        if v.ExecutionID == executionID {
+            delete(r.data, k)
+        }
+    }
+    return nil
 }
@@ -0,0 +1,1071 @@
+package core
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+)
+
+// NewSQLRepos creates repos backed by db, applying any pending migrations
+// first. The queries are plain SQL that both PostgreSQL and SQLite accept.
+func NewSQLRepos(ctx context.Context, db *Database) (Repositories, error) {
+    migrator, err := NewMigrator(db)
+    if err != nil {
+        return Repositories{}, err
+    }
+    applied, err := migrator.Up(ctx, 0)
+    for _, m := range applied {
+        log.Printf("applied migration %04d_%s", m.Version, m.Name)
+    }
+    if err != nil {
+        return Repositories{}, fmt.Errorf("migrate: %w", err)
+    }
+    return Repositories{
+        Commands:   &SQLCommandRepo{db: db.DB},
+        Nodes:      &SQLNodeRepo{db: db.DB},
+        Executions: &SQLExecutionRepo{db: db.DB},
+        Audit:      &SQLAuditRepo{db: db.DB},
+        Sessions:   &SQLSessionRepo{db: db.DB},
+        Grants:     &SQLGrantRepo{db: db.DB},
+        Queue:      &SQLQueue{db: db.DB, dialect: db.Dialect},
+        GPUMetrics: &SQLGPUMetricsRepo{db: db.DB},
+        Alerts:     &SQLAlertRepo{db: db.DB},
+        GPUs:       &SQLGPUReservationRepo{db: db.DB},
+        Tunnels:    &SQLTunnelRepo{db: db.DB},
+    }, nil
+}
+
+type SQLCommandRepo struct {
+    db *sql.DB
+}
+
+const commandColumns = `id, name, description, script, timeout_seconds, memory_limit_mb, cpu_limit_percent, pids_limit, isolation, artifacts, max_concurrent, gpu_count, gpu_min_free_mb, gpu_nodes, created_at`
+
+func (r *SQLCommandRepo) List(ctx context.Context) ([]Command, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT `+commandColumns+` FROM commands ORDER BY created_at DESC`)
+    if err != nil {
+        return nil, fmt.Errorf("list commands: %w", err)
+    }
+    defer rows.Close()
+    out := []Command{}
+    for rows.Next() {
+        c, err := scanCommand(rows)
+        if err != nil {
+            return nil, fmt.Errorf("list commands: %w", err)
+        }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLCommandRepo) Get(ctx context.Context, id string) (Command, error) {
+    c, err := scanCommand(r.db.QueryRowContext(ctx, `SELECT `+commandColumns+` FROM commands WHERE id=$1`, id))
+    if err != nil {
+        return Command{}, notFound(err, "get command")
+    }
+    return c, nil
+}
+
+func (r *SQLCommandRepo) Save(ctx context.Context, command Command) (Command, error) {
+    _, err := r.db.ExecContext(ctx,
+        `INSERT INTO commands (`+commandColumns+`)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+         ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, description=EXCLUDED.description, script=EXCLUDED.script, timeout_seconds=EXCLUDED.timeout_seconds, memory_limit_mb=EXCLUDED.memory_limit_mb, cpu_limit_percent=EXCLUDED.cpu_limit_percent, pids_limit=EXCLUDED.pids_limit, isolation=EXCLUDED.isolation, artifacts=EXCLUDED.artifacts, max_concurrent=EXCLUDED.max_concurrent, gpu_count=EXCLUDED.gpu_count, gpu_min_free_mb=EXCLUDED.gpu_min_free_mb, gpu_nodes=EXCLUDED.gpu_nodes`,
+        command.ID, command.Name, command.Description, command.Script, command.TimeoutSeconds, command.Limits.MemoryMB, command.Limits.CPUPercent, command.Limits.MaxPids, string(command.Isolation), jsonArray(command.Artifacts), command.MaxConcurrent, command.GPU.Count, command.GPU.MinFreeMemoryMB, jsonArray(command.GPU.Nodes), command.CreatedAt,
+    )
+    if err != nil {
+        return Command{}, fmt.Errorf("save command: %w", err)
+    }
+    return command, nil
+}
+
+func (r *SQLCommandRepo) Delete(ctx context.Context, id string) error {
+    res, err := r.db.ExecContext(ctx, `DELETE FROM commands WHERE id=$1`, id)
+    if err != nil {
+        return fmt.Errorf("delete command: %w", err)
+    }
+    if n, err := res.RowsAffected(); err == nil && n == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+func scanCommand(row scanner) (Command, error) {
+    var c Command
+    var desc sql.NullString
+    var isolation string
+    var artifacts, gpuNodes []byte
+    if err := row.Scan(&c.ID, &c.Name, &desc, &c.Script, &c.TimeoutSeconds, &c.Limits.MemoryMB, &c.Limits.CPUPercent, &c.Limits.MaxPids, &isolation, &artifacts, &c.MaxConcurrent, &c.GPU.Count, &c.GPU.MinFreeMemoryMB, &gpuNodes, &c.CreatedAt); err != nil {
+        return Command{}, err
+    }
+    c.Description = desc.String
+    c.Isolation = IsolationMode(isolation)
+    json.Unmarshal(artifacts, &c.Artifacts)
+    json.Unmarshal(gpuNodes, &c.GPU.Nodes)
+    return c, nil
+}
+
+type SQLNodeRepo struct {
+    db *sql.DB
+}
+
+func (r *SQLNodeRepo) List(ctx context.Context) ([]Node, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT id, name, address, max_concurrent FROM nodes ORDER BY name`)
+    if err != nil {
+        return nil, fmt.Errorf("list nodes: %w", err)
+    }
+    defer rows.Close()
+    out := []Node{}
+    for rows.Next() {
+        var n Node
+        if err := rows.Scan(&n.ID, &n.Name, &n.Address, &n.MaxConcurrent); err != nil {
+            return nil, fmt.Errorf("list nodes: %w", err)
+        }
+        out = append(out, n)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLNodeRepo) Get(ctx context.Context, id string) (Node, error) {
+    var n Node
+    row := r.db.QueryRowContext(ctx, `SELECT id, name, address, max_concurrent FROM nodes WHERE id=$1`, id)
+    if err := row.Scan(&n.ID, &n.Name, &n.Address, &n.MaxConcurrent); err != nil {
+        return Node{}, notFound(err, "get node")
+    }
+    return n, nil
+}
+
+func (r *SQLNodeRepo) Save(ctx context.Context, node Node) (Node, error) {
+    _, err := r.db.ExecContext(ctx,
+        `INSERT INTO nodes (id, name, address, max_concurrent)
+         VALUES ($1,$2,$3,$4)
+         ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, address=EXCLUDED.address, max_concurrent=EXCLUDED.max_concurrent`,
+        node.ID, node.Name, node.Address, node.MaxConcurrent,
+    )
+    if err != nil {
+        return Node{}, fmt.Errorf("save node: %w", err)
+    }
+    return node, nil
+}
+
+type SQLExecutionRepo struct {
+    db *sql.DB
+}
+
+const executionColumns = `id, command_id, node_id, status, started_at, completed_at, stdout, stderr, exit_code, duration_ms, peak_memory_bytes, cpu_time_ms, stdout_bytes, stderr_bytes, stdout_truncated, stderr_truncated, output_spooled, stdout_ref, stderr_ref, artifacts, triggered_by, grant_id, gpu_devices`
+
+const executionSummaryColumns = `id, command_id, node_id, status, started_at, completed_at, exit_code, duration_ms, peak_memory_bytes, cpu_time_ms, stdout_bytes, stderr_bytes, stdout_truncated, stderr_truncated, output_spooled, triggered_by, grant_id`
+
+func (r *SQLExecutionRepo) List(ctx context.Context, filter ExecutionFilter) ([]ExecutionSummary, error) {
+    var where []string
+    var args []interface{}
+    arg := func(v interface{}) string {
+        args = append(args, v)
+        return fmt.Sprintf("$%d", len(args))
+    }
+    if filter.CommandID != "" {
+        where = append(where, "command_id="+arg(filter.CommandID))
+    }
+    if filter.NodeID != "" {
+        where = append(where, "node_id="+arg(filter.NodeID))
+    }
+    if filter.Status != "" {
+        where = append(where, "status="+arg(string(filter.Status)))
+    }
+    if filter.TriggeredBy != "" {
+        where = append(where, "triggered_by="+arg(filter.TriggeredBy))
+    }
+    if filter.ExitCode != nil {
+        where = append(where, "exit_code="+arg(*filter.ExitCode))
+    }
+    if filter.VisibleTo != "" {
+        visible := []string{"triggered_by=" + arg(filter.VisibleTo)}
+        for _, nodeID := range filter.VisibleNodes {
+            visible = append(visible, "node_id="+arg(nodeID))
+        }
+        where = append(where, "("+strings.Join(visible, " OR ")+")")
+    }
+    if !filter.From.IsZero() {
+        where = append(where, "started_at>="+arg(filter.From))
+    }
+    if !filter.To.IsZero() {
+        where = append(where, "started_at<"+arg(filter.To))
+    }
+    order, cmp := "DESC", "<"
+    if filter.Ascending {
+        order, cmp = "ASC", ">"
+    }
+    if filter.After != nil {
+        where = append(where, "(started_at, id) "+cmp+" ("+arg(filter.After.StartedAt)+", "+arg(filter.After.ID)+")")
+    }
+    query := `SELECT ` + executionSummaryColumns + ` FROM executions`
+    if len(where) > 0 {
+        query += " WHERE " + strings.Join(where, " AND ")
+    }
+    query += " ORDER BY started_at " + order + ", id " + order
+    if filter.Limit > 0 {
+        query += " LIMIT " + arg(filter.Limit)
+    }
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("list executions: %w", err)
+    }
+    defer rows.Close()
+    out := []ExecutionSummary{}
+    for rows.Next() {
+        var e ExecutionSummary
+        var completed sql.NullTime
+        var status string
+        if err := rows.Scan(&e.ID, &e.CommandID, &e.NodeID, &status, &e.StartedAt, &completed, &e.ExitCode, &e.DurationMs, &e.PeakMemoryBytes, &e.CPUTimeMs, &e.StdoutBytes, &e.StderrBytes, &e.StdoutTruncated, &e.StderrTruncated, &e.OutputSpooled, &e.TriggeredBy, &e.GrantID); err != nil {
+            return nil, fmt.Errorf("list executions: %w", err)
+        }
+        e.Status = ExecutionStatus(status)
+        e.CompletedAt = timePtr(completed)
+        out = append(out, e)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLExecutionRepo) Get(ctx context.Context, id string) (Execution, error) {
+    exec, err := scanExecution(r.db.QueryRowContext(ctx, `SELECT `+executionColumns+` FROM executions WHERE id=$1`, id))
+    if err != nil {
+        return Execution{}, notFound(err, "get execution")
+    }
+    return exec, nil
+}
+
+func (r *SQLExecutionRepo) Save(ctx context.Context, execution Execution) (Execution, error) {
+    _, err := r.db.ExecContext(ctx,
+        `INSERT INTO executions (`+executionColumns+`)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23)
+         ON CONFLICT (id) DO UPDATE SET status=EXCLUDED.status, completed_at=EXCLUDED.completed_at, stdout=EXCLUDED.stdout, stderr=EXCLUDED.stderr, exit_code=EXCLUDED.exit_code, duration_ms=EXCLUDED.duration_ms, peak_memory_bytes=EXCLUDED.peak_memory_bytes, cpu_time_ms=EXCLUDED.cpu_time_ms, stdout_bytes=EXCLUDED.stdout_bytes, stderr_bytes=EXCLUDED.stderr_bytes, stdout_truncated=EXCLUDED.stdout_truncated, stderr_truncated=EXCLUDED.stderr_truncated, output_spooled=EXCLUDED.output_spooled, stdout_ref=EXCLUDED.stdout_ref, stderr_ref=EXCLUDED.stderr_ref, artifacts=EXCLUDED.artifacts, gpu_devices=EXCLUDED.gpu_devices`,
+        execution.ID, execution.CommandID, execution.NodeID, string(execution.Status), execution.StartedAt, nullTime(execution.CompletedAt), execution.Stdout, execution.Stderr, execution.ExitCode, execution.DurationMs, execution.PeakMemoryBytes, execution.CPUTimeMs, execution.StdoutBytes, execution.StderrBytes, execution.StdoutTruncated, execution.StderrTruncated, execution.OutputSpooled, execution.StdoutRef, execution.StderrRef, jsonArray(execution.Artifacts), execution.TriggeredBy, execution.GrantID, jsonArray(execution.GPUDevices),
+    )
+    if err != nil {
+        return Execution{}, fmt.Errorf("save execution: %w", err)
+    }
+    return execution, nil
+}
+
+func (r *SQLExecutionRepo) Prunable(ctx context.Context, policy RetentionPolicy, now time.Time, limit int) ([]Execution, error) {
+    var args []interface{}
+    arg := func(v interface{}) string {
+        args = append(args, v)
+        return fmt.Sprintf("$%d", len(args))
+    }
+    var expired []string
+    if policy.MaxAge > 0 {
+        expired = append(expired, "started_at < "+arg(now.Add(-policy.MaxAge)))
+    }
+    if policy.MaxPerCommand > 0 {
+        expired = append(expired, "command_rank > "+arg(policy.MaxPerCommand))
+    }
+    if len(expired) == 0 {
+        return nil, nil
+    }
+    // The windows rank only the key columns; the full rows, output included,
+    // are read for the chosen batch alone.
+    chosen := `SELECT id FROM (
+            SELECT id, command_id, status, started_at,
+                ROW_NUMBER() OVER (PARTITION BY command_id ORDER BY started_at DESC, id DESC) AS command_rank,
+                ROW_NUMBER() OVER (PARTITION BY command_id, status ORDER BY started_at DESC, id DESC) AS status_rank
+            FROM executions
+        ) ranked
+        WHERE status <> ` + arg(string(ExecutionPending)) + ` AND status <> ` + arg(string(ExecutionRunning)) + `
+        AND (` + strings.Join(expired, " OR ") + `)`
+    if policy.KeepFailures > 0 {
+        chosen += ` AND NOT (status = ` + arg(string(ExecutionFailed)) + ` AND status_rank <= ` + arg(policy.KeepFailures) + `)`
+    }
+    chosen += ` ORDER BY started_at, id LIMIT ` + arg(limit)
+    query := `SELECT e.` + strings.ReplaceAll(executionColumns, ", ", ", e.") + ` FROM executions e
+        JOIN (` + chosen + `) chosen ON chosen.id = e.id
+        ORDER BY e.started_at, e.id`
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("find prunable executions: %w", err)
+    }
+    defer rows.Close()
+    var out []Execution
+    for rows.Next() {
+        exec, err := scanExecution(rows)
+        if err != nil {
+            return nil, fmt.Errorf("find prunable executions: %w", err)
+        }
+        out = append(out, exec)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLExecutionRepo) Delete(ctx context.Context, ids ...string) (int, error) {
+    if len(ids) == 0 {
+        return 0, nil
+    }
+    marks := make([]string, len(ids))
+    args := make([]interface{}, len(ids))
+    for i, id := range ids {
+        marks[i] = fmt.Sprintf("$%d", i+1)
+        args[i] = id
+    }
+    res, err := r.db.ExecContext(ctx, `DELETE FROM executions WHERE id IN (`+strings.Join(marks, ", ")+`)`, args...)
+    if err != nil {
+        return 0, fmt.Errorf("delete executions: %w", err)
+    }
+    n, err := res.RowsAffected()
+    return int(n), err
+}
+
+type SQLAuditRepo struct {
+    db *sql.DB
+}
+
+func (r *SQLAuditRepo) List(ctx context.Context) ([]AuditEvent, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT id, at, actor, action, node_id, target, detail, success FROM audit_events ORDER BY at DESC`)
+    if err != nil {
+        return nil, fmt.Errorf("list audit events: %w", err)
+    }
+    defer rows.Close()
+    out := []AuditEvent{}
+    for rows.Next() {
+        var e AuditEvent
+        if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.NodeID, &e.Target, &e.Detail, &e.Success); err != nil {
+            return nil, fmt.Errorf("list audit events: %w", err)
+        }
+        out = append(out, e)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLAuditRepo) Save(ctx context.Context, event AuditEvent) (AuditEvent, error) {
+    _, err := r.db.ExecContext(ctx,
+        `INSERT INTO audit_events (id, at, actor, action, node_id, target, detail, success)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+        event.ID, event.At, event.Actor, event.Action, event.NodeID, event.Target, event.Detail, event.Success,
+    )
+    if err != nil {
+        return AuditEvent{}, fmt.Errorf("save audit event: %w", err)
+    }
+    return event, nil
+}
+
+type SQLSessionRepo struct {
+    db *sql.DB
+}
+
+func (r *SQLSessionRepo) List(ctx context.Context) ([]TerminalSession, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT id, node_id, user_name, cols, rows, started_at, ended_at, recording_bytes FROM terminal_sessions ORDER BY started_at DESC`)
+    if err != nil {
+        return nil, fmt.Errorf("list sessions: %w", err)
+    }
+    defer rows.Close()
+    out := []TerminalSession{}
+    for rows.Next() {
+        var t TerminalSession
+        var ended sql.NullTime
+        if err := rows.Scan(&t.ID, &t.NodeID, &t.User, &t.Cols, &t.Rows, &t.StartedAt, &ended, &t.RecordingBytes); err != nil {
+            return nil, fmt.Errorf("list sessions: %w", err)
+        }
+        t.EndedAt = timePtr(ended)
+        out = append(out, t)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLSessionRepo) Get(ctx context.Context, id string) (TerminalSession, error) {
+    var t TerminalSession
+    var ended sql.NullTime
+    row := r.db.QueryRowContext(ctx, `SELECT id, node_id, user_name, cols, rows, started_at, ended_at, recording_bytes, recording FROM terminal_sessions WHERE id=$1`, id)
+    if err := row.Scan(&t.ID, &t.NodeID, &t.User, &t.Cols, &t.Rows, &t.StartedAt, &ended, &t.RecordingBytes, &t.Recording); err != nil {
+        return TerminalSession{}, notFound(err, "get session")
+    }
+    t.EndedAt = timePtr(ended)
+    // Sessions recorded before chunking keep their recording inline.
+    rows, err := r.db.QueryContext(ctx, `SELECT data FROM terminal_recording_chunks WHERE session_id=$1 ORDER BY seq`, id)
+    if err != nil {
+        return TerminalSession{}, fmt.Errorf("get session recording: %w", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var chunk []byte
+        if err := rows.Scan(&chunk); err != nil {
+            return TerminalSession{}, fmt.Errorf("get session recording: %w", err)
+        }
+        t.Recording = append(t.Recording, chunk...)
+    }
+    if err := rows.Err(); err != nil {
+        return TerminalSession{}, fmt.Errorf("get session recording: %w", err)
+    }
+    return t, nil
+}
+
+func (r *SQLSessionRepo) Save(ctx context.Context, session TerminalSession) (TerminalSession, error) {
+    _, err := r.db.ExecContext(ctx,
+        `INSERT INTO terminal_sessions (id, node_id, user_name, cols, rows, started_at, ended_at, recording_bytes)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+         ON CONFLICT (id) DO UPDATE SET ended_at=EXCLUDED.ended_at, recording_bytes=EXCLUDED.recording_bytes`,
+        session.ID, session.NodeID, session.User, session.Cols, session.Rows, session.StartedAt, nullTime(session.EndedAt), session.RecordingBytes,
+    )
+    if err != nil {
+        return TerminalSession{}, fmt.Errorf("save session: %w", err)
+    }
+    session.Recording = nil
+    return session, nil
+}
+
+func (r *SQLSessionRepo) AppendRecording(ctx context.Context, id string, seq int, chunk []byte) error {
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("append recording: %w", err)
+    }
+    defer tx.Rollback()
+    res, err := tx.ExecContext(ctx,
+        `INSERT INTO terminal_recording_chunks (session_id, seq, data) VALUES ($1,$2,$3) ON CONFLICT (session_id, seq) DO NOTHING`,
+        id, seq, chunk,
+    )
+    if err != nil {
+        return fmt.Errorf("append recording: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return nil
+    }
+    res, err = tx.ExecContext(ctx, `UPDATE terminal_sessions SET recording_bytes=recording_bytes+$1 WHERE id=$2`, len(chunk), id)
+    if err != nil {
+        return fmt.Errorf("append recording: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrNotFound
+    }
+    return tx.Commit()
+}
+
+type SQLGrantRepo struct {
+    db *sql.DB
+}
+
+const grantColumns = `id, user_name, node_id, action, reason, duration_seconds, status, requested_at, decided_by, decided_at, starts_at, expires_at`
+
+func (r *SQLGrantRepo) List(ctx context.Context) ([]AccessGrant, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT `+grantColumns+` FROM access_grants ORDER BY requested_at DESC`)
+    if err != nil {
+        return nil, fmt.Errorf("list grants: %w", err)
+    }
+    defer rows.Close()
+    out := []AccessGrant{}
+    for rows.Next() {
+        g, err := scanGrant(rows)
+        if err != nil {
+            return nil, fmt.Errorf("list grants: %w", err)
+        }
+        out = append(out, g)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLGrantRepo) Active(ctx context.Context, user, nodeID, action string, at time.Time) ([]AccessGrant, error) {
+    rows, err := r.db.QueryContext(ctx,
+        `SELECT `+grantColumns+` FROM access_grants
+         WHERE user_name=$1 AND action=$2 AND status=$3 AND ($4 = '' OR node_id=$4) AND starts_at <= $5 AND expires_at > $5`,
+        user, action, string(GrantApproved), nodeID, at)
+    if err != nil {
+        return nil, fmt.Errorf("active grants: %w", err)
+    }
+    defer rows.Close()
+    var out []AccessGrant
+    for rows.Next() {
+        g, err := scanGrant(rows)
+        if err != nil {
+            return nil, fmt.Errorf("active grants: %w", err)
+        }
+        out = append(out, g)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLGrantRepo) Get(ctx context.Context, id string) (AccessGrant, error) {
+    g, err := scanGrant(r.db.QueryRowContext(ctx, `SELECT `+grantColumns+` FROM access_grants WHERE id=$1`, id))
+    if err != nil {
+        return AccessGrant{}, notFound(err, "get grant")
+    }
+    return g, nil
+}
+
+func (r *SQLGrantRepo) Save(ctx context.Context, grant AccessGrant) (AccessGrant, error) {
+    _, err := r.db.ExecContext(ctx,
+        `INSERT INTO access_grants (`+grantColumns+`)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+         ON CONFLICT (id) DO UPDATE SET status=EXCLUDED.status, decided_by=EXCLUDED.decided_by, decided_at=EXCLUDED.decided_at, starts_at=EXCLUDED.starts_at, expires_at=EXCLUDED.expires_at`,
+        grant.ID, grant.User, grant.NodeID, grant.Action, grant.Reason, grant.DurationSeconds, string(grant.Status), grant.RequestedAt, grant.DecidedBy, nullTime(grant.DecidedAt), nullTime(grant.StartsAt), nullTime(grant.ExpiresAt),
+    )
+    if err != nil {
+        return AccessGrant{}, fmt.Errorf("save grant: %w", err)
+    }
+    return grant, nil
+}
+
+func scanGrant(row scanner) (AccessGrant, error) {
+    var g AccessGrant
+    var status string
+    var decided, starts, expires sql.NullTime
+    if err := row.Scan(&g.ID, &g.User, &g.NodeID, &g.Action, &g.Reason, &g.DurationSeconds, &status, &g.RequestedAt, &g.DecidedBy, &decided, &starts, &expires); err != nil {
+        return AccessGrant{}, err
+    }
+    g.Status = GrantStatus(status)
+    g.DecidedAt = timePtr(decided)
+    g.StartsAt = timePtr(starts)
+    g.ExpiresAt = timePtr(expires)
+    return g, nil
+}
+
+// SQLQueue keeps jobs in execution_jobs. Claims are serialised, by an
+// advisory lock on PostgreSQL and by SQLite's single writer, so concurrency
+// limits hold across replicas; heartbeats and completions are not held up
+// by them.
+type SQLQueue struct {
+    db      *sql.DB
+    dialect string
+}
+
+// queueLockKey is the PostgreSQL advisory lock claims are made under.
+const queueLockKey int64 = 0x626173746971
+
+const queueJobColumns = `execution_id, node_id, command_id, enqueued_at, priority, node_limit, command_limit, leased_by, lease_expires_at, attempts, not_before`
+
+func (q *SQLQueue) Enqueue(ctx context.Context, job QueueJob) error {
+    _, err := q.db.ExecContext(ctx,
+        `INSERT INTO execution_jobs (execution_id, node_id, command_id, enqueued_at, priority, node_limit, command_limit) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+        job.ExecutionID, job.NodeID, job.CommandID, job.EnqueuedAt, job.Priority, job.NodeLimit, job.CommandLimit,
+    )
+    if err != nil {
+        return fmt.Errorf("enqueue execution: %w", err)
+    }
+    return nil
+}
+
+func (q *SQLQueue) Claim(ctx context.Context, worker string, lease time.Duration, policy QueuePolicy) (QueueJob, bool, error) {
+    tx, err := q.db.BeginTx(ctx, nil)
+    if err != nil {
+        return QueueJob{}, false, fmt.Errorf("claim execution: %w", err)
+    }
+    defer tx.Rollback()
+    lock := ""
+    if q.dialect == DialectPostgres {
+        if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, queueLockKey); err != nil {
+            return QueueJob{}, false, fmt.Errorf("claim execution: %w", err)
+        }
+        lock = " FOR UPDATE SKIP LOCKED"
+    }
+    now := time.Now().UTC()
+    job, err := scanQueueJob(tx.QueryRowContext(ctx,
+        `UPDATE execution_jobs SET leased_by=$1, lease_expires_at=$2, attempts=attempts+1
+         WHERE execution_id IN (
+            SELECT j.execution_id FROM execution_jobs j
+            WHERE (j.lease_expires_at IS NULL OR j.lease_expires_at <= $3)
+              AND (j.not_before IS NULL OR j.not_before <= $3)
+              AND ($4 = 0 OR (SELECT COUNT(*) FROM execution_jobs r WHERE r.lease_expires_at > $3) < $4)
+              AND (j.node_limit = 0 OR (SELECT COUNT(*) FROM execution_jobs r WHERE r.node_id = j.node_id AND r.lease_expires_at > $3) < j.node_limit)
+              AND (j.command_limit = 0 OR (SELECT COUNT(*) FROM execution_jobs r WHERE r.command_id = j.command_id AND r.lease_expires_at > $3) < j.command_limit)
+            ORDER BY `+queueOrderBy(policy.Order, "j.")+`
+            LIMIT 1`+lock+`
+         )
+         RETURNING `+queueJobColumns,
+        worker, now.Add(lease), now, policy.MaxRunning,
+    ))
+    if errors.Is(err, sql.ErrNoRows) {
+        return QueueJob{}, false, nil
+    }
+    if err != nil {
+        return QueueJob{}, false, fmt.Errorf("claim execution: %w", err)
+    }
+    if err := tx.Commit(); err != nil {
+        return QueueJob{}, false, fmt.Errorf("claim execution: %w", err)
+    }
+    return job, true, nil
+}
+
+func (q *SQLQueue) Heartbeat(ctx context.Context, job QueueJob, lease time.Duration) error {
+    res, err := q.db.ExecContext(ctx,
+        `UPDATE execution_jobs SET lease_expires_at=$1 WHERE execution_id=$2 AND leased_by=$3`,
+        time.Now().UTC().Add(lease), job.ExecutionID, job.Worker,
+    )
+    if err != nil {
+        return fmt.Errorf("renew lease: %w", err)
+    }
+    if n, err := res.RowsAffected(); err == nil && n == 0 {
+        return ErrLeaseLost
+    }
+    return nil
+}
+
+func (q *SQLQueue) Defer(ctx context.Context, job QueueJob, until time.Time) error {
+    res, err := q.db.ExecContext(ctx,
+        `UPDATE execution_jobs SET leased_by='', lease_expires_at=NULL, attempts=attempts-1, not_before=$1 WHERE execution_id=$2 AND leased_by=$3`,
+        until.UTC(), job.ExecutionID, job.Worker,
+    )
+    if err != nil {
+        return fmt.Errorf("defer execution job: %w", err)
+    }
+    if n, err := res.RowsAffected(); err == nil && n == 0 {
+        return ErrLeaseLost
+    }
+    return nil
+}
+
+func (q *SQLQueue) Complete(ctx context.Context, job QueueJob) error {
+    _, err := q.db.ExecContext(ctx, `DELETE FROM execution_jobs WHERE execution_id=$1 AND leased_by=$2`, job.ExecutionID, job.Worker)
+    if err != nil {
+        return fmt.Errorf("complete execution job: %w", err)
+    }
+    return nil
+}
+
+func (q *SQLQueue) Get(ctx context.Context, executionID string) (QueueJob, error) {
+    job, err := scanQueueJob(q.db.QueryRowContext(ctx, `SELECT `+queueJobColumns+` FROM execution_jobs WHERE execution_id=$1`, executionID))
+    if err != nil {
+        return QueueJob{}, notFound(err, "get execution job")
+    }
+    return job, nil
+}
+
+func (q *SQLQueue) Pending(ctx context.Context, order QueueOrder) ([]QueueJob, error) {
+    rows, err := q.db.QueryContext(ctx,
+        `SELECT `+queueJobColumns+` FROM execution_jobs
+         WHERE lease_expires_at IS NULL OR lease_expires_at <= $1
+         ORDER BY `+queueOrderBy(order, ""),
+        time.Now().UTC(),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("list pending executions: %w", err)
+    }
+    defer rows.Close()
+    out := []QueueJob{}
+    for rows.Next() {
+        job, err := scanQueueJob(rows)
+        if err != nil {
+            return nil, fmt.Errorf("list pending executions: %w", err)
+        }
+        out = append(out, job)
+    }
+    return out, rows.Err()
+}
+
+func queueOrderBy(order QueueOrder, prefix string) string {
+    by := prefix + "enqueued_at, " + prefix + "execution_id"
+    if order == QueuePriority {
+        by = prefix + "priority DESC, " + by
+    }
+    return by
+}
+
+func scanQueueJob(row scanner) (QueueJob, error) {
+    var job QueueJob
+    var expires, notBefore sql.NullTime
+    if err := row.Scan(&job.ExecutionID, &job.NodeID, &job.CommandID, &job.EnqueuedAt, &job.Priority, &job.NodeLimit, &job.CommandLimit, &job.Worker, &expires, &job.Attempts, &notBefore); err != nil {
+        return QueueJob{}, err
+    }
+    job.LeaseExpiresAt = timePtr(expires)
+    job.NotBefore = timePtr(notBefore)
+    return job, nil
+}
+
+type SQLGPUMetricsRepo struct {
+    db *sql.DB
+}
+
+const gpuMetricColumns = `node_id, resolution, bucket, device_index, name, uuid, samples, utilization, memory_used_mb, memory_total_mb, temperature_c, power_w, vendor`
+
+// gpuMetricUpsert writes a reading, averaging it into the bucket's existing
+// one weighted by sample counts, as mergeGPUMetrics does.
+const gpuMetricUpsert = `INSERT INTO gpu_metrics (` + gpuMetricColumns + `)
+    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+    ON CONFLICT (node_id, resolution, bucket, device_index) DO UPDATE SET
+        name=EXCLUDED.name,
+        uuid=EXCLUDED.uuid,
+        vendor=EXCLUDED.vendor,
+        utilization=(gpu_metrics.utilization*gpu_metrics.samples + EXCLUDED.utilization*EXCLUDED.samples) / (gpu_metrics.samples + EXCLUDED.samples),
+        memory_used_mb=(gpu_metrics.memory_used_mb*gpu_metrics.samples + EXCLUDED.memory_used_mb*EXCLUDED.samples) / (gpu_metrics.samples + EXCLUDED.samples),
+        memory_total_mb=CASE WHEN EXCLUDED.memory_total_mb > gpu_metrics.memory_total_mb THEN EXCLUDED.memory_total_mb ELSE gpu_metrics.memory_total_mb END,
+        temperature_c=(gpu_metrics.temperature_c*gpu_metrics.samples + EXCLUDED.temperature_c*EXCLUDED.samples) / (gpu_metrics.samples + EXCLUDED.samples),
+        power_w=(gpu_metrics.power_w*gpu_metrics.samples + EXCLUDED.power_w*EXCLUDED.samples) / (gpu_metrics.samples + EXCLUDED.samples),
+        samples=gpu_metrics.samples + EXCLUDED.samples`
+
+func (r *SQLGPUMetricsRepo) Append(ctx context.Context, metrics []GPUMetric) error {
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("append gpu metrics: %w", err)
+    }
+    defer tx.Rollback()
+    if err := upsertGPUMetrics(ctx, tx, metrics); err != nil {
+        return fmt.Errorf("append gpu metrics: %w", err)
+    }
+    return tx.Commit()
+}
+
+func upsertGPUMetrics(ctx context.Context, tx *sql.Tx, metrics []GPUMetric) error {
+    stmt, err := tx.PrepareContext(ctx, gpuMetricUpsert)
+    if err != nil {
+        return err
+    }
+    defer stmt.Close()
+    for _, m := range metrics {
+        _, err := stmt.ExecContext(ctx,
+            m.NodeID, int64(m.Resolution/time.Second), m.At.UTC(), m.Index, m.Name, m.UUID, max(m.Samples, 1),
+            m.Utilization, float64(m.MemoryUsedMB), m.MemoryTotalMB, m.TemperatureC, m.PowerW, m.Vendor,
+        )
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r *SQLGPUMetricsRepo) Range(ctx context.Context, nodeID string, from, to time.Time) ([]GPUMetric, error) {
+    query := `SELECT ` + gpuMetricColumns + ` FROM gpu_metrics WHERE bucket >= $1 AND bucket < $2`
+    args := []any{from.UTC(), to.UTC()}
+    if nodeID != "" {
+        query += ` AND node_id = $3`
+        args = append(args, nodeID)
+    }
+    rows, err := r.db.QueryContext(ctx, query+` ORDER BY bucket, node_id, device_index`, args...)
+    if err != nil {
+        return nil, fmt.Errorf("query gpu metrics: %w", err)
+    }
+    return scanGPUMetrics(rows)
+}
+
+func (r *SQLGPUMetricsRepo) Oldest(ctx context.Context, resolution time.Duration) (time.Time, bool, error) {
+    var oldest time.Time
+    err := r.db.QueryRowContext(ctx,
+        `SELECT bucket FROM gpu_metrics WHERE resolution=$1 ORDER BY bucket LIMIT 1`,
+        int64(resolution/time.Second),
+    ).Scan(&oldest)
+    if errors.Is(err, sql.ErrNoRows) {
+        return time.Time{}, false, nil
+    }
+    if err != nil {
+        return time.Time{}, false, fmt.Errorf("oldest gpu metric: %w", err)
+    }
+    return oldest, true, nil
+}
+
+func (r *SQLGPUMetricsRepo) Compact(ctx context.Context, from, to time.Duration, start, end time.Time) (int, error) {
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, fmt.Errorf("compact gpu metrics: %w", err)
+    }
+    defer tx.Rollback()
+    res := int64(from / time.Second)
+    rows, err := tx.QueryContext(ctx,
+        `SELECT `+gpuMetricColumns+` FROM gpu_metrics WHERE resolution=$1 AND bucket >= $2 AND bucket < $3`,
+        res, start.UTC(), end.UTC(),
+    )
+    if err != nil {
+        return 0, fmt.Errorf("compact gpu metrics: %w", err)
+    }
+    metrics, err := scanGPUMetrics(rows)
+    if err != nil {
+        return 0, fmt.Errorf("compact gpu metrics: %w", err)
+    }
+    if err := upsertGPUMetrics(ctx, tx, rollupGPUMetrics(metrics, to)); err != nil {
+        return 0, fmt.Errorf("compact gpu metrics: %w", err)
+    }
+    if _, err := tx.ExecContext(ctx,
+        `DELETE FROM gpu_metrics WHERE resolution=$1 AND bucket >= $2 AND bucket < $3`,
+        res, start.UTC(), end.UTC(),
+    ); err != nil {
+        return 0, fmt.Errorf("compact gpu metrics: %w", err)
+    }
+    if err := tx.Commit(); err != nil {
+        return 0, fmt.Errorf("compact gpu metrics: %w", err)
+    }
+    return len(metrics), nil
+}
+
+func (r *SQLGPUMetricsRepo) DeleteBefore(ctx context.Context, resolution time.Duration, before time.Time) (int, error) {
+    res, err := r.db.ExecContext(ctx,
+        `DELETE FROM gpu_metrics WHERE resolution=$1 AND bucket < $2`,
+        int64(resolution/time.Second), before.UTC(),
+    )
+    if err != nil {
+        return 0, fmt.Errorf("delete gpu metrics: %w", err)
+    }
+    n, _ := res.RowsAffected()
+    return int(n), nil
+}
+
+func scanGPUMetrics(rows *sql.Rows) ([]GPUMetric, error) {
+    defer rows.Close()
+    out := []GPUMetric{}
+    for rows.Next() {
+        var m GPUMetric
+        var res int64
+        var memUsed float64
+        if err := rows.Scan(&m.NodeID, &res, &m.At, &m.Index, &m.Name, &m.UUID, &m.Samples, &m.Utilization, &memUsed, &m.MemoryTotalMB, &m.TemperatureC, &m.PowerW, &m.Vendor); err != nil {
+            return nil, err
+        }
+        m.Resolution = time.Duration(res) * time.Second
+        m.MemoryUsedMB = int(memUsed + 0.5)
+        out = append(out, m)
+    }
+    return out, rows.Err()
+}
+
+type SQLGPUReservationRepo struct {
+    db *sql.DB
+}
+
+func (r *SQLGPUReservationRepo) List(ctx context.Context) ([]GPUReservation, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT node_id, device_index, execution_id, reserved_at FROM gpu_reservations ORDER BY node_id, device_index`)
+    if err != nil {
+        return nil, fmt.Errorf("list gpu reservations: %w", err)
+    }
+    defer rows.Close()
+    out := []GPUReservation{}
+    for rows.Next() {
+        var res GPUReservation
+        if err := rows.Scan(&res.NodeID, &res.DeviceIndex, &res.ExecutionID, &res.ReservedAt); err != nil {
+            return nil, fmt.Errorf("list gpu reservations: %w", err)
+        }
+        out = append(out, res)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLGPUReservationRepo) Reserve(ctx context.Context, reservations []GPUReservation) error {
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("reserve gpus: %w", err)
+    }
+    defer tx.Rollback()
+    for _, res := range reservations {
+        out, err := tx.ExecContext(ctx,
+            `INSERT INTO gpu_reservations (node_id, device_index, execution_id, reserved_at)
+             VALUES ($1,$2,$3,$4) ON CONFLICT (node_id, device_index) DO NOTHING`,
+            res.NodeID, res.DeviceIndex, res.ExecutionID, res.ReservedAt,
+        )
+        if err != nil {
+            return fmt.Errorf("reserve gpus: %w", err)
+        }
+        n, err := out.RowsAffected()
+        if err != nil {
+            return fmt.Errorf("reserve gpus: %w", err)
+        }
+        if n == 0 {
+            return ErrGPUReserved
+        }
+    }
+    return tx.Commit()
+}
+
+func (r *SQLGPUReservationRepo) Release(ctx context.Context, executionID string) error {
+    if _, err := r.db.ExecContext(ctx, `DELETE FROM gpu_reservations WHERE execution_id=$1`, executionID); err != nil {
+        return fmt.Errorf("release gpus: %w", err)
+    }
+    return nil
+}
+
+type SQLAlertRepo struct {
+    db *sql.DB
+}
+
+const alertColumns = `id, rule, node_id, device_index, device_uuid, state, severity, value, threshold, summary, started_at, fired_at, resolved_at, updated_at, notified`
+
+func (r *SQLAlertRepo) Active(ctx context.Context) ([]Alert, error) {
+    return r.query(ctx, `SELECT `+alertColumns+` FROM alerts WHERE state IN ('pending', 'firing')`)
+}
+
+func (r *SQLAlertRepo) List(ctx context.Context, state AlertState, limit int) ([]Alert, error) {
+    query := `SELECT ` + alertColumns + ` FROM alerts`
+    var args []any
+    if state != "" {
+        query += ` WHERE state = $1`
+        args = append(args, string(state))
+    }
+    query += ` ORDER BY updated_at DESC`
+    if limit > 0 {
+        query += fmt.Sprintf(` LIMIT %d`, limit)
+    }
+    return r.query(ctx, query, args...)
+}
+
+func (r *SQLAlertRepo) query(ctx context.Context, query string, args ...any) ([]Alert, error) {
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("list alerts: %w", err)
+    }
+    defer rows.Close()
+    out := []Alert{}
+    for rows.Next() {
+        var a Alert
+        var state, notified string
+        var fired, resolved sql.NullTime
+        if err := rows.Scan(&a.ID, &a.Rule, &a.NodeID, &a.DeviceIndex, &a.DeviceUUID, &state, &a.Severity, &a.Value, &a.Threshold, &a.Summary, &a.StartedAt, &fired, &resolved, &a.UpdatedAt, &notified); err != nil {
+            return nil, fmt.Errorf("list alerts: %w", err)
+        }
+        a.State, a.Notified = AlertState(state), AlertState(notified)
+        a.FiredAt, a.ResolvedAt = timePtr(fired), timePtr(resolved)
+        out = append(out, a)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLAlertRepo) Save(ctx context.Context, a Alert) (Alert, error) {
+    _, err := r.db.ExecContext(ctx,
+        `INSERT INTO alerts (`+alertColumns+`)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+         ON CONFLICT (id) DO UPDATE SET device_uuid=EXCLUDED.device_uuid, state=EXCLUDED.state, severity=EXCLUDED.severity, value=EXCLUDED.value, threshold=EXCLUDED.threshold, summary=EXCLUDED.summary, fired_at=EXCLUDED.fired_at, resolved_at=EXCLUDED.resolved_at, updated_at=EXCLUDED.updated_at, notified=EXCLUDED.notified`,
+        a.ID, a.Rule, a.NodeID, a.DeviceIndex, a.DeviceUUID, string(a.State), a.Severity, a.Value, a.Threshold, a.Summary, a.StartedAt, nullTime(a.FiredAt), nullTime(a.ResolvedAt), a.UpdatedAt, string(a.Notified),
+    )
+    if err != nil {
+        return Alert{}, fmt.Errorf("save alert: %w", err)
+    }
+    return a, nil
+}
+
+func (r *SQLAlertRepo) Delete(ctx context.Context, id string) error {
+    if _, err := r.db.ExecContext(ctx, `DELETE FROM alerts WHERE id=$1`, id); err != nil {
+        return fmt.Errorf("delete alert: %w", err)
+    }
+    return nil
+}
+
+type SQLTunnelRepo struct {
+    db *sql.DB
+}
+
+const tunnelColumns = `id, node_id, port, user_name, created_at, expires_at, closed_at, closed_by, active_connections, connections, bytes_in, bytes_out`
+
+func scanTunnel(row scanner) (Tunnel, error) {
+    var t Tunnel
+    var closed sql.NullTime
+    if err := row.Scan(&t.ID, &t.NodeID, &t.Port, &t.User, &t.CreatedAt, &t.ExpiresAt, &closed, &t.ClosedBy, &t.Active, &t.Connections, &t.BytesIn, &t.BytesOut); err != nil {
+        return Tunnel{}, err
+    }
+    t.ClosedAt = timePtr(closed)
+    return t, nil
+}
+
+func (r *SQLTunnelRepo) List(ctx context.Context) ([]Tunnel, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT `+tunnelColumns+` FROM tunnels`)
+    if err != nil {
+        return nil, fmt.Errorf("list tunnels: %w", err)
+    }
+    defer rows.Close()
+    out := []Tunnel{}
+    for rows.Next() {
+        t, err := scanTunnel(rows)
+        if err != nil {
+            return nil, fmt.Errorf("list tunnels: %w", err)
+        }
+        out = append(out, t)
+    }
+    return out, rows.Err()
+}
+
+func (r *SQLTunnelRepo) Get(ctx context.Context, id string) (Tunnel, error) {
+    t, err := scanTunnel(r.db.QueryRowContext(ctx, `SELECT `+tunnelColumns+` FROM tunnels WHERE id=$1`, id))
+    if err != nil {
+        return Tunnel{}, notFound(err, "get tunnel")
+    }
+    return t, nil
+}
+
+func (r *SQLTunnelRepo) Create(ctx context.Context, t Tunnel) (Tunnel, error) {
+    _, err := r.db.ExecContext(ctx,
+        `INSERT INTO tunnels (`+tunnelColumns+`) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`,
+        t.ID, t.NodeID, t.Port, t.User, t.CreatedAt, t.ExpiresAt, nullTime(t.ClosedAt), t.ClosedBy, t.Active, t.Connections, t.BytesIn, t.BytesOut,
+    )
+    if err != nil {
+        return Tunnel{}, fmt.Errorf("create tunnel: %w", err)
+    }
+    return t, nil
+}
+
+func (r *SQLTunnelRepo) Close(ctx context.Context, id, by string, at time.Time) (bool, error) {
+    res, err := r.db.ExecContext(ctx, `UPDATE tunnels SET closed_at=$1, closed_by=$2 WHERE id=$3 AND closed_at IS NULL`, at, by, id)
+    if err != nil {
+        return false, fmt.Errorf("close tunnel: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n > 0 {
+        return true, nil
+    }
+    if _, err := r.Get(ctx, id); err != nil {
+        return false, err
+    }
+    return false, nil
+}
+
+func (r *SQLTunnelRepo) AddTraffic(ctx context.Context, id string, active, connections int, in, out int64) error {
+    res, err := r.db.ExecContext(ctx,
+        `UPDATE tunnels SET active_connections=active_connections+$1, connections=connections+$2, bytes_in=bytes_in+$3, bytes_out=bytes_out+$4 WHERE id=$5`,
+        active, connections, in, out, id,
+    )
+    if err != nil {
+        return fmt.Errorf("tunnel traffic: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+func (r *SQLTunnelRepo) DeleteEndedBefore(ctx context.Context, before time.Time) error {
+    if _, err := r.db.ExecContext(ctx, `DELETE FROM tunnels WHERE closed_at < $1 OR expires_at < $2`, before, before); err != nil {
+        return fmt.Errorf("delete tunnels: %w", err)
+    }
+    return nil
+}
+
+// notFound turns a missing row into ErrNotFound and labels anything else.
+func notFound(err error, op string) error {
+    if errors.Is(err, sql.ErrNoRows) {
+        return ErrNotFound
+    }
+    return fmt.Errorf("%s: %w", op, err)
+}
+
+// nullTime and timePtr convert optional timestamps to and from SQL.
+func nullTime(t *time.Time) sql.NullTime {
+    if t == nil {
+        return sql.NullTime{}
+    }
+    return sql.NullTime{Time: *t, Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+    if !t.Valid {
+        return nil
+    }
+    return &t.Time
+}
+
+type scanner interface {
+    Scan(dest ...interface{}) error
+}
+
+func scanExecution(row scanner) (Execution, error) {
+    var e Execution
+    var completed sql.NullTime
+    var status string
+    var artifacts, gpus []byte
+    if err := row.Scan(&e.ID, &e.CommandID, &e.NodeID, &status, &e.StartedAt, &completed, &e.Stdout, &e.Stderr, &e.ExitCode, &e.DurationMs, &e.PeakMemoryBytes, &e.CPUTimeMs, &e.StdoutBytes, &e.StderrBytes, &e.StdoutTruncated, &e.StderrTruncated, &e.OutputSpooled, &e.StdoutRef, &e.StderrRef, &artifacts, &e.TriggeredBy, &e.GrantID, &gpus); err != nil {
+        return Execution{}, err
+    }
+    e.Status = ExecutionStatus(status)
+    json.Unmarshal(artifacts, &e.Artifacts)
+    json.Unmarshal(gpus, &e.GPUDevices)
+    e.CompletedAt = timePtr(completed)
+    return e, nil
+}
+
+// jsonArray encodes a slice for a JSONB column, writing [] rather than null.
+func jsonArray(v interface{}) string {
+    raw, err := json.Marshal(v)
+    if err != nil || string(raw) == "null" {
+        return "[]"
+    }
+    return string(raw)
+}
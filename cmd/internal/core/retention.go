@@ -0,0 +1,241 @@
+package core
+
+import (
+    "compress/gzip"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+)
+
+const DefaultPruneBatchSize = 500
+
+// RetentionPolicy decides which finished executions are kept. An execution
+// is pruned once it is too old or too far down its command's history,
+// unless it is one of that command's most recent failures.
+type RetentionPolicy struct {
+    // MaxAge prunes executions started longer ago than this.
+    MaxAge time.Duration
+    // MaxPerCommand prunes all but the newest MaxPerCommand executions of
+    // each command.
+    MaxPerCommand int
+    // KeepFailures exempts the newest KeepFailures failed executions of each
+    // command from both limits, so the last breakages stay debuggable.
+    KeepFailures int
+    // BatchSize bounds how many executions are archived and deleted at once.
+    BatchSize int
+    // ArchiveDir, if set, receives the pruned executions as gzipped JSON
+    // Lines, one file per pass, before they are deleted.
+    ArchiveDir string
+}
+
+func (p RetentionPolicy) enabled() bool {
+    return p.MaxAge > 0 || p.MaxPerCommand > 0
+}
+
+// PruneResult summarises one pruning pass.
+type PruneResult struct {
+    Deleted int
+    // Archive is the file the deleted executions were written to, if any.
+    Archive string
+}
+
+// SetRetention sets the policy PruneExecutions applies. The zero policy
+// keeps everything.
+func (s *BastionService) SetRetention(policy RetentionPolicy) {
+    s.retention = policy
+}
+
+// PruneExecutions deletes, in batches, the executions the retention policy no
+// longer keeps, archiving each batch first if an archive directory is set.
+// Blobs the deleted executions referenced are removed with them.
+func (s *BastionService) PruneExecutions(ctx context.Context) (res PruneResult, err error) {
+    policy := s.retention
+    if !policy.enabled() {
+        return res, nil
+    }
+    batch := policy.BatchSize
+    if batch <= 0 {
+        batch = DefaultPruneBatchSize
+    }
+    now := time.Now()
+    var archive *executionArchive
+    defer func() {
+        if archive != nil {
+            if cerr := archive.Close(); err == nil {
+                err = cerr
+            }
+        }
+        if res.Deleted > 0 || err != nil {
+            s.recordAudit(ctx, "executions.prune", "", res.Archive, fmt.Sprintf("deleted %d", res.Deleted), err)
+        }
+    }()
+    for {
+        list, err := s.executions.Prunable(ctx, policy, now, batch)
+        if err != nil {
+            return res, err
+        }
+        if len(list) == 0 {
+            return res, nil
+        }
+        if policy.ArchiveDir != "" {
+            if archive == nil {
+                if archive, err = openExecutionArchive(policy.ArchiveDir, now); err != nil {
+                    return res, err
+                }
+                res.Archive = archive.path
+            }
+            if err := archive.write(list); err != nil {
+                return res, err
+            }
+        }
+        ids := make([]string, len(list))
+        for i, e := range list {
+            ids[i] = e.ID
+        }
+        n, err := s.executions.Delete(ctx, ids...)
+        res.Deleted += n
+        if err != nil {
+            return res, err
+        }
+        s.deleteExecutionBlobs(ctx, list)
+        if len(list) < batch {
+            return res, nil
+        }
+    }
+}
+
+func (s *BastionService) deleteExecutionBlobs(ctx context.Context, list []Execution) {
+    if s.blobs == nil {
+        return
+    }
+    for _, e := range list {
+        keys := []string{e.StdoutRef, e.StderrRef}
+        for _, a := range e.Artifacts {
+            keys = append(keys, a.Ref)
+        }
+        for _, key := range keys {
+            if key == "" {
+                continue
+            }
+            if err := s.blobs.Delete(ctx, key); err != nil && err != ErrBlobNotFound {
+                log.Printf("prune: delete blob %s: %v", key, err)
+            }
+        }
+    }
+}
+
+// RunPruner calls PruneExecutions every interval until ctx is done, on the
+// leader only.
+func (s *BastionService) RunPruner(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if !s.leading(ctx) {
+                continue
+            }
+            res, err := s.PruneExecutions(ctx)
+            if err != nil {
+                log.Printf("prune executions: %v", err)
+            } else if res.Deleted > 0 {
+                log.Printf("pruned %d executions", res.Deleted)
+            }
+        }
+    }
+}
+
+// executionArchive is a gzipped JSON Lines file of full execution records.
+type executionArchive struct {
+    path string
+    f    *os.File
+    gz   *gzip.Writer
+    enc  *json.Encoder
+}
+
+func openExecutionArchive(dir string, now time.Time) (*executionArchive, error) {
+    if err := os.MkdirAll(dir, 0o700); err != nil {
+        return nil, fmt.Errorf("archive: %w", err)
+    }
+    // Two passes in the same second, say from two bastions, must not collide;
+    // the timestamp still sorts the files.
+    path := filepath.Join(dir, randomID("executions-"+now.UTC().Format("20060102T150405Z"))+".jsonl.gz")
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+    if err != nil {
+        return nil, fmt.Errorf("archive: %w", err)
+    }
+    gz := gzip.NewWriter(f)
+    return &executionArchive{path: path, f: f, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// write appends list and makes it durable, since the records are deleted
+// from the database right after.
+func (a *executionArchive) write(list []Execution) error {
+    for _, e := range list {
+        if err := a.enc.Encode(e); err != nil {
+            return fmt.Errorf("archive: %w", err)
+        }
+    }
+    if err := a.gz.Flush(); err != nil {
+        return fmt.Errorf("archive: %w", err)
+    }
+    if err := a.f.Sync(); err != nil {
+        return fmt.Errorf("archive: %w", err)
+    }
+    return nil
+}
+
+func (a *executionArchive) Close() error {
+    err := a.gz.Close()
+    if cerr := a.f.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
+
+// prunable applies policy to every execution the way the SQL query does.
+func prunable(all []Execution, policy RetentionPolicy, now time.Time, limit int) []Execution {
+    if !policy.enabled() {
+        return nil
+    }
+    sort.Slice(all, func(i, j int) bool {
+        if !all[i].StartedAt.Equal(all[j].StartedAt) {
+            return all[i].StartedAt.After(all[j].StartedAt)
+        }
+        return all[i].ID > all[j].ID
+    })
+    commandRank := map[string]int{}
+    failureRank := map[string]int{}
+    cutoff := now.Add(-policy.MaxAge)
+    var out []Execution
+    for _, e := range all {
+        commandRank[e.CommandID]++
+        if e.Status == ExecutionFailed {
+            failureRank[e.CommandID]++
+        }
+        switch {
+        case e.Status == ExecutionPending || e.Status == ExecutionRunning:
+            continue
+        case e.Status == ExecutionFailed && failureRank[e.CommandID] <= policy.KeepFailures:
+            continue
+        case policy.MaxAge > 0 && e.StartedAt.Before(cutoff),
+            policy.MaxPerCommand > 0 && commandRank[e.CommandID] > policy.MaxPerCommand:
+            out = append(out, e)
+        }
+    }
+    // Oldest first, as the SQL query returns them.
+    for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+        out[i], out[j] = out[j], out[i]
+    }
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func executionIDs(list []Execution) []string {
+    ids := []string{}
+    for _, e := range list {
+        ids = append(ids, e.ID)
+    }
+    return ids
+}
+
+// saveRetentionHistory stores, per command, executions an hour apart, newest
+// last and the latest an hour before now, so a and b tie on some times.
+func saveRetentionHistory(t *testing.T, repos Repositories, now time.Time) {
+    t.Helper()
+    ctx := context.Background()
+    saveTestCommand(t, repos, "a", "node-1")
+    saveTestCommand(t, repos, "b", "node-1")
+    history := map[string][]ExecutionStatus{
+        "a": {ExecutionFailed, ExecutionSucceeded, ExecutionFailed, ExecutionSucceeded, ExecutionFailed, ExecutionSucceeded, ExecutionRunning},
+        "b": {ExecutionSucceeded, ExecutionPending, ExecutionLost, ExecutionSucceeded},
+    }
+    for command, statuses := range history {
+        for i, status := range statuses {
+            exec := Execution{
+                ID:        fmt.Sprintf("%s-%d", command, i),
+                CommandID: command,
+                NodeID:    "node-1",
+                Status:    status,
+                StartedAt: now.Add(-time.Duration(len(statuses)-i) * time.Hour),
+                Stdout:    "output of " + command,
+            }
+            if _, err := repos.Executions.Save(ctx, exec); err != nil {
+                t.Fatal(err)
+            }
+        }
+    }
+}
+
+func TestPrunableMatchesAcrossRepos(t *testing.T) {
+    ctx := context.Background()
+    now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    for _, tc := range []struct {
+        name   string
+        policy RetentionPolicy
+        limit  int
+        want   []string
+    }{
+        {"disabled", RetentionPolicy{KeepFailures: 1}, 100, []string{}},
+        // a-6 is running and b-1 pending; neither is ever pruned.
+        {"max age", RetentionPolicy{MaxAge: 3*time.Hour + time.Minute}, 100, []string{"a-0", "a-1", "a-2", "a-3", "b-0"}},
+        {"max per command", RetentionPolicy{MaxPerCommand: 2}, 100, []string{"a-0", "a-1", "a-2", "a-3", "b-0", "a-4"}},
+        // The two newest failures of a, a-2 and a-4, stay.
+        {"keep failures", RetentionPolicy{MaxPerCommand: 2, KeepFailures: 2}, 100, []string{"a-0", "a-1", "a-3", "b-0"}},
+        {"either limit", RetentionPolicy{MaxAge: 5*time.Hour + time.Minute, MaxPerCommand: 3, KeepFailures: 1}, 100, []string{"a-0", "a-1", "a-2", "a-3", "b-0"}},
+        {"limit", RetentionPolicy{MaxPerCommand: 1}, 3, []string{"a-0", "a-1", "a-2"}},
+    } {
+        for name, repos := range testRepos(t) {
+            saveRetentionHistory(t, repos, now)
+            list, err := repos.Executions.Prunable(ctx, tc.policy, now, tc.limit)
+            if err != nil {
+                t.Fatalf("%s/%s: %v", tc.name, name, err)
+            }
+            if got := executionIDs(list); !reflect.DeepEqual(got, tc.want) {
+                t.Errorf("%s/%s: Prunable = %v, want %v", tc.name, name, got, tc.want)
+            }
+            for _, e := range list {
+                if e.Stdout != "output of "+e.CommandID {
+                    t.Errorf("%s/%s: %s came back without its full record: %+v", tc.name, name, e.ID, e)
+                }
+            }
+        }
+    }
+}
+
+func TestPruneExecutionsArchiveNamesDoNotCollide(t *testing.T) {
+    ctx := context.Background()
+    dir := t.TempDir()
+    now := time.Now()
+    for pass := 0; pass < 2; pass++ {
+        repos := NewInMemoryRepos()
+        saveRetentionHistory(t, repos, now)
+        svc := NewBastionService(repos)
+        svc.SetRetention(RetentionPolicy{MaxPerCommand: 1, ArchiveDir: dir})
+        res, err := svc.PruneExecutions(ctx)
+        if err != nil {
+            t.Fatalf("pass %d: %v", pass, err)
+        }
+        if res.Deleted != 8 || res.Archive == "" {
+            t.Fatalf("pass %d: %+v", pass, res)
+        }
+    }
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(entries) != 2 {
+        t.Errorf("two passes in the same second left %d archives", len(entries))
+    }
+}
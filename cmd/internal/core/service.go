@@ -6,11 +6,11 @@ import (
     "crypto/rand"
     "encoding/hex"
     "encoding/json"
-    "errors"
     "fmt"
+    "log"
     "net/http"
-    "sort"
     "strings"
+    "sync"
     "time"
 )
 
@@ -18,174 +18,379 @@ type BastionService struct {
     commands   CommandRepository
     nodes      NodeRepository
     executions ExecutionRepository
+    audit      AuditRepository
+    sessions   SessionRepository
+    grants     GrantRepository
     client     *http.Client
+    // execClient sends runs to daemons. It has no overall timeout: a run's
+    // request is bounded by its command's timeout instead.
+    execClient *http.Client
+    // blobs holds outputs larger than inlineOutputLimit. Nil keeps everything inline.
+    blobs             BlobStore
+    inlineOutputLimit int
+
+    maxRecordingBytes int64
+    maxCopyBytes      int64
+
+    tunnels      TunnelRepository
+    tunnelsMu    sync.Mutex
+    tunnelConns  map[string]*tunnelState
+    tunnelMaxTTL time.Duration
+
+    // grantsMu serialises grant state changes.
+    grantsMu         sync.Mutex
+    requireGrants    bool
+    maxGrantDuration time.Duration
+
+    retention RetentionPolicy
+
+    queue       ExecutionQueue
+    queuePolicy QueuePolicy
+    queueWake   chan struct{}
+    waiters     executionWaiters
+    leader      LeaderElector
+
+    gpuMetrics GPUMetricsRepository
+    gpuHistory GPUHistoryPolicy
+    gpus       GPUReservationRepository
+
+    alerts     AlertRepository
+    alertRules []AlertRule
+    notifier   AlertNotifier
 }
 
-func NewBastionService(commands CommandRepository, nodes NodeRepository, executions ExecutionRepository) *BastionService {
+func NewBastionService(repos Repositories) *BastionService {
     return &BastionService{
-        commands:   commands,
-        nodes:      nodes,
-        executions: executions,
+        commands:   repos.Commands,
+        nodes:      repos.Nodes,
+        executions: repos.Executions,
+        audit:      repos.Audit,
+        sessions:   repos.Sessions,
+        grants:     repos.Grants,
         client: &http.Client{
             Timeout: 60 * time.Second,
         },
+        execClient:  &http.Client{},
+        tunnels:     repos.Tunnels,
+        tunnelConns: map[string]*tunnelState{},
+        queue:       repos.Queue,
+        queuePolicy: QueuePolicy{Order: QueueFIFO},
+        queueWake:   make(chan struct{}, 1),
+        leader:      soleLeader{},
+        gpuMetrics:  repos.GPUMetrics,
+        gpuHistory:  DefaultGPUHistoryPolicy,
+        alerts:      repos.Alerts,
+        gpus:        repos.GPUs,
+        notifier:    LogNotifier{},
     }
 }
 
-func (s *BastionService) ListCommands() []Command {
-    return s.commands.List()
+func (s *BastionService) ListCommands(ctx context.Context) ([]Command, error) {
+    return s.commands.List(ctx)
+}
+
+func (s *BastionService) GetCommand(ctx context.Context, id string) (Command, error) {
+    cmd, err := s.commands.Get(ctx, id)
+    return cmd, unknown(err, "command", id)
 }
 
-func (s *BastionService) GetCommand(id string) (Command, bool) {
-    return s.commands.Get(id)
+func (s *BastionService) ListNodes(ctx context.Context) ([]Node, error) {
+    return s.nodes.List(ctx)
 }
 
-func (s *BastionService) ListNodes() []Node {
-    return s.nodes.List()
+func (s *BastionService) getNode(ctx context.Context, id string) (Node, error) {
+    node, err := s.nodes.Get(ctx, id)
+    return node, unknown(err, "node", id)
 }
 
-func (s *BastionService) ListExecutions() []Execution {
-    list := s.executions.List()
-    sort.Slice(list, func(i, j int) bool {
-        return list[i].StartedAt.After(list[j].StartedAt)
-    })
-    return list
+func (s *BastionService) GetExecution(ctx context.Context, id string) (Execution, error) {
+    execRecord, err := s.executions.Get(ctx, id)
+    if err != nil {
+        return execRecord, unknown(err, "execution", id)
+    }
+    if err := s.authorizeExecution(ctx, execRecord); err != nil {
+        return Execution{}, err
+    }
+    if execRecord.Status == ExecutionPending {
+        positions, err := s.queuePositions(ctx)
+        if err != nil {
+            return Execution{}, err
+        }
+        execRecord.QueuePosition = positions[id]
+    }
+    return execRecord, nil
 }
 
-func (s *BastionService) CreateCommand(input Command) (Command, error) {
+func (s *BastionService) CreateCommand(ctx context.Context, input Command) (Command, error) {
     if strings.TrimSpace(input.Name) == "" {
-        return Command{}, errors.New("name is required")
+        return Command{}, invalidf("name is required")
     }
     if strings.TrimSpace(input.Script) == "" {
-        return Command{}, errors.New("script is required")
+        return Command{}, invalidf("script is required")
     }
     if input.TimeoutSeconds <= 0 {
         input.TimeoutSeconds = 300
     }
+    if err := validateLimits(input.Limits); err != nil {
+        return Command{}, err
+    }
+    if err := validateIsolation(input.Isolation); err != nil {
+        return Command{}, err
+    }
+    if input.MaxConcurrent < 0 {
+        return Command{}, invalidf("max_concurrent must not be negative")
+    }
+    if err := validateGPURequirement(input.GPU); err != nil {
+        return Command{}, err
+    }
+    if err := validateArtifactPatterns(input.Artifacts); err != nil {
+        return Command{}, err
+    }
     input.ID = randomID("cmd")
     input.CreatedAt = time.Now().UTC()
-    return s.commands.Save(input), nil
+    return s.commands.Save(ctx, input)
 }
 
-func (s *BastionService) DeleteCommand(id string) error {
+func (s *BastionService) DeleteCommand(ctx context.Context, id string) error {
     if strings.TrimSpace(id) == "" {
-        return errors.New("id is required")
-    }
-    if _, ok := s.commands.Get(id); !ok {
-        return fmt.Errorf("unknown command %s", id)
+        return invalidf("id is required")
     }
-    s.commands.Delete(id)
-    return nil
+    return unknown(s.commands.Delete(ctx, id), "command", id)
 }
 
-func (s *BastionService) UpdateCommand(id string, input Command) (Command, error) {
+func (s *BastionService) UpdateCommand(ctx context.Context, id string, input Command) (Command, error) {
     if strings.TrimSpace(id) == "" {
-        return Command{}, errors.New("id is required")
+        return Command{}, invalidf("id is required")
     }
-    existing, ok := s.commands.Get(id)
-    if !ok {
-        return Command{}, fmt.Errorf("unknown command %s", id)
+    existing, err := s.GetCommand(ctx, id)
+    if err != nil {
+        return Command{}, err
     }
     if strings.TrimSpace(input.Name) == "" {
-        return Command{}, errors.New("name is required")
+        return Command{}, invalidf("name is required")
     }
     if strings.TrimSpace(input.Script) == "" {
-        return Command{}, errors.New("script is required")
+        return Command{}, invalidf("script is required")
     }
     if input.TimeoutSeconds <= 0 {
         input.TimeoutSeconds = existing.TimeoutSeconds
     }
+    if err := validateLimits(input.Limits); err != nil {
+        return Command{}, err
+    }
+    if err := validateIsolation(input.Isolation); err != nil {
+        return Command{}, err
+    }
+    if input.MaxConcurrent < 0 {
+        return Command{}, invalidf("max_concurrent must not be negative")
+    }
+    if err := validateGPURequirement(input.GPU); err != nil {
+        return Command{}, err
+    }
+    if err := validateArtifactPatterns(input.Artifacts); err != nil {
+        return Command{}, err
+    }
     updated := Command{
         ID:             existing.ID,
         Name:           input.Name,
         Description:    input.Description,
         Script:         input.Script,
         TimeoutSeconds: input.TimeoutSeconds,
+        Limits:         input.Limits,
+        Isolation:      input.Isolation,
+        Artifacts:      input.Artifacts,
+        MaxConcurrent:  input.MaxConcurrent,
+        GPU:            input.GPU,
         CreatedAt:      existing.CreatedAt,
     }
-    return s.commands.Save(updated), nil
+    return s.commands.Save(ctx, updated)
 }
 
-func (s *BastionService) RegisterNode(node Node) Node {
+func (s *BastionService) RegisterNode(ctx context.Context, node Node) (Node, error) {
+    if node.MaxConcurrent < 0 {
+        return Node{}, invalidf("max_concurrent must not be negative")
+    }
     if node.ID == "" {
         node.ID = randomID("node")
     }
-    return s.nodes.Save(node)
+    return s.nodes.Save(ctx, node)
 }
 
-func (s *BastionService) ExecuteCommand(ctx context.Context, commandID, nodeID string) (Execution, error) {
-    cmd, ok := s.commands.Get(commandID)
-    if !ok {
-        return Execution{}, fmt.Errorf("unknown command %s", commandID)
+// ExecuteCommand queues a run of a command on a node and waits for it to
+// finish. Higher priorities start first when the queue is ordered by
+// priority. A command that needs GPUs has its devices reserved from when the
+// run starts until it finishes; without a nodeID it goes to the node
+// chooseGPUNode picks.
+func (s *BastionService) ExecuteCommand(ctx context.Context, commandID, nodeID string, priority int) (Execution, error) {
+    cmd, err := s.GetCommand(ctx, commandID)
+    if err != nil {
+        return Execution{}, err
     }
-    node, ok := s.nodes.Get(nodeID)
-    if !ok {
-        return Execution{}, fmt.Errorf("unknown node %s", nodeID)
+    execID := randomID("exec")
+    var node Node
+    var grantID string
+    if nodeID == "" && cmd.GPU.Count > 0 {
+        node, grantID, err = s.placeExecution(ctx, cmd)
+        if err != nil {
+            return Execution{}, err
+        }
+    } else {
+        if node, err = s.getNode(ctx, nodeID); err != nil {
+            return Execution{}, err
+        }
+        if grantID, err = s.authorizeNode(ctx, node.ID, ActionExecute); err != nil {
+            s.recordAudit(ctx, "execute", node.ID, cmd.ID, "", err)
+            return Execution{}, err
+        }
+        if !gpuNodeAllowed(cmd.GPU, node.ID) {
+            return Execution{}, invalidf("command %s may only run on nodes %s", cmd.ID, strings.Join(cmd.GPU.Nodes, ", "))
+        }
+        if cmd.GPU.Count > 0 {
+            if _, err = s.chooseGPUNode(ctx, cmd.GPU, []Node{node}); err != nil {
+                return Execution{}, err
+            }
+        }
     }
 
     now := time.Now().UTC()
     execRecord := Execution{
-        ID:        randomID("exec"),
-        CommandID: cmd.ID,
-        NodeID:    node.ID,
-        Status:    ExecutionRunning,
-        StartedAt: now,
+        ID:          execID,
+        CommandID:   cmd.ID,
+        NodeID:      node.ID,
+        Status:      ExecutionPending,
+        StartedAt:   now,
+        TriggeredBy: PrincipalFrom(ctx).Name,
+        GrantID:     grantID,
+    }
+    if _, err := s.executions.Save(ctx, execRecord); err != nil {
+        return Execution{}, err
+    }
+    job := QueueJob{
+        ExecutionID:  execRecord.ID,
+        NodeID:       node.ID,
+        CommandID:    cmd.ID,
+        EnqueuedAt:   now,
+        Priority:     priority,
+        NodeLimit:    node.MaxConcurrent,
+        CommandLimit: cmd.MaxConcurrent,
+    }
+    if err := s.queue.Enqueue(ctx, job); err != nil {
+        return s.failExecution(ctx, execRecord, fmt.Sprintf("enqueue: %v", err)), err
     }
-    s.executions.Save(execRecord)
+    s.wakeWorkers()
+    // The run belongs to the queue now: if the caller goes away it carries
+    // on, and whichever worker claims it records the result.
+    return s.awaitExecution(ctx, execRecord.ID)
+}
 
+// dispatchExecution sends a run to its daemon and records the result. The
+// request is bound to ctx; if ctx ends first the execution is returned as it
+// stands with ctx's error and nothing is recorded. Saves use store.
+func (s *BastionService) dispatchExecution(ctx, store context.Context, cmd Command, node Node, execRecord Execution) (Execution, error) {
     req := ExecRequest{
+        ExecutionID:    execRecord.ID,
         Script:         cmd.Script,
         TimeoutSeconds: cmd.TimeoutSeconds,
+        Limits:         cmd.Limits,
+        Isolation:      cmd.Isolation,
+        Artifacts:      cmd.Artifacts,
+        Env:            gpuEnv(execRecord.GPUDevices),
     }
 
     payload, err := json.Marshal(req)
     if err != nil {
-        return s.failExecution(execRecord, fmt.Sprintf("marshal request: %v", err)), err
+        return s.failExecution(store, execRecord, fmt.Sprintf("marshal request: %v", err)), err
     }
 
+    // The daemon stops the script at the timeout; the grace covers
+    // collecting its outputs and artifacts.
+    limit := commandTimeout(cmd) + recoveryGrace
+    reqCtx, cancel := context.WithTimeout(ctx, limit)
+    defer cancel()
     url := strings.TrimRight(node.Address, "/") + "/api/v1/exec"
-    httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+    httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, url, bytes.NewReader(payload))
     if err != nil {
-        return s.failExecution(execRecord, fmt.Sprintf("build request: %v", err)), err
+        return s.failExecution(store, execRecord, fmt.Sprintf("build request: %v", err)), err
     }
     httpReq.Header.Set("Content-Type", "application/json")
 
-    resp, err := s.client.Do(httpReq)
+    resp, err := s.execClient.Do(httpReq)
     if err != nil {
-        return s.failExecution(execRecord, fmt.Sprintf("request failed: %v", err)), err
+        if ctx.Err() != nil {
+            return execRecord, ctx.Err()
+        }
+        if reqCtx.Err() != nil {
+            err = fmt.Errorf("no result from the daemon within %s: %w", limit, err)
+        }
+        return s.failExecution(store, execRecord, fmt.Sprintf("request failed: %v", err)), err
     }
     defer resp.Body.Close()
 
     var execResp ExecResponse
     if err := json.NewDecoder(resp.Body).Decode(&execResp); err != nil {
-        return s.failExecution(execRecord, fmt.Sprintf("decode response: %v", err)), err
+        if ctx.Err() != nil {
+            return execRecord, ctx.Err()
+        }
+        return s.failExecution(store, execRecord, fmt.Sprintf("decode response: %v", err)), err
     }
+    return s.finishExecution(store, node, execRecord, execResp)
+}
 
+// finishExecution stores the daemon's result for a run.
+func (s *BastionService) finishExecution(ctx context.Context, node Node, execRecord Execution, execResp ExecResponse) (Execution, error) {
     finished := time.Now().UTC()
     execRecord.Stdout = execResp.Stdout
     execRecord.Stderr = execResp.Stderr
     execRecord.ExitCode = execResp.ExitCode
     execRecord.DurationMs = execResp.DurationMs
+    execRecord.PeakMemoryBytes = execResp.PeakMemoryBytes
+    execRecord.CPUTimeMs = execResp.CPUTimeMs
+    execRecord.StdoutBytes = execResp.StdoutBytes
+    execRecord.StderrBytes = execResp.StderrBytes
+    execRecord.StdoutTruncated = execResp.StdoutTruncated
+    execRecord.StderrTruncated = execResp.StderrTruncated
+    execRecord.OutputSpooled = execResp.Spooled
+    s.offloadOutputs(ctx, node, &execRecord)
+    execRecord.Artifacts = s.storeArtifacts(ctx, node, execRecord.ID, execResp.Artifacts)
     execRecord.CompletedAt = &finished
     if execResp.ExitCode == 0 {
         execRecord.Status = ExecutionSucceeded
     } else {
         execRecord.Status = ExecutionFailed
     }
-    s.executions.Save(execRecord)
-    return execRecord, nil
+    return s.executions.Save(ctx, execRecord)
 }
 
-func (s *BastionService) failExecution(execRecord Execution, message string) Execution {
+// failExecution records a run that never got a result from the daemon. The
+// daemon error is what the caller reports, so a failed save is only logged.
+func (s *BastionService) failExecution(ctx context.Context, execRecord Execution, message string) Execution {
     now := time.Now().UTC()
     execRecord.CompletedAt = &now
     execRecord.Status = ExecutionFailed
     execRecord.Stderr = message
     execRecord.ExitCode = 1
-    s.executions.Save(execRecord)
+    if _, err := s.executions.Save(ctx, execRecord); err != nil {
+        log.Printf("save failed execution %s: %v", execRecord.ID, err)
+    }
     return execRecord
 }
 
+func validateLimits(limits ResourceLimits) error {
+    if limits.MemoryMB < 0 || limits.CPUPercent < 0 || limits.MaxPids < 0 {
+        return invalidf("limits must not be negative")
+    }
+    return nil
+}
+
+func validateIsolation(mode IsolationMode) error {
+    switch mode {
+    case "", IsolationNone, IsolationNamespace:
+        return nil
+    default:
+        return invalidf("unknown isolation mode %q", mode)
+    }
+}
+
 func randomID(prefix string) string {
     b := make([]byte, 6)
     if _, err := rand.Read(b); err != nil {
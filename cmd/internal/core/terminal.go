@@ -0,0 +1,206 @@
+package core
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gorilla/websocket"
+)
+
+// Terminal is an open shell on a node, waiting to be bridged to a client.
+type Terminal struct {
+    NodeID string
+    conn   *websocket.Conn
+    opened time.Time
+    cols   uint16
+    rows   uint16
+}
+
+// OpenTerminal starts a PTY shell on a node. Dialing happens before the
+// client's socket is upgraded so failures can still be reported over HTTP.
+func (s *BastionService) OpenTerminal(ctx context.Context, nodeID string, cols, rows uint16) (*Terminal, error) {
+    term, err := s.openTerminal(ctx, nodeID, cols, rows)
+    s.recordAudit(ctx, "terminal.open", nodeID, "", fmt.Sprintf("%dx%d", cols, rows), err)
+    return term, err
+}
+
+func (s *BastionService) openTerminal(ctx context.Context, nodeID string, cols, rows uint16) (*Terminal, error) {
+    node, err := s.getNode(ctx, nodeID)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := s.authorizeNode(ctx, nodeID, ActionTerminal); err != nil {
+        return nil, err
+    }
+    target, err := daemonWebSocketURL(node, "/api/v1/terminal", url.Values{
+        "cols": {strconv.Itoa(int(cols))},
+        "rows": {strconv.Itoa(int(rows))},
+    })
+    if err != nil {
+        return nil, err
+    }
+    dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+    conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target, nil)
+    if err != nil {
+        if resp != nil {
+            return nil, fmt.Errorf("daemon status %d", resp.StatusCode)
+        }
+        return nil, fmt.Errorf("dial daemon: %w", err)
+    }
+    return &Terminal{NodeID: nodeID, conn: conn, opened: time.Now(), cols: cols, rows: rows}, nil
+}
+
+// daemonWebSocketURL maps a node's http(s) address to ws(s).
+func daemonWebSocketURL(node Node, path string, q url.Values) (string, error) {
+    u, err := url.Parse(strings.TrimRight(node.Address, "/") + path)
+    if err != nil {
+        return "", fmt.Errorf("node address: %w", err)
+    }
+    switch u.Scheme {
+    case "https":
+        u.Scheme = "wss"
+    default:
+        u.Scheme = "ws"
+    }
+    u.RawQuery = q.Encode()
+    return u.String(), nil
+}
+
+// BridgeTerminal relays between the client socket and the node's shell until
+// either side closes or the client sends nothing for idle. Binary frames
+// pass through untouched; of the client's text frames only resize requests
+// are forwarded. Everything relayed is recorded into the TerminalSession in
+// chunks as the session runs, up to the service's recording limit.
+func (s *BastionService) BridgeTerminal(ctx context.Context, term *Terminal, client *websocket.Conn, idle time.Duration) {
+    session := TerminalSession{
+        ID:        randomID("sess"),
+        NodeID:    term.NodeID,
+        User:      PrincipalFrom(ctx).Name,
+        Cols:      int(term.cols),
+        Rows:      int(term.rows),
+        StartedAt: term.opened.UTC(),
+    }
+    // The row exists while the shell is live so it shows up in listings.
+    if _, err := s.sessions.Save(ctx, session); err != nil {
+        log.Printf("save session %s: %v", session.ID, err)
+    }
+    maxBytes := s.maxRecordingBytes
+    if maxBytes <= 0 {
+        maxBytes = DefaultMaxRecordingBytes
+    }
+    rec := newAsciicastRecorder(session.Cols, session.Rows, term.opened, session.User+"@"+session.NodeID, maxBytes,
+        func(seq int, chunk []byte) error {
+            return s.sessions.AppendRecording(ctx, session.ID, seq, chunk)
+        })
+    // Quiet sessions still get their events written out now and then.
+    stopFlushing := make(chan struct{})
+    go func() {
+        ticker := time.NewTicker(recordingFlushInterval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ticker.C:
+                rec.flush()
+            case <-stopFlushing:
+                return
+            }
+        }
+    }()
+
+    // gorilla/websocket allows one concurrent writer per connection.
+    var clientMu sync.Mutex
+    writeClient := func(kind int, data []byte) error {
+        clientMu.Lock()
+        defer clientMu.Unlock()
+        return client.WriteMessage(kind, data)
+    }
+    var closeOnce sync.Once
+    var reason string
+    shutdown := func(why string) {
+        closeOnce.Do(func() {
+            reason = why
+            closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, why)
+            clientMu.Lock()
+            client.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+            clientMu.Unlock()
+            term.conn.Close()
+            client.Close()
+        })
+    }
+
+    var idleTimer *time.Timer
+    if idle > 0 {
+        idleTimer = time.AfterFunc(idle, func() {
+            msg, _ := json.Marshal(TerminalMessage{Type: "error", Message: "idle timeout"})
+            writeClient(websocket.TextMessage, msg)
+            shutdown("idle timeout")
+        })
+        defer idleTimer.Stop()
+    }
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for {
+            kind, data, err := term.conn.ReadMessage()
+            if err != nil {
+                shutdown("shell closed")
+                return
+            }
+            if kind == websocket.BinaryMessage {
+                rec.output(data)
+            }
+            if err := writeClient(kind, data); err != nil {
+                shutdown("client gone")
+                return
+            }
+        }
+    }()
+
+    for {
+        kind, data, err := client.ReadMessage()
+        if err != nil {
+            shutdown("client closed")
+            break
+        }
+        if idleTimer != nil {
+            idleTimer.Reset(idle)
+        }
+        if kind == websocket.TextMessage {
+            var msg TerminalMessage
+            if json.Unmarshal(data, &msg) != nil || msg.Type != "resize" {
+                continue
+            }
+            rec.resize(msg.Cols, msg.Rows)
+        } else {
+            rec.input(data)
+        }
+        if err := term.conn.WriteMessage(kind, data); err != nil {
+            shutdown("shell closed")
+            break
+        }
+    }
+    <-done
+    ended := time.Now().UTC()
+    session.EndedAt = &ended
+    close(stopFlushing)
+    session.RecordingBytes = rec.close()
+    if _, err := s.sessions.Save(ctx, session); err != nil {
+        log.Printf("save session %s recording: %v", session.ID, err)
+    }
+    duration := ended.Sub(term.opened).Round(time.Second)
+    s.recordAudit(ctx, "terminal.close", term.NodeID, session.ID, fmt.Sprintf("%s after %s", reason, duration), nil)
+}
+
+// Close releases a terminal that was never bridged.
+func (t *Terminal) Close() error {
+    return t.conn.Close()
+}
@@ -0,0 +1,302 @@
+package core
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "net/url"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/gorilla/websocket"
+)
+
+const (
+    DefaultTunnelTTL = time.Hour
+    DefaultMaxTunnel = 8 * time.Hour
+)
+
+// tunnelPollInterval is how often a relay rereads its tunnel, so a close on
+// another replica reaches connections relayed here.
+const tunnelPollInterval = 5 * time.Second
+
+// tunnelState is this replica's part of a tunnel: the connections it relays
+// and, on the replica that opened it, the expiry timer. The tunnel itself is
+// stored in the repository so every replica can list, use and close it.
+type tunnelState struct {
+    conns map[*websocket.Conn]struct{}
+    timer *time.Timer
+}
+
+// SetTunnelMaxTTL caps how long a tunnel may be requested for.
+func (s *BastionService) SetTunnelMaxTTL(max time.Duration) {
+    s.tunnelsMu.Lock()
+    defer s.tunnelsMu.Unlock()
+    s.tunnelMaxTTL = max
+}
+
+// OpenTunnel registers a forward to port on a node for the caller. Nothing
+// is dialed until a client connects through DialTunnel.
+func (s *BastionService) OpenTunnel(ctx context.Context, nodeID string, port int, ttl time.Duration) (Tunnel, error) {
+    t, err := s.openTunnel(ctx, nodeID, port, ttl)
+    s.recordAudit(ctx, "tunnel.open", nodeID, fmt.Sprintf("%s:%d", t.ID, port), "expires "+t.ExpiresAt.Format(time.RFC3339), err)
+    return t, err
+}
+
+func (s *BastionService) openTunnel(ctx context.Context, nodeID string, port int, ttl time.Duration) (Tunnel, error) {
+    if _, err := s.getNode(ctx, nodeID); err != nil {
+        return Tunnel{}, err
+    }
+    if port <= 0 || port > 65535 {
+        return Tunnel{}, invalidf("port must be between 1 and 65535")
+    }
+    if _, err := s.authorizeNode(ctx, nodeID, ActionTunnel); err != nil {
+        return Tunnel{}, err
+    }
+    if ttl <= 0 {
+        ttl = DefaultTunnelTTL
+    }
+    s.tunnelsMu.Lock()
+    max := s.tunnelMaxTTL
+    s.tunnelsMu.Unlock()
+    if max <= 0 {
+        max = DefaultMaxTunnel
+    }
+    if ttl > max {
+        return Tunnel{}, invalidf("ttl exceeds maximum of %s", max)
+    }
+    now := time.Now().UTC()
+    // Ended tunnels stay listed for a day so admins can see what ran.
+    if err := s.tunnels.DeleteEndedBefore(ctx, now.Add(-24*time.Hour)); err != nil {
+        log.Printf("forget old tunnels: %v", err)
+    }
+    t, err := s.tunnels.Create(ctx, Tunnel{
+        ID:        randomID("tun"),
+        NodeID:    nodeID,
+        Port:      port,
+        User:      PrincipalFrom(ctx).Name,
+        CreatedAt: now,
+        ExpiresAt: now.Add(ttl),
+    })
+    if err != nil {
+        return Tunnel{}, err
+    }
+    id := t.ID
+    s.tunnelsMu.Lock()
+    s.localTunnel(id).timer = time.AfterFunc(ttl, func() {
+        s.closeTunnel(context.Background(), id, "expired")
+    })
+    s.tunnelsMu.Unlock()
+    return t, nil
+}
+
+// localTunnel returns this replica's state for a tunnel, creating it on
+// first use. The caller holds tunnelsMu.
+func (s *BastionService) localTunnel(id string) *tunnelState {
+    state, ok := s.tunnelConns[id]
+    if !ok {
+        state = &tunnelState{conns: map[*websocket.Conn]struct{}{}}
+        s.tunnelConns[id] = state
+    }
+    return state
+}
+
+// expireTunnel shows a tunnel past its expiry as closed even if the replica
+// that opened it went away before its timer closed it.
+func expireTunnel(t Tunnel, now time.Time) Tunnel {
+    if t.ClosedAt == nil && !now.Before(t.ExpiresAt) {
+        expired := t.ExpiresAt
+        t.ClosedAt, t.ClosedBy = &expired, "expired"
+    }
+    return t
+}
+
+// ListTunnels returns tunnels newest first, whichever replica opened them.
+// Callers without the admin role only see their own.
+func (s *BastionService) ListTunnels(ctx context.Context) ([]Tunnel, error) {
+    caller := PrincipalFrom(ctx)
+    tunnels, err := s.tunnels.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    out := []Tunnel{}
+    for _, t := range tunnels {
+        if caller.HasRole(RoleAdmin) || t.User == caller.Name {
+            out = append(out, expireTunnel(t, now))
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        return out[i].CreatedAt.After(out[j].CreatedAt)
+    })
+    return out, nil
+}
+
+// CloseTunnel ends a tunnel and drops its live connections; replicas other
+// than this one drop theirs within tunnelPollInterval. Owners can close
+// their own tunnels; admins can close any.
+func (s *BastionService) CloseTunnel(ctx context.Context, id string) (Tunnel, error) {
+    caller := PrincipalFrom(ctx)
+    t, err := s.tunnels.Get(ctx, id)
+    if err == nil && !caller.HasRole(RoleAdmin) && t.User != caller.Name {
+        err = ErrNotFound
+    }
+    if err != nil {
+        return Tunnel{}, unknown(err, "tunnel", id)
+    }
+    return s.closeTunnel(ctx, id, caller.Name)
+}
+
+func (s *BastionService) closeTunnel(ctx context.Context, id, by string) (Tunnel, error) {
+    closed, err := s.tunnels.Close(ctx, id, by, time.Now().UTC())
+    if err != nil {
+        return Tunnel{}, unknown(err, "tunnel", id)
+    }
+    s.tunnelsMu.Lock()
+    if state, ok := s.tunnelConns[id]; ok {
+        if state.timer != nil {
+            state.timer.Stop()
+        }
+        for conn := range state.conns {
+            conn.Close()
+        }
+        delete(s.tunnelConns, id)
+    }
+    s.tunnelsMu.Unlock()
+    if !closed {
+        return Tunnel{}, invalidf("tunnel %s is not open", id)
+    }
+    t, err := s.tunnels.Get(ctx, id)
+    if err != nil {
+        return Tunnel{}, unknown(err, "tunnel", id)
+    }
+    s.recordAudit(ctx, "tunnel.close", t.NodeID, fmt.Sprintf("%s:%d", id, t.Port),
+        fmt.Sprintf("by %s; %d connections, %d bytes in, %d bytes out", by, t.Connections, t.BytesIn, t.BytesOut), nil)
+    return t, nil
+}
+
+// TunnelConn is one TCP connection dialed through a tunnel, waiting to be
+// joined to a client socket.
+type TunnelConn struct {
+    tunnelID string
+    conn     *websocket.Conn
+}
+
+// DialTunnel asks the node's daemon to connect to the tunnel's port. Only
+// the tunnel's owner may use it, and only until it expires or is closed.
+func (s *BastionService) DialTunnel(ctx context.Context, id string) (*TunnelConn, error) {
+    tc, nodeID, err := s.dialTunnel(ctx, id)
+    s.recordAudit(ctx, "tunnel.connect", nodeID, id, "", err)
+    return tc, err
+}
+
+func (s *BastionService) dialTunnel(ctx context.Context, id string) (*TunnelConn, string, error) {
+    caller := PrincipalFrom(ctx)
+    t, err := s.tunnels.Get(ctx, id)
+    if err == nil && t.User != caller.Name {
+        err = ErrNotFound
+    }
+    if err != nil {
+        return nil, "", unknown(err, "tunnel", id)
+    }
+    if expireTunnel(t, time.Now()).ClosedAt != nil {
+        return nil, t.NodeID, invalidf("tunnel %s is closed", id)
+    }
+    nodeID, port := t.NodeID, t.Port
+    // Checked per connection so a revoked or lapsed grant stops new ones.
+    if _, err := s.authorizeNode(ctx, nodeID, ActionTunnel); err != nil {
+        return nil, nodeID, err
+    }
+
+    node, err := s.getNode(ctx, nodeID)
+    if err != nil {
+        return nil, nodeID, err
+    }
+    target, err := daemonWebSocketURL(node, "/api/v1/forward", url.Values{"port": {strconv.Itoa(port)}})
+    if err != nil {
+        return nil, nodeID, err
+    }
+    dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+    conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target, nil)
+    if err != nil {
+        if resp != nil {
+            return nil, nodeID, fmt.Errorf("daemon status %d", resp.StatusCode)
+        }
+        return nil, nodeID, fmt.Errorf("dial daemon: %w", err)
+    }
+    return &TunnelConn{tunnelID: id, conn: conn}, nodeID, nil
+}
+
+// Close releases a tunnel connection that was never relayed.
+func (tc *TunnelConn) Close() error {
+    return tc.conn.Close()
+}
+
+// RelayTunnel joins a client socket to a dialed connection until either side
+// ends or the tunnel closes or expires, on this replica or any other.
+func (s *BastionService) RelayTunnel(tc *TunnelConn, client *websocket.Conn) {
+    ctx := context.Background()
+    t, err := s.tunnels.Get(ctx, tc.tunnelID)
+    if err != nil || expireTunnel(t, time.Now()).ClosedAt != nil {
+        tc.conn.Close()
+        client.Close()
+        return
+    }
+    // Registering the client lets closeTunnel on this replica sever it; a
+    // close on another replica meanwhile is caught by watchTunnel.
+    s.tunnelsMu.Lock()
+    s.localTunnel(tc.tunnelID).conns[client] = struct{}{}
+    s.tunnelsMu.Unlock()
+    if err := s.tunnels.AddTraffic(ctx, tc.tunnelID, 1, 1, 0, 0); err != nil {
+        log.Printf("tunnel %s: %v", tc.tunnelID, err)
+    }
+
+    done := make(chan struct{})
+    go s.watchTunnel(tc.tunnelID, t.ExpiresAt, client, done)
+    in, out := relayWebSockets(client, tc.conn)
+    close(done)
+
+    s.tunnelsMu.Lock()
+    if state, ok := s.tunnelConns[tc.tunnelID]; ok {
+        delete(state.conns, client)
+        if len(state.conns) == 0 && state.timer == nil {
+            delete(s.tunnelConns, tc.tunnelID)
+        }
+    }
+    s.tunnelsMu.Unlock()
+    s.addTunnelTraffic(tc.tunnelID, in, out)
+}
+
+// addTunnelTraffic records the end of a relayed connection.
+func (s *BastionService) addTunnelTraffic(id string, in, out int64) {
+    if err := s.tunnels.AddTraffic(context.Background(), id, -1, 0, in, out); err != nil {
+        log.Printf("tunnel %s: %v", id, err)
+    }
+}
+
+// watchTunnel severs client once the tunnel expires or is closed, which may
+// happen on another replica, until done is closed.
+func (s *BastionService) watchTunnel(id string, expires time.Time, client *websocket.Conn, done <-chan struct{}) {
+    expiry := time.NewTimer(time.Until(expires))
+    defer expiry.Stop()
+    ticker := time.NewTicker(tunnelPollInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-done:
+            return
+        case <-expiry.C:
+            client.Close()
+            return
+        case <-ticker.C:
+            t, err := s.tunnels.Get(context.Background(), id)
+            if errors.Is(err, ErrNotFound) || (err == nil && t.ClosedAt != nil) {
+                client.Close()
+                return
+            }
+        }
+    }
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+)
+
+// echoDaemon stands in for a daemon whose forwarded port echoes every frame.
+func echoDaemon(t *testing.T) *httptest.Server {
+    upgrader := websocket.Upgrader{}
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        for {
+            kind, data, err := conn.ReadMessage()
+            if err != nil || conn.WriteMessage(kind, data) != nil {
+                return
+            }
+        }
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+// tunnelReplica serves tunnel connections through svc as alice, the way the
+// bastion's connect endpoint does.
+func tunnelReplica(t *testing.T, svc *BastionService) *httptest.Server {
+    upgrader := websocket.Upgrader{}
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ctx := WithPrincipal(r.Context(), Principal{Name: "alice"})
+        tc, err := svc.DialTunnel(ctx, r.URL.Query().Get("id"))
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadGateway)
+            return
+        }
+        client, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            tc.Close()
+            return
+        }
+        svc.RelayTunnel(tc, client)
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func TestTunnelsSharedAcrossReplicas(t *testing.T) {
+    ctx := context.Background()
+    alice := WithPrincipal(ctx, Principal{Name: "alice"})
+    bob := WithPrincipal(ctx, Principal{Name: "bob"})
+    daemon := echoDaemon(t)
+    for name, repos := range testRepos(t) {
+        t.Run(name, func(t *testing.T) {
+            if _, err := repos.Nodes.Save(ctx, Node{ID: "node-1", Name: "node-1", Address: daemon.URL}); err != nil {
+                t.Fatal(err)
+            }
+            // Two bastion replicas share the repositories.
+            a, b := NewBastionService(repos), NewBastionService(repos)
+            tunnel, err := a.OpenTunnel(alice, "node-1", 5432, time.Hour)
+            if err != nil {
+                t.Fatal(err)
+            }
+            list, err := b.ListTunnels(alice)
+            if err != nil || len(list) != 1 || list[0].ID != tunnel.ID {
+                t.Fatalf("replica b lists %+v, %v; want the tunnel opened on a", list, err)
+            }
+            if list, _ := b.ListTunnels(bob); len(list) != 0 {
+                t.Errorf("bob sees %+v", list)
+            }
+
+            // A connection through b is relayed and counted where a sees it.
+            url := "ws" + strings.TrimPrefix(tunnelReplica(t, b).URL, "http") + "?id=" + tunnel.ID
+            client, _, err := websocket.DefaultDialer.Dial(url, nil)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err := client.WriteMessage(websocket.BinaryMessage, []byte("ping")); err != nil {
+                t.Fatal(err)
+            }
+            if _, data, err := client.ReadMessage(); err != nil || string(data) != "ping" {
+                t.Fatalf("echo through the tunnel = %q, %v", data, err)
+            }
+            if list, _ := a.ListTunnels(alice); list[0].Active != 1 || list[0].Connections != 1 {
+                t.Errorf("replica a sees %+v, want one live connection", list[0])
+            }
+            client.Close()
+            deadline := time.Now().Add(2 * time.Second)
+            for {
+                list, _ := a.ListTunnels(alice)
+                if list[0].Active == 0 && list[0].BytesIn == 4 && list[0].BytesOut == 4 {
+                    break
+                }
+                if time.Now().After(deadline) {
+                    t.Fatalf("after the client left: %+v", list[0])
+                }
+                time.Sleep(10 * time.Millisecond)
+            }
+
+            if _, err := b.CloseTunnel(bob, tunnel.ID); !errors.Is(err, ErrNotFound) {
+                t.Errorf("bob closing alice's tunnel: %v, want ErrNotFound", err)
+            }
+            closed, err := b.CloseTunnel(alice, tunnel.ID)
+            if err != nil || closed.ClosedAt == nil || closed.ClosedBy != "alice" {
+                t.Fatalf("closing on replica b = %+v, %v", closed, err)
+            }
+            if _, err := a.DialTunnel(alice, tunnel.ID); !errors.Is(err, ErrInvalid) {
+                t.Errorf("dialing a closed tunnel on replica a: %v, want ErrInvalid", err)
+            }
+            if _, err := a.CloseTunnel(alice, tunnel.ID); !errors.Is(err, ErrInvalid) {
+                t.Errorf("closing twice: %v, want ErrInvalid", err)
+            }
+        })
+    }
+}
+
+func TestTunnelExpiresWithoutItsReplica(t *testing.T) {
+    ctx := context.Background()
+    alice := WithPrincipal(ctx, Principal{Name: "alice"})
+    for name, repos := range testRepos(t) {
+        // The replica that opened this tunnel died before its timer fired.
+        created := time.Now().Add(-2 * time.Hour).UTC()
+        if _, err := repos.Tunnels.Create(ctx, Tunnel{ID: "tun-1", NodeID: "node-1", Port: 22, User: "alice", CreatedAt: created, ExpiresAt: created.Add(time.Hour)}); err != nil {
+            t.Fatal(err)
+        }
+        svc := NewBastionService(repos)
+        list, err := svc.ListTunnels(alice)
+        if err != nil || len(list) != 1 || list[0].ClosedAt == nil || list[0].ClosedBy != "expired" {
+            t.Errorf("%s: ListTunnels = %+v, %v; want the tunnel shown expired", name, list, err)
+        }
+        if _, err := svc.DialTunnel(alice, "tun-1"); !errors.Is(err, ErrInvalid) {
+            t.Errorf("%s: dialing an expired tunnel: %v, want ErrInvalid", name, err)
+        }
+        if _, err := svc.DialTunnel(alice, "tun-2"); !errors.Is(err, ErrNotFound) {
+            t.Errorf("%s: dialing an unknown tunnel: %v, want ErrNotFound", name, err)
+        }
+    }
+}
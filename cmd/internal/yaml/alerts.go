@@ -0,0 +1,63 @@
+package yamlloader
+
+import (
+    "fmt"
+    "os"
+    "time"
+
+    "gopkg.in/yaml.v3"
+
+    "github.com/yourorg/boundless-bastion/cmd/internal/core"
+)
+
+type alertRuleDocument struct {
+    Name         string  `yaml:"name"`
+    Metric       string  `yaml:"metric"`
+    Op           string  `yaml:"op"`
+    Threshold    float64 `yaml:"threshold"`
+    For          string  `yaml:"for"`
+    Node         string  `yaml:"node"`
+    WhileRunning bool    `yaml:"while_running"`
+    Severity     string  `yaml:"severity"`
+}
+
+// LoadAlertRulesFromFile reads GPU alert rules, such as
+//
+//   - name: gpu-idle
+//     metric: utilization
+//     op: "<"
+//     threshold: 5
+//     for: 30m
+//     while_running: true
+func LoadAlertRulesFromFile(path string) ([]core.AlertRule, error) {
+    raw, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("read yaml: %w", err)
+    }
+
+    var docs []alertRuleDocument
+    if err := yaml.Unmarshal(raw, &docs); err != nil {
+        return nil, fmt.Errorf("parse yaml: %w", err)
+    }
+
+    rules := make([]core.AlertRule, 0, len(docs))
+    for _, d := range docs {
+        var wait time.Duration
+        if d.For != "" {
+            if wait, err = time.ParseDuration(d.For); err != nil {
+                return nil, fmt.Errorf("alert rule %q: invalid for %q", d.Name, d.For)
+            }
+        }
+        rules = append(rules, core.AlertRule{
+            Name:         d.Name,
+            Metric:       core.AlertMetric(d.Metric),
+            Op:           d.Op,
+            Threshold:    d.Threshold,
+            ForSeconds:   int(wait / time.Second),
+            NodeID:       d.Node,
+            WhileRunning: d.WhileRunning,
+            Severity:     d.Severity,
+        })
+    }
+    return rules, nil
+}
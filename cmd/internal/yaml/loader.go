@@ -10,10 +10,27 @@ import (
 )
 
 type commandDocument struct {
-    Name           string `yaml:"name"`
-    Description    string `yaml:"description"`
-    Script         string `yaml:"script"`
-    TimeoutSeconds int    `yaml:"timeout_seconds"`
+    Name           string         `yaml:"name"`
+    Description    string         `yaml:"description"`
+    Script         string         `yaml:"script"`
+    TimeoutSeconds int            `yaml:"timeout_seconds"`
+    Limits         limitsDocument `yaml:"limits"`
+    Isolation      string         `yaml:"isolation"`
+    Artifacts      []string       `yaml:"artifacts"`
+    MaxConcurrent  int            `yaml:"max_concurrent"`
+    GPU            gpuDocument    `yaml:"gpu"`
+}
+
+type gpuDocument struct {
+    Count           int      `yaml:"count"`
+    MinFreeMemoryMB int      `yaml:"min_free_memory_mb"`
+    Nodes           []string `yaml:"nodes"`
+}
+
+type limitsDocument struct {
+    MemoryMB   int `yaml:"memory_mb"`
+    CPUPercent int `yaml:"cpu_percent"`
+    MaxPids    int `yaml:"max_pids"`
 }
 
 func LoadCommandsFromFile(path string) ([]core.Command, error) {
@@ -34,6 +51,19 @@ func LoadCommandsFromFile(path string) ([]core.Command, error) {
             Description:    d.Description,
             Script:         d.Script,
             TimeoutSeconds: d.TimeoutSeconds,
+            Limits: core.ResourceLimits{
+                MemoryMB:   d.Limits.MemoryMB,
+                CPUPercent: d.Limits.CPUPercent,
+                MaxPids:    d.Limits.MaxPids,
+            },
+            Isolation:     core.IsolationMode(d.Isolation),
+            Artifacts:     d.Artifacts,
+            MaxConcurrent: d.MaxConcurrent,
+            GPU: core.GPURequirement{
+                Count:           d.GPU.Count,
+                MinFreeMemoryMB: d.GPU.MinFreeMemoryMB,
+                Nodes:           d.GPU.Nodes,
+            },
         })
     }
     return commands, nil
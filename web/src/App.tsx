@@ -10,11 +10,12 @@ import {
   fetchCommands,
   fetchExecutions,
   fetchGPU,
+  fetchGPUHistory,
   fetchNodes,
   runCommand,
   updateCommand,
 } from "./api";
-import { Command, Execution, GpuSample, Node } from "./types";
+import { Command, ExecutionSummary, GpuSample, Node } from "./types";
 
 const { Header, Content } = Layout;
 
@@ -22,7 +23,7 @@ function App() {
   const [commands, setCommands] = useState<Command[]>([]);
   const [nodes, setNodes] = useState<Node[]>([]);
   const [selectedNode, setSelectedNode] = useState<string>();
-  const [executions, setExecutions] = useState<Execution[]>([]);
+  const [executions, setExecutions] = useState<ExecutionSummary[]>([]);
   const [gpu, setGpu] = useState<GpuSample[]>([]);
   const [loading, setLoading] = useState(false);
 
@@ -38,16 +39,17 @@ function App() {
   const refreshAll = async () => {
     setLoading(true);
     try {
-      const [cmds, nds, exes, gpuSamples] = await Promise.all([
+      const [cmds, nds, exes, gpuSamples, gpuHistory] = await Promise.all([
         fetchCommands(),
         fetchNodes(),
         fetchExecutions(),
         fetchGPU(),
+        fetchGPUHistory(),
       ]);
       setCommands(cmds);
       setNodes(nds);
-      setExecutions(exes);
-      setGpu(gpuSamples);
+      setExecutions(exes.items);
+      setGpu([...gpuHistory, ...gpuSamples]);
       if (!selectedNode && nds.length > 0) {
         setSelectedNode(nds[0].id);
       }
@@ -62,7 +64,7 @@ function App() {
   const refreshExecutionsOnly = async () => {
     try {
       const exes = await fetchExecutions();
-      setExecutions(exes);
+      setExecutions(exes.items);
     } catch (err) {
       message.error("Failed to refresh executions");
     }
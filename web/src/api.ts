@@ -1,5 +1,5 @@
 ﻿import axios from "axios";
-import { Command, Execution, GpuSample, Node } from "./types";
+import { Alert, AlertState, Command, Execution, ExecutionPage, ExecutionQuery, GpuQuery, GpuReservation, GpuSample, Node, QueuedExecution } from "./types";
 
 const api = axios.create({
   baseURL: import.meta.env.VITE_API_BASE || "http://localhost:8080",
@@ -15,8 +15,13 @@ export async function fetchNodes(): Promise<Node[]> {
   return res.data;
 }
 
-export async function fetchExecutions(): Promise<Execution[]> {
-  const res = await api.get<Execution[]>("/api/v1/executions");
+export async function fetchExecutions(query: ExecutionQuery = {}): Promise<ExecutionPage> {
+  const res = await api.get<ExecutionPage>("/api/v1/executions", { params: query });
+  return res.data;
+}
+
+export async function fetchExecution(id: string): Promise<Execution> {
+  const res = await api.get<Execution>("/api/v1/executions", { params: { id } });
   return res.data;
 }
 
@@ -52,17 +57,56 @@ export async function fetchCommand(id: string): Promise<Command> {
   return res.data;
 }
 
-export async function runCommand(commandId: string, nodeId: string): Promise<Execution> {
+// runCommand executes a command; leave nodeId empty to let the bastion place
+// a command that needs GPUs.
+export async function runCommand(commandId: string, nodeId: string, priority = 0): Promise<Execution> {
   const res = await api.post<Execution>("/api/v1/execute", {
     command_id: commandId,
     node_id: nodeId,
+    priority,
   });
   return res.data;
 }
 
+export async function fetchQueue(): Promise<QueuedExecution[]> {
+  const res = await api.get<QueuedExecution[]>("/api/v1/queue");
+  return res.data;
+}
+
 export async function fetchGPU(): Promise<GpuSample[]> {
   const res = await api.get<GpuSample[]>("/api/v1/gpu");
   return res.data;
 }
 
+export async function fetchGPUHistory(query: GpuQuery = {}): Promise<GpuSample[]> {
+  const res = await api.get<GpuSample[]>("/api/v1/gpu", {
+    params: { from: new Date(Date.now() - 3600_000).toISOString().replace(/\.\d+Z$/, "Z"), ...query },
+  });
+  return res.data;
+}
+
+export async function fetchGPUReservations(): Promise<GpuReservation[]> {
+  const res = await api.get<GpuReservation[]>("/api/v1/gpu/reservations");
+  return res.data;
+}
+
+export async function fetchAlerts(state?: AlertState): Promise<Alert[]> {
+  const res = await api.get<Alert[]>("/api/v1/alerts", { params: state ? { state } : {} });
+  return res.data;
+}
+
+// terminalSocketUrl is the WebSocket address of an interactive shell on a node.
+// Binary frames carry terminal bytes; text frames carry resize/exit messages.
+export function terminalSocketUrl(nodeId: string, cols: number, rows: number, token?: string): string {
+  const url = new URL("/api/v1/terminal", api.defaults.baseURL);
+  url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+  url.searchParams.set("node_id", nodeId);
+  url.searchParams.set("cols", String(cols));
+  url.searchParams.set("rows", String(rows));
+  if (token) {
+    url.searchParams.set("access_token", token);
+  }
+  return url.toString();
+}
+
 export { api };
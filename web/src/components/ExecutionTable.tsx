@@ -1,10 +1,11 @@
 ﻿import React, { useMemo, useState } from "react";
-import { Button, Modal, Space, Table, Tag, Typography, Tabs } from "antd";
+import { Button, Modal, Space, Table, Tag, Typography, Tabs, message } from "antd";
 import { EyeOutlined, ReloadOutlined } from "@ant-design/icons";
-import { Command, Execution, Node } from "../types";
+import { fetchExecution } from "../api";
+import { Command, Execution, ExecutionSummary, Node } from "../types";
 
 interface Props {
-  executions: Execution[];
+  executions: ExecutionSummary[];
   commands: Command[];
   nodes: Node[];
   onRefresh?: () => void;
@@ -13,6 +14,14 @@ interface Props {
 const ExecutionTable: React.FC<Props> = ({ executions, commands, nodes, onRefresh }) => {
   const [selected, setSelected] = useState<Execution | null>(null);
 
+  const openLogs = async (id: string) => {
+    try {
+      setSelected(await fetchExecution(id));
+    } catch (err) {
+      message.error("Failed to load execution");
+    }
+  };
+
   const commandLookup = useMemo(() => {
     const map: Record<string, string> = {};
     commands.forEach((c) => (map[c.id] = c.name));
@@ -33,6 +42,8 @@ const ExecutionTable: React.FC<Props> = ({ executions, commands, nodes, onRefres
         return "success";
       case "failed":
         return "error";
+      case "lost":
+        return "warning";
       default:
         return "default";
     }
@@ -52,9 +63,10 @@ const ExecutionTable: React.FC<Props> = ({ executions, commands, nodes, onRefres
     {
       title: "Status",
       dataIndex: "status",
-      render: (status: Execution["status"]) => (
+      render: (status: Execution["status"], record: ExecutionSummary) => (
         <Tag color={statusColor(status)} style={{ textTransform: "capitalize" }}>
           {status}
+          {record.queue_position ? ` #${record.queue_position}` : ""}
         </Tag>
       ),
     },
@@ -64,7 +76,7 @@ const ExecutionTable: React.FC<Props> = ({ executions, commands, nodes, onRefres
     },
     {
       title: "Duration",
-      render: (_: unknown, record: Execution) => `${record.duration_ms} ms`,
+      render: (_: unknown, record: ExecutionSummary) => `${record.duration_ms} ms`,
     },
     {
       title: "Started",
@@ -79,8 +91,8 @@ const ExecutionTable: React.FC<Props> = ({ executions, commands, nodes, onRefres
     {
       title: "Logs",
       key: "logs",
-      render: (_: unknown, record: Execution) => (
-        <Button icon={<EyeOutlined />} onClick={() => setSelected(record)}>
+      render: (_: unknown, record: ExecutionSummary) => (
+        <Button icon={<EyeOutlined />} onClick={() => openLogs(record.id)}>
           View
         </Button>
       ),
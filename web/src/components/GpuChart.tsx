@@ -1,5 +1,5 @@
 ﻿import React, { useMemo } from "react";
-import { Button, Card, Space } from "antd";
+import { Button, Card, Space, Table } from "antd";
 import {
   LineChart,
   Line,
@@ -10,7 +10,7 @@ import {
   ResponsiveContainer,
   CartesianGrid,
 } from "recharts";
-import { GpuSample, Node } from "../types";
+import { GpuDevice, GpuSample, Node } from "../types";
 
 interface Props {
   samples: GpuSample[];
@@ -32,6 +32,30 @@ const GpuChart: React.FC<Props> = ({ samples, nodes, onRefresh, loading }) => {
     return Object.values(grouped).sort((a, b) => a.timestamp - b.timestamp);
   }, [samples]);
 
+  // The latest sample of each node, one row per device.
+  const devices = useMemo(() => {
+    const latest: Record<string, GpuSample> = {};
+    samples.forEach((s) => {
+      if (!latest[s.node_id] || latest[s.node_id].timestamp < s.timestamp) {
+        latest[s.node_id] = s;
+      }
+    });
+    const nodeName = Object.fromEntries(nodes.map((n) => [n.id, n.name]));
+    return Object.values(latest).flatMap((s) =>
+      (s.devices || []).map((d) => ({ ...d, key: `${s.node_id}-${d.index}`, node: nodeName[s.node_id] || s.node_id }))
+    );
+  }, [samples, nodes]);
+
+  const deviceColumns = [
+    { title: "Node", dataIndex: "node" },
+    { title: "GPU", render: (_: unknown, d: GpuDevice) => `${d.index}: ${d.name}` },
+    { title: "Util", render: (_: unknown, d: GpuDevice) => `${d.utilization}%` },
+    { title: "Memory", render: (_: unknown, d: GpuDevice) => `${d.memory_used_mb} / ${d.memory_total_mb} MB` },
+    { title: "Temp", render: (_: unknown, d: GpuDevice) => (d.temperature_c ? `${d.temperature_c}°C` : "-") },
+    { title: "Power", render: (_: unknown, d: GpuDevice) => (d.power_w ? `${d.power_w.toFixed(0)} W` : "-") },
+    { title: "UUID", dataIndex: "uuid", ellipsis: true },
+  ];
+
   return (
     <Card
       className="table-card"
@@ -80,6 +104,9 @@ const GpuChart: React.FC<Props> = ({ samples, nodes, onRefresh, loading }) => {
           ))}
         </LineChart>
       </ResponsiveContainer>
+      {devices.length > 0 && (
+        <Table size="small" pagination={false} columns={deviceColumns} dataSource={devices} style={{ marginTop: 16 }} />
+      )}
     </Card>
   );
 };
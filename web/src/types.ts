@@ -1,4 +1,4 @@
-﻿export type ExecutionStatus = "pending" | "running" | "succeeded" | "failed";
+﻿export type ExecutionStatus = "pending" | "running" | "succeeded" | "failed" | "lost";
 
 export interface Command {
   id: string;
@@ -6,13 +6,31 @@ export interface Command {
   description: string;
   script: string;
   timeout_seconds: number;
+  limits?: ResourceLimits;
+  isolation?: "none" | "namespace";
+  artifacts?: string[];
+  max_concurrent?: number;
+  gpu?: GpuRequirement;
   created_at: string;
 }
 
+export interface GpuRequirement {
+  count: number;
+  min_free_memory_mb?: number;
+  nodes?: string[];
+}
+
+export interface ResourceLimits {
+  memory_mb?: number;
+  cpu_percent?: number;
+  max_pids?: number;
+}
+
 export interface Node {
   id: string;
   name: string;
   address: string;
+  max_concurrent?: number;
 }
 
 export interface Execution {
@@ -26,6 +44,60 @@ export interface Execution {
   stderr: string;
   exit_code: number;
   duration_ms: number;
+  peak_memory_bytes: number;
+  cpu_time_ms: number;
+  stdout_bytes: number;
+  stderr_bytes: number;
+  stdout_truncated: boolean;
+  stderr_truncated: boolean;
+  output_spooled: boolean;
+  stdout_ref?: string;
+  stderr_ref?: string;
+  artifacts?: Artifact[];
+  gpu_devices?: number[];
+  triggered_by?: string;
+  grant_id?: string;
+  queue_position?: number;
+}
+
+export type ExecutionSummary = Omit<
+  Execution,
+  "stdout" | "stderr" | "stdout_ref" | "stderr_ref" | "artifacts"
+>;
+
+export interface ExecutionPage {
+  items: ExecutionSummary[];
+  next_cursor?: string;
+}
+
+export interface QueuedExecution {
+  execution_id: string;
+  command_id: string;
+  node_id: string;
+  priority: number;
+  enqueued_at: string;
+  position: number;
+}
+
+export interface ExecutionQuery {
+  command_id?: string;
+  node_id?: string;
+  status?: ExecutionStatus;
+  triggered_by?: string;
+  exit_code?: number;
+  from?: string;
+  to?: string;
+  order?: "asc" | "desc";
+  cursor?: string;
+  limit?: number;
+}
+
+export interface Artifact {
+  name: string;
+  size: number;
+  sha256?: string;
+  ref?: string;
+  skipped?: string;
 }
 
 export interface GpuSample {
@@ -33,4 +105,109 @@ export interface GpuSample {
   timestamp: number;
   utilization: number;
   memory_mb: number;
+  memory_total_mb: number;
+  devices?: GpuDevice[];
+}
+
+export interface GpuQuery {
+  node?: string;
+  from?: string;
+  to?: string;
+  step?: string;
+}
+
+export interface GpuDevice {
+  index: number;
+  vendor?: "nvidia" | "amd";
+  name: string;
+  uuid: string;
+  utilization: number;
+  memory_used_mb: number;
+  memory_total_mb: number;
+  temperature_c: number;
+  power_w: number;
+  processes?: GpuProcess[];
+}
+
+export interface GpuProcess {
+  pid: number;
+  name: string;
+  user?: string;
+  memory_used_mb: number;
+  execution_id?: string;
+}
+
+export interface TerminalMessage {
+  type: "resize" | "exit" | "error";
+  cols?: number;
+  rows?: number;
+  exit_code?: number;
+  message?: string;
+}
+
+export interface TerminalSession {
+  id: string;
+  node_id: string;
+  user: string;
+  cols: number;
+  rows: number;
+  started_at: string;
+  ended_at?: string;
+  recording_bytes: number;
+}
+
+export interface Tunnel {
+  id: string;
+  node_id: string;
+  port: number;
+  user: string;
+  created_at: string;
+  expires_at: string;
+  closed_at?: string;
+  closed_by?: string;
+  active_connections: number;
+  connections: number;
+  bytes_in: number;
+  bytes_out: number;
+}
+
+export interface AccessGrant {
+  id: string;
+  user: string;
+  node_id: string;
+  action: "execute" | "terminal" | "files" | "tunnel";
+  reason: string;
+  duration_seconds: number;
+  status: "pending" | "approved" | "denied" | "revoked" | "expired";
+  requested_at: string;
+  decided_by?: string;
+  decided_at?: string;
+  starts_at?: string;
+  expires_at?: string;
+}
+
+export type AlertState = "pending" | "firing" | "resolved";
+
+export interface Alert {
+  id: string;
+  rule: string;
+  node_id: string;
+  device_index: number;
+  device_uuid?: string;
+  state: AlertState;
+  severity?: string;
+  value: number;
+  threshold: number;
+  summary: string;
+  started_at: string;
+  fired_at?: string;
+  resolved_at?: string;
+  updated_at: string;
+}
+
+export interface GpuReservation {
+  node_id: string;
+  device_index: number;
+  execution_id: string;
+  reserved_at: string;
 }